@@ -0,0 +1,424 @@
+// Package acme gets TLS certificates from Let's Encrypt, or any other certificate authority
+// that speaks ACME (RFC 8555), for anybody running LinkLetter out in the open rather than
+// behind a proxy or a platform (like Heroku) that takes care of TLS for them.
+package acme
+
+// The usual answer to this in Go is golang.org/x/crypto/acme/autocert, and it's a fine
+// answer. But it's another dependency to vendor for something most people running LinkLetter
+// will never turn on, and the slice of ACME we actually need is pretty small: one account,
+// a handful of domain names, and http-01 challenges, where the certificate authority checks
+// that we're really the ones behind a domain by asking it for a file we've been told to put
+// at /.well-known/acme-challenge/. So, like the metrics package, we do it ourselves.
+//
+// Every request to an ACME server is a POST of a JWS (a JSON Web Signature, RFC 7515), signed
+// with our account's key, and every one of them has to carry a nonce the server gave us in
+// its last response, so that nobody can replay them. Even fetching something is a POST, with
+// an empty payload, which the RFC calls a "POST-as-GET".
+//
+// This file is the protocol. manager.go is what decides when we need a certificate and keeps
+// track of the ones we've got.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pollInterval is how long we wait between asking the server whether it's done something yet
+var pollInterval = time.Second
+
+// pollTimeout is how long we'll keep asking before giving up on it
+var pollTimeout = 2 * time.Minute
+
+// Problem is an error from an ACME server (RFC 7807), like "urn:ietf:params:acme:error:badNonce"
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (problem *Problem) Error() string {
+	return fmt.Sprintf("ACME error %d %s: %s", problem.Status, problem.Type, problem.Detail)
+}
+
+// directory is where everything we need is on the server. It's the only URL we're given,
+// everything else we find out from it.
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// order is a request for a certificate. The server hands us an authorization to complete for
+// each of its names, and once they're all valid we can finalize it with a CSR.
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error"`
+}
+
+// client talks to a single ACME server on behalf of a single account
+type client struct {
+	http         *http.Client
+	directoryURL string
+	key          *ecdsa.PrivateKey
+
+	dir    directory
+	kid    string
+	mu     sync.Mutex
+	nonces []string
+}
+
+func newClient(httpClient *http.Client, directoryURL string, key *ecdsa.PrivateKey) *client {
+	return &client{http: httpClient, directoryURL: directoryURL, key: key}
+}
+
+// encode is the unpadded, URL safe, base64 that everything in a JWS is written in
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwk is our account's public key, as a JSON Web Key (RFC 7517). Its members are in
+// alphabetical order, since that's the order thumbprint needs them in.
+func jwk(key *ecdsa.PublicKey) string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, size)
+	y := make([]byte, size)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, encode(x), encode(y))
+}
+
+// thumbprint identifies our account's key (RFC 7638), and is what a challenge's response is
+// made out of
+func thumbprint(key *ecdsa.PublicKey) string {
+	sum := sha256.Sum256([]byte(jwk(key)))
+	return encode(sum[:])
+}
+
+// keyAuthorization is what we have to serve up for a challenge's token
+func (c *client) keyAuthorization(token string) string {
+	return token + "." + thumbprint(&c.key.PublicKey)
+}
+
+// sign wraps a payload up in a JWS for the given url. Until we have an account, we identify
+// ourselves by our key itself, after that by the account's URL (its "kid").
+func (c *client) sign(url, nonce string, payload []byte) ([]byte, error) {
+	protected := fmt.Sprintf(`{"alg":"ES256","nonce":%q,"url":%q,`, nonce, url)
+	if c.kid == "" {
+		protected += `"jwk":` + jwk(&c.key.PublicKey) + `}`
+	} else {
+		protected += fmt.Sprintf(`"kid":%q}`, c.kid)
+	}
+
+	signingInput := encode([]byte(protected)) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// ES256 signatures are r and s side by side, 32 bytes each, rather than the ASN.1 that
+	// Go would give us from key.Sign
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return json.Marshal(map[string]string{
+		"protected": encode([]byte(protected)),
+		"payload":   encode(payload),
+		"signature": encode(signature),
+	})
+}
+
+// discover fetches the server's directory
+func (c *client) discover() error {
+	resp, err := c.http.Get(c.directoryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to fetch the ACME directory at %s: %s", c.directoryURL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(&c.dir)
+}
+
+// nonce hands out a nonce we've been given, or asks for a new one if we don't have any
+func (c *client) nonce() (string, error) {
+	c.mu.Lock()
+	if len(c.nonces) > 0 {
+		nonce := c.nonces[len(c.nonces)-1]
+		c.nonces = c.nonces[:len(c.nonces)-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	resp, err := c.http.Head(c.dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("The ACME server didn't give us a nonce")
+	}
+	return nonce, nil
+}
+
+func (c *client) keepNonce(resp *http.Response) {
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+}
+
+// post sends a payload to the server, or does a POST-as-GET if it's nil, and decodes the
+// response into out (if there is an out). Servers are allowed to turn down any nonce they
+// like, so if ours is turned down we try once more with a fresh one.
+func (c *client) post(url string, payload interface{}, out interface{}) (*http.Response, []byte, error) {
+	body := []byte{}
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		nonce, err := c.nonce()
+		if err != nil {
+			return nil, nil, err
+		}
+		signed, err := c.sign(url, nonce, body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		resp, err := c.http.Post(url, "application/jose+json", bytes.NewReader(signed))
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.keepNonce(resp)
+
+		if resp.StatusCode >= 400 {
+			problem := &Problem{Status: resp.StatusCode}
+			json.Unmarshal(data, problem)
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			return nil, nil, problem
+		}
+		if out != nil {
+			if err := json.Unmarshal(data, out); err != nil {
+				return nil, nil, err
+			}
+		}
+		return resp, data, nil
+	}
+}
+
+// register creates our account, or finds it again if the key already has one, and agrees to
+// the server's terms of service on our behalf. (Whoever turned on ACME in the config has
+// agreed to them, really.)
+func (c *client) register(email string) error {
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		account["contact"] = []string{"mailto:" + email}
+	}
+	resp, _, err := c.post(c.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return errors.New("The ACME server didn't tell us where our account is")
+	}
+	return nil
+}
+
+// obtain gets a certificate for domains, whose key is key. respond is called with each
+// challenge's token and what it should be answered with before we tell the server to go and
+// check it, and cleanup once it has. The certificate comes back as its chain of DER
+// certificates, ours first.
+func (c *client) obtain(domains []string, key crypto.Signer, respond func(token, keyAuth string), cleanup func(token string)) ([][]byte, error) {
+	identifiers := []identifier{}
+	for _, domain := range domains {
+		identifiers = append(identifiers, identifier{Type: "dns", Value: domain})
+	}
+	current := order{}
+	resp, _, err := c.post(c.dir.NewOrder, map[string]interface{}{"identifiers": identifiers}, &current)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range current.Authorizations {
+		if err := c.authorize(authzURL, respond, cleanup); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.post(current.Finalize, map[string]string{"csr": encode(csr)}, &current); err != nil {
+		return nil, err
+	}
+
+	// Issuing the certificate can take the server a little while
+	err = c.poll(func() (bool, error) {
+		if _, _, err := c.post(orderURL, nil, &current); err != nil {
+			return false, err
+		}
+		switch current.Status {
+		case "valid":
+			return true, nil
+		case "invalid":
+			return false, orderError(current)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, data, err := c.post(current.Certificate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseChain(data)
+}
+
+// authorize completes a single authorization with its http-01 challenge
+func (c *client) authorize(url string, respond func(token, keyAuth string), cleanup func(token string)) error {
+	authz := authorization{}
+	if _, _, err := c.post(url, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		// We've proven this one recently enough that the server doesn't need us to again
+		return nil
+	}
+
+	var chosen *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "http-01" {
+			chosen = &authz.Challenges[i]
+		}
+	}
+	if chosen == nil {
+		return fmt.Errorf("The ACME server didn't offer an http-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	respond(chosen.Token, c.keyAuthorization(chosen.Token))
+	defer cleanup(chosen.Token)
+
+	// An empty object is how we tell the server we're ready for it to check
+	if _, _, err := c.post(chosen.URL, struct{}{}, nil); err != nil {
+		return err
+	}
+	return c.poll(func() (bool, error) {
+		if _, _, err := c.post(url, nil, &authz); err != nil {
+			return false, err
+		}
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending":
+			return false, nil
+		}
+		for _, challenge := range authz.Challenges {
+			if challenge.Error != nil {
+				return false, fmt.Errorf("Unable to prove we're %s: %s", authz.Identifier.Value, challenge.Error)
+			}
+		}
+		return false, fmt.Errorf("Unable to prove we're %s, the authorization is %s", authz.Identifier.Value, authz.Status)
+	})
+}
+
+// poll keeps calling check until it's done or fails, or we run out of patience
+func (c *client) poll(check func() (bool, error)) error {
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		done, err := check()
+		if done || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("Timed out waiting on the ACME server")
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func orderError(current order) error {
+	if current.Error != nil {
+		return current.Error
+	}
+	return errors.New("The ACME server turned down our order")
+}
+
+// parseChain reads the PEM certificates the server sends us
+func parseChain(data []byte) ([][]byte, error) {
+	chain := [][]byte{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("The ACME server didn't send us a certificate")
+	}
+	return chain, nil
+}
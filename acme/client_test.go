@@ -0,0 +1,120 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeJWS pulls a JWS back apart, and checks its signature against key
+func decodeJWS(t *testing.T, body []byte, key *ecdsa.PublicKey) (map[string]interface{}, []byte) {
+	jws := map[string]string{}
+	assert.Nil(t, json.Unmarshal(body, &jws))
+
+	protectedJSON, _ := base64.RawURLEncoding.DecodeString(jws["protected"])
+	payload, _ := base64.RawURLEncoding.DecodeString(jws["payload"])
+	signature, _ := base64.RawURLEncoding.DecodeString(jws["signature"])
+
+	digest := sha256.Sum256([]byte(jws["protected"] + "." + jws["payload"]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	assert.True(t, ecdsa.Verify(key, digest[:], r, s))
+
+	protected := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(protectedJSON, &protected))
+	return protected, payload
+}
+
+func TestSign(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := newClient(nil, "", key)
+
+	signed, err := c.sign("https://acme.example.com/new-account", "nonce1", []byte(`{"a":1}`))
+	assert.Nil(t, err)
+	protected, payload := decodeJWS(t, signed, &key.PublicKey)
+	assert.Equal(t, "ES256", protected["alg"])
+	assert.Equal(t, "nonce1", protected["nonce"])
+	assert.Equal(t, "https://acme.example.com/new-account", protected["url"])
+	assert.Equal(t, "EC", protected["jwk"].(map[string]interface{})["kty"])
+	assert.Nil(t, protected["kid"])
+	assert.Equal(t, `{"a":1}`, string(payload))
+
+	// Once we have an account, we go by that instead
+	c.kid = "https://acme.example.com/account/1"
+	signed, _ = c.sign("https://acme.example.com/new-order", "nonce2", []byte{})
+	protected, payload = decodeJWS(t, signed, &key.PublicKey)
+	assert.Equal(t, "https://acme.example.com/account/1", protected["kid"])
+	assert.Nil(t, protected["jwk"])
+	assert.Empty(t, payload)
+}
+
+func TestThumbprint(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := newClient(nil, "", key)
+
+	sum := sha256.Sum256([]byte(jwk(&key.PublicKey)))
+	assert.Equal(t, "token."+base64.RawURLEncoding.EncodeToString(sum[:]), c.keyAuthorization("token"))
+	assert.Len(t, thumbprint(&key.PublicKey), 43)
+}
+
+func TestPostRetriesBadNonce(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "fresh")
+		if r.Method == http.MethodHead {
+			return
+		}
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce","detail":"Stale"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"valid"}`))
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := newClient(server.Client(), "", key)
+	c.dir.NewNonce = server.URL
+
+	out := order{}
+	_, _, err := c.post(server.URL, nil, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "valid", out.Status)
+}
+
+func TestPostProblem(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "fresh")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"urn:ietf:params:acme:error:unauthorized","detail":"No"}`))
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := newClient(server.Client(), "", key)
+	c.dir.NewNonce = server.URL
+
+	_, _, err := c.post(server.URL, struct{}{}, nil)
+	assert.Equal(t, &Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "No", Status: http.StatusForbidden}, err)
+}
+
+func TestParseChain(t *testing.T) {
+	_, err := parseChain([]byte("nope"))
+	assert.NotNil(t, err)
+
+	chain, err := parseChain([]byte("-----BEGIN CERTIFICATE-----\nAQID\n-----END CERTIFICATE-----\n-----BEGIN CERTIFICATE-----\nBAUG\n-----END CERTIFICATE-----\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{{1, 2, 3}, {4, 5, 6}}, chain)
+}
@@ -0,0 +1,390 @@
+package acme
+
+// The Manager keeps one certificate, for every domain we're configured with, on disk in the
+// cache directory next to our account's key. Keeping them on disk matters more than it looks:
+// Let's Encrypt only hands out so many certificates for the same names a week, and a process
+// that asked for a new one every time it started would run into that limit in an afternoon of
+// restarts.
+//
+// The first handshake after starting up without a certificate waits for us to get one, and
+// after that we renew it in the background once it has less than a month left, which is what
+// Let's Encrypt asks everybody to do. If we can't get one, we give it a while before trying
+// again, rather than trying again for every handshake.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// LetsEncrypt is the directory of Let's Encrypt's production ACME server
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ChallengePath is where the server comes looking for the answers to our http-01 challenges
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// renewBefore is how long before a certificate expires we go and get a new one
+const renewBefore = 30 * 24 * time.Hour
+
+// renewCheckInterval is how often we check whether it's time to renew
+var renewCheckInterval = 12 * time.Hour
+
+// After we fail to get a certificate when we don't have one, we wait retryAfterFailure before
+// trying again, and twice as long after each failure after that, up to maxRetryAfterFailure.
+// In the meantime handshakes fail straight away. Otherwise every handshake would try again,
+// and anybody who kept connecting to us could use up our rate limits with Let's Encrypt.
+var (
+	retryAfterFailure    = time.Minute
+	maxRetryAfterFailure = time.Hour
+)
+
+// Manager gets and renews a certificate for our domains
+type Manager struct {
+	domains      []string
+	email        string
+	directoryURL string
+	cacheDir     string
+	http         *http.Client
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	// failures is how many times in a row we've failed to get a certificate, lastErr why the
+	// last one failed and retryAt when we'll try again
+	failures int
+	lastErr  error
+	retryAt  time.Time
+
+	// obtaining is held while we're loading or getting a certificate, so that there's only
+	// ever one of us doing it. It isn't mu, so that handshakes can go on using the certificate
+	// we've got while we renew it.
+	obtaining sync.Mutex
+
+	tokensMu sync.Mutex
+	tokens   map[string]string
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewManager creates a Manager for the given domains, using the ACME server at directoryURL
+// (LetsEncrypt, usually). email is who the certificate authority should write to about
+// problems with our certificates, and can be empty. Certificates and our account's key are
+// kept in cacheDir.
+func NewManager(directoryURL, email, cacheDir string, domains []string, httpClient *http.Client) *Manager {
+	return &Manager{
+		domains:      domains,
+		email:        email,
+		directoryURL: directoryURL,
+		cacheDir:     cacheDir,
+		http:         httpClient,
+		tokens:       map[string]string{},
+		stop:         make(chan struct{}),
+	}
+}
+
+// HTTPClient is the client a Manager talks to its ACME server with. A local test CA (like
+// Pebble) serves its directory with a certificate of its own making, so caFile can name a
+// PEM file of roots to trust on top of the system's.
+func HTTPClient(caFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if caFile == "" {
+		return client, nil
+	}
+
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("There aren't any certificates in %s", caFile)
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	return client, nil
+}
+
+// GetCertificate is for tls.Config's GetCertificate, and hands over our certificate for
+// any of our domains
+func (manager *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName != "" && !manager.isOurs(hello.ServerName) {
+		return nil, fmt.Errorf("We don't have a certificate for %s", hello.ServerName)
+	}
+	return manager.certificate()
+}
+
+func (manager *Manager) isOurs(name string) bool {
+	for _, domain := range manager.domains {
+		if strings.EqualFold(domain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPHandler answers the ACME server's challenges, and passes everything else on to next
+func (manager *Manager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, ChallengePath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		manager.tokensMu.Lock()
+		keyAuth, ok := manager.tokens[strings.TrimPrefix(r.URL.Path, ChallengePath)]
+		manager.tokensMu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// Start loads or gets our certificate in the background, rather than waiting for the first
+// handshake to, and keeps it renewed
+func (manager *Manager) Start() {
+	logger.Info.Printf("Managing a certificate for %s", strings.Join(manager.domains, ", "))
+	manager.wg.Add(1)
+	go manager.run()
+}
+
+// Stop stops renewing our certificate, and waits for a renewal that's under way to finish
+func (manager *Manager) Stop() {
+	close(manager.stop)
+	manager.wg.Wait()
+}
+
+func (manager *Manager) run() {
+	defer manager.wg.Done()
+	for {
+		if err := manager.renewIfDue(); err != nil {
+			logger.Error.Printf("Unable to renew our certificate: %s", err)
+		}
+		select {
+		case <-manager.stop:
+			return
+		case <-time.After(renewCheckInterval):
+		}
+	}
+}
+
+// certificate is our certificate, from memory, the cache or the ACME server, whichever has it
+// first. One that's due for renewal is still good until it expires, and run will get to it.
+func (manager *Manager) certificate() (*tls.Certificate, error) {
+	if cert := manager.current(); cert != nil {
+		return cert, nil
+	}
+	if err := manager.backingOff(); err != nil {
+		return nil, err
+	}
+
+	manager.obtaining.Lock()
+	defer manager.obtaining.Unlock()
+	// Somebody else may have got it (or failed to) while we were waiting
+	if cert := manager.current(); cert != nil {
+		return cert, nil
+	}
+	if err := manager.backingOff(); err != nil {
+		return nil, err
+	}
+
+	cert, err := manager.load()
+	if err != nil || !time.Now().Before(cert.Leaf.NotAfter) {
+		if cert, err = manager.obtain(); err != nil {
+			manager.failed(err)
+			return nil, err
+		}
+	}
+	manager.setCurrent(cert)
+	return cert, nil
+}
+
+// backingOff is why we last failed to get a certificate, if it isn't time to try again yet
+func (manager *Manager) backingOff() error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if manager.lastErr != nil && time.Now().Before(manager.retryAt) {
+		return fmt.Errorf("Unable to get a certificate, trying again at %s: %s", manager.retryAt.Format(time.RFC1123), manager.lastErr)
+	}
+	return nil
+}
+
+// failed makes a note that we failed to get a certificate, and puts off trying again
+func (manager *Manager) failed(err error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	wait := retryAfterFailure << uint(manager.failures)
+	if wait > maxRetryAfterFailure || wait <= 0 {
+		wait = maxRetryAfterFailure
+	}
+	manager.failures++
+	manager.lastErr = err
+	manager.retryAt = time.Now().Add(wait)
+	logger.Error.Printf("Unable to get a certificate, trying again in %s: %s", wait, err)
+}
+
+// current is the certificate we have in memory, if we have one and it hasn't expired
+func (manager *Manager) current() *tls.Certificate {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if manager.cert != nil && time.Now().Before(manager.cert.Leaf.NotAfter) {
+		return manager.cert
+	}
+	return nil
+}
+
+func (manager *Manager) setCurrent(cert *tls.Certificate) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.cert = cert
+	manager.failures, manager.lastErr = 0, nil
+}
+
+// renewIfDue gets a new certificate if we don't have one, or ours is expiring soon
+func (manager *Manager) renewIfDue() error {
+	cert, err := manager.certificate()
+	if err != nil {
+		return err
+	}
+	if time.Until(cert.Leaf.NotAfter) > renewBefore {
+		return nil
+	}
+
+	logger.Info.Printf("Renewing our certificate, which expires %s", cert.Leaf.NotAfter.Format(time.RFC1123))
+	manager.obtaining.Lock()
+	defer manager.obtaining.Unlock()
+	renewed, err := manager.obtain()
+	if err != nil {
+		return err
+	}
+	manager.setCurrent(renewed)
+	return nil
+}
+
+func (manager *Manager) certFile() string {
+	return filepath.Join(manager.cacheDir, manager.domains[0]+".pem")
+}
+
+// load reads our certificate from the cache. It's only any use to us if it's for every one of
+// our domains, which it won't be if somebody's added one to the config since.
+func (manager *Manager) load() (*tls.Certificate, error) {
+	data, err := ioutil.ReadFile(manager.certFile())
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	for _, domain := range manager.domains {
+		if err := cert.Leaf.VerifyHostname(domain); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// obtain gets a new certificate from the ACME server and saves it to the cache. The caller
+// has to hold obtaining.
+func (manager *Manager) obtain() (*tls.Certificate, error) {
+	logger.Info.Printf("Requesting a certificate for %s from %s", strings.Join(manager.domains, ", "), manager.directoryURL)
+	if err := os.MkdirAll(manager.cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	accountKey, err := manager.accountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	c := newClient(manager.http, manager.directoryURL, accountKey)
+	if err := c.discover(); err != nil {
+		return nil, err
+	}
+	if err := c.register(manager.email); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := c.obtain(manager.domains, key, manager.respond, manager.cleanup)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, der := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := ioutil.WriteFile(manager.certFile(), data, 0600); err != nil {
+		return nil, err
+	}
+	return manager.load()
+}
+
+func (manager *Manager) respond(token, keyAuth string) {
+	manager.tokensMu.Lock()
+	defer manager.tokensMu.Unlock()
+	manager.tokens[token] = keyAuth
+}
+
+func (manager *Manager) cleanup(token string) {
+	manager.tokensMu.Lock()
+	defer manager.tokensMu.Unlock()
+	delete(manager.tokens, token)
+}
+
+// accountKey is the key for our account with the ACME server, which we make the first time
+// we need it
+func (manager *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	name := filepath.Join(manager.cacheDir, "account.key")
+	data, err := ioutil.ReadFile(name)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("Our ACME account key isn't PEM")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
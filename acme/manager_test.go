@@ -0,0 +1,321 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCA is just enough of an ACME server to get a certificate out of. It checks our
+// challenges by asking the Manager's HTTPHandler for them, rather than going out over port 80.
+type fakeCA struct {
+	t        *testing.T
+	server   *httptest.Server
+	manager  *Manager
+	key      *ecdsa.PrivateKey
+	root     *x509.Certificate
+	validFor time.Duration
+
+	accountKey *ecdsa.PublicKey
+	accounts   int
+	domains    []string
+	validated  map[string]bool
+	issued     [][]byte
+}
+
+func newFakeCA(t *testing.T, validFor time.Duration) *fakeCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	root, _ := x509.ParseCertificate(der)
+
+	ca := &fakeCA{t: t, key: key, root: root, validFor: validFor, validated: map[string]bool{}}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.serve))
+	return ca
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	base := ca.server.URL
+
+	switch {
+	case r.URL.Path == "/directory":
+		json.NewEncoder(w).Encode(directory{NewNonce: base + "/nonce", NewAccount: base + "/new-account", NewOrder: base + "/new-order"})
+		return
+	case r.URL.Path == "/nonce":
+		return
+	case r.URL.Path == "/certificate/1":
+		ca.read(r)
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.issued[len(ca.issued)-1]}))
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw}))
+		return
+	}
+
+	payload := ca.read(r)
+	switch {
+	case r.URL.Path == "/new-account":
+		ca.accounts++
+		w.Header().Set("Location", base+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+
+	case r.URL.Path == "/new-order":
+		request := struct{ Identifiers []identifier }{}
+		json.Unmarshal(payload, &request)
+		ca.domains = nil
+		authorizations := []string{}
+		for i, id := range request.Identifiers {
+			ca.domains = append(ca.domains, id.Value)
+			authorizations = append(authorizations, fmt.Sprintf("%s/authz/%d", base, i))
+			ca.validated[fmt.Sprint(i)] = false
+		}
+		w.Header().Set("Location", base+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(order{Status: "pending", Authorizations: authorizations, Finalize: base + "/finalize"})
+
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		i := strings.TrimPrefix(r.URL.Path, "/authz/")
+		status := "pending"
+		if ca.validated[i] {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(authorization{Status: status, Challenges: []challenge{
+			{Type: "dns-01", URL: base + "/challenge/dns", Token: "dns"},
+			{Type: "http-01", URL: base + "/challenge/" + i, Token: "token-" + i},
+		}})
+
+	case strings.HasPrefix(r.URL.Path, "/challenge/"):
+		i := strings.TrimPrefix(r.URL.Path, "/challenge/")
+		resp := httptest.NewRecorder()
+		ca.manager.HTTPHandler(http.NotFoundHandler()).ServeHTTP(resp, httptest.NewRequest("GET", ChallengePath+"token-"+i, nil))
+		ca.validated[i] = resp.Body.String() == "token-"+i+"."+thumbprint(ca.accountKey)
+		w.Write([]byte(`{}`))
+
+	case r.URL.Path == "/finalize":
+		request := map[string]string{}
+		json.Unmarshal(payload, &request)
+		der, _ := base64.RawURLEncoding.DecodeString(request["csr"])
+		csr, err := x509.ParseCertificateRequest(der)
+		assert.Nil(ca.t, err)
+		assert.Equal(ca.t, ca.domains, csr.DNSNames)
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(len(ca.issued) + 2)),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(ca.validFor),
+		}
+		cert, _ := x509.CreateCertificate(rand.Reader, template, ca.root, csr.PublicKey, ca.key)
+		ca.issued = append(ca.issued, cert)
+		json.NewEncoder(w).Encode(order{Status: "processing"})
+
+	case r.URL.Path == "/order/1":
+		json.NewEncoder(w).Encode(order{Status: "valid", Certificate: base + "/certificate/1"})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// read checks a request's signature, and returns its payload
+func (ca *fakeCA) read(r *http.Request) []byte {
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.URL.Path == "/new-account" {
+		jws := map[string]string{}
+		json.Unmarshal(body, &jws)
+		protectedJSON, _ := base64.RawURLEncoding.DecodeString(jws["protected"])
+		protected := struct{ JWK map[string]string }{}
+		json.Unmarshal(protectedJSON, &protected)
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK["y"])
+		ca.accountKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	}
+
+	protected, payload := decodeJWS(ca.t, body, ca.accountKey)
+	assert.Equal(ca.t, ca.server.URL+r.URL.Path, protected["url"])
+	if r.URL.Path != "/new-account" {
+		assert.Equal(ca.t, ca.server.URL+"/account/1", protected["kid"])
+	}
+	return payload
+}
+
+func newTestManager(t *testing.T, ca *fakeCA) (*Manager, func()) {
+	pollInterval = time.Millisecond
+	dir, _ := ioutil.TempDir("", "acme")
+	manager := NewManager(ca.server.URL+"/directory", "admin@example.com", dir, []string{"links.example.com", "www.links.example.com"}, ca.server.Client())
+	ca.manager = manager
+	return manager, func() {
+		ca.server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	ca := newFakeCA(t, 90*24*time.Hour)
+	manager, cleanup := newTestManager(t, ca)
+	defer cleanup()
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "links.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"links.example.com", "www.links.example.com"}, cert.Leaf.DNSNames)
+	assert.Len(t, cert.Certificate, 2)
+	assert.Len(t, ca.issued, 1)
+
+	// Once we have it, we hang on to it
+	again, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "WWW.links.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, cert, again)
+	assert.Len(t, ca.issued, 1)
+
+	_, err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "somebody-else.example.com"})
+	assert.NotNil(t, err)
+
+	// And so does the cache, for the next time we start up
+	restarted := NewManager(ca.server.URL+"/directory", "", manager.cacheDir, manager.domains, ca.server.Client())
+	cached, err := restarted.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Certificate, cached.Certificate)
+	assert.Len(t, ca.issued, 1)
+
+	// Unless the cached one is missing one of our domains
+	added := NewManager(ca.server.URL+"/directory", "", manager.cacheDir, append(manager.domains, "new.links.example.com"), ca.server.Client())
+	ca.manager = added
+	cert, err = added.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Nil(t, err)
+	assert.Len(t, cert.Leaf.DNSNames, 3)
+	assert.Len(t, ca.issued, 2)
+}
+
+func TestRenewIfDue(t *testing.T) {
+	ca := newFakeCA(t, 10*24*time.Hour)
+	manager, cleanup := newTestManager(t, ca)
+	defer cleanup()
+
+	// Our first certificate is already due, so it's renewed right away
+	assert.Nil(t, manager.renewIfDue())
+	assert.Len(t, ca.issued, 2)
+	assert.Equal(t, ca.issued[1], manager.current().Certificate[0])
+	assert.Equal(t, 2, ca.accounts)
+
+	// With the same account both times
+	_, err := os.Stat(filepath.Join(manager.cacheDir, "account.key"))
+	assert.Nil(t, err)
+
+	ca.validFor = 90 * 24 * time.Hour
+	assert.Nil(t, manager.renewIfDue())
+	assert.Len(t, ca.issued, 3)
+	assert.Nil(t, manager.renewIfDue())
+	assert.Len(t, ca.issued, 3)
+}
+
+func TestFailedChallenge(t *testing.T) {
+	ca := newFakeCA(t, 90*24*time.Hour)
+	manager, cleanup := newTestManager(t, ca)
+	defer cleanup()
+	pollTimeout = 50 * time.Millisecond
+	defer func() { pollTimeout = 2 * time.Minute }()
+
+	// Somebody else answering on port 80 means the challenge never comes out right
+	ca.manager = NewManager("", "", "", nil, nil)
+	_, err := manager.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NotNil(t, err)
+	assert.Empty(t, ca.issued)
+	assert.Empty(t, manager.tokens)
+	assert.Equal(t, 1, ca.accounts)
+
+	// The handshakes after that fail straight away, rather than trying again
+	ca.manager = manager
+	_, err = manager.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "trying again at")
+	assert.Equal(t, 1, ca.accounts)
+	assert.Equal(t, retryAfterFailure, manager.retryAt.Sub(time.Now()).Round(time.Minute))
+
+	// Until it's time to try again
+	manager.retryAt = time.Now()
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Nil(t, err)
+	assert.NotNil(t, cert)
+	assert.Equal(t, 2, ca.accounts)
+	assert.Equal(t, 0, manager.failures)
+}
+
+func TestFailedBackOff(t *testing.T) {
+	manager := NewManager("", "", "", nil, nil)
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		manager.failed(fmt.Errorf("Failure %d", i))
+		assert.Equal(t, expected, manager.retryAt.Sub(time.Now()).Round(time.Minute))
+	}
+	for i := 0; i < 100; i++ {
+		manager.failed(fmt.Errorf("Failure"))
+	}
+	assert.Equal(t, maxRetryAfterFailure, manager.retryAt.Sub(time.Now()).Round(time.Minute))
+}
+
+func TestHTTPHandler(t *testing.T) {
+	manager := NewManager("", "", "", nil, nil)
+	manager.respond("abc", "abc.xyz")
+	handler := manager.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app"))
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", ChallengePath+"abc", nil))
+	assert.Equal(t, "abc.xyz", resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", ChallengePath+"nope", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/links", nil))
+	assert.Equal(t, "app", resp.Body.String())
+
+	manager.cleanup("abc")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", ChallengePath+"abc", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestHTTPClient(t *testing.T) {
+	client, err := HTTPClient("")
+	assert.Nil(t, err)
+	assert.Nil(t, client.Transport)
+
+	_, err = HTTPClient("/does/not/exist.pem")
+	assert.NotNil(t, err)
+
+	file, _ := ioutil.TempFile("", "ca")
+	defer os.Remove(file.Name())
+	file.WriteString("not a certificate")
+	file.Close()
+	_, err = HTTPClient(file.Name())
+	assert.NotNil(t, err)
+}
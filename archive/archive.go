@@ -0,0 +1,152 @@
+// Package archive exports everything in an instance to a single file, and imports it again
+// somewhere else.
+package archive
+
+// pg_dump is the right tool for backing up a database, but it's a lousy one for moving a
+// LinkLetter from one place to another. Its output is tied to whichever version of Postgres
+// made it, it drags along every bit of bookkeeping (the job queue, the search vectors) and
+// it's no help at all to somebody who wants to poke at their data with anything other than
+// psql. So we have our own.
+//
+// An archive is JSON Lines, one JSON object per line, so that it can be written and read a
+// record at a time no matter how big the instance is, and gzipped when its name ends in
+// ".gz". The first line is a header saying what the file is, which version of the archive
+// format it uses, and which migration the database it came from was at. Every line after
+// that is a record, {"type": "link", "data": {...}}, and the records come in the order of
+// our tables (see records.go) so that nothing ever refers to something that hasn't shown up
+// yet. The last line is a footer with how many of each record there were and a SHA-256 of
+// everything before it, which is how we can tell a complete archive from one that got cut
+// off halfway through a copy.
+//
+// Ids are kept exactly as they were, so that links to /links/42 still go to the same place
+// after a move. That only works if there's nothing already in the way, so an archive can
+// only be imported into an empty instance. It also has to be at the same migration the
+// archive was made at, since that's the only way to be sure every column means what it did.
+// To move an old instance to a new release, upgrade it (starting it runs its migrations)
+// before exporting it.
+//
+// Keep archives somewhere safe. Along with everybody's email address they have the secret
+// tokens for everybody's inbound address and the secrets for every webhook.
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Format is what every archive's header calls itself
+const Format = "linkletter-archive"
+
+// Version is the version of the archive format we write. It's only bumped when the format
+// itself changes, changes to our tables are covered by the schema in the header.
+const Version = 1
+
+const (
+	typeHeader = "header"
+	typeFooter = "footer"
+)
+
+// ErrNotEmpty is returned when trying to import into an instance that already has things in it
+var ErrNotEmpty = errors.New("Archives can only be imported into an instance with no users, links, issues or subscribers")
+
+// Header is the first line of every archive
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Schema    string    `json:"schema"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Footer is the last line of every archive
+type Footer struct {
+	Counts map[string]int `json:"counts"`
+	SHA256 string         `json:"sha256"`
+}
+
+// Summary describes an archive that's been written or read
+type Summary struct {
+	Header Header
+	Counts map[string]int
+}
+
+// line is how everything in an archive is written down
+type line struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// writeLine writes a single line of the archive
+func writeLine(w io.Writer, lineType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	encoded, err = json.Marshal(line{lineType, encoded})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(encoded, '\n'))
+	return err
+}
+
+// Export writes everything in the database to an archive. It all comes from a single
+// read-only snapshot, so an instance that's busy while it's being exported still ends up
+// with an archive that agrees with itself.
+func Export(db *sql.DB, schema string, w io.Writer) (Summary, error) {
+	summary := Summary{Counts: map[string]int{}}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return summary, err
+	}
+
+	buffered := bufio.NewWriter(w)
+	hash := sha256.New()
+	out := io.MultiWriter(buffered, hash)
+
+	summary.Header = Header{Format: Format, Version: Version, Schema: schema, CreatedAt: time.Now().UTC()}
+	if err := writeLine(out, typeHeader, summary.Header); err != nil {
+		return summary, err
+	}
+
+	for _, table := range tables {
+		if err := exportTable(tx, table, out, summary.Counts); err != nil {
+			return summary, err
+		}
+	}
+
+	footer := Footer{Counts: summary.Counts, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if err := writeLine(buffered, typeFooter, footer); err != nil {
+		return summary, err
+	}
+	return summary, buffered.Flush()
+}
+
+func exportTable(tx *sql.Tx, table table, w io.Writer, counts map[string]int) error {
+	rows, err := tx.Query(table.export)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := table.fresh()
+		if err := rows.Scan(record.fields()...); err != nil {
+			return err
+		}
+		if err := writeLine(w, table.recordType, record); err != nil {
+			return err
+		}
+		counts[table.recordType]++
+	}
+	return rows.Err()
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = "9_webhooks.sql"
+
+var testTime = time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// expectExport sets up a small instance: a user who shared a link, commented on it and
+// had their comment picked, along with an issue the link went out in, a subscriber, the
+// feed the link was promoted out of, a snapshot of the link, a click on it and an open of the issue.
+func expectExport(mock sqlmock.Sqlmock) {
+	rows := map[string]*sqlmock.Rows{
+		"user": sqlmock.NewRows([]string{"id", "email", "role", "inbound_token", "created_at"}).
+			AddRow(1, "admin@example.com", "admin", "secret-token", testTime).
+			AddRow(2, "member@example.com", "member", nil, testTime),
+		"category": sqlmock.NewRows([]string{"id", "name", "slug", "position"}),
+		"tag":      sqlmock.NewRows([]string{"id", "name", "category_id"}).AddRow(4, "go", nil),
+		"link": sqlmock.NewRows([]string{"id", "url", "title", "description", "submitter_id", "created_at", "popular_at", "imported"}).
+			AddRow(42, "https://example.com", "Example", "", 2, testTime, nil, false),
+		"link_tag":      sqlmock.NewRows([]string{"link_id", "tag_id"}).AddRow(42, 4),
+		"vote":          sqlmock.NewRows([]string{"link_id", "user_id", "value", "created_at"}).AddRow(42, 1, 1, testTime),
+		"comment":       sqlmock.NewRows([]string{"id", "link_id", "parent_id", "author_id", "body", "deleted", "hidden", "created_at", "updated_at"}).AddRow(7, 42, nil, 1, "Nice", false, false, testTime, testTime),
+		"top_comment":   sqlmock.NewRows([]string{"id", "top_comment_id"}).AddRow(42, 7),
+		"issue":         sqlmock.NewRows([]string{"id", "title", "status", "manual_order", "created_at", "sent_at", "recipients"}).AddRow(3, "Issue #3", "sent", false, testTime, testTime, 1),
+		"issue_link":    sqlmock.NewRows([]string{"issue_id", "link_id", "position"}).AddRow(3, 42, 0),
+		"subscriber":    sqlmock.NewRows([]string{"id", "email", "status", "suppressed_reason", "soft_bounces", "tracking", "created_at", "updated_at"}).AddRow(9, "reader@example.com", "active", "", 0, true, testTime, testTime),
+		"webhook":       sqlmock.NewRows([]string{"id", "url", "secret", "events", "active", "created_at"}).AddRow(5, "https://hooks.example.com", "shh", []byte("{link.created}"), true, testTime),
+		"feed":          sqlmock.NewRows([]string{"id", "url", "title", "site_url", "interval_minutes", "active", "created_at"}).AddRow(6, "https://example.com/feed", "Example", "https://example.com", 60, true, testTime),
+		"feed_item":     sqlmock.NewRows([]string{"id", "feed_id", "guid", "url", "title", "summary", "published_at", "status", "link_id", "created_at"}).AddRow(8, 6, "post-1", "https://example.com", "Example", "", nil, "promoted", 42, testTime),
+		"link_snapshot": sqlmock.NewRows([]string{"link_id", "status_code", "title", "body", "error", "captured_at"}).AddRow(42, 200, "Example", "Some text", "", testTime),
+		"click":         sqlmock.NewRows([]string{"id", "issue_id", "link_id", "subscriber_hash", "created_at"}).AddRow(11, 3, 42, "", testTime),
+		"open":          sqlmock.NewRows([]string{"issue_id", "subscriber_hash", "prefetched", "opens", "first_opened_at"}).AddRow(3, "", false, 2, testTime),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, table := range tables {
+		mock.ExpectQuery(regexp.QuoteMeta(table.export)).WillReturnRows(rows[table.recordType])
+	}
+	mock.ExpectRollback()
+}
+
+// exportTestArchive exports the instance from expectExport
+func exportTestArchive(t *testing.T) []byte {
+	db, mock, _ := sqlmock.New()
+	expectExport(mock)
+
+	out := &bytes.Buffer{}
+	_, err := Export(db, testSchema, out)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	return out.Bytes()
+}
+
+func TestExport(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	expectExport(mock)
+
+	out := &bytes.Buffer{}
+	summary, err := Export(db, testSchema, out)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, Format, summary.Header.Format)
+	assert.Equal(t, Version, summary.Header.Version)
+	assert.Equal(t, testSchema, summary.Header.Schema)
+	assert.Equal(t, 2, summary.Counts["user"])
+	assert.Equal(t, 0, summary.Counts["category"])
+	assert.Equal(t, 1, summary.Counts["webhook"])
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	// A header, 17 records and a footer
+	assert.Len(t, lines, 19)
+	assert.True(t, strings.HasPrefix(lines[0], `{"type":"header","data":{"format":"linkletter-archive","version":1,"schema":"9_webhooks.sql"`))
+	assert.Equal(t, `{"type":"user","data":{"id":2,"email":"member@example.com","role":"member","inbound_token":null,"created_at":"2017-03-01T12:00:00Z"}}`, lines[2])
+	assert.Equal(t, `{"type":"webhook","data":{"id":5,"url":"https://hooks.example.com","secret":"shh","events":["link.created"],"active":true,"created_at":"2017-03-01T12:00:00Z"}}`, lines[12])
+
+	footer := line{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[18]), &footer))
+	assert.Equal(t, typeFooter, footer.Type)
+}
+
+func TestRecordTypes(t *testing.T) {
+	recordTypes := RecordTypes()
+	assert.Equal(t, "user", recordTypes[0])
+	assert.Equal(t, "open", recordTypes[len(recordTypes)-1])
+	assert.Len(t, recordTypes, len(tables))
+}
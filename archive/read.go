@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+)
+
+const emptyQuery = "SELECT NOT EXISTS (SELECT 1 FROM users) AND NOT EXISTS (SELECT 1 FROM links) " +
+	"AND NOT EXISTS (SELECT 1 FROM issues) AND NOT EXISTS (SELECT 1 FROM subscribers)"
+
+// resetSequenceQuery catches a table's id sequence up with the ids we've inserted. It has
+// to be built for each table, since a table's name can't be a query argument.
+const resetSequenceQuery = "SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %[1]s"
+
+// InvalidError is returned for an archive that isn't what it should be. Line is where in the
+// archive the problem was found.
+type InvalidError struct {
+	Line   int
+	Reason string
+}
+
+func (err InvalidError) Error() string {
+	return fmt.Sprintf("Invalid archive, line %d: %s", err.Line, err.Reason)
+}
+
+// reader goes through an archive a record at a time, checking everything about it as it
+// goes. Nothing it hands out has been checked against the footer yet, that can only happen
+// once we get there.
+type reader struct {
+	in     *bufio.Reader
+	hash   hash.Hash
+	schema string
+	line   int
+
+	header Header
+	counts map[string]int
+
+	// position is which of our tables the records are up to, they're only allowed to go forward
+	position int
+
+	// seen has the id of every record so far that has one, by type
+	seen map[string]map[int64]bool
+}
+
+// newReader starts reading an archive, which may or may not be gzipped, made at the given
+// schema.
+func newReader(r io.Reader, schema string) (*reader, error) {
+	in := bufio.NewReader(r)
+	if magic, err := in.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		in = bufio.NewReader(unzipped)
+	}
+
+	archive := &reader{in: in, hash: sha256.New(), schema: schema, counts: map[string]int{}, seen: map[string]map[int64]bool{}}
+	for _, table := range tables {
+		archive.seen[table.recordType] = map[int64]bool{}
+	}
+	return archive, archive.readHeader()
+}
+
+func (archive *reader) invalid(format string, args ...interface{}) error {
+	return InvalidError{archive.line, fmt.Sprintf(format, args...)}
+}
+
+// readLine reads the next line of the archive. A missing line is an error, since every
+// archive ends with a footer.
+func (archive *reader) readLine() (line, []byte, error) {
+	raw, err := archive.in.ReadBytes('\n')
+	if err == io.EOF && len(raw) == 0 {
+		return line{}, nil, archive.invalid("the archive ends before its footer, it may have been cut off")
+	}
+	if err != nil && err != io.EOF {
+		return line{}, nil, err
+	}
+	archive.line++
+
+	parsed := line{}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return parsed, nil, archive.invalid("%s", err)
+	}
+	return parsed, raw, nil
+}
+
+func (archive *reader) readHeader() error {
+	parsed, raw, err := archive.readLine()
+	if err != nil {
+		return err
+	}
+	archive.hash.Write(raw)
+
+	if parsed.Type != typeHeader || json.Unmarshal(parsed.Data, &archive.header) != nil || archive.header.Format != Format {
+		return archive.invalid("this isn't a LinkLetter archive")
+	}
+	if archive.header.Version != Version {
+		return archive.invalid("archives in version %d of the format can't be read, only version %d", archive.header.Version, Version)
+	}
+	if archive.header.Schema != archive.schema {
+		return archive.invalid("the archive was made at migration %s, but this database is at %s", archive.header.Schema, archive.schema)
+	}
+	return nil
+}
+
+// next reads the next record in the archive, along with the table it belongs in. After the
+// last record it checks the footer, and returns io.EOF if everything adds up.
+func (archive *reader) next() (*table, record, error) {
+	parsed, raw, err := archive.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if parsed.Type == typeFooter {
+		return nil, nil, archive.checkFooter(parsed)
+	}
+	archive.hash.Write(raw)
+
+	for archive.position < len(tables) && tables[archive.position].recordType != parsed.Type {
+		archive.position++
+	}
+	if archive.position == len(tables) {
+		return nil, nil, archive.invalid("a %q record is either out of order or isn't something we know about", parsed.Type)
+	}
+	table := &tables[archive.position]
+
+	record := table.fresh()
+	if err := json.Unmarshal(parsed.Data, record); err != nil {
+		return nil, nil, archive.invalid("unable to read a %s: %s", parsed.Type, err)
+	}
+	for _, ref := range record.references() {
+		if !archive.seen[ref.recordType][ref.id] {
+			return nil, nil, archive.invalid("a %s refers to %s %d, which isn't in the archive", parsed.Type, ref.recordType, ref.id)
+		}
+	}
+	if id := record.id(); id != 0 {
+		if archive.seen[parsed.Type][id] {
+			return nil, nil, archive.invalid("there's more than one %s %d", parsed.Type, id)
+		}
+		archive.seen[parsed.Type][id] = true
+	}
+
+	archive.counts[parsed.Type]++
+	return table, record, nil
+}
+
+func (archive *reader) checkFooter(parsed line) error {
+	footer := Footer{}
+	if err := json.Unmarshal(parsed.Data, &footer); err != nil {
+		return archive.invalid("unable to read the footer: %s", err)
+	}
+	if footer.SHA256 != hex.EncodeToString(archive.hash.Sum(nil)) {
+		return archive.invalid("the checksum doesn't match, the archive has been changed or damaged")
+	}
+	for _, table := range tables {
+		if footer.Counts[table.recordType] != archive.counts[table.recordType] {
+			return archive.invalid("the archive should have %d of %s, but has %d",
+				footer.Counts[table.recordType], table.recordType, archive.counts[table.recordType])
+		}
+	}
+
+	if rest, _ := archive.in.ReadBytes('\n'); len(bytes.TrimSpace(rest)) > 0 {
+		archive.line++
+		return archive.invalid("there's more after the footer")
+	}
+	return io.EOF
+}
+
+// Validate reads through an entire archive, made at the given schema, and makes sure it's
+// all there and all makes sense without importing any of it.
+func Validate(r io.Reader, schema string) (Summary, error) {
+	archive, err := newReader(r, schema)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	for {
+		_, _, err := archive.next()
+		if err == io.EOF {
+			return Summary{archive.header, archive.counts}, nil
+		}
+		if err != nil {
+			return Summary{archive.header, archive.counts}, err
+		}
+	}
+}
+
+// Import restores an archive into an empty instance at the given schema. It all happens in
+// a single transaction, so an archive that turns out to be a problem partway through leaves
+// nothing behind. It's still worth calling Validate first though, since that won't tie up
+// the database for however long it takes to read an archive that's broken at the end.
+func Import(db *sql.DB, r io.Reader, schema string) (Summary, error) {
+	archive, err := newReader(r, schema)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer tx.Rollback()
+
+	var empty bool
+	if err := tx.QueryRow(emptyQuery).Scan(&empty); err != nil {
+		return Summary{}, err
+	}
+	if !empty {
+		return Summary{}, ErrNotEmpty
+	}
+
+	for {
+		table, record, err := archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Summary{archive.header, archive.counts}, err
+		}
+		if _, err := tx.Exec(table.insert, record.fields()...); err != nil {
+			return Summary{archive.header, archive.counts}, fmt.Errorf("Unable to import %s on line %d: %s", table.recordType, archive.line, err)
+		}
+	}
+
+	for _, table := range tables {
+		if table.serial == "" {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(resetSequenceQuery, table.serial)); err != nil {
+			return Summary{archive.header, archive.counts}, err
+		}
+	}
+	return Summary{archive.header, archive.counts}, tx.Commit()
+}
@@ -0,0 +1,150 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildArchive puts together an archive out of the records given, with a footer that adds up
+func buildArchive(schema string, records ...string) string {
+	archive := fmt.Sprintf(`{"type":"header","data":{"format":"linkletter-archive","version":1,"schema":%q,"created_at":"2017-03-01T12:00:00Z"}}`+"\n", schema)
+	counts := map[string]int{}
+	for _, record := range records {
+		archive += record + "\n"
+		counts[regexp.MustCompile(`"type":"(\w+)"`).FindStringSubmatch(record)[1]]++
+	}
+
+	encodedCounts := []string{}
+	for _, recordType := range RecordTypes() {
+		if counts[recordType] > 0 {
+			encodedCounts = append(encodedCounts, fmt.Sprintf("%q:%d", recordType, counts[recordType]))
+		}
+	}
+	sum := sha256.Sum256([]byte(archive))
+	return archive + fmt.Sprintf(`{"type":"footer","data":{"counts":{%s},"sha256":%q}}`, strings.Join(encodedCounts, ","), hex.EncodeToString(sum[:])) + "\n"
+}
+
+const (
+	testUser = `{"type":"user","data":{"id":1,"email":"admin@example.com","role":"admin","inbound_token":null,"created_at":"2017-03-01T12:00:00Z"}}`
+	testLink = `{"type":"link","data":{"id":42,"url":"https://example.com","title":"","description":"","submitter_id":1,"created_at":"2017-03-01T12:00:00Z","popular_at":null,"imported":true}}`
+)
+
+func TestValidate(t *testing.T) {
+	summary, err := Validate(bytes.NewReader(exportTestArchive(t)), testSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, testSchema, summary.Header.Schema)
+	assert.Equal(t, 2, summary.Counts["user"])
+	assert.Equal(t, 1, summary.Counts["top_comment"])
+
+	summary, err = Validate(strings.NewReader(buildArchive(testSchema, testUser, testLink)), testSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Counts["link"])
+}
+
+func TestValidateGzip(t *testing.T) {
+	zipped := &bytes.Buffer{}
+	writer := gzip.NewWriter(zipped)
+	writer.Write(exportTestArchive(t))
+	writer.Close()
+
+	summary, err := Validate(zipped, testSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.Counts["user"])
+}
+
+func TestValidateInvalid(t *testing.T) {
+	valid := buildArchive(testSchema, testUser, testLink)
+
+	cases := []struct {
+		archive string
+		line    int
+		reason  string
+	}{
+		{"", 0, "cut off"},
+		{"Just some text\n", 1, "invalid character"},
+		{`{"type":"header","data":{"format":"something-else"}}` + "\n", 1, "isn't a LinkLetter archive"},
+		{strings.Replace(valid, `"version":1`, `"version":2`, 1), 1, "version 2"},
+		{buildArchive("8_bounces.sql", testUser), 1, "made at migration 8_bounces.sql"},
+		{strings.Join(strings.SplitAfter(valid, "\n")[:3], ""), 3, "cut off"},
+		{buildArchive(testSchema, testUser, `{"type":"bookmark","data":{}}`), 3, `"bookmark" record`},
+		{buildArchive(testSchema, `{"type":"issue","data":{"id":3}}`, testUser), 3, `"user" record is either out of order`},
+		{buildArchive(testSchema, testLink), 2, "refers to user 1"},
+		{buildArchive(testSchema, testUser, testUser), 3, "more than one user 1"},
+		{strings.Replace(valid, "admin@example.com", "someone@example.com", 1), 4, "checksum"},
+		{strings.Replace(valid, `"link":1`, `"link":2`, 1), 4, "should have 2 of link"},
+		{valid + testUser + "\n", 5, "after the footer"},
+	}
+
+	for _, c := range cases {
+		_, err := Validate(strings.NewReader(c.archive), testSchema)
+		if assert.IsType(t, InvalidError{}, err, c.reason) {
+			assert.Equal(t, c.line, err.(InvalidError).Line, c.reason)
+			assert.Contains(t, err.Error(), c.reason)
+		}
+	}
+
+	// Trailing blank lines are fine though
+	_, err := Validate(strings.NewReader(valid+"\n"), testSchema)
+	assert.Nil(t, err)
+}
+
+func TestImport(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(emptyQuery)).WillReturnRows(sqlmock.NewRows([]string{"empty"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(tables[0].insert)).
+		WithArgs(1, "admin@example.com", "admin", nil, testTime).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(tables[3].insert)).
+		WithArgs(42, "https://example.com", "", "", 1, testTime, nil, true).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	for _, table := range tables {
+		if table.serial != "" {
+			mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(resetSequenceQuery, table.serial))).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+	mock.ExpectCommit()
+
+	summary, err := Import(db, strings.NewReader(buildArchive(testSchema, testUser, testLink)), testSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Counts["link"])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestImportNotEmpty(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(emptyQuery)).WillReturnRows(sqlmock.NewRows([]string{"empty"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err := Import(db, strings.NewReader(buildArchive(testSchema, testUser)), testSchema)
+	assert.Equal(t, ErrNotEmpty, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestImportInvalid(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	// Nothing gets committed when the archive turns out to be broken partway through
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(emptyQuery)).WillReturnRows(sqlmock.NewRows([]string{"empty"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(tables[0].insert)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(tables[3].insert)).WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectRollback()
+
+	archive := strings.Replace(buildArchive(testSchema, testUser, testLink), "https://example.com", "https://example.org", 1)
+	_, err := Import(db, strings.NewReader(archive), testSchema)
+	assert.IsType(t, InvalidError{}, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,406 @@
+package archive
+
+// Every kind of record in an archive is one of these, along with the table it comes from
+// and goes back into. The structs have their own JSON field names, rather than archiving
+// whatever our other packages happen to call things, because an archive written today has
+// to still mean the same thing after everybody has forgotten what the code looked like.
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// record is a single row of one of our tables
+type record interface {
+	// fields lists pointers to every one of the record's columns, in the order its table's
+	// queries use them. They're used to scan the row when exporting, and as the arguments
+	// to the insert when importing.
+	fields() []interface{}
+
+	// id is the record's primary key, or 0 for records that don't have one of their own
+	id() int64
+
+	// references lists every other record this one refers to, which all have to come
+	// earlier in the archive
+	references() []reference
+}
+
+type reference struct {
+	recordType string
+	id         int64
+}
+
+// optional is for references that are allowed to be NULL
+func optional(recordType string, id *int64) []reference {
+	if id == nil {
+		return nil
+	}
+	return []reference{{recordType, *id}}
+}
+
+type userRecord struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	InboundToken *string   `json:"inbound_token"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (r *userRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.Email, &r.Role, &r.InboundToken, &r.CreatedAt}
+}
+func (r *userRecord) id() int64               { return r.ID }
+func (r *userRecord) references() []reference { return nil }
+
+type categoryRecord struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Position int    `json:"position"`
+}
+
+func (r *categoryRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.Name, &r.Slug, &r.Position}
+}
+func (r *categoryRecord) id() int64               { return r.ID }
+func (r *categoryRecord) references() []reference { return nil }
+
+type tagRecord struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	CategoryID *int64 `json:"category_id"`
+}
+
+func (r *tagRecord) fields() []interface{}   { return []interface{}{&r.ID, &r.Name, &r.CategoryID} }
+func (r *tagRecord) id() int64               { return r.ID }
+func (r *tagRecord) references() []reference { return optional("category", r.CategoryID) }
+
+type linkRecord struct {
+	ID          int64      `json:"id"`
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	SubmitterID int64      `json:"submitter_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PopularAt   *time.Time `json:"popular_at"`
+	Imported    bool       `json:"imported"`
+}
+
+func (r *linkRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.URL, &r.Title, &r.Description, &r.SubmitterID, &r.CreatedAt, &r.PopularAt, &r.Imported}
+}
+func (r *linkRecord) id() int64               { return r.ID }
+func (r *linkRecord) references() []reference { return []reference{{"user", r.SubmitterID}} }
+
+type linkTagRecord struct {
+	LinkID int64 `json:"link_id"`
+	TagID  int64 `json:"tag_id"`
+}
+
+func (r *linkTagRecord) fields() []interface{} { return []interface{}{&r.LinkID, &r.TagID} }
+func (r *linkTagRecord) id() int64             { return 0 }
+func (r *linkTagRecord) references() []reference {
+	return []reference{{"link", r.LinkID}, {"tag", r.TagID}}
+}
+
+type voteRecord struct {
+	LinkID    int64     `json:"link_id"`
+	UserID    int64     `json:"user_id"`
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *voteRecord) fields() []interface{} {
+	return []interface{}{&r.LinkID, &r.UserID, &r.Value, &r.CreatedAt}
+}
+func (r *voteRecord) id() int64 { return 0 }
+func (r *voteRecord) references() []reference {
+	return []reference{{"link", r.LinkID}, {"user", r.UserID}}
+}
+
+type commentRecord struct {
+	ID        int64     `json:"id"`
+	LinkID    int64     `json:"link_id"`
+	ParentID  *int64    `json:"parent_id"`
+	AuthorID  int64     `json:"author_id"`
+	Body      string    `json:"body"`
+	Deleted   bool      `json:"deleted"`
+	Hidden    bool      `json:"hidden"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r *commentRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.LinkID, &r.ParentID, &r.AuthorID, &r.Body, &r.Deleted, &r.Hidden, &r.CreatedAt, &r.UpdatedAt}
+}
+func (r *commentRecord) id() int64 { return r.ID }
+func (r *commentRecord) references() []reference {
+	return append([]reference{{"link", r.LinkID}, {"user", r.AuthorID}}, optional("comment", r.ParentID)...)
+}
+
+// topCommentRecord is the comment an editor picked to quote for a link. It can't just be a
+// field of the link, because the link has to be imported before any of its comments can be.
+type topCommentRecord struct {
+	LinkID    int64 `json:"link_id"`
+	CommentID int64 `json:"comment_id"`
+}
+
+func (r *topCommentRecord) fields() []interface{} { return []interface{}{&r.LinkID, &r.CommentID} }
+func (r *topCommentRecord) id() int64             { return 0 }
+func (r *topCommentRecord) references() []reference {
+	return []reference{{"link", r.LinkID}, {"comment", r.CommentID}}
+}
+
+type issueRecord struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Status      string     `json:"status"`
+	ManualOrder bool       `json:"manual_order"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SentAt      *time.Time `json:"sent_at"`
+	Recipients  int        `json:"recipients"`
+}
+
+func (r *issueRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.Title, &r.Status, &r.ManualOrder, &r.CreatedAt, &r.SentAt, &r.Recipients}
+}
+func (r *issueRecord) id() int64               { return r.ID }
+func (r *issueRecord) references() []reference { return nil }
+
+type issueLinkRecord struct {
+	IssueID  int64 `json:"issue_id"`
+	LinkID   int64 `json:"link_id"`
+	Position int   `json:"position"`
+}
+
+func (r *issueLinkRecord) fields() []interface{} {
+	return []interface{}{&r.IssueID, &r.LinkID, &r.Position}
+}
+func (r *issueLinkRecord) id() int64 { return 0 }
+func (r *issueLinkRecord) references() []reference {
+	return []reference{{"issue", r.IssueID}, {"link", r.LinkID}}
+}
+
+type subscriberRecord struct {
+	ID               int64     `json:"id"`
+	Email            string    `json:"email"`
+	Status           string    `json:"status"`
+	SuppressedReason string    `json:"suppressed_reason"`
+	SoftBounces      int       `json:"soft_bounces"`
+	Tracking         bool      `json:"tracking"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (r *subscriberRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.Email, &r.Status, &r.SuppressedReason, &r.SoftBounces, &r.Tracking, &r.CreatedAt, &r.UpdatedAt}
+}
+func (r *subscriberRecord) id() int64               { return r.ID }
+func (r *subscriberRecord) references() []reference { return nil }
+
+type webhookRecord struct {
+	ID        int64          `json:"id"`
+	URL       string         `json:"url"`
+	Secret    string         `json:"secret"`
+	Events    pq.StringArray `json:"events"`
+	Active    bool           `json:"active"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func (r *webhookRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.URL, &r.Secret, &r.Events, &r.Active, &r.CreatedAt}
+}
+func (r *webhookRecord) id() int64               { return r.ID }
+func (r *webhookRecord) references() []reference { return nil }
+
+// feedRecord leaves out everything about how polling the feed has been going, that's about
+// this instance rather than the feed
+type feedRecord struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	SiteURL   string    `json:"site_url"`
+	Interval  int       `json:"interval_minutes"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *feedRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.URL, &r.Title, &r.SiteURL, &r.Interval, &r.Active, &r.CreatedAt}
+}
+func (r *feedRecord) id() int64               { return r.ID }
+func (r *feedRecord) references() []reference { return nil }
+
+// feedItemRecord is everything that's turned up in a feed. They're worth keeping even once
+// they've been dealt with, since they're how we know not to suggest them all over again.
+type feedItemRecord struct {
+	ID          int64      `json:"id"`
+	FeedID      int64      `json:"feed_id"`
+	GUID        string     `json:"guid"`
+	URL         string     `json:"url"`
+	Title       string     `json:"title"`
+	Summary     string     `json:"summary"`
+	PublishedAt *time.Time `json:"published_at"`
+	Status      string     `json:"status"`
+	LinkID      *int64     `json:"link_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (r *feedItemRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.FeedID, &r.GUID, &r.URL, &r.Title, &r.Summary, &r.PublishedAt, &r.Status, &r.LinkID, &r.CreatedAt}
+}
+func (r *feedItemRecord) id() int64 { return r.ID }
+func (r *feedItemRecord) references() []reference {
+	return append([]reference{{"feed", r.FeedID}}, optional("link", r.LinkID)...)
+}
+
+// linkSnapshotRecord is the text of a link as it was when it was shared, which may well be
+// the only copy of it left by now. How the link's been holding up since isn't archived, a
+// new instance will check for itself.
+type linkSnapshotRecord struct {
+	LinkID     int64     `json:"link_id"`
+	StatusCode int       `json:"status_code"`
+	Title      string    `json:"title"`
+	Body       string    `json:"body"`
+	Error      string    `json:"error"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+func (r *linkSnapshotRecord) fields() []interface{} {
+	return []interface{}{&r.LinkID, &r.StatusCode, &r.Title, &r.Body, &r.Error, &r.CapturedAt}
+}
+func (r *linkSnapshotRecord) id() int64               { return 0 }
+func (r *linkSnapshotRecord) references() []reference { return []reference{{"link", r.LinkID}} }
+
+// clickRecord is a click on a link in an issue. Who clicked is only ever a hash, see the
+// clicks package, and since it's keyed with the SecretKey an instance that's moved somewhere
+// else needs to keep its SecretKey for the hashes to keep lining up.
+type clickRecord struct {
+	ID             int64     `json:"id"`
+	IssueID        int64     `json:"issue_id"`
+	LinkID         int64     `json:"link_id"`
+	SubscriberHash string    `json:"subscriber_hash"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (r *clickRecord) fields() []interface{} {
+	return []interface{}{&r.ID, &r.IssueID, &r.LinkID, &r.SubscriberHash, &r.CreatedAt}
+}
+func (r *clickRecord) id() int64 { return r.ID }
+func (r *clickRecord) references() []reference {
+	return []reference{{"issue", r.IssueID}, {"link", r.LinkID}}
+}
+
+// openRecord is how many times one subscriber opened an issue, hashed the same way as a
+// click is
+type openRecord struct {
+	IssueID        int64     `json:"issue_id"`
+	SubscriberHash string    `json:"subscriber_hash"`
+	Prefetched     bool      `json:"prefetched"`
+	Opens          int       `json:"opens"`
+	FirstOpenedAt  time.Time `json:"first_opened_at"`
+}
+
+func (r *openRecord) fields() []interface{} {
+	return []interface{}{&r.IssueID, &r.SubscriberHash, &r.Prefetched, &r.Opens, &r.FirstOpenedAt}
+}
+func (r *openRecord) id() int64               { return 0 }
+func (r *openRecord) references() []reference { return []reference{{"issue", r.IssueID}} }
+
+// table is everything we need to know to export and import one kind of record
+type table struct {
+	recordType string
+
+	// serial is the table's name if it has a BIGSERIAL id, whose sequence needs catching up
+	// after we've inserted ids of our own
+	serial string
+
+	export string
+	insert string
+	fresh  func() record
+}
+
+// tables are in the order they're archived in, which is an order that lets every record
+// refer to the ones before it. Jobs, webhook deliveries, link health and the bounce log are left out,
+// they're a record of what this particular instance has been up to rather than anything
+// worth moving somewhere else.
+var tables = []table{
+	{"user", "users",
+		"SELECT id, email, role, inbound_token, created_at FROM users ORDER BY id",
+		"INSERT INTO users (id, email, role, inbound_token, created_at) VALUES ($1, $2, $3, $4, $5)",
+		func() record { return &userRecord{} }},
+	{"category", "categories",
+		"SELECT id, name, slug, position FROM categories ORDER BY id",
+		"INSERT INTO categories (id, name, slug, position) VALUES ($1, $2, $3, $4)",
+		func() record { return &categoryRecord{} }},
+	{"tag", "tags",
+		"SELECT id, name, category_id FROM tags ORDER BY id",
+		"INSERT INTO tags (id, name, category_id) VALUES ($1, $2, $3)",
+		func() record { return &tagRecord{} }},
+	{"link", "links",
+		"SELECT id, url, title, description, submitter_id, created_at, popular_at, imported FROM links ORDER BY id",
+		"INSERT INTO links (id, url, title, description, submitter_id, created_at, popular_at, imported) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		func() record { return &linkRecord{} }},
+	{"link_tag", "",
+		"SELECT link_id, tag_id FROM link_tags ORDER BY link_id, tag_id",
+		"INSERT INTO link_tags (link_id, tag_id) VALUES ($1, $2)",
+		func() record { return &linkTagRecord{} }},
+	{"vote", "",
+		"SELECT link_id, user_id, value, created_at FROM votes ORDER BY link_id, user_id",
+		"INSERT INTO votes (link_id, user_id, value, created_at) VALUES ($1, $2, $3, $4)",
+		func() record { return &voteRecord{} }},
+	{"comment", "comments",
+		"SELECT id, link_id, parent_id, author_id, body, deleted, hidden, created_at, updated_at FROM comments ORDER BY id",
+		"INSERT INTO comments (id, link_id, parent_id, author_id, body, deleted, hidden, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		func() record { return &commentRecord{} }},
+	{"top_comment", "",
+		"SELECT id, top_comment_id FROM links WHERE top_comment_id IS NOT NULL ORDER BY id",
+		"UPDATE links SET top_comment_id = $2 WHERE id = $1",
+		func() record { return &topCommentRecord{} }},
+	{"issue", "issues",
+		"SELECT id, title, status, manual_order, created_at, sent_at, recipients FROM issues ORDER BY id",
+		"INSERT INTO issues (id, title, status, manual_order, created_at, sent_at, recipients) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		func() record { return &issueRecord{} }},
+	{"issue_link", "",
+		"SELECT issue_id, link_id, position FROM issue_links ORDER BY issue_id, position",
+		"INSERT INTO issue_links (issue_id, link_id, position) VALUES ($1, $2, $3)",
+		func() record { return &issueLinkRecord{} }},
+	{"subscriber", "subscribers",
+		"SELECT id, email, status, suppressed_reason, soft_bounces, tracking, created_at, updated_at FROM subscribers ORDER BY id",
+		"INSERT INTO subscribers (id, email, status, suppressed_reason, soft_bounces, tracking, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		func() record { return &subscriberRecord{} }},
+	{"webhook", "webhooks",
+		"SELECT id, url, secret, events, active, created_at FROM webhooks ORDER BY id",
+		"INSERT INTO webhooks (id, url, secret, events, active, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		func() record { return &webhookRecord{} }},
+	{"feed", "feeds",
+		"SELECT id, url, title, site_url, interval_minutes, active, created_at FROM feeds ORDER BY id",
+		"INSERT INTO feeds (id, url, title, site_url, interval_minutes, active, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		func() record { return &feedRecord{} }},
+	{"feed_item", "feed_items",
+		"SELECT id, feed_id, guid, url, title, summary, published_at, status, link_id, created_at FROM feed_items ORDER BY id",
+		"INSERT INTO feed_items (id, feed_id, guid, url, title, summary, published_at, status, link_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		func() record { return &feedItemRecord{} }},
+	{"link_snapshot", "",
+		"SELECT link_id, status_code, title, body, error, captured_at FROM link_snapshots ORDER BY link_id",
+		"INSERT INTO link_snapshots (link_id, status_code, title, body, error, captured_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		func() record { return &linkSnapshotRecord{} }},
+	{"click", "clicks",
+		"SELECT id, issue_id, link_id, subscriber_hash, created_at FROM clicks ORDER BY id",
+		"INSERT INTO clicks (id, issue_id, link_id, subscriber_hash, created_at) VALUES ($1, $2, $3, $4, $5)",
+		func() record { return &clickRecord{} }},
+	{"open", "",
+		"SELECT issue_id, subscriber_hash, prefetched, opens, first_opened_at FROM opens ORDER BY issue_id, subscriber_hash, prefetched",
+		"INSERT INTO opens (issue_id, subscriber_hash, prefetched, opens, first_opened_at) VALUES ($1, $2, $3, $4, $5)",
+		func() record { return &openRecord{} }},
+}
+
+// RecordTypes lists every kind of record an archive can have, in the order they're archived
+func RecordTypes() []string {
+	recordTypes := []string{}
+	for _, table := range tables {
+		recordTypes = append(recordTypes, table.recordType)
+	}
+	return recordTypes
+}
@@ -0,0 +1,141 @@
+// Package bookmarks imports the links a group shared somewhere else before they found us.
+package bookmarks
+
+// Everybody who shows up with years of bookmarks has them in one of a handful of formats:
+//
+// "netscape" is the bookmark file every browser (and del.icio.us, and Diigo, and just about
+// everything else) exports. It's HTML from the Netscape Navigator days, which is to say it
+// isn't really HTML at all. Tags, when there are any, are in a TAGS attribute.
+//
+// "pocket" is Pocket's export. It used to be an HTML page not unlike a Netscape file, and
+// these days it's a CSV with title, url, time_added, tags and status columns. Either works.
+//
+// "pinboard" is the JSON from Pinboard's export (or its posts/all API).
+//
+// "csv" is our own, for everybody else. The first row names the columns, in any order:
+// "url" (the only one that's required), "title", "description", "tags" (separated by
+// commas, the same as typing them into the share form) and "created_at" (either RFC 3339,
+// "2006-01-02 15:04:05", "2006-01-02" or a unix timestamp). Anything else is ignored.
+//
+// Whatever the format, every bookmark keeps its tags and the date it was originally saved,
+// and anything that's already been shared (or shows up twice in the same file) is reported
+// as a duplicate rather than imported again. See links.NormalizeURL for what counts as the
+// same link.
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/tags"
+)
+
+// These are the formats we know how to import
+const (
+	FormatNetscape = "netscape"
+	FormatPocket   = "pocket"
+	FormatPinboard = "pinboard"
+	FormatCSV      = "csv"
+)
+
+// Formats lists every format, for anybody who needs to pick one
+var Formats = []string{FormatNetscape, FormatPocket, FormatPinboard, FormatCSV}
+
+// ErrUnknownFormat is returned when asked to parse a format that isn't one of Formats
+var ErrUnknownFormat = errors.New("Bookmarks must be in one of the netscape, pocket, pinboard or csv formats")
+
+// Bookmark is a single link, as it came out of somebody's export
+type Bookmark struct {
+	URL         string
+	Title       string
+	Description string
+	Tags        []string
+
+	// CreatedAt is when the bookmark was originally saved, or the zero time if the export
+	// didn't say
+	CreatedAt time.Time
+}
+
+// Detect has a guess at what format an export is in
+func Detect(data []byte) string {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	start := data
+	if len(start) > 1024 {
+		start = start[:1024]
+	}
+	lower := strings.ToLower(string(start))
+
+	switch {
+	case strings.HasPrefix(lower, "["), strings.HasPrefix(lower, "{"):
+		return FormatPinboard
+	case strings.HasPrefix(lower, "<"):
+		if strings.Contains(lower, "pocket export") {
+			return FormatPocket
+		}
+		return FormatNetscape
+	case strings.HasPrefix(lower, "title,url,time_added"):
+		return FormatPocket
+	}
+	return FormatCSV
+}
+
+// Parse reads every bookmark out of an export in the given format. An empty format means
+// we'll Detect it.
+func Parse(format string, data []byte) ([]Bookmark, error) {
+	if format == "" {
+		format = Detect(data)
+	}
+
+	switch format {
+	case FormatNetscape:
+		return parseHTML(data), nil
+	case FormatPocket:
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			return parseHTML(data), nil
+		}
+		return parseCSV(data, "|")
+	case FormatPinboard:
+		return parsePinboard(data)
+	case FormatCSV:
+		return parseCSV(data, ",")
+	}
+	return nil, ErrUnknownFormat
+}
+
+// cleanTags normalizes tags the same way the share form does
+func cleanTags(raw []string) []string {
+	return tags.Parse(strings.Join(raw, ","))
+}
+
+// timeFormats are the ways of writing a date we'll accept, besides a unix timestamp
+var timeFormats = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseTime makes what sense it can of a date. Exports are remarkably inconsistent about
+// timestamps, a few write theirs in milliseconds or even microseconds rather than seconds,
+// so anything that would be centuries from now is scaled back down. It returns the zero
+// time for anything it can't make sense of.
+func parseTime(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}
+	}
+
+	if unix, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		for unix > 1e11 {
+			unix /= 1000
+		}
+		if unix <= 0 {
+			return time.Time{}
+		}
+		return time.Unix(unix, 0).UTC()
+	}
+
+	for _, format := range timeFormats {
+		if parsed, err := time.Parse(format, raw); err == nil {
+			return parsed.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,53 @@
+package bookmarks
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAsset(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("test_assets/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, FormatNetscape, Detect(readAsset(t, "netscape.html")))
+	assert.Equal(t, FormatPocket, Detect(readAsset(t, "pocket.html")))
+	assert.Equal(t, FormatPocket, Detect(readAsset(t, "pocket.csv")))
+	assert.Equal(t, FormatPinboard, Detect(readAsset(t, "pinboard.json")))
+	assert.Equal(t, FormatCSV, Detect(readAsset(t, "bookmarks.csv")))
+	assert.Equal(t, FormatPinboard, Detect([]byte("\xef\xbb\xbf  []")))
+}
+
+func TestParse(t *testing.T) {
+	// An explicit format wins over whatever Detect would have said
+	_, err := Parse(FormatPinboard, readAsset(t, "bookmarks.csv"))
+	assert.NotNil(t, err)
+
+	found, err := Parse("", readAsset(t, "pocket.csv"))
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+
+	_, err = Parse("delicious", nil)
+	assert.Equal(t, ErrUnknownFormat, err)
+}
+
+func TestParseTime(t *testing.T) {
+	second := time.Unix(1500000000, 0).UTC()
+	assert.Equal(t, second, parseTime("1500000000"))
+	assert.Equal(t, second, parseTime(" 1500000000000 "))
+	assert.Equal(t, second, parseTime("1500000000000000"))
+	assert.Equal(t, second, parseTime("2017-07-14T02:40:00Z"))
+	assert.Equal(t, second, parseTime("2017-07-14 02:40:00"))
+	assert.Equal(t, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC), parseTime("2017-07-14"))
+
+	for _, nonsense := range []string{"", "0", "-5", "yesterday", "14/07/2017"} {
+		assert.True(t, parseTime(nonsense).IsZero(), nonsense)
+	}
+}
@@ -0,0 +1,79 @@
+package bookmarks
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNoURLColumn is returned for a CSV without a "url" column
+var ErrNoURLColumn = errors.New("The first row of the CSV must name its columns, and one of them must be \"url\"")
+
+// columnNames maps the names a column might go by onto the name we know it as. Pocket's
+// export is close enough to our own CSV that it only needs "time_added" to be understood.
+var columnNames = map[string]string{
+	"url":         "url",
+	"href":        "url",
+	"title":       "title",
+	"description": "description",
+	"tags":        "tags",
+	"created_at":  "created_at",
+	"time_added":  "created_at",
+}
+
+// parseCSV reads a CSV whose first row names its columns (see the package comments), with
+// tags separated by tagSeparator.
+func parseCSV(data []byte, tagSeparator string) ([]Bookmark, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []Bookmark{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if known, ok := columnNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[known] = i
+		}
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, ErrNoURLColumn
+	}
+
+	found := []Bookmark{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if field("url") == "" {
+			continue
+		}
+		found = append(found, Bookmark{
+			URL:         field("url"),
+			Title:       field("title"),
+			Description: field("description"),
+			Tags:        cleanTags(strings.Split(field("tags"), tagSeparator)),
+			CreatedAt:   parseTime(field("created_at")),
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	found, err := Parse(FormatCSV, readAsset(t, "bookmarks.csv"))
+	assert.Nil(t, err)
+	assert.Len(t, found, 3)
+
+	assert.Equal(t, Bookmark{
+		URL:       "https://example.com/ours",
+		Title:     "Our own format",
+		Tags:      []string{"go", "tooling"},
+		CreatedAt: time.Date(2018, 2, 3, 0, 0, 0, 0, time.UTC),
+	}, found[0])
+	assert.True(t, found[1].CreatedAt.IsZero())
+	assert.Equal(t, time.Unix(1500000000, 0).UTC(), found[2].CreatedAt)
+
+	_, err = Parse(FormatCSV, []byte("title,link\nSomething,https://example.com\n"))
+	assert.Equal(t, ErrNoURLColumn, err)
+
+	found, err = Parse(FormatCSV, []byte(""))
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+}
+
+func TestParsePocketCSV(t *testing.T) {
+	found, err := Parse(FormatPocket, readAsset(t, "pocket.csv"))
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+
+	assert.Equal(t, []string{"later", "long-reads"}, found[0].Tags)
+	assert.Equal(t, time.Unix(1500000000, 0).UTC(), found[0].CreatedAt)
+	assert.Equal(t, "Quoted, with a comma", found[1].Title)
+	assert.Equal(t, []string{}, found[1].Tags)
+}
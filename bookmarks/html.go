@@ -0,0 +1,71 @@
+package bookmarks
+
+// Netscape bookmark files look like HTML, but only if you squint. Nothing is ever closed,
+// <DT> and <p> are sprinkled around wherever the exporter felt like it, and no two browsers
+// agree on the details. What they do all agree on is that every bookmark is an <A> tag,
+// with the link's title inside of it and its attributes in the tag, optionally followed by
+// a <DD> with a description. So rather than trying to parse the whole document we just go
+// looking for those.
+//
+//     <DT><A HREF="https://example.com" ADD_DATE="1500000000" TAGS="go,design">Example</A>
+//     <DD>What it's about
+//
+// Pocket's old HTML export is the same idea, with "time_added" and "tags" attributes.
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	anchorPattern      = regexp.MustCompile(`(?is)<a\s([^>]*)>(.*?)</a\s*>`)
+	attributePattern   = regexp.MustCompile(`(?s)([a-zA-Z_:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	descriptionPattern = regexp.MustCompile(`(?is)^\s*(?:</dt>\s*)?<dd>([^<]*)`)
+	markupPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// attributes reads the attributes out of a tag, with lowercase names
+func attributes(tag string) map[string]string {
+	found := map[string]string{}
+	for _, match := range attributePattern.FindAllStringSubmatch(tag, -1) {
+		found[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return found
+}
+
+// text turns a bit of HTML into the plain text it says
+func text(markup string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(markupPattern.ReplaceAllString(markup, " "))), " ")
+}
+
+func parseHTML(data []byte) []Bookmark {
+	content := string(data)
+	found := []Bookmark{}
+
+	for _, match := range anchorPattern.FindAllStringSubmatchIndex(content, -1) {
+		attrs := attributes(content[match[2]:match[3]])
+		if attrs["href"] == "" {
+			continue
+		}
+
+		bookmark := Bookmark{
+			URL:   strings.TrimSpace(attrs["href"]),
+			Title: text(content[match[4]:match[5]]),
+			Tags:  cleanTags(strings.Split(attrs["tags"], ",")),
+		}
+
+		created := attrs["add_date"]
+		if created == "" {
+			created = attrs["time_added"]
+		}
+		bookmark.CreatedAt = parseTime(created)
+
+		if description := descriptionPattern.FindStringSubmatch(content[match[1]:]); description != nil {
+			bookmark.Description = text(description[1])
+		}
+
+		found = append(found, bookmark)
+	}
+	return found
+}
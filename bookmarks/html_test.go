@@ -0,0 +1,47 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetscape(t *testing.T) {
+	found, err := Parse(FormatNetscape, readAsset(t, "netscape.html"))
+	assert.Nil(t, err)
+	assert.Len(t, found, 4)
+
+	assert.Equal(t, Bookmark{
+		URL:         "https://example.com/go-at-scale",
+		Title:       "Go at & Scale",
+		Description: "How one team runs a few thousand services",
+		Tags:        []string{"go", "distributed-systems"},
+		CreatedAt:   time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, found[0])
+
+	// Microseconds, markup in the title, and no description
+	assert.Equal(t, "A design primer", found[1].Title)
+	assert.Equal(t, "", found[1].Description)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), found[1].CreatedAt)
+
+	// The browser's own queries come along too, it's up to Import to throw them out
+	assert.Equal(t, "place:sort=8&maxResults=10", found[2].URL)
+
+	// Single quotes, unquoted attributes, and no tags
+	assert.Equal(t, "http://blog.example.com/post", found[3].URL)
+	assert.Equal(t, []string{}, found[3].Tags)
+	assert.Equal(t, time.Unix(1300000000, 0).UTC(), found[3].CreatedAt)
+}
+
+func TestParsePocketHTML(t *testing.T) {
+	found, err := Parse(FormatPocket, readAsset(t, "pocket.html"))
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+
+	assert.Equal(t, "https://example.com/unread", found[0].URL)
+	assert.Equal(t, "An unread article", found[0].Title)
+	assert.Equal(t, []string{"later", "long-reads"}, found[0].Tags)
+	assert.Equal(t, time.Unix(1500000000, 0).UTC(), found[0].CreatedAt)
+	assert.Equal(t, []string{}, found[1].Tags)
+}
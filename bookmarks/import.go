@@ -0,0 +1,98 @@
+package bookmarks
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+)
+
+// Duplicate is a bookmark that wasn't imported because we already had it
+type Duplicate struct {
+	Bookmark Bookmark
+
+	// LinkID is the link that was already shared, or 0 if it's a bookmark that came earlier
+	// in the same import
+	LinkID int64
+}
+
+// byCreatedAt sorts bookmarks oldest first
+type byCreatedAt []Bookmark
+
+func (b byCreatedAt) Len() int           { return len(b) }
+func (b byCreatedAt) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreatedAt) Less(i, j int) bool { return b[i].CreatedAt.Before(b[j].CreatedAt) }
+
+// Report is what happened to every bookmark in an import
+type Report struct {
+	Imported   []Bookmark
+	Duplicates []Duplicate
+
+	// Invalid are the bookmarks that aren't links we're willing to share, like the
+	// "javascript:" bookmarklets and "place:" queries that browsers export right along with
+	// everything else
+	Invalid []Bookmark
+}
+
+func (report Report) String() string {
+	return fmt.Sprintf("Imported %d links, skipped %d duplicates and %d that weren't valid links",
+		len(report.Imported), len(report.Duplicates), len(report.Invalid))
+}
+
+// Import shares every bookmark that hasn't already been shared, as the given user. They're
+// shared oldest first, so that the links end up in the same order they were bookmarked in.
+// When dryRun is set nothing is actually saved, but the report is the same as if it had
+// been.
+//
+// Imported links don't go out to webhooks as link.created. Somebody's entire history
+// arriving at once would be a flood, and none of it is news.
+func Import(db *sql.DB, submitterID int64, bookmarks []Bookmark, dryRun bool) (Report, error) {
+	report := Report{Imported: []Bookmark{}, Duplicates: []Duplicate{}, Invalid: []Bookmark{}}
+
+	existing, err := links.NormalizedURLs(db)
+	if err != nil {
+		return report, err
+	}
+
+	sorted := make([]Bookmark, len(bookmarks))
+	copy(sorted, bookmarks)
+	sort.Stable(byCreatedAt(sorted))
+
+	imported := map[string]bool{}
+	for _, bookmark := range sorted {
+		key := links.NormalizeURL(bookmark.URL)
+		if key == "" {
+			report.Invalid = append(report.Invalid, bookmark)
+			continue
+		}
+		if id, ok := existing[key]; ok {
+			report.Duplicates = append(report.Duplicates, Duplicate{Bookmark: bookmark, LinkID: id})
+			continue
+		}
+		if imported[key] {
+			report.Duplicates = append(report.Duplicates, Duplicate{Bookmark: bookmark})
+			continue
+		}
+		imported[key] = true
+
+		if !dryRun {
+			link, err := links.Import(db, links.Link{
+				URL:         bookmark.URL,
+				Title:       bookmark.Title,
+				Description: bookmark.Description,
+				SubmitterID: submitterID,
+				CreatedAt:   bookmark.CreatedAt,
+			})
+			if err != nil {
+				return report, err
+			}
+			if err := tags.SetForLink(db, link.ID, bookmark.Tags); err != nil {
+				return report, err
+			}
+		}
+		report.Imported = append(report.Imported, bookmark)
+	}
+	return report, nil
+}
@@ -0,0 +1,72 @@
+package bookmarks
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	listURLsQuery   = "SELECT id, url FROM links"
+	importLinkQuery = "INSERT INTO links"
+)
+
+var testBookmarks = []Bookmark{
+	{URL: "https://example.com/new", Tags: []string{"go"}, CreatedAt: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{URL: "http://www.example.com/shared/?utm_source=feed"},
+	{URL: "javascript:alert(1)"},
+	{URL: "https://example.com/new#again", CreatedAt: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{URL: "https://example.com/older", CreatedAt: time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func expectExisting(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(listURLsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url"}).AddRow(7, "https://example.com/shared"))
+}
+
+func TestImport(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	expectExisting(mock)
+	// Oldest first
+	mock.ExpectQuery(regexp.QuoteMeta(importLinkQuery)).
+		WithArgs("https://example.com/older", "", "", 3, time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM link_tags").WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(importLinkQuery)).
+		WithArgs("https://example.com/new", "", "", 3, time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM link_tags").WithArgs(11).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO tags").WithArgs("go").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("INSERT INTO link_tags").WithArgs(11, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	report, err := Import(db, 3, testBookmarks, false)
+	assert.Nil(t, err)
+	assert.Len(t, report.Imported, 2)
+	assert.Equal(t, []Duplicate{
+		{Bookmark: testBookmarks[1], LinkID: 7},
+		{Bookmark: testBookmarks[3]},
+	}, report.Duplicates)
+	assert.Equal(t, []Bookmark{testBookmarks[2]}, report.Invalid)
+	assert.Equal(t, "Imported 2 links, skipped 2 duplicates and 1 that weren't valid links", report.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestImportDryRun(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	expectExisting(mock)
+	report, err := Import(db, 3, testBookmarks, true)
+	assert.Nil(t, err)
+	assert.Len(t, report.Imported, 2)
+	assert.Len(t, report.Duplicates, 2)
+	assert.Len(t, report.Invalid, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,35 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// pinboardPost is a single bookmark in Pinboard's export. Pinboard calls the title the
+// "description", and the description "extended", for reasons lost to del.icio.us history.
+type pinboardPost struct {
+	Href        string `json:"href"`
+	Description string `json:"description"`
+	Extended    string `json:"extended"`
+	Time        string `json:"time"`
+	Tags        string `json:"tags"`
+}
+
+func parsePinboard(data []byte) ([]Bookmark, error) {
+	posts := []pinboardPost{}
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, err
+	}
+
+	found := make([]Bookmark, 0, len(posts))
+	for _, post := range posts {
+		found = append(found, Bookmark{
+			URL:         strings.TrimSpace(post.Href),
+			Title:       strings.TrimSpace(post.Description),
+			Description: strings.TrimSpace(post.Extended),
+			Tags:        cleanTags(strings.Fields(post.Tags)),
+			CreatedAt:   parseTime(post.Time),
+		})
+	}
+	return found, nil
+}
@@ -0,0 +1,31 @@
+package bookmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePinboard(t *testing.T) {
+	found, err := Parse(FormatPinboard, readAsset(t, "pinboard.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Bookmark{
+		{
+			URL:         "https://example.com/pinned",
+			Title:       "Pinned article",
+			Description: "Worth a second look",
+			Tags:        []string{"go", "performance"},
+			CreatedAt:   time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC),
+		},
+		{
+			URL:       "https://example.com/untagged",
+			Title:     "Untagged",
+			Tags:      []string{},
+			CreatedAt: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, found)
+
+	_, err = Parse(FormatPinboard, []byte(`{"not": "a list"}`))
+	assert.NotNil(t, err)
+}
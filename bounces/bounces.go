@@ -0,0 +1,140 @@
+// Package bounces handles the bad news that comes back after we send an email: bounces
+// and spam complaints.
+package bounces
+
+// Every time we send an email to an address that doesn't exist (or a person who's decided
+// our newsletter is spam) the big mail providers make a note of it. Do it often enough and
+// they'll decide that *we're* the spammer, at which point nobody gets the newsletter at all.
+// So it's very much in our interest to listen when we're told an address is bad, and stop
+// sending to it.
+//
+// That news can reach us in two ways. If we're sending through a provider (Mailgun, SES,
+// Postmark, and friends) they'll usually post it to a webhook for us, each in their own
+// proprietary JSON format. If we're sending through a plain old SMTP server then the news
+// arrives the old fashioned way, as an email back to us in the format laid out by RFC 3464.
+// Both of those end up as a Bounce, and from there they get treated exactly the same way.
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/subscribers"
+)
+
+// The kinds of bounce we know how to deal with. A hard bounce means the address will never
+// work (it doesn't exist, the domain doesn't exist). A soft bounce means it didn't work this
+// time (the mailbox is full, the server is down) but might next time. A complaint means the
+// recipient clicked "this is spam", which we treat as seriously as a hard bounce.
+const (
+	KindHard      = "hard"
+	KindSoft      = "soft"
+	KindComplaint = "complaint"
+)
+
+// The places a Bounce can come from, recorded for posterity in the bounces table.
+const (
+	SourceWebhook = "webhook"
+	SourceDSN     = "dsn"
+)
+
+const (
+	recordBounceQuery = "INSERT INTO bounces (email, kind, diagnostic, source) VALUES ($1, $2, $3, $4)"
+	countBouncesQuery = "SELECT kind, count(*) FROM bounces GROUP BY kind"
+)
+
+// Bounce is a single report of a failed delivery or complaint for an address.
+type Bounce struct {
+	Email      string
+	Kind       string
+	Diagnostic string
+	Source     string
+}
+
+// Processor takes Bounces and updates our subscribers accordingly.
+type Processor struct {
+	db *sql.DB
+
+	// SoftBounceThreshold is how many soft bounces an address is allowed before we treat
+	// it as if it had hard bounced.
+	SoftBounceThreshold int
+}
+
+// NewProcessor creates a Processor using the supplied database connection and threshold.
+func NewProcessor(db *sql.DB, softBounceThreshold int) *Processor {
+	return &Processor{db: db, SoftBounceThreshold: softBounceThreshold}
+}
+
+// Process records the bounce and, if it's bad enough, suppresses the subscriber so that
+// they won't be sent anything else.
+func (processor *Processor) Process(bounce Bounce) error {
+	return processor.process(processor.db, bounce)
+}
+
+// ProcessAll is Process for a whole batch of bounces, all or nothing. Providers post their
+// webhooks again if we fail, batch and all, so if we'd kept the bounces that went through
+// before one that didn't, they'd be counted twice (and a couple of retries is all it takes
+// for a soft bounce to become a suppression).
+func (processor *Processor) ProcessAll(found []Bounce) error {
+	tx, err := processor.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, bounce := range found {
+		if err := processor.process(tx, bounce); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %s", bounce.Email, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (processor *Processor) process(db subscribers.Querier, bounce Bounce) error {
+	if bounce.Kind != KindHard && bounce.Kind != KindSoft && bounce.Kind != KindComplaint {
+		return fmt.Errorf("Unknown bounce kind: '%s'", bounce.Kind)
+	}
+
+	email := subscribers.NormalizeEmail(bounce.Email)
+	_, err := db.Exec(recordBounceQuery, email, bounce.Kind, bounce.Diagnostic, bounce.Source)
+	if err != nil {
+		return err
+	}
+
+	switch bounce.Kind {
+	case KindHard, KindComplaint:
+		logger.Info.Printf("Suppressing %s after %s bounce: %s", email, bounce.Kind, bounce.Diagnostic)
+		return subscribers.Suppress(db, email, fmt.Sprintf("%s: %s", bounce.Kind, bounce.Diagnostic))
+
+	default:
+		count, err := subscribers.RecordSoftBounce(db, email)
+		if err != nil {
+			return err
+		}
+		if processor.SoftBounceThreshold > 0 && count >= processor.SoftBounceThreshold {
+			logger.Info.Printf("Suppressing %s after %d soft bounces", email, count)
+			return subscribers.Suppress(db, email, fmt.Sprintf("%d soft bounces, last: %s", count, bounce.Diagnostic))
+		}
+	}
+
+	return nil
+}
+
+// CountByKind counts every bounce we've ever been told about, by kind
+func CountByKind(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query(countBouncesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		kind := ""
+		count := 0
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,116 @@
+package bounces
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	suppressQuery   = "UPDATE subscribers SET status = 'suppressed'"
+	softBounceQuery = "UPDATE subscribers SET soft_bounces = soft_bounces + 1"
+)
+
+func TestProcessHardBounce(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, 3)
+
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).
+		WithArgs("a@example.com", KindHard, "550", SourceDSN).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(suppressQuery)).
+		WithArgs("a@example.com", "hard: 550").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, processor.Process(Bounce{Email: "A@example.com", Kind: KindHard, Diagnostic: "550", Source: SourceDSN}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessSoftBounce(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, 3)
+
+	// Under the threshold, we just count it
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(softBounceQuery)).
+		WithArgs("a@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}).AddRow(2))
+	assert.Nil(t, processor.Process(Bounce{Email: "a@example.com", Kind: KindSoft, Source: SourceWebhook}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// At the threshold, we suppress
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(softBounceQuery)).
+		WithArgs("a@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(suppressQuery)).
+		WithArgs("a@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, processor.Process(Bounce{Email: "a@example.com", Kind: KindSoft, Source: SourceWebhook}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessUnknownKind(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, 3)
+
+	assert.NotNil(t, processor.Process(Bounce{Email: "a@example.com", Kind: "squishy"}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessAll(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, 3)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).
+		WithArgs("a@example.com", KindHard, "550", SourceWebhook).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(suppressQuery)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).
+		WithArgs("b@example.com", KindSoft, "", SourceWebhook).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(softBounceQuery)).
+		WithArgs("b@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}).AddRow(1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, processor.ProcessAll([]Bounce{
+		{Email: "a@example.com", Kind: KindHard, Diagnostic: "550", Source: SourceWebhook},
+		{Email: "b@example.com", Kind: KindSoft, Source: SourceWebhook},
+	}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessAllFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, 3)
+
+	// The soft bounce that went through before the one that didn't is thrown away too, so
+	// that it isn't counted again when the provider retries
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(recordBounceQuery)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(softBounceQuery)).
+		WithArgs("a@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}).AddRow(1))
+	mock.ExpectRollback()
+
+	assert.NotNil(t, processor.ProcessAll([]Bounce{
+		{Email: "a@example.com", Kind: KindSoft, Source: SourceWebhook},
+		{Email: "b@example.com", Kind: "squishy", Source: SourceWebhook},
+	}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByKind(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(regexp.QuoteMeta(countBouncesQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"kind", "count"}).AddRow(KindHard, 3).AddRow(KindSoft, 10))
+
+	counts, err := CountByKind(db)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{KindHard: 3, KindSoft: 10}, counts)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,186 @@
+package bounces
+
+// A "Delivery Status Notification" (RFC 3464) is the bounce email you've almost certainly
+// gotten at some point: "Delivery to the following recipient failed permanently". To a
+// human it's a friendly explanation, but underneath that friendly explanation is a
+// "multipart/report" message with a machine readable "message/delivery-status" part that
+// looks something like:
+//
+//     Reporting-MTA: dns; mail.example.com
+//     Arrival-Date: Mon, 3 Apr 2017 10:00:00 -0400
+//
+//     Final-Recipient: rfc822; someone@example.com
+//     Action: failed
+//     Status: 5.1.1
+//     Diagnostic-Code: smtp; 550 5.1.1 User unknown
+//
+// The first block of fields describes the message as a whole and every block after that
+// describes one recipient. Conveniently, each block is formatted just like a set of email
+// headers, so Go's textproto package can do the heavy lifting for us.
+//
+// While we're at it, we'll also accept spam complaints in the Abuse Reporting Format
+// (RFC 5965) which is the same idea, but with a "message/feedback-report" part instead.
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrNotAReport is returned when the message handed to ParseDSN isn't a multipart/report
+var ErrNotAReport = errors.New("Message is not a multipart/report")
+
+// ParseDSN reads a raw RFC 5322 email message and extracts any bounces or complaints
+// reported in it.
+func ParseDSN(r io.Reader) ([]Bounce, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != "multipart/report" {
+		return nil, ErrNotAReport
+	}
+
+	bounces := []Bounce{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status":
+			found, err := parseDeliveryStatus(part)
+			if err != nil {
+				return nil, err
+			}
+			bounces = append(bounces, found...)
+		case "message/feedback-report":
+			found, err := parseFeedbackReport(part)
+			if err != nil {
+				return nil, err
+			}
+			bounces = append(bounces, found...)
+		}
+	}
+
+	return bounces, nil
+}
+
+// readFieldBlocks splits a report body into its blank line separated blocks of fields.
+func readFieldBlocks(r io.Reader) ([]textproto.MIMEHeader, error) {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	blocks := []textproto.MIMEHeader{}
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if len(fields) > 0 {
+			blocks = append(blocks, fields)
+		}
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// stripTypePrefix removes the "type;" prefix used by fields like Final-Recipient
+// ("rfc822; someone@example.com") and Diagnostic-Code ("smtp; 550 User unknown")
+func stripTypePrefix(value string) string {
+	if i := strings.Index(value, ";"); i != -1 {
+		return strings.TrimSpace(value[i+1:])
+	}
+	return strings.TrimSpace(value)
+}
+
+// parseDeliveryStatus turns the per-recipient blocks of a message/delivery-status part
+// into Bounces. Recipients that were actually delivered (or relayed, or expanded) aren't
+// bounces and get skipped.
+func parseDeliveryStatus(r io.Reader) ([]Bounce, error) {
+	blocks, err := readFieldBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounces := []Bounce{}
+	for _, fields := range blocks {
+		recipient := fields.Get("Final-Recipient")
+		if recipient == "" {
+			recipient = fields.Get("Original-Recipient")
+		}
+		if recipient == "" {
+			// Most likely the per-message block
+			continue
+		}
+
+		bounce := Bounce{
+			Email:      stripTypePrefix(recipient),
+			Diagnostic: stripTypePrefix(fields.Get("Diagnostic-Code")),
+			Source:     SourceDSN,
+		}
+		if bounce.Diagnostic == "" {
+			bounce.Diagnostic = fields.Get("Status")
+		}
+
+		// A status code of 5.x.x is permanent, 4.x.x is transient. Occasionally an
+		// MTA will say "failed" with a transient status once it gets tired of retrying,
+		// which we'll give the benefit of the doubt and count as soft. "delayed" only
+		// means it's still trying, and will likely get there in the end (or tell us
+		// again when it gives up), so it isn't a bounce at all.
+		action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+		status := strings.TrimSpace(fields.Get("Status"))
+		switch {
+		case action == "failed" && strings.HasPrefix(status, "4"):
+			bounce.Kind = KindSoft
+		case action == "failed":
+			bounce.Kind = KindHard
+		default:
+			continue
+		}
+		bounces = append(bounces, bounce)
+	}
+
+	return bounces, nil
+}
+
+// parseFeedbackReport turns a message/feedback-report part into a complaint. Plenty of
+// providers redact the original recipient for privacy reasons, in which case there's
+// unfortunately nothing we can do with it.
+func parseFeedbackReport(r io.Reader) ([]Bounce, error) {
+	blocks, err := readFieldBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounces := []Bounce{}
+	for _, fields := range blocks {
+		recipient := fields.Get("Original-Rcpt-To")
+		if recipient == "" {
+			continue
+		}
+		bounces = append(bounces, Bounce{
+			Email:      strings.Trim(strings.TrimSpace(recipient), "<>"),
+			Kind:       KindComplaint,
+			Diagnostic: fields.Get("Feedback-Type"),
+			Source:     SourceDSN,
+		})
+	}
+
+	return bounces, nil
+}
@@ -0,0 +1,41 @@
+package bounces
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseAsset(t *testing.T, name string) ([]Bounce, error) {
+	file, err := os.Open("test_assets/" + name)
+	assert.Nil(t, err)
+	defer file.Close()
+	return ParseDSN(file)
+}
+
+func TestParseDSN(t *testing.T) {
+	bounces, err := parseAsset(t, "bounce.eml")
+	assert.Nil(t, err)
+	assert.Len(t, bounces, 2)
+
+	assert.Equal(t, Bounce{Email: "nobody@example.com", Kind: KindHard, Diagnostic: "550 5.1.1 User unknown", Source: SourceDSN}, bounces[0])
+	assert.Equal(t, Bounce{Email: "full@example.com", Kind: KindSoft, Diagnostic: "452 4.2.2 Mailbox full", Source: SourceDSN}, bounces[1])
+	// slow@example.com's mail was only delayed, which isn't a bounce
+}
+
+func TestParseDSNComplaint(t *testing.T) {
+	bounces, err := parseAsset(t, "complaint.eml")
+	assert.Nil(t, err)
+	assert.Equal(t, []Bounce{{Email: "annoyed@example.net", Kind: KindComplaint, Diagnostic: "abuse", Source: SourceDSN}}, bounces)
+}
+
+func TestParseDSNNotAReport(t *testing.T) {
+	_, err := parseAsset(t, "not_a_report.eml")
+	assert.Equal(t, ErrNotAReport, err)
+}
+
+func TestStripTypePrefix(t *testing.T) {
+	assert.Equal(t, "someone@example.com", stripTypePrefix("rfc822; someone@example.com"))
+	assert.Equal(t, "someone@example.com", stripTypePrefix(" someone@example.com"))
+}
@@ -0,0 +1,72 @@
+package bounces
+
+// Every email provider under the sun has their own idea of what a bounce webhook should
+// look like, and chasing all of them is a losing game. Instead we define one simple, generic,
+// schema and leave it to whoever is setting up the instance to point their provider at it
+// (most providers let you customize the payload, and for the ones that don't a ten line
+// script in between will do). The schema looks like:
+//
+//     {
+//         "events": [
+//             {
+//                 "type": "bounce",
+//                 "email": "someone@example.com",
+//                 "bounce_type": "hard",
+//                 "diagnostic": "550 5.1.1 The email account that you tried to reach does not exist"
+//             },
+//             {
+//                 "type": "complaint",
+//                 "email": "someone.else@example.com"
+//             }
+//         ]
+//     }
+//
+// Where "type" is either "bounce" or "complaint", "bounce_type" (only for bounces) is either
+// "hard" or "soft", and "diagnostic" is optional free text that gets saved along with the bounce.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type webhookEvent struct {
+	Type       string `json:"type"`
+	Email      string `json:"email"`
+	BounceType string `json:"bounce_type"`
+	Diagnostic string `json:"diagnostic"`
+}
+
+type webhookPayload struct {
+	Events []webhookEvent `json:"events"`
+}
+
+// ParseWebhook decodes a webhook payload in our generic schema into Bounces. If any one of
+// the events is invalid the whole payload is rejected, that way the provider knows to retry
+// (or, more likely, somebody notices their configuration is wrong).
+func ParseWebhook(r io.Reader) ([]Bounce, error) {
+	payload := webhookPayload{}
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	bounces := []Bounce{}
+	for i, event := range payload.Events {
+		if event.Email == "" {
+			return nil, fmt.Errorf("Event %d is missing an email", i)
+		}
+
+		bounce := Bounce{Email: event.Email, Diagnostic: event.Diagnostic, Source: SourceWebhook}
+		switch {
+		case event.Type == "complaint":
+			bounce.Kind = KindComplaint
+		case event.Type == "bounce" && (event.BounceType == KindHard || event.BounceType == KindSoft):
+			bounce.Kind = event.BounceType
+		default:
+			return nil, fmt.Errorf("Event %d has an invalid type: '%s' (bounce_type: '%s')", i, event.Type, event.BounceType)
+		}
+		bounces = append(bounces, bounce)
+	}
+
+	return bounces, nil
+}
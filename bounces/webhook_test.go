@@ -0,0 +1,35 @@
+package bounces
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebhook(t *testing.T) {
+	bounces, err := ParseWebhook(strings.NewReader(`{
+		"events": [
+			{"type": "bounce", "email": "a@example.com", "bounce_type": "hard", "diagnostic": "550 no such user"},
+			{"type": "bounce", "email": "b@example.com", "bounce_type": "soft"},
+			{"type": "complaint", "email": "c@example.com"}
+		]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []Bounce{
+		{Email: "a@example.com", Kind: KindHard, Diagnostic: "550 no such user", Source: SourceWebhook},
+		{Email: "b@example.com", Kind: KindSoft, Source: SourceWebhook},
+		{Email: "c@example.com", Kind: KindComplaint, Source: SourceWebhook},
+	}, bounces)
+}
+
+func TestParseWebhookInvalid(t *testing.T) {
+	_, err := ParseWebhook(strings.NewReader(`not json`))
+	assert.NotNil(t, err)
+
+	_, err = ParseWebhook(strings.NewReader(`{"events": [{"type": "bounce", "email": "a@example.com", "bounce_type": "squishy"}]}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseWebhook(strings.NewReader(`{"events": [{"type": "complaint"}]}`))
+	assert.NotNil(t, err)
+}
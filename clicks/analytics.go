@@ -0,0 +1,156 @@
+package clicks
+
+// Click-through rate is the fraction of the people an issue went out to who clicked on
+// something, which is a much more useful number than a raw count of clicks: one enthusiastic
+// reader clicking a link ten times doesn't make it ten times as interesting. So wherever we
+// can tell clicks apart by who made them we count people rather than clicks. Where we can't,
+// because the mailing tool didn't tell us who was clicking, every click counts as somebody
+// different, which overestimates a little but is the best we can do.
+//
+// The number of people an issue went out to is the number of active subscribers we had when
+// it was marked as sent (see newsletter.MarkSent). Issues sent before we started counting
+// don't have one, so they only get counts.
+
+import (
+	"database/sql"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+)
+
+const (
+	recipientsQuery  = "SELECT recipients FROM issues WHERE id = $1"
+	countClicksQuery = "SELECT link_id, subscriber_hash, count(*) FROM clicks WHERE issue_id = $1 " +
+		"GROUP BY link_id, subscriber_hash"
+)
+
+// Stats are the clicks on a link, a section, or a whole issue
+type Stats struct {
+	Clicks int
+
+	// Unique is how many different people clicked, as best we can tell
+	Unique int
+
+	Recipients int
+}
+
+// HasRate is whether we know enough to work out a click-through rate
+func (stats Stats) HasRate() bool {
+	return stats.Recipients > 0
+}
+
+// Rate is the click-through rate, as a percentage
+func (stats Stats) Rate() float64 {
+	if !stats.HasRate() {
+		return 0
+	}
+	return float64(stats.Unique) * 100 / float64(stats.Recipients)
+}
+
+// LinkStats are the clicks on a single link in an issue
+type LinkStats struct {
+	Link links.Link
+	Stats
+}
+
+// SectionStats are the clicks on a section of an issue, along with each of its links
+type SectionStats struct {
+	Name  string
+	Links []LinkStats
+	Stats
+}
+
+// Report is everything we know about the clicks on an issue
+type Report struct {
+	Sections []SectionStats
+	Stats
+}
+
+// clickCount is how many times one subscriber (or any number of people we can't tell apart,
+// when the hash is empty) clicked on a link
+type clickCount struct {
+	linkID int64
+	hash   string
+	clicks int
+}
+
+// tally adds up clicks, keeping track of who made them
+type tally struct {
+	clicks    int
+	anonymous int
+	readers   map[string]bool
+}
+
+func newTally() *tally {
+	return &tally{readers: map[string]bool{}}
+}
+
+func (t *tally) add(count clickCount) {
+	t.clicks += count.clicks
+	if count.hash == "" {
+		t.anonymous += count.clicks
+	} else {
+		t.readers[count.hash] = true
+	}
+}
+
+func (t *tally) stats(recipients int) Stats {
+	return Stats{Clicks: t.clicks, Unique: len(t.readers) + t.anonymous, Recipients: recipients}
+}
+
+// ForIssue reports on the clicks on an issue, section by section and link by link
+func ForIssue(db *sql.DB, issue newsletter.Issue) (Report, error) {
+	recipients := 0
+	if err := db.QueryRow(recipientsQuery, issue.ID).Scan(&recipients); err != nil {
+		return Report{}, err
+	}
+
+	rows, err := db.Query(countClicksQuery, issue.ID)
+	if err != nil {
+		return Report{}, err
+	}
+	defer rows.Close()
+
+	counts := []clickCount{}
+	for rows.Next() {
+		count := clickCount{}
+		if err := rows.Scan(&count.linkID, &count.hash, &count.clicks); err != nil {
+			return Report{}, err
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+
+	return summarize(issue, recipients, counts), nil
+}
+
+// summarize puts together a Report from the clicks on each link. Clicks on links that aren't
+// in the issue anymore (which shouldn't happen once it's been sent) are left out.
+func summarize(issue newsletter.Issue, recipients int, counts []clickCount) Report {
+	byLink := map[int64][]clickCount{}
+	for _, count := range counts {
+		byLink[count.linkID] = append(byLink[count.linkID], count)
+	}
+
+	report := Report{}
+	overall := newTally()
+	for _, section := range issue.Sections {
+		sectionStats := SectionStats{Name: section.Name}
+		sectionTally := newTally()
+		for _, link := range section.Links {
+			linkTally := newTally()
+			for _, count := range byLink[link.ID] {
+				linkTally.add(count)
+				sectionTally.add(count)
+				overall.add(count)
+			}
+			sectionStats.Links = append(sectionStats.Links, LinkStats{link, linkTally.stats(recipients)})
+		}
+		sectionStats.Stats = sectionTally.stats(recipients)
+		report.Sections = append(report.Sections, sectionStats)
+	}
+	report.Stats = overall.stats(recipients)
+	return report
+}
@@ -0,0 +1,67 @@
+package clicks
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/stretchr/testify/assert"
+)
+
+func testIssue() newsletter.Issue {
+	return newsletter.Issue{ID: 9, Sections: []newsletter.Section{
+		{Name: "Engineering", Links: []links.Link{{ID: 1}, {ID: 2}}},
+		{Name: newsletter.OtherSection, Links: []links.Link{{ID: 3}}},
+	}}
+}
+
+func TestSummarize(t *testing.T) {
+	report := summarize(testIssue(), 10, []clickCount{
+		{1, "alice", 3},
+		{1, "bob", 1},
+		{2, "alice", 1},
+		{2, "", 2},
+		{3, "carol", 1},
+		// Somehow not in the issue
+		{4, "dave", 1},
+	})
+
+	assert.Len(t, report.Sections, 2)
+	engineering := report.Sections[0]
+	assert.Equal(t, Stats{Clicks: 4, Unique: 2, Recipients: 10}, engineering.Links[0].Stats)
+	assert.Equal(t, Stats{Clicks: 3, Unique: 3, Recipients: 10}, engineering.Links[1].Stats)
+	// Alice clicked on both links, but she's only one person
+	assert.Equal(t, Stats{Clicks: 7, Unique: 4, Recipients: 10}, engineering.Stats)
+	assert.Equal(t, 40.0, engineering.Rate())
+
+	other := report.Sections[1]
+	assert.Equal(t, int64(3), other.Links[0].Link.ID)
+	assert.Equal(t, Stats{Clicks: 1, Unique: 1, Recipients: 10}, other.Stats)
+
+	assert.Equal(t, Stats{Clicks: 8, Unique: 5, Recipients: 10}, report.Stats)
+}
+
+func TestRateWithoutRecipients(t *testing.T) {
+	stats := Stats{Clicks: 3, Unique: 2}
+	assert.False(t, stats.HasRate())
+	assert.Equal(t, 0.0, stats.Rate())
+}
+
+func TestForIssue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(recipientsQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"recipients"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(countClicksQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"link_id", "subscriber_hash", "count"}).
+			AddRow(1, "alice", 2).
+			AddRow(3, "", 1))
+
+	report, err := ForIssue(db, testIssue())
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Clicks: 3, Unique: 2, Recipients: 4}, report.Stats)
+	assert.Equal(t, 50.0, report.Rate())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
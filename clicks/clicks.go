@@ -0,0 +1,117 @@
+// Package clicks keeps track of which links in an issue readers actually click on.
+package clicks
+
+// Every link in the copy of an issue that editors paste into their mailing tool (see the
+// email view of an issue) goes through us first, as "/r/{token}". The token says which issue
+// and which link were clicked, and we send the reader straight on to the link after making a
+// note of it. The token is signed with our SecretKey, and we only ever redirect to a link
+// that's actually in the issue, so nobody can use us to bounce people off to wherever they
+// like (an "open redirect", which phishers are very fond of).
+//
+// We don't send the newsletter ourselves, so we don't know who any given click came from.
+// Mailing tools can fill in the subscriber's email for us though, as "?s=" on the end of a
+// link, and when they do we keep a hash of it, rather than the address itself, so that we can
+// tell how many different people clicked rather than just how many clicks there were.
+// Subscribers who've asked not to be tracked aren't recorded at all, and an instance can turn
+// tracking off entirely (ClickTracking in the config), in which case the links in issues go
+// straight to where they point.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/subscribers"
+)
+
+// signatureSize is how much of the HMAC we put in a token. 128 bits is plenty to make
+// guessing one hopeless, and keeps the links from getting any longer than they need to be.
+const signatureSize = 16
+
+const (
+	destinationQuery = "SELECT l.url FROM issue_links il JOIN links l ON l.id = il.link_id WHERE il.issue_id = $1 AND il.link_id = $2"
+
+	// Clicks from subscribers who've turned tracking off are simply not inserted
+	recordClickQuery = "INSERT INTO clicks (issue_id, link_id, subscriber_hash) SELECT $1, $2, $3 " +
+		"WHERE NOT EXISTS (SELECT 1 FROM subscribers WHERE email = $4 AND NOT tracking)"
+)
+
+// ErrInvalidToken is returned for a token that we didn't sign
+var ErrInvalidToken = errors.New("That isn't a valid link")
+
+// sign is the HMAC of a message under our secret. The prefix on each message keeps the
+// signatures made for one purpose from being any use for another.
+func sign(secret, message string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)[:signatureSize]
+}
+
+func tokenSignature(secret string, issueID, linkID int64) string {
+	return base64.RawURLEncoding.EncodeToString(sign(secret, fmt.Sprintf("click:%d:%d", issueID, linkID)))
+}
+
+// Token creates the token for a link in an issue, which looks like "9.2a.<signature>". The
+// ids are in base 36, just to keep things short.
+func Token(secret string, issueID, linkID int64) string {
+	return fmt.Sprintf("%s.%s.%s", strconv.FormatInt(issueID, 36), strconv.FormatInt(linkID, 36),
+		tokenSignature(secret, issueID, linkID))
+}
+
+// ParseToken checks a token's signature and returns the issue and link it's for
+func ParseToken(secret, token string) (int64, int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, 0, ErrInvalidToken
+	}
+	issueID, err := strconv.ParseInt(parts[0], 36, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidToken
+	}
+	linkID, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(tokenSignature(secret, issueID, linkID))) {
+		return 0, 0, ErrInvalidToken
+	}
+	return issueID, linkID, nil
+}
+
+// URL is where a link in an issue should point to have its clicks counted
+func URL(urlBase, secret string, issueID, linkID int64) string {
+	return fmt.Sprintf("%s/r/%s", urlBase, Token(secret, issueID, linkID))
+}
+
+// HashSubscriber is what we keep instead of a subscriber's email address. It's keyed with
+// our secret so that it can't be reversed by simply hashing a list of likely addresses.
+func HashSubscriber(secret, email string) string {
+	return hex.EncodeToString(sign(secret, "subscriber:"+subscribers.NormalizeEmail(email)))
+}
+
+// Destination is where a click on a link in an issue should go, or sql.ErrNoRows if the
+// link isn't in the issue
+func Destination(db *sql.DB, issueID, linkID int64) (string, error) {
+	destination := ""
+	err := db.QueryRow(destinationQuery, issueID, linkID).Scan(&destination)
+	return destination, err
+}
+
+// Record makes a note of a click on a link in an issue. email is who clicked it, as far as
+// the link tells us, and may well be empty.
+func Record(db *sql.DB, secret string, issueID, linkID int64, email string) error {
+	email = subscribers.NormalizeEmail(email)
+	hash := ""
+	if email != "" {
+		hash = HashSubscriber(secret, email)
+	}
+	_, err := db.Exec(recordClickQuery, issueID, linkID, hash, email)
+	return err
+}
@@ -0,0 +1,84 @@
+package clicks
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "secret123"
+
+func TestToken(t *testing.T) {
+	token := Token(testSecret, 9, 42)
+	assert.True(t, strings.HasPrefix(token, "9.16."))
+
+	issueID, linkID, err := ParseToken(testSecret, token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), issueID)
+	assert.Equal(t, int64(42), linkID)
+
+	assert.Equal(t, "https://linkletter.example.com/r/"+token, URL("https://linkletter.example.com", testSecret, 9, 42))
+}
+
+func TestParseTokenInvalid(t *testing.T) {
+	token := Token(testSecret, 9, 42)
+	signature := token[strings.LastIndex(token, ".")+1:]
+
+	for _, invalid := range []string{
+		"",
+		"9.16",
+		"9.16." + signature + ".extra",
+		// Somebody else's link can't be had by changing the ids
+		"9.17." + signature,
+		"x!.16." + signature,
+		// Or by signing it with some other secret
+		Token("guessed", 9, 42),
+	} {
+		_, _, err := ParseToken(testSecret, invalid)
+		assert.Equal(t, ErrInvalidToken, err, invalid)
+	}
+}
+
+func TestHashSubscriber(t *testing.T) {
+	hash := HashSubscriber(testSecret, "someone@example.com")
+	assert.Len(t, hash, signatureSize*2)
+	assert.Equal(t, hash, HashSubscriber(testSecret, " Someone@Example.com"))
+	assert.NotEqual(t, hash, HashSubscriber("other", "someone@example.com"))
+	assert.False(t, strings.Contains(hash, "someone"))
+}
+
+func TestDestination(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(destinationQuery)).WithArgs(9, 42).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}).AddRow("https://example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta(destinationQuery)).WithArgs(9, 43).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}))
+
+	destination, err := Destination(db, 9, 42)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", destination)
+
+	_, err = Destination(db, 9, 43)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRecord(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(recordClickQuery)).
+		WithArgs(9, 42, HashSubscriber(testSecret, "someone@example.com"), "someone@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(recordClickQuery)).
+		WithArgs(9, 42, "", "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	assert.Nil(t, Record(db, testSecret, 9, 42, "Someone@Example.com"))
+	assert.Nil(t, Record(db, testSecret, 9, 42, ""))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
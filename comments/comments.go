@@ -0,0 +1,273 @@
+// Package comments handles the discussion people have about the links they share.
+package comments
+
+// Comments are threaded, every comment can either be about the link itself or a reply to
+// another comment. They're written in Markdown, which gets rendered by our own markdown
+// package so that nobody can slip a <script> tag into a comment.
+//
+// Deleting a comment doesn't actually delete it. If we did, every reply to it would lose
+// its place in the thread (or, thanks to the ON DELETE CASCADE, vanish along with it). So
+// instead we throw away what it said and leave a "[deleted]" in its place. Editors can also
+// hide comments, which is the same idea except that it can be undone and editors can still
+// see what was said.
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/markdown"
+	"github.com/cj-dimaggio/LinkLetter/users"
+)
+
+// MaxLength is the most a single comment is allowed to say
+const MaxLength = 10000
+
+// maxIndent is how deep a thread gets indented before we stop indenting it any further,
+// otherwise a long enough back and forth would end up as a column one word wide.
+const maxIndent = 8
+
+const (
+	selectComments = "SELECT c.id, c.link_id, COALESCE(c.parent_id, 0), c.author_id, u.email, c.body, c.deleted, c.hidden, c.created_at, c.updated_at " +
+		"FROM comments c JOIN users u ON u.id = c.author_id"
+
+	getCommentQuery      = selectComments + " WHERE c.id = $1"
+	listForLinkQuery     = selectComments + " WHERE c.link_id = $1 ORDER BY c.created_at, c.id"
+	topForIssueQuery     = selectComments + " JOIN links l ON l.top_comment_id = c.id JOIN issue_links il ON il.link_id = l.id WHERE il.issue_id = $1 AND NOT c.deleted AND NOT c.hidden"
+	createCommentQuery   = "INSERT INTO comments (link_id, parent_id, author_id, body) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at"
+	updateCommentQuery   = "UPDATE comments SET body = $2, updated_at = now() WHERE id = $1 AND NOT deleted"
+	deleteCommentQuery   = "UPDATE comments SET body = '', deleted = true, updated_at = now() WHERE id = $1"
+	setHiddenQuery       = "UPDATE comments SET hidden = $2 WHERE id = $1"
+	setTopCommentQuery   = "UPDATE links SET top_comment_id = $2 WHERE id = $1"
+	clearTopCommentQuery = "UPDATE links SET top_comment_id = NULL WHERE id = $1 AND top_comment_id = $2"
+)
+
+// ErrEmpty is returned when trying to save a comment that doesn't say anything
+var ErrEmpty = errors.New("Comments can't be empty")
+
+// ErrTooLong is returned when trying to save a comment longer than MaxLength
+var ErrTooLong = errors.New("Comments can't be longer than 10000 characters")
+
+// ErrInvalidParent is returned when replying to a comment on a different link
+var ErrInvalidParent = errors.New("Replies must be to a comment on the same link")
+
+// Comment is a single comment on a link
+type Comment struct {
+	ID          int64
+	LinkID      int64
+	ParentID    int64
+	AuthorID    int64
+	AuthorEmail string
+	Body        string
+	Deleted     bool
+	Hidden      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// Depth is how many replies deep the comment is in its thread. It's only filled in by
+	// Thread.
+	Depth int
+}
+
+// HTML renders the comment's Markdown
+func (comment Comment) HTML() template.HTML {
+	return markdown.Render(comment.Body)
+}
+
+// Edited determines whether the comment has been changed since it was first written
+func (comment Comment) Edited() bool {
+	return comment.UpdatedAt.After(comment.CreatedAt)
+}
+
+// Indent is the comment's depth, capped at however far we're willing to indent a thread
+func (comment Comment) Indent() int {
+	if comment.Depth > maxIndent {
+		return maxIndent
+	}
+	return comment.Depth
+}
+
+// CanEdit determines whether a user is allowed to change what the comment says. Only the
+// author can put words in their own mouth.
+func (comment Comment) CanEdit(user users.User) bool {
+	return !comment.Deleted && comment.AuthorID == user.ID
+}
+
+// CanDelete determines whether a user is allowed to delete the comment, which both the
+// author and editors are.
+func (comment Comment) CanDelete(user users.User) bool {
+	return !comment.Deleted && (comment.AuthorID == user.ID || user.IsEditor())
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanComment(row scanner) (Comment, error) {
+	comment := Comment{}
+	err := row.Scan(&comment.ID, &comment.LinkID, &comment.ParentID, &comment.AuthorID, &comment.AuthorEmail,
+		&comment.Body, &comment.Deleted, &comment.Hidden, &comment.CreatedAt, &comment.UpdatedAt)
+	return comment, err
+}
+
+func scanComments(rows *sql.Rows) ([]Comment, error) {
+	defer rows.Close()
+
+	found := []Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, comment)
+	}
+	return found, rows.Err()
+}
+
+// cleanBody trims a comment and makes sure it's something we're willing to save
+func cleanBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", ErrEmpty
+	}
+	if len(body) > MaxLength {
+		return "", ErrTooLong
+	}
+	return body, nil
+}
+
+// Create saves a new comment. A parentID of 0 means the comment is about the link itself
+// rather than a reply to another comment.
+func Create(db *sql.DB, linkID, parentID, authorID int64, body string) (Comment, error) {
+	body, err := cleanBody(body)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	parent := sql.NullInt64{}
+	if parentID != 0 {
+		existing, err := Get(db, parentID)
+		if err == sql.ErrNoRows || (err == nil && existing.LinkID != linkID) {
+			return Comment{}, ErrInvalidParent
+		}
+		if err != nil {
+			return Comment{}, err
+		}
+		parent = sql.NullInt64{Int64: parentID, Valid: true}
+	}
+
+	comment := Comment{LinkID: linkID, ParentID: parentID, AuthorID: authorID, Body: body}
+	err = db.QueryRow(createCommentQuery, linkID, parent, authorID, body).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+	return comment, err
+}
+
+// Get retrieves a single comment
+func Get(db *sql.DB, id int64) (Comment, error) {
+	return scanComment(db.QueryRow(getCommentQuery, id))
+}
+
+// ListForLink retrieves every comment on a link, oldest first. Use Thread to put them into
+// their threads.
+func ListForLink(db *sql.DB, linkID int64) ([]Comment, error) {
+	rows, err := db.Query(listForLinkQuery, linkID)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+// TopForIssue retrieves the top comment of each link in an issue, keyed by the link's id.
+// Links without a top comment, or whose top comment has since been deleted or hidden, are
+// left out.
+func TopForIssue(db *sql.DB, issueID int64) (map[int64]*Comment, error) {
+	rows, err := db.Query(topForIssueQuery, issueID)
+	if err != nil {
+		return nil, err
+	}
+	found, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	top := map[int64]*Comment{}
+	for i := range found {
+		top[found[i].LinkID] = &found[i]
+	}
+	return top, nil
+}
+
+// Update changes what a comment says
+func Update(db *sql.DB, id int64, body string) error {
+	body, err := cleanBody(body)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(updateCommentQuery, id, body)
+	return err
+}
+
+// Delete blanks out a comment, leaving its replies where they are
+func Delete(db *sql.DB, id int64) error {
+	_, err := db.Exec(deleteCommentQuery, id)
+	return err
+}
+
+// SetHidden hides, or unhides, a comment from everybody but editors
+func SetHidden(db *sql.DB, id int64, hidden bool) error {
+	_, err := db.Exec(setHiddenQuery, id, hidden)
+	return err
+}
+
+// SetTopComment picks the comment to pull into the link's newsletter entry as a quote. A
+// commentID of 0 means the link doesn't get one.
+func SetTopComment(db *sql.DB, linkID, commentID int64) error {
+	top := sql.NullInt64{Int64: commentID, Valid: commentID != 0}
+	_, err := db.Exec(setTopCommentQuery, linkID, top)
+	return err
+}
+
+// ClearTopComment takes a comment back from being the link's top comment. If some other
+// comment has been picked since, that one stays where it is.
+func ClearTopComment(db *sql.DB, linkID, commentID int64) error {
+	_, err := db.Exec(clearTopCommentQuery, linkID, commentID)
+	return err
+}
+
+// Thread puts a link's comments in the order they should be displayed, each comment
+// followed by its replies (and their replies, and so on), with every comment's Depth filled
+// in. Comments are expected to be oldest first, which is how ListForLink returns them.
+//
+// We flatten the thread out rather than building a tree because html/template can't keep
+// track of who's looking at the page while it recurses through a tree, and the template
+// needs to know that to decide which comments get edit and delete buttons. An indent does
+// the job just as well.
+func Thread(flat []Comment) []Comment {
+	known := map[int64]bool{}
+	for _, comment := range flat {
+		known[comment.ID] = true
+	}
+
+	replies := map[int64][]Comment{}
+	for _, comment := range flat {
+		parent := comment.ParentID
+		if !known[parent] {
+			parent = 0
+		}
+		replies[parent] = append(replies[parent], comment)
+	}
+
+	threaded := []Comment{}
+	var walk func(parent int64, depth int)
+	walk = func(parent int64, depth int) {
+		for _, comment := range replies[parent] {
+			comment.Depth = depth
+			threaded = append(threaded, comment)
+			walk(comment.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+
+	return threaded
+}
@@ -0,0 +1,166 @@
+package comments
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/stretchr/testify/assert"
+)
+
+var commentColumns = []string{"id", "link_id", "parent_id", "author_id", "email", "body", "deleted", "hidden", "created_at", "updated_at"}
+
+func TestCreate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(createCommentQuery)).
+		WithArgs(5, nil, 3, "Great read").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(1, now, now))
+
+	comment, err := Create(db, 5, 0, 3, "  Great read\n")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), comment.ID)
+	assert.Equal(t, "Great read", comment.Body)
+	assert.False(t, comment.Edited())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateReply(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getCommentQuery)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(1, 5, 0, 3, "a@example.com", "Great read", false, false, now, now))
+	mock.ExpectQuery(regexp.QuoteMeta(createCommentQuery)).
+		WithArgs(5, 1, 4, "Agreed").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(2, now, now))
+
+	comment, err := Create(db, 5, 1, 4, "Agreed")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), comment.ParentID)
+
+	// Replying to a comment on some other link isn't allowed
+	mock.ExpectQuery(regexp.QuoteMeta(getCommentQuery)).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(1, 5, 0, 3, "a@example.com", "Great read", false, false, now, now))
+	_, err = Create(db, 6, 1, 4, "Agreed")
+	assert.Equal(t, ErrInvalidParent, err)
+
+	// And neither is replying to one that doesn't exist
+	mock.ExpectQuery(regexp.QuoteMeta(getCommentQuery)).WithArgs(9).WillReturnError(sql.ErrNoRows)
+	_, err = Create(db, 5, 9, 4, "Agreed")
+	assert.Equal(t, ErrInvalidParent, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateInvalid(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	_, err := Create(db, 5, 0, 3, " \n ")
+	assert.Equal(t, ErrEmpty, err)
+
+	_, err = Create(db, 5, 0, 3, strings.Repeat("a", MaxLength+1))
+	assert.Equal(t, ErrTooLong, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(updateCommentQuery)).WithArgs(1, "Changed my mind").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Update(db, 1, "Changed my mind"))
+	assert.Equal(t, ErrEmpty, Update(db, 1, ""))
+
+	mock.ExpectExec(regexp.QuoteMeta(deleteCommentQuery)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Delete(db, 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestModeration(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(setHiddenQuery)).WithArgs(1, true).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, SetHidden(db, 1, true))
+
+	mock.ExpectExec(regexp.QuoteMeta(setTopCommentQuery)).WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, SetTopComment(db, 5, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(setTopCommentQuery)).WithArgs(5, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, SetTopComment(db, 5, 0))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestClearTopComment(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(clearTopCommentQuery)).WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Nil(t, ClearTopComment(db, 5, 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTopForIssue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(topForIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow(1, 5, 0, 3, "a@example.com", "Great read", false, false, now, now).
+			AddRow(4, 6, 2, 3, "a@example.com", "Meh", false, false, now, now))
+
+	top, err := TopForIssue(db, 9)
+	assert.Nil(t, err)
+	assert.Len(t, top, 2)
+	assert.Equal(t, "Great read", top[5].Body)
+	assert.Equal(t, "Meh", top[6].Body)
+	assert.Nil(t, top[7])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestThread(t *testing.T) {
+	flat := []Comment{
+		{ID: 1},
+		{ID: 2},
+		{ID: 3, ParentID: 1},
+		{ID: 4, ParentID: 3},
+		{ID: 5, ParentID: 1},
+		{ID: 6, ParentID: 2},
+		// A reply to a comment we don't know about shouldn't disappear
+		{ID: 7, ParentID: 100},
+	}
+
+	ids, depths := []int64{}, []int{}
+	for _, comment := range Thread(flat) {
+		ids = append(ids, comment.ID)
+		depths = append(depths, comment.Depth)
+	}
+	assert.Equal(t, []int64{1, 3, 4, 5, 2, 6, 7}, ids)
+	assert.Equal(t, []int{0, 1, 2, 1, 0, 1, 0}, depths)
+}
+
+func TestPermissions(t *testing.T) {
+	author := users.User{ID: 1, Role: users.RoleMember}
+	someone := users.User{ID: 2, Role: users.RoleMember}
+	editor := users.User{ID: 3, Role: users.RoleEditor}
+
+	comment := Comment{AuthorID: 1}
+	assert.True(t, comment.CanEdit(author))
+	assert.False(t, comment.CanEdit(someone))
+	assert.False(t, comment.CanEdit(editor))
+
+	assert.True(t, comment.CanDelete(author))
+	assert.False(t, comment.CanDelete(someone))
+	assert.True(t, comment.CanDelete(editor))
+
+	comment.Deleted = true
+	assert.False(t, comment.CanEdit(author))
+	assert.False(t, comment.CanDelete(editor))
+}
+
+func TestIndent(t *testing.T) {
+	assert.Equal(t, 2, Comment{Depth: 2}.Indent())
+	assert.Equal(t, maxIndent, Comment{Depth: 30}.Indent())
+}
@@ -37,6 +37,52 @@ type Config struct {
 	AuthorizationPattern string
 	GoogleClientID       string
 	GoogleClientSecret   string
+	Workers              int
+	BounceWebhookToken   string
+	SoftBounceThreshold  int
+	Editors              string
+	Admins               string
+	AllowDownvotes       bool
+	InboundAddress       string
+	InboundWebhookToken  string
+	InboundSMTPPort      int
+	SMTPHost             string
+	SMTPPort             int
+	SMTPUsername         string
+	SMTPPassword         string
+	MailFrom             string
+	SlackSigningSecret   string
+	SlackBotToken        string
+	SlackWebhookURL      string
+	SlackPopularVotes    int
+	LinkCheckDays        int
+	Snapshots            bool
+	ClickTracking        bool
+	OpenTracking         bool
+	LogFormat            string
+	LogLevel             string
+	AccessLogFormat      string
+	MetricsToken         string
+	MetricsAddress       string
+	ReadTimeout          int
+	WriteTimeout         int
+	IdleTimeout          int
+	ShutdownTimeout      int
+	TLSCert              string
+	TLSKey               string
+	HTTPPort             int
+	ACMEDomains          string
+	ACMEEmail            string
+	ACMEDirectory        string
+	ACMECA               string
+	ACMECacheDir         string
+	RateLimitLogin       int
+	RateLimitSubmit      int
+	RateLimitAPI         int
+	RateLimitStore       string
+	BehindProxy          bool
+	TemplateReload       bool
+	InstanceName         string
 }
 
 // GetEnvStringDefault wraps os.Getenv to get an environment variable as a
@@ -59,6 +105,25 @@ func GetEnvIntDefault(env string, defaultInt int) int {
 	return i
 }
 
+// GetEnvBoolDefault gets an environment variable as a bool (anything
+// strconv.ParseBool understands, such as "true" or "1") and supports a
+// default option.
+func GetEnvBoolDefault(env string, defaultBool bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(env))
+	if err != nil {
+		b = defaultBool
+	}
+	return b
+}
+
+// onHeroku is whether we're running on a Heroku dyno, which always have DYNO set. On Heroku
+// every request comes to us through their router, so everything that cares where a request
+// came from (the rate limits, mostly) has to take X-Forwarded-For's word for it, or everybody
+// would look like they were coming from the router, and share its limits.
+func onHeroku() bool {
+	return os.Getenv("DYNO") != ""
+}
+
 // ParseForConfig grabs required information from the program args
 // and environment variables and creates a Config object. Program
 // arguments take precedence over environment variables.
@@ -92,6 +157,52 @@ func ParseForConfig() Config {
 		AuthorizationPattern: GetEnvStringDefault("LINKLETTER_AUTHORIZATIONPATTERN", "localprojects\\.(com|net)"),
 		GoogleClientID:       GetEnvStringDefault("LINKLETTER_GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret:   GetEnvStringDefault("LINKLETTER_GOOGLE_CLIENT_SECRET", ""),
+		Workers:              GetEnvIntDefault("LINKLETTER_WORKERS", 2),
+		BounceWebhookToken:   GetEnvStringDefault("LINKLETTER_BOUNCE_WEBHOOK_TOKEN", ""),
+		SoftBounceThreshold:  GetEnvIntDefault("LINKLETTER_SOFT_BOUNCE_THRESHOLD", 3),
+		Editors:              GetEnvStringDefault("LINKLETTER_EDITORS", ""),
+		Admins:               GetEnvStringDefault("LINKLETTER_ADMINS", ""),
+		AllowDownvotes:       GetEnvBoolDefault("LINKLETTER_ALLOW_DOWNVOTES", false),
+		InboundAddress:       GetEnvStringDefault("LINKLETTER_INBOUND_ADDRESS", ""),
+		InboundWebhookToken:  GetEnvStringDefault("LINKLETTER_INBOUND_WEBHOOK_TOKEN", ""),
+		InboundSMTPPort:      GetEnvIntDefault("LINKLETTER_INBOUND_SMTP_PORT", 0),
+		SMTPHost:             GetEnvStringDefault("LINKLETTER_SMTP_HOST", ""),
+		SMTPPort:             GetEnvIntDefault("LINKLETTER_SMTP_PORT", 587),
+		SMTPUsername:         GetEnvStringDefault("LINKLETTER_SMTP_USERNAME", ""),
+		SMTPPassword:         GetEnvStringDefault("LINKLETTER_SMTP_PASSWORD", ""),
+		MailFrom:             GetEnvStringDefault("LINKLETTER_MAIL_FROM", "LinkLetter <links@localhost>"),
+		SlackSigningSecret:   GetEnvStringDefault("LINKLETTER_SLACK_SIGNING_SECRET", ""),
+		SlackBotToken:        GetEnvStringDefault("LINKLETTER_SLACK_BOT_TOKEN", ""),
+		SlackWebhookURL:      GetEnvStringDefault("LINKLETTER_SLACK_WEBHOOK_URL", ""),
+		SlackPopularVotes:    GetEnvIntDefault("LINKLETTER_SLACK_POPULAR_VOTES", 5),
+		LinkCheckDays:        GetEnvIntDefault("LINKLETTER_LINK_CHECK_DAYS", 7),
+		Snapshots:            GetEnvBoolDefault("LINKLETTER_SNAPSHOTS", false),
+		ClickTracking:        GetEnvBoolDefault("LINKLETTER_CLICK_TRACKING", true),
+		OpenTracking:         GetEnvBoolDefault("LINKLETTER_OPEN_TRACKING", false),
+		LogFormat:            GetEnvStringDefault("LINKLETTER_LOG_FORMAT", "text"),
+		LogLevel:             GetEnvStringDefault("LINKLETTER_LOG_LEVEL", "debug"),
+		AccessLogFormat:      GetEnvStringDefault("LINKLETTER_ACCESS_LOG_FORMAT", "combined"),
+		MetricsToken:         GetEnvStringDefault("LINKLETTER_METRICS_TOKEN", ""),
+		MetricsAddress:       GetEnvStringDefault("LINKLETTER_METRICS_ADDRESS", ""),
+		ReadTimeout:          GetEnvIntDefault("LINKLETTER_READ_TIMEOUT", 30),
+		WriteTimeout:         GetEnvIntDefault("LINKLETTER_WRITE_TIMEOUT", 60),
+		IdleTimeout:          GetEnvIntDefault("LINKLETTER_IDLE_TIMEOUT", 120),
+		ShutdownTimeout:      GetEnvIntDefault("LINKLETTER_SHUTDOWN_TIMEOUT", 25),
+		TLSCert:              GetEnvStringDefault("LINKLETTER_TLS_CERT", ""),
+		TLSKey:               GetEnvStringDefault("LINKLETTER_TLS_KEY", ""),
+		HTTPPort:             GetEnvIntDefault("LINKLETTER_HTTP_PORT", 0),
+		ACMEDomains:          GetEnvStringDefault("LINKLETTER_ACME_DOMAINS", ""),
+		ACMEEmail:            GetEnvStringDefault("LINKLETTER_ACME_EMAIL", ""),
+		ACMEDirectory:        GetEnvStringDefault("LINKLETTER_ACME_DIRECTORY", "https://acme-v02.api.letsencrypt.org/directory"),
+		ACMECA:               GetEnvStringDefault("LINKLETTER_ACME_CA", ""),
+		ACMECacheDir:         GetEnvStringDefault("LINKLETTER_ACME_CACHE_DIR", "certs"),
+		RateLimitLogin:       GetEnvIntDefault("LINKLETTER_RATE_LIMIT_LOGIN", 10),
+		RateLimitSubmit:      GetEnvIntDefault("LINKLETTER_RATE_LIMIT_SUBMIT", 30),
+		RateLimitAPI:         GetEnvIntDefault("LINKLETTER_RATE_LIMIT_API", 120),
+		RateLimitStore:       GetEnvStringDefault("LINKLETTER_RATE_LIMIT_STORE", "memory"),
+		BehindProxy:          GetEnvBoolDefault("LINKLETTER_BEHIND_PROXY", onHeroku()),
+		TemplateReload:       GetEnvBoolDefault("LINKLETTER_TEMPLATE_RELOAD", false),
+		InstanceName:         GetEnvStringDefault("LINKLETTER_INSTANCE_NAME", "LinkLetter"),
 	}
 
 	flag.IntVar(&conf.WebPort, "webPort", conf.WebPort, "The port to run the web application on")
@@ -106,6 +217,53 @@ func ParseForConfig() Config {
 	flag.StringVar(&conf.AuthorizationPattern, "authorizationPattern", conf.AuthorizationPattern, "The regex pattern to match against hosted domains for authorization")
 	flag.StringVar(&conf.GoogleClientID, "googleClientID", conf.GoogleClientID, "Google OAuth2 client ID")
 	flag.StringVar(&conf.GoogleClientSecret, "googleClientSecret", conf.GoogleClientSecret, "Google OAuth2 client secret")
+	flag.IntVar(&conf.Workers, "workers", conf.Workers, "The number of background job workers to run (0 disables them for the web process)")
+	flag.StringVar(&conf.BounceWebhookToken, "bounceWebhookToken", conf.BounceWebhookToken, "Secret token required to post to the bounce webhook (the webhook is disabled if empty)")
+	flag.IntVar(&conf.SoftBounceThreshold, "softBounceThreshold", conf.SoftBounceThreshold, "The number of soft bounces after which a subscriber is suppressed")
+	flag.StringVar(&conf.Editors, "editors", conf.Editors, "Comma separated list of emails of users who should be editors")
+	flag.StringVar(&conf.Admins, "admins", conf.Admins, "Comma separated list of emails of users who should be admins")
+	flag.BoolVar(&conf.AllowDownvotes, "allowDownvotes", conf.AllowDownvotes, "Whether or not members can downvote links")
+	flag.StringVar(&conf.InboundAddress, "inboundAddress", conf.InboundAddress, "The address people email links to, such as links@example.com (sharing by email is disabled if empty)")
+	flag.StringVar(&conf.InboundWebhookToken, "inboundWebhookToken", conf.InboundWebhookToken, "Secret token required to post raw emails to the inbound webhook (the webhook is disabled if empty)")
+	flag.IntVar(&conf.InboundSMTPPort, "inboundSMTPPort", conf.InboundSMTPPort, "The port to receive inbound email over SMTP on (0 disables the SMTP server)")
+	flag.StringVar(&conf.SMTPHost, "smtpHost", conf.SMTPHost, "The SMTP relay to send email through (sending email is disabled if empty)")
+	flag.IntVar(&conf.SMTPPort, "smtpPort", conf.SMTPPort, "The port of the SMTP relay")
+	flag.StringVar(&conf.SMTPUsername, "smtpUsername", conf.SMTPUsername, "The username to log in to the SMTP relay with, if it needs one")
+	flag.StringVar(&conf.SMTPPassword, "smtpPassword", conf.SMTPPassword, "The password to log in to the SMTP relay with")
+	flag.StringVar(&conf.MailFrom, "mailFrom", conf.MailFrom, "Who the emails we send are from")
+	flag.StringVar(&conf.SlackSigningSecret, "slackSigningSecret", conf.SlackSigningSecret, "The signing secret of the Slack app, used to verify slash commands (the slash command is disabled if empty)")
+	flag.StringVar(&conf.SlackBotToken, "slackBotToken", conf.SlackBotToken, "Slack bot token with the users:read.email scope, used to find out who used a slash command")
+	flag.StringVar(&conf.SlackWebhookURL, "slackWebhookURL", conf.SlackWebhookURL, "Slack incoming webhook URL to announce new issues and popular links to (disabled if empty)")
+	flag.IntVar(&conf.SlackPopularVotes, "slackPopularVotes", conf.SlackPopularVotes, "The score at which a link is announced to Slack as popular")
+	flag.IntVar(&conf.LinkCheckDays, "linkCheckDays", conf.LinkCheckDays, "How many days apart links in sent issues are checked for having gone dead (0 disables checking)")
+	flag.BoolVar(&conf.Snapshots, "snapshots", conf.Snapshots, "Whether or not to save the readable text of every newly shared link, for when it goes dead")
+	flag.BoolVar(&conf.ClickTracking, "clickTracking", conf.ClickTracking, "Whether or not to count clicks on the links in issues, by sending them through a redirect")
+	flag.BoolVar(&conf.OpenTracking, "openTracking", conf.OpenTracking, "Whether or not to count opens of issues, with a tracking image")
+	flag.StringVar(&conf.LogFormat, "logFormat", conf.LogFormat, "How logs are written: \"text\" for people or \"json\" for log pipelines")
+	flag.StringVar(&conf.LogLevel, "logLevel", conf.LogLevel, "The lowest level of log to keep: debug, info, warning or error")
+	flag.StringVar(&conf.AccessLogFormat, "accessLogFormat", conf.AccessLogFormat, "How a line is written for each request: \"combined\" (the Combined Log Format) or \"json\"")
+	flag.StringVar(&conf.MetricsToken, "metricsToken", conf.MetricsToken, "Bearer token Prometheus has to send to scrape /metrics")
+	flag.StringVar(&conf.MetricsAddress, "metricsAddress", conf.MetricsAddress, "Address to serve /metrics on by itself, such as 127.0.0.1:9100, rather than alongside the app (/metrics is disabled if this and metricsToken are both empty)")
+
+	flag.IntVar(&conf.ReadTimeout, "readTimeout", conf.ReadTimeout, "Seconds a client gets to send us the whole of a request")
+	flag.IntVar(&conf.WriteTimeout, "writeTimeout", conf.WriteTimeout, "Seconds we get to send back the whole of a response")
+	flag.IntVar(&conf.IdleTimeout, "idleTimeout", conf.IdleTimeout, "Seconds a kept-alive connection can sit waiting for its next request")
+	flag.IntVar(&conf.ShutdownTimeout, "shutdownTimeout", conf.ShutdownTimeout, "Seconds requests that are under way get to finish once we're told to stop (Heroku waits 30 before killing us)")
+	flag.StringVar(&conf.TLSCert, "tlsCert", conf.TLSCert, "PEM certificate (chain) file to serve HTTPS with, along with tlsKey")
+	flag.StringVar(&conf.TLSKey, "tlsKey", conf.TLSKey, "PEM private key file for tlsCert")
+	flag.IntVar(&conf.HTTPPort, "httpPort", conf.HTTPPort, "When serving HTTPS, a port to redirect plain HTTP from, and answer ACME challenges on (80 if it isn't set and acmeDomains is)")
+	flag.StringVar(&conf.ACMEDomains, "acmeDomains", conf.ACMEDomains, "Comma separated domains to get an HTTPS certificate for over ACME, from Let's Encrypt unless acmeDirectory says otherwise")
+	flag.StringVar(&conf.ACMEEmail, "acmeEmail", conf.ACMEEmail, "Email address the certificate authority can write to about our certificates")
+	flag.StringVar(&conf.ACMEDirectory, "acmeDirectory", conf.ACMEDirectory, "Directory URL of the ACME server to get certificates from")
+	flag.StringVar(&conf.ACMECA, "acmeCA", conf.ACMECA, "PEM file of the root to trust for the ACME server itself, for a local test CA like Pebble")
+	flag.StringVar(&conf.ACMECacheDir, "acmeCacheDir", conf.ACMECacheDir, "Directory to keep our ACME account key and certificates in")
+	flag.IntVar(&conf.RateLimitLogin, "rateLimitLogin", conf.RateLimitLogin, "Requests a minute each IP address can make to /login (0 disables the limit)")
+	flag.IntVar(&conf.RateLimitSubmit, "rateLimitSubmit", conf.RateLimitSubmit, "Links, comments and votes a minute each user can post (0 disables the limit)")
+	flag.IntVar(&conf.RateLimitAPI, "rateLimitAPI", conf.RateLimitAPI, "Requests a minute each user or IP address can make to /api (0 disables the limit)")
+	flag.StringVar(&conf.RateLimitStore, "rateLimitStore", conf.RateLimitStore, "Where rate limits are kept: \"memory\" for a single process, or \"postgres\" to share them between every web process")
+	flag.BoolVar(&conf.BehindProxy, "behindProxy", conf.BehindProxy, "Whether we're behind a proxy (like Heroku's router) that we can trust X-Forwarded-For from. Defaults to true on Heroku")
+	flag.BoolVar(&conf.TemplateReload, "templateReload", conf.TemplateReload, "Whether to parse templates again whenever they change, and show errors in them in the browser (for development only)")
+	flag.StringVar(&conf.InstanceName, "instanceName", conf.InstanceName, "What this LinkLetter is called, in page titles and when it's added to a home screen")
 
 	flag.Parse()
 	return conf
@@ -23,6 +23,27 @@ func TestGetEnvIntDefault(t *testing.T) {
 	assert.Equal(t, 5, GetEnvIntDefault("MAKEBELIEVEENV1234", 5))
 }
 
+func TestGetEnvBoolDefault(t *testing.T) {
+	os.Setenv("TESTENV", "true")
+
+	assert.Equal(t, true, GetEnvBoolDefault("TESTENV", false))
+
+	os.Setenv("TESTENV", "notabool")
+
+	assert.Equal(t, false, GetEnvBoolDefault("TESTENV", false))
+
+	assert.Equal(t, true, GetEnvBoolDefault("MAKEBELIEVEENV1234", true))
+}
+
+func TestOnHeroku(t *testing.T) {
+	os.Unsetenv("DYNO")
+	assert.False(t, onHeroku())
+
+	os.Setenv("DYNO", "web.1")
+	defer os.Unsetenv("DYNO")
+	assert.True(t, onHeroku())
+}
+
 func TestParseForConfig(t *testing.T) {
 	os.Setenv("PORT", "7000")
 	os.Setenv("LINKLETTER_SQLHOST", "testhost")
@@ -17,6 +17,7 @@ package database
 // this.
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
@@ -50,8 +51,17 @@ const (
 	createFirstEntryQuery     = "INSERT INTO _migrations_ VALUES ('')"
 	getCurrentMigrationQuery  = "SELECT version FROM _migrations_ LIMIT 1"
 	updateMigrationQuery      = "UPDATE _migrations_ SET version=$1"
+	lockMigrationsQuery       = "SELECT pg_advisory_xact_lock(hashtext('_migrations_'))"
 )
 
+// queryer is what *sql.DB and *sql.Tx have in common, so that the functions that look at the
+// migration table can be used from inside DoMigrations' transaction as well as outside of it
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func getSplitToken(content string) string {
 	// Here's a little trick we'll try. We'll default to just splitting by the semi colon if we don't find
 	// instances of the full split token in the file so that people can get simple statements (which should
@@ -144,12 +154,21 @@ func (array byMigrationIndex) Less(i, j int) bool {
 // the convention "num_desc.sql" and orders them in numerically ascending
 // order.
 func getMigrationsInOrder() []string {
-	migrations := []string{}
-	files, err := ioutil.ReadDir("migrations")
+	migrations, err := listMigrations()
 	if err != nil {
 		logger.Error.Printf("Error occured getting list of database migrations")
 		panic(err)
 	}
+	return migrations
+}
+
+// listMigrations is getMigrationsInOrder without the panic
+func listMigrations() ([]string, error) {
+	migrations := []string{}
+	files, err := ioutil.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
 	for _, f := range files {
 		if !f.IsDir() && strings.HasSuffix(f.Name(), ".sql") {
 
@@ -163,12 +182,25 @@ func getMigrationsInOrder() []string {
 	}
 
 	sort.Stable(byMigrationIndex(migrations))
-	return migrations
+	return migrations, nil
+}
+
+// LatestMigration is the name of the last migration on disk, which is what SchemaVersion
+// should be once DoMigrations has run
+func LatestMigration() (string, error) {
+	migrations, err := listMigrations()
+	if err != nil {
+		return "", err
+	}
+	if len(migrations) == 0 {
+		return "", nil
+	}
+	return migrations[len(migrations)-1], nil
 }
 
 // doesMigrationTableExist determines if the table used to track migrations
 // already exists
-func doesMigrationTableExist(db *sql.DB) bool {
+func doesMigrationTableExist(db queryer) bool {
 	rows, err := db.Query(listTablesQuery)
 	if err != nil {
 		logger.Error.Printf("Unable to get database table information for migrations")
@@ -188,7 +220,7 @@ func doesMigrationTableExist(db *sql.DB) bool {
 }
 
 // createMigrationTable creates the table used for keeping track of migrations
-func createMigrationTable(db *sql.DB) {
+func createMigrationTable(db queryer) {
 	_, err := db.Exec(createMigrationTableQuery)
 	if err != nil {
 		logger.Error.Printf("Unable to create migration table")
@@ -203,7 +235,7 @@ func createMigrationTable(db *sql.DB) {
 }
 
 // getCurrentMigration retrives the current migration listed in the database
-func getCurrentMigration(db *sql.DB) string {
+func getCurrentMigration(db queryer) string {
 	var migration string
 	err := db.QueryRow(getCurrentMigrationQuery).Scan(&migration)
 	if err != nil {
@@ -215,7 +247,7 @@ func getCurrentMigration(db *sql.DB) string {
 
 // createMigrationTableIfNeeded checks to see if the migration table exists and
 // if it doesn't creates it.
-func createMigrationTableIfNeeded(db *sql.DB) {
+func createMigrationTableIfNeeded(db queryer) {
 	if !doesMigrationTableExist(db) {
 		logger.Info.Printf("Migration table does not yet exist. Creating it")
 		createMigrationTable(db)
@@ -224,7 +256,7 @@ func createMigrationTableIfNeeded(db *sql.DB) {
 
 // getCurrentMigrationIndex retrieves the currently last executed file
 // from the database
-func getCurrentMigrationIndex(db *sql.DB, migrations []string) int {
+func getCurrentMigrationIndex(db queryer, migrations []string) int {
 	if currentMigration := getCurrentMigration(db); currentMigration != "" {
 		startIndex := posInSlice(migrations, currentMigration)
 		if startIndex == -1 {
@@ -259,34 +291,66 @@ func updateMigrationTable(tx *sql.Tx, migrations []string) {
 	}
 }
 
+// SchemaVersion is the name of the last migration that's been run against the database,
+// which makes it as good a version number for the shape the database is in as any. Unlike
+// the rest of the functions in here it doesn't panic, since it isn't only used on startup.
+func SchemaVersion(db *sql.DB) (string, error) {
+	return SchemaVersionContext(context.Background(), db)
+}
+
+// SchemaVersionContext is SchemaVersion for when somebody's waiting on the answer, like a
+// health check, and would rather give up than wait on a database that isn't answering
+func SchemaVersionContext(ctx context.Context, db *sql.DB) (string, error) {
+	var version string
+	err := db.QueryRowContext(ctx, getCurrentMigrationQuery).Scan(&version)
+	return version, err
+}
+
 // DoMigrations brings the supplied database up to date with current state of
 // the migration files
+//
+// Both the web and the worker processes call this when they start, and they usually start at
+// the same time, so it all happens inside a transaction that starts by taking an advisory lock.
+// Whoever gets there second waits for the first to finish, and then finds the database already
+// up to date, rather than both of them trying to run the same migrations at once. The lock goes
+// away by itself when the transaction does, however that happens.
 func DoMigrations(db *sql.DB) {
-	createMigrationTableIfNeeded(db)
+	tx, err := db.Begin()
+
+	if err != nil {
+		logger.Error.Printf("Could not start transaction for migrations")
+		panic(err)
+	}
+
+	_, err = tx.Exec(lockMigrationsQuery)
+	if err != nil {
+		logger.Error.Printf("Could not lock the database for migrations")
+		tx.Rollback()
+		panic(err)
+	}
+
+	createMigrationTableIfNeeded(tx)
 
 	migrations := getMigrationsInOrder()
 
-	startIndex := getCurrentMigrationIndex(db, migrations)
+	startIndex := getCurrentMigrationIndex(tx, migrations)
 
 	if startIndex == -1 {
 		logger.Warning.Printf("Could not find migration listed in database on filesystem")
+		tx.Rollback()
 		return
 	}
 
 	if startIndex == len(migrations) {
 		logger.Debug.Printf("The database seems to be up to date")
+		// Committing rather than rolling back, so that a migration table we've only just
+		// created sticks around
+		tx.Commit()
 		return
 	}
 
 	logger.Info.Printf("Performing database migrations")
 
-	tx, err := db.Begin()
-
-	if err != nil {
-		logger.Error.Printf("Could not start transaction for migrations")
-		panic(err)
-	}
-
 	performNeededMigrations(tx, migrations, startIndex)
 
 	logger.Info.Printf("Finished performing migrations. Updating migration table")
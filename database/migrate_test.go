@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -75,6 +76,20 @@ func TestGetMigrationsInOrder(t *testing.T) {
 	assert.Equal(t, "10_tenth.sql", migrations[2])
 }
 
+func TestLatestMigration(t *testing.T) {
+	originalCWD, _ := os.Getwd()
+	defer func() { os.Chdir(originalCWD) }()
+	os.Chdir("test_assets")
+
+	latest, err := LatestMigration()
+	assert.Nil(t, err)
+	assert.Equal(t, "10_tenth.sql", latest)
+
+	os.Chdir("migrations")
+	_, err = LatestMigration()
+	assert.NotNil(t, err)
+}
+
 func TestDoesMigrationTableExist(t *testing.T) {
 	outputColumns := []string{"table_name"}
 	db, mock, _ := sqlmock.New()
@@ -108,6 +123,26 @@ func TestGetCurrentMigration(t *testing.T) {
 	assert.Nil(t, mock.ExpectationsWereMet())
 }
 
+func TestSchemaVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(regexp.QuoteMeta(getCurrentMigrationQuery)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("9_test.sql"))
+	version, err := SchemaVersion(db)
+	assert.Nil(t, err)
+	assert.Equal(t, "9_test.sql", version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSchemaVersionContext(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	// Somebody who's stopped waiting doesn't get an answer
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := SchemaVersionContext(ctx, db)
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestCreateMigrationTableIfNeeded(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 
@@ -185,8 +220,11 @@ func TestDoMigrationsCouldNotFind(t *testing.T) {
 
 	db, mock, _ := sqlmock.New()
 
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(lockMigrationsQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectQuery(listTablesQuery).WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow(migrationTable))
 	mock.ExpectQuery(regexp.QuoteMeta(getCurrentMigrationQuery)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("doesNotExist.sql"))
+	mock.ExpectRollback()
 
 	DoMigrations(db)
 	assert.Nil(t, mock.ExpectationsWereMet())
@@ -202,8 +240,11 @@ func TestDoMigrationsUpToDate(t *testing.T) {
 
 	db, mock, _ := sqlmock.New()
 
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(lockMigrationsQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectQuery(listTablesQuery).WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow(migrationTable))
 	mock.ExpectQuery(regexp.QuoteMeta(getCurrentMigrationQuery)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("3_third.sql"))
+	mock.ExpectCommit()
 
 	DoMigrations(db)
 	assert.Nil(t, mock.ExpectationsWereMet())
@@ -217,12 +258,15 @@ func TestDoMigrationsExecute(t *testing.T) {
 
 	db, mock, _ := sqlmock.New()
 
+	// The lock comes first, so that nothing's looked at while somebody else is migrating
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(lockMigrationsQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectQuery(listTablesQuery).WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow(migrationTable))
 	mock.ExpectQuery(regexp.QuoteMeta(getCurrentMigrationQuery)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("1_first.sql"))
-	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta("SELECT * FROM testing2")).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(regexp.QuoteMeta("SELECT * FROM testing3")).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(regexp.QuoteMeta(updateMigrationQuery)).WithArgs("3_third.sql").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	DoMigrations(db)
 	assert.Nil(t, mock.ExpectationsWereMet())
@@ -0,0 +1,196 @@
+// Package feeds follows RSS and Atom feeds on behalf of editors, turning whatever shows up in
+// them into suggestions that an editor can promote into a link.
+package feeds
+
+// Plenty of what ends up in a newsletter comes from the same handful of blogs, and somebody
+// has to remember to go and check them. So instead editors register those feeds here, and a
+// Poller checks each of them in the background, every so often (each feed has an interval of
+// its own, a blog that posts once a month doesn't need checking every ten minutes). Anything
+// new lands in a queue of suggestions. Nothing in the queue is shared with anybody until an
+// editor promotes it, at which point it becomes an ordinary link, submitted by that editor,
+// and goes in the next issue just like anything else.
+//
+// We try to be a good citizen towards the feeds we follow: requests are conditional, so a
+// feed that hasn't changed costs its server a 304 and nothing more, and a feed that keeps
+// failing gets checked less and less often rather than hammered (see backoff in poll.go).
+//
+// Feeds can also be moved in and out of other readers as OPML, see opml.go.
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// These are the limits on how often a feed is checked, in minutes. Even the busiest feed
+// doesn't need checking more than every quarter hour for a newsletter.
+const (
+	MinInterval     = 15
+	DefaultInterval = 60
+	MaxInterval     = 7 * 24 * 60
+)
+
+const (
+	feedColumns = "id, url, title, site_url, interval_minutes, active, etag, last_modified, next_poll_at, " +
+		"last_polled_at, error_count, last_error, created_at"
+	selectFeeds = "SELECT " + feedColumns + " FROM feeds"
+
+	listFeedsQuery    = selectFeeds + " ORDER BY lower(COALESCE(NULLIF(title, ''), url)), id"
+	getFeedQuery      = selectFeeds + " WHERE id = $1"
+	addFeedQuery      = "INSERT INTO feeds (url, title, site_url, interval_minutes) VALUES ($1, $2, $3, $4) ON CONFLICT (url) DO NOTHING RETURNING id"
+	getFeedByURLQuery = selectFeeds + " WHERE url = $1"
+	setActiveQuery    = "UPDATE feeds SET active = $2, next_poll_at = now() WHERE id = $1"
+	setIntervalQuery  = "UPDATE feeds SET interval_minutes = $2 WHERE id = $1"
+	pollSoonQuery     = "UPDATE feeds SET next_poll_at = now() WHERE id = $1"
+	deleteFeedQuery   = "DELETE FROM feeds WHERE id = $1"
+)
+
+// ErrInvalidURL is returned when a feed's URL isn't somewhere we can fetch it from
+var ErrInvalidURL = errors.New("Feeds must be absolute http or https URLs")
+
+// Feed is a single RSS or Atom feed we keep an eye on
+type Feed struct {
+	ID  int64
+	URL string
+
+	// Title and SiteURL come from the feed itself, they're filled in the first time it's polled
+	Title   string
+	SiteURL string
+
+	// Interval is how many minutes apart the feed is checked
+	Interval int
+	Active   bool
+
+	// ETag and LastModified are what the feed's server told us last time, and are sent back
+	// so that it can tell us nothing has changed
+	ETag         string
+	LastModified string
+
+	NextPollAt   time.Time
+	LastPolledAt *time.Time
+
+	// ErrorCount is how many times in a row polling the feed has failed, and LastError is why
+	// the last of those did
+	ErrorCount int
+	LastError  string
+
+	CreatedAt time.Time
+}
+
+// DisplayTitle is the feed's title, falling back to its URL if we don't know it yet
+func (feed Feed) DisplayTitle() string {
+	if feed.Title != "" {
+		return feed.Title
+	}
+	return feed.URL
+}
+
+// ValidateURL makes sure a feed's URL is something we can fetch
+func ValidateURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	return u.String(), nil
+}
+
+// clampInterval keeps an interval between MinInterval and MaxInterval, with anything that
+// isn't set at all getting the DefaultInterval
+func clampInterval(minutes int) int {
+	switch {
+	case minutes <= 0:
+		return DefaultInterval
+	case minutes < MinInterval:
+		return MinInterval
+	case minutes > MaxInterval:
+		return MaxInterval
+	}
+	return minutes
+}
+
+type scanner interface {
+	Scan(...interface{}) error
+}
+
+func scanFeed(row scanner) (Feed, error) {
+	feed := Feed{}
+	err := row.Scan(&feed.ID, &feed.URL, &feed.Title, &feed.SiteURL, &feed.Interval, &feed.Active, &feed.ETag,
+		&feed.LastModified, &feed.NextPollAt, &feed.LastPolledAt, &feed.ErrorCount, &feed.LastError, &feed.CreatedAt)
+	return feed, err
+}
+
+// Add starts following a feed, which will be polled as soon as a Poller gets to it. The
+// title and site URL are optional, they'll be filled in from the feed. Adding a feed we're
+// already following doesn't change it, and returns false along with the existing feed.
+func Add(db *sql.DB, rawURL, title, siteURL string, interval int) (Feed, bool, error) {
+	cleaned, err := ValidateURL(rawURL)
+	if err != nil {
+		return Feed{}, false, err
+	}
+
+	var id int64
+	err = db.QueryRow(addFeedQuery, cleaned, strings.TrimSpace(title), strings.TrimSpace(siteURL), clampInterval(interval)).Scan(&id)
+	if err == sql.ErrNoRows {
+		feed, err := scanFeed(db.QueryRow(getFeedByURLQuery, cleaned))
+		return feed, false, err
+	}
+	if err != nil {
+		return Feed{}, false, err
+	}
+
+	feed, err := Get(db, id)
+	return feed, true, err
+}
+
+// Get retrieves a single feed, or sql.ErrNoRows if there isn't one
+func Get(db *sql.DB, id int64) (Feed, error) {
+	return scanFeed(db.QueryRow(getFeedQuery, id))
+}
+
+// List retrieves every feed, alphabetically
+func List(db *sql.DB) ([]Feed, error) {
+	rows, err := db.Query(listFeedsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []Feed{}
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, feed)
+	}
+	return found, rows.Err()
+}
+
+// SetActive pauses or resumes polling a feed. A resumed feed is checked straight away.
+func SetActive(db *sql.DB, id int64, active bool) error {
+	_, err := db.Exec(setActiveQuery, id, active)
+	return err
+}
+
+// SetInterval changes how many minutes apart a feed is checked. It takes effect after the
+// next time it's checked.
+func SetInterval(db *sql.DB, id int64, interval int) error {
+	_, err := db.Exec(setIntervalQuery, id, clampInterval(interval))
+	return err
+}
+
+// PollSoon has a feed checked the next time a Poller looks for feeds to check, rather than
+// waiting for its interval to come around
+func PollSoon(db *sql.DB, id int64) error {
+	_, err := db.Exec(pollSoonQuery, id)
+	return err
+}
+
+// Delete stops following a feed, and forgets everything that was found in it. Links that
+// were promoted out of it stay, of course.
+func Delete(db *sql.DB, id int64) error {
+	_, err := db.Exec(deleteFeedQuery, id)
+	return err
+}
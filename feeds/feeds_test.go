@@ -0,0 +1,75 @@
+package feeds
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var feedColumnNames = []string{"id", "url", "title", "site_url", "interval_minutes", "active", "etag", "last_modified",
+	"next_poll_at", "last_polled_at", "error_count", "last_error", "created_at"}
+
+func feedRows() *sqlmock.Rows {
+	return sqlmock.NewRows(feedColumnNames)
+}
+
+func feedRow(id int64, url string) []driver.Value {
+	return []driver.Value{id, url, "", "", DefaultInterval, true, "", "", time.Now(), nil, 0, "", time.Now()}
+}
+
+func TestClampInterval(t *testing.T) {
+	assert.Equal(t, DefaultInterval, clampInterval(0))
+	assert.Equal(t, MinInterval, clampInterval(1))
+	assert.Equal(t, 90, clampInterval(90))
+	assert.Equal(t, MaxInterval, clampInterval(MaxInterval*2))
+}
+
+func TestAdd(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(addFeedQuery)).
+		WithArgs("https://example.com/feed.xml", "", "", MinInterval).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(getFeedQuery)).
+		WithArgs(3).
+		WillReturnRows(feedRows().AddRow(feedRow(3, "https://example.com/feed.xml")...))
+
+	feed, added, err := Add(db, " https://example.com/feed.xml ", "", "", 5)
+	assert.Nil(t, err)
+	assert.True(t, added)
+	assert.Equal(t, int64(3), feed.ID)
+	assert.Equal(t, "https://example.com/feed.xml", feed.DisplayTitle())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, _, err = Add(db, "javascript:alert(1)", "", "", 0)
+	assert.Equal(t, ErrInvalidURL, err)
+}
+
+func TestList(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	polled := time.Now()
+	row := feedRow(1, "https://example.com/feed.xml")
+	row[2], row[9], row[10], row[11] = "Example", polled, 2, "The feed responded with 500"
+	mock.ExpectQuery(regexp.QuoteMeta(listFeedsQuery)).WillReturnRows(feedRows().AddRow(row...))
+
+	found, err := List(db)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "Example", found[0].DisplayTitle())
+	assert.Equal(t, polled, *found[0].LastPolledAt)
+	assert.Equal(t, 2, found[0].ErrorCount)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSetInterval(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(setIntervalQuery)).WithArgs(1, MaxInterval).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, SetInterval(db, 1, 1000000))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
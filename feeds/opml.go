@@ -0,0 +1,124 @@
+package feeds
+
+// OPML is what every feed reader uses to import and export the feeds somebody follows, which
+// makes it the easiest way to bring a whole list of them over from wherever an editor was
+// reading them before, or to take ours somewhere else. All we care about in it are the
+// outlines with an xmlUrl, which are the feeds; everything else is folders, which can nest,
+// so we go looking through all of them.
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Outline is a single feed in an OPML file
+type Outline struct {
+	Title   string
+	XMLURL  string
+	HTMLURL string
+}
+
+// OPMLReport describes what happened to each of the feeds in an OPML file that was imported
+type OPMLReport struct {
+	Added    []Feed
+	Existing []Feed
+	Invalid  []Outline
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName     xml.Name      `xml:"opml"`
+	Version     string        `xml:"version,attr"`
+	Title       string        `xml:"head>title"`
+	DateCreated string        `xml:"head>dateCreated,omitempty"`
+	Outlines    []opmlOutline `xml:"body>outline"`
+}
+
+// ParseOPML finds every feed in an OPML file, in the order they appear
+func ParseOPML(data []byte) ([]Outline, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = charsetReader
+
+	document := opmlDocument{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	found := []Outline{}
+	var walk func([]opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			if outline.XMLURL != "" {
+				found = append(found, Outline{
+					Title:   firstOf(outline.Title, outline.Text),
+					XMLURL:  outline.XMLURL,
+					HTMLURL: outline.HTMLURL,
+				})
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(document.Outlines)
+	return found, nil
+}
+
+// ImportOPML starts following every feed in an OPML file we aren't already following
+func ImportOPML(db *sql.DB, outlines []Outline) (OPMLReport, error) {
+	report := OPMLReport{}
+	for _, outline := range outlines {
+		feed, added, err := Add(db, outline.XMLURL, outline.Title, outline.HTMLURL, DefaultInterval)
+		switch {
+		case err == ErrInvalidURL:
+			report.Invalid = append(report.Invalid, outline)
+		case err != nil:
+			return report, err
+		case added:
+			report.Added = append(report.Added, feed)
+		default:
+			report.Existing = append(report.Existing, feed)
+		}
+	}
+	return report, nil
+}
+
+// WriteOPML writes out every feed as an OPML file that any feed reader can import
+func WriteOPML(w io.Writer, feeds []Feed, now time.Time) error {
+	document := opmlDocument{
+		Version:     "2.0",
+		Title:       "LinkLetter feeds",
+		DateCreated: now.UTC().Format(time.RFC1123Z),
+	}
+	for _, feed := range feeds {
+		document.Outlines = append(document.Outlines, opmlOutline{
+			Text:    feed.DisplayTitle(),
+			Title:   feed.Title,
+			Type:    "rss",
+			XMLURL:  feed.URL,
+			HTMLURL: feed.SiteURL,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package feeds
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOPML(t *testing.T) {
+	outlines, err := ParseOPML(readAsset(t, "subscriptions.opml"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Outline{
+		{Title: "Example & Friends", XMLURL: "https://example.com/feed.xml", HTMLURL: "https://example.com/"},
+		{Title: "An Atom Feed", XMLURL: "https://atom.example.com/atom.xml"},
+		{Title: "Gopher", XMLURL: "ftp://gopher.example.com/feed"},
+	}, outlines)
+
+	_, err = ParseOPML([]byte("not opml"))
+	assert.NotNil(t, err)
+}
+
+func TestImportOPML(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(addFeedQuery)).
+		WithArgs("https://example.com/feed.xml", "Example", "https://example.com/", DefaultInterval).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(getFeedQuery)).
+		WithArgs(1).
+		WillReturnRows(feedRows().AddRow(feedRow(1, "https://example.com/feed.xml")...))
+	mock.ExpectQuery(regexp.QuoteMeta(addFeedQuery)).
+		WithArgs("https://atom.example.com/atom.xml", "", "", DefaultInterval).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(getFeedByURLQuery)).
+		WithArgs("https://atom.example.com/atom.xml").
+		WillReturnRows(feedRows().AddRow(feedRow(2, "https://atom.example.com/atom.xml")...))
+
+	report, err := ImportOPML(db, []Outline{
+		{Title: "Example", XMLURL: "https://example.com/feed.xml", HTMLURL: "https://example.com/"},
+		{XMLURL: "https://atom.example.com/atom.xml"},
+		{Title: "Gopher", XMLURL: "ftp://gopher.example.com/feed"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, report.Added, 1)
+	assert.Equal(t, int64(2), report.Existing[0].ID)
+	assert.Equal(t, "Gopher", report.Invalid[0].Title)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestWriteOPML(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := WriteOPML(out, []Feed{
+		{URL: "https://example.com/feed.xml", Title: "Example & Friends", SiteURL: "https://example.com/"},
+		{URL: "https://atom.example.com/atom.xml"},
+	}, time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head>
+    <title>LinkLetter feeds</title>
+    <dateCreated>Wed, 01 Mar 2017 12:00:00 +0000</dateCreated>
+  </head>
+  <body>
+    <outline text="Example &amp; Friends" title="Example &amp; Friends" type="rss" xmlUrl="https://example.com/feed.xml" htmlUrl="https://example.com/"></outline>
+    <outline text="https://atom.example.com/atom.xml" type="rss" xmlUrl="https://atom.example.com/atom.xml"></outline>
+  </body>
+</opml>
+`, out.String())
+
+	// Whatever we write, we can read back
+	outlines, err := ParseOPML(out.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "Example & Friends", outlines[0].Title)
+	assert.Equal(t, "https://atom.example.com/atom.xml", outlines[1].XMLURL)
+}
@@ -0,0 +1,264 @@
+package feeds
+
+// There are three kinds of feed still out there in any numbers: RSS 2.0, Atom, and the odd
+// RSS 1.0 (RDF) feed that nobody has touched since 2004. They all boil down to the same
+// thing for our purposes, a title and a list of items that each have a link, and thankfully
+// they're close enough that a single set of structs can read all three. encoding/xml matches
+// elements by their local name when a struct tag doesn't give a namespace, so "dc:date" is
+// just "date" and Atom's "link" is the same as RSS's, the only difference being that Atom
+// puts the URL in an attribute.
+//
+// Feeds in the wild are often not quite XML, so the decoder is put into its forgiving mode
+// and taught HTML's entities, which show up unescaped far more often than they should. What
+// it isn't taught is HTML's self-closing elements, since one of them is <link>, and that's
+// the one element no feed can do without.
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSummary is how many characters of an item's description we keep. It's only there to
+// give an editor an idea of what the item is about.
+const maxSummary = 300
+
+// ErrNotAFeed is returned when something parses but isn't RSS or Atom
+var ErrNotAFeed = errors.New("That doesn't look like an RSS or Atom feed")
+
+// Parsed is everything we care about in a feed
+type Parsed struct {
+	Title   string
+	SiteURL string
+	Items   []Item
+}
+
+// Item is a single thing that showed up in a feed
+type Item struct {
+	// GUID is whatever the feed uses to tell its items apart, falling back to the item's URL.
+	// It's how we know whether we've seen an item before.
+	GUID        string
+	URL         string
+	Title       string
+	Summary     string
+	PublishedAt *time.Time
+}
+
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+type xmlItem struct {
+	GUID        string    `xml:"guid"`
+	ID          string    `xml:"id"`
+	About       string    `xml:"about,attr"`
+	Title       string    `xml:"title"`
+	Links       []xmlLink `xml:"link"`
+	Description string    `xml:"description"`
+	Summary     string    `xml:"summary"`
+	Content     string    `xml:"content"`
+	PubDate     string    `xml:"pubDate"`
+	Published   string    `xml:"published"`
+	Updated     string    `xml:"updated"`
+	Date        string    `xml:"date"`
+}
+
+type xmlChannel struct {
+	Title string    `xml:"title"`
+	Links []xmlLink `xml:"link"`
+	Items []xmlItem `xml:"item"`
+}
+
+// xmlFeed is any of the three kinds of feed. RSS 2.0 puts its items inside the channel,
+// RSS 1.0 puts them next to it, and Atom doesn't have a channel at all.
+type xmlFeed struct {
+	XMLName xml.Name
+	Channel xmlChannel `xml:"channel"`
+	Items   []xmlItem  `xml:"item"`
+	Title   string     `xml:"title"`
+	Links   []xmlLink  `xml:"link"`
+	Entries []xmlItem  `xml:"entry"`
+}
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// dateFormats are the ways feeds write their dates. RSS is supposed to use RFC 822 and Atom
+// RFC 3339, but plenty of feeds get creative.
+var dateFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 06 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Parse reads an RSS or Atom feed. Relative links in the feed are resolved against the URL
+// the feed came from, and items without a link we could share are left out.
+func Parse(data []byte, feedURL string) (Parsed, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = charsetReader
+
+	raw := xmlFeed{}
+	if err := decoder.Decode(&raw); err != nil {
+		return Parsed{}, err
+	}
+
+	base, _ := url.Parse(feedURL)
+	parsed := Parsed{}
+	var items []xmlItem
+
+	switch strings.ToLower(raw.XMLName.Local) {
+	case "rss":
+		parsed.Title = raw.Channel.Title
+		parsed.SiteURL = pickLink(raw.Channel.Links, base)
+		items = raw.Channel.Items
+	case "rdf":
+		parsed.Title = raw.Channel.Title
+		parsed.SiteURL = pickLink(raw.Channel.Links, base)
+		items = raw.Items
+	case "feed":
+		parsed.Title = raw.Title
+		parsed.SiteURL = pickLink(raw.Links, base)
+		items = raw.Entries
+	default:
+		return Parsed{}, ErrNotAFeed
+	}
+	parsed.Title = cleanText(parsed.Title, 0)
+
+	parsed.Items = []Item{}
+	for _, raw := range items {
+		if item, ok := convertItem(raw, base); ok {
+			parsed.Items = append(parsed.Items, item)
+		}
+	}
+	return parsed, nil
+}
+
+func convertItem(raw xmlItem, base *url.URL) (Item, bool) {
+	link := pickLink(raw.Links, base)
+	if link == "" {
+		// RSS allows an item with nothing but a guid, as long as it's a permalink
+		link = resolve(raw.GUID, base)
+	}
+	if link == "" {
+		return Item{}, false
+	}
+
+	item := Item{URL: link, Title: cleanText(raw.Title, 0)}
+	item.GUID = firstOf(raw.GUID, raw.ID, raw.About, link)
+	item.Summary = cleanText(firstOf(raw.Description, raw.Summary, raw.Content), maxSummary)
+	if published, ok := parseDate(firstOf(raw.PubDate, raw.Published, raw.Date, raw.Updated)); ok {
+		item.PublishedAt = &published
+	}
+	return item, true
+}
+
+// pickLink finds the link to the web page among a feed's or item's links. RSS just has the
+// one, but Atom can have any number, and the page is the one that's rel="alternate" (or
+// doesn't say).
+func pickLink(links []xmlLink, base *url.URL) string {
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if resolved := resolve(firstOf(link.Href, link.Text), base); resolved != "" {
+			return resolved
+		}
+	}
+	return ""
+}
+
+// resolve turns a link in a feed into an absolute URL we'd be willing to share, or ""
+func resolve(raw string, base *url.URL) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || raw == "" {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// cleanText turns a bit of a feed, which may well be HTML, into plain text of at most limit
+// characters (or any length for 0)
+func cleanText(raw string, limit int) string {
+	text := html.UnescapeString(tagPattern.ReplaceAllString(raw, " "))
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+	if limit > 0 && utf8.RuneCountInString(text) > limit {
+		text = strings.TrimSpace(string([]rune(text)[:limit-1])) + "…"
+	}
+	return text
+}
+
+func parseDate(raw string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	for _, format := range dateFormats {
+		if parsed, err := time.Parse(format, raw); err == nil {
+			return parsed.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// charsetReader lets the decoder read the older feeds that are still in Latin-1 (or claim
+// to be, when they're really Windows-1252, which we treat the same). The decoder handles
+// UTF-8 itself, and anything more exotic than these is an error.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "us-ascii":
+		return latin1Reader{input}, nil
+	}
+	return nil, fmt.Errorf("Feeds in %s aren't supported", charset)
+}
+
+// latin1Reader turns Latin-1 into UTF-8, which is easy since every Latin-1 byte is the code
+// point of the same number
+type latin1Reader struct {
+	in io.Reader
+}
+
+func (r latin1Reader) Read(p []byte) (int, error) {
+	// Each byte can become at most two, so only read half as much as we were asked for
+	raw := make([]byte, len(p)/2)
+	if len(raw) == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	n, err := r.in.Read(raw)
+	written := 0
+	for _, b := range raw[:n] {
+		written += utf8.EncodeRune(p[written:], rune(b))
+	}
+	return written, err
+}
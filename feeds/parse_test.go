@@ -0,0 +1,87 @@
+package feeds
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAsset(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("test_assets/" + name)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestParseRSS(t *testing.T) {
+	parsed, err := Parse(readAsset(t, "rss.xml"), "https://example.com/feed.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, "Example & Friends", parsed.Title)
+	assert.Equal(t, "https://example.com/", parsed.SiteURL)
+
+	// The mailto: item is left out
+	assert.Len(t, parsed.Items, 3)
+
+	published := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, Item{
+		GUID:        "post-2",
+		URL:         "https://example.com/posts/job-queue",
+		Title:       "Postgres is a fine job queue",
+		Summary:     "It turns out SKIP LOCKED is all you need.",
+		PublishedAt: &published,
+	}, parsed.Items[0])
+
+	assert.Equal(t, "https://example.com/posts/relative", parsed.Items[1].URL)
+	assert.Equal(t, "https://example.com/posts/relative", parsed.Items[1].GUID)
+	assert.Equal(t, time.Date(2017, 2, 28, 8, 30, 0, 0, time.UTC), *parsed.Items[1].PublishedAt)
+
+	assert.Equal(t, "https://example.com/posts/guid-only", parsed.Items[2].URL)
+	assert.Nil(t, parsed.Items[2].PublishedAt)
+}
+
+func TestParseAtom(t *testing.T) {
+	parsed, err := Parse(readAsset(t, "atom.xml"), "https://atom.example.com/atom.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, "An Atom Feed", parsed.Title)
+	assert.Equal(t, "https://atom.example.com/", parsed.SiteURL)
+	assert.Len(t, parsed.Items, 2)
+
+	assert.Equal(t, "tag:atom.example.com,2017:1", parsed.Items[0].GUID)
+	assert.Equal(t, "https://atom.example.com/entries/1", parsed.Items[0].URL)
+	assert.Equal(t, "Just a summary", parsed.Items[0].Summary)
+	assert.Equal(t, time.Date(2017, 3, 2, 14, 0, 0, 0, time.UTC), *parsed.Items[0].PublishedAt)
+
+	assert.Equal(t, "https://atom.example.com/entries/2", parsed.Items[1].URL)
+	assert.Equal(t, "Some content", parsed.Items[1].Summary)
+	assert.Equal(t, time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC), *parsed.Items[1].PublishedAt)
+}
+
+func TestParseRDF(t *testing.T) {
+	parsed, err := Parse(readAsset(t, "rdf.xml"), "http://old.example.com/index.rdf")
+	assert.Nil(t, err)
+	assert.Equal(t, "Café Old", parsed.Title)
+	assert.Equal(t, "http://old.example.com/", parsed.SiteURL)
+	if assert.Len(t, parsed.Items, 1) {
+		assert.Equal(t, "Café culture", parsed.Items[0].Title)
+		assert.Equal(t, "http://old.example.com/2004/caf", parsed.Items[0].GUID)
+		assert.Equal(t, time.Date(2004, 5, 1, 12, 0, 0, 0, time.UTC), *parsed.Items[0].PublishedAt)
+	}
+}
+
+func TestParseNotAFeed(t *testing.T) {
+	_, err := Parse([]byte(`<html><body>Hello</body></html>`), "https://example.com")
+	assert.Equal(t, ErrNotAFeed, err)
+
+	_, err = Parse([]byte(`not xml at all`), "https://example.com")
+	assert.NotNil(t, err)
+
+	_, err = Parse([]byte(`<?xml version="1.0" encoding="KOI8-R"?><rss></rss>`), "https://example.com")
+	assert.NotNil(t, err)
+}
+
+func TestCleanText(t *testing.T) {
+	assert.Equal(t, "Hello there & welcome", cleanText("<p>Hello\n   <em>there</em> &amp; welcome</p>", 0))
+	assert.Equal(t, "abcd…", cleanText("abcdefgh", 5))
+	assert.Equal(t, "abcde", cleanText("abcde", 5))
+}
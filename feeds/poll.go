@@ -0,0 +1,277 @@
+package feeds
+
+// The Poller works a lot like the job workers do (see jobs/worker.go). It asks the database
+// for a feed that's due, using "FOR UPDATE SKIP LOCKED" so that any number of pollers in any
+// number of processes never grab the same feed, and while it's at it pushes that feed's
+// next_poll_at a little way into the future. That's our lease: if the process dies halfway
+// through polling, the feed simply comes due again a few minutes later. Once the feed has
+// been polled its next_poll_at is set properly, from its interval.
+//
+// Why not just use the jobs package? Because a feed isn't a job that gets done, it's a thing
+// that needs doing forever, on its own schedule, and that schedule needs to be somewhere an
+// editor can see it and change it. Rescheduling jobs from inside of themselves works right
+// up until the first time one of them goes missing and a feed quietly stops being checked.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+)
+
+const (
+	// pollerInterval is how long a Poller waits before checking for due feeds again once
+	// it's run out of them
+	pollerInterval = time.Minute
+
+	// fetchTimeout is how long we give a feed's server to send us the whole feed
+	fetchTimeout = 30 * time.Second
+
+	// maxFeedSize is the biggest feed we'll read. Even feeds with full articles in them rarely
+	// come to more than a megabyte.
+	maxFeedSize = 5 << 20
+
+	// maxBackoff is the longest we'll go without checking a feed that keeps failing
+	maxBackoff = 24 * time.Hour
+
+	// firstPollWindow is how recent an item has to be on the first poll of a feed to be
+	// suggested, see Poll
+	firstPollWindow = 7 * 24 * time.Hour
+)
+
+const (
+	claimFeedQuery = "UPDATE feeds SET next_poll_at = now() + interval '10 minutes' WHERE id = (SELECT id FROM feeds " +
+		"WHERE active AND next_poll_at <= now() ORDER BY next_poll_at LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING " + feedColumns
+	recordSuccessQuery = "UPDATE feeds SET title = CASE WHEN title = '' THEN $2 ELSE title END, " +
+		"site_url = CASE WHEN site_url = '' THEN $3 ELSE site_url END, etag = $4, last_modified = $5, " +
+		"last_polled_at = $6, next_poll_at = $7, error_count = 0, last_error = '' WHERE id = $1"
+	recordFailureQuery = "UPDATE feeds SET last_polled_at = $2, next_poll_at = $3, error_count = error_count + 1, last_error = $4 WHERE id = $1"
+	recordGoneQuery    = "UPDATE feeds SET active = false, last_polled_at = $2, error_count = error_count + 1, last_error = $3 WHERE id = $1"
+)
+
+// errGone is what a feed's server tells us when it wants us to stop asking for it, with a 410
+var errGone = errors.New("The feed is gone (410), so it's been paused")
+
+// response is what we got back from asking for a feed
+type response struct {
+	notModified  bool
+	body         []byte
+	etag         string
+	lastModified string
+}
+
+// fetch asks for a feed, sending along what we were told last time so that an unchanged
+// feed can simply tell us so
+func fetch(feed Feed, userAgent string) (response, error) {
+	req, err := http.NewRequest("GET", feed.URL, nil)
+	if err != nil {
+		return response{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/rdf+xml, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.1")
+	if feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	// Feeds are added by editors, who shouldn't be able to have us fetch anything off our own
+	// network either (see publicnet)
+	resp, err := publicnet.Client().Do(req)
+	if err != nil {
+		return response{}, err
+	}
+	defer resp.Body.Close()
+
+	result := response{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		result.notModified = true
+		return result, nil
+	case resp.StatusCode == http.StatusGone:
+		return result, errGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return result, fmt.Errorf("The feed responded with %d", resp.StatusCode)
+	}
+
+	result.body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err == nil && len(result.body) > maxFeedSize {
+		err = fmt.Errorf("The feed is bigger than %dMB", maxFeedSize>>20)
+	}
+	return result, err
+}
+
+// backoff is how long to wait before checking a feed that's failed the given number of times
+// in a row: its interval, doubled for every failure, up to maxBackoff
+func backoff(interval, failures int) time.Duration {
+	delay := time.Duration(interval) * time.Minute
+	for i := 0; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Poll checks a feed for anything new, and records how it went. Whatever fails is recorded
+// against the feed as well as returned, so that editors can see which of their feeds are
+// having trouble.
+//
+// The first time a feed is polled it's likely to be full of things that were posted long
+// before anybody here was interested in it. So on that first poll only items from the last
+// week become suggestions, and everything else is remembered (so that it never becomes a
+// suggestion later) but ignored.
+func Poll(db *sql.DB, feed Feed, userAgent string, now time.Time) error {
+	result, err := fetch(feed, userAgent)
+	if err == errGone {
+		_, recordErr := db.Exec(recordGoneQuery, feed.ID, now, err.Error())
+		return firstError(err, recordErr)
+	}
+	if err != nil {
+		return recordFailure(db, feed, now, err)
+	}
+
+	// A server that doesn't send new validators along with a 304 means for us to keep the old ones
+	if result.notModified {
+		etag, lastModified := firstOf(result.etag, feed.ETag), firstOf(result.lastModified, feed.LastModified)
+		_, err := db.Exec(recordSuccessQuery, feed.ID, feed.Title, feed.SiteURL, etag, lastModified, now, nextPoll(feed, now))
+		return err
+	}
+
+	parsed, err := Parse(result.body, feed.URL)
+	if err != nil {
+		return recordFailure(db, feed, now, fmt.Errorf("Unable to read the feed: %s", err))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range parsed.Items {
+		status := StatusSuggested
+		if feed.LastPolledAt == nil && (item.PublishedAt == nil || item.PublishedAt.Before(now.Add(-firstPollWindow))) {
+			status = StatusIgnored
+		}
+		_, err := tx.Exec(saveSuggestionQuery, feed.ID, item.GUID, item.URL, item.Title, item.Summary, item.PublishedAt, status)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(recordSuccessQuery, feed.ID, parsed.Title, parsed.SiteURL, result.etag, result.lastModified, now, nextPoll(feed, now))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func nextPoll(feed Feed, now time.Time) time.Time {
+	return now.Add(time.Duration(feed.Interval) * time.Minute)
+}
+
+// recordFailure notes that polling a feed failed, and when to try again
+func recordFailure(db *sql.DB, feed Feed, now time.Time, pollErr error) error {
+	retryAt := now.Add(backoff(feed.Interval, feed.ErrorCount+1))
+	_, err := db.Exec(recordFailureQuery, feed.ID, now, retryAt, pollErr.Error())
+	return firstError(pollErr, err)
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Poller checks every active feed in the background, each when it comes due
+type Poller struct {
+	db        *sql.DB
+	userAgent string
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewPoller creates a Poller. urlBase is where this instance lives, and is mentioned in the
+// User-Agent we send so that whoever runs a feed knows who's asking for it.
+func NewPoller(db *sql.DB, urlBase string) *Poller {
+	return &Poller{
+		db:        db,
+		userAgent: fmt.Sprintf("LinkLetter feed poller (+%s)", urlBase),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start kicks off the poller in the background
+func (poller *Poller) Start() {
+	logger.Info.Printf("Starting feed poller")
+	poller.wg.Add(1)
+	go poller.run()
+}
+
+// Stop tells the poller to finish whatever feed it's polling and then waits for it to do so
+func (poller *Poller) Stop() {
+	close(poller.stop)
+	poller.wg.Wait()
+}
+
+func (poller *Poller) run() {
+	defer poller.wg.Done()
+	for {
+		select {
+		case <-poller.stop:
+			return
+		default:
+		}
+
+		found, err := poller.pollNext()
+		if err != nil {
+			logger.Error.Printf("Error occurred while looking for feeds to poll: %s", err)
+		}
+
+		if !found || err != nil {
+			select {
+			case <-poller.stop:
+				return
+			case <-time.After(pollerInterval):
+			}
+		}
+	}
+}
+
+// pollNext claims and polls a single feed that's due. It returns whether there was one. A
+// feed that fails to poll isn't an error here, Poll has already recorded it against the feed.
+func (poller *Poller) pollNext() (bool, error) {
+	feed, err := scanFeed(poller.db.QueryRow(claimFeedQuery))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := Poll(poller.db, feed, poller.userAgent, time.Now()); err != nil {
+		logger.Warning.Printf("Unable to poll feed %d (%s): %s", feed.ID, feed.URL, err)
+	} else {
+		logger.Debug.Printf("Polled feed %d (%s)", feed.ID, feed.URL)
+	}
+	return true, nil
+}
@@ -0,0 +1,174 @@
+package feeds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+	"github.com/cj-dimaggio/LinkLetter/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUserAgent = "LinkLetter feed poller (+https://linkletter.example.com)"
+
+var pollTime = time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func testFeed() Feed {
+	polled := pollTime.Add(-time.Hour)
+	return Feed{ID: 1, URL: "https://example.com/feed.xml", Interval: 60, Active: true, ETag: `"abc"`,
+		LastModified: "Tue, 28 Feb 2017 00:00:00 GMT", LastPolledAt: &polled}
+}
+
+func serveFeed(t *testing.T, status int, body []byte) testhelpers.TestingHTTPTransport {
+	return testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "https://example.com/feed.xml", req.URL.String())
+		assert.Equal(t, testUserAgent, req.Header.Get("User-Agent"))
+		assert.Equal(t, `"abc"`, req.Header.Get("If-None-Match"))
+		assert.Equal(t, "Tue, 28 Feb 2017 00:00:00 GMT", req.Header.Get("If-Modified-Since"))
+
+		resp := httptest.NewRecorder()
+		resp.Header().Set("ETag", `"def"`)
+		resp.WriteHeader(status)
+		resp.Write(body)
+		return resp.Result(), nil
+	})
+}
+
+func TestPoll(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 200, readAsset(t, "rss.xml"))
+	defer transport.Close()
+
+	published := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).
+		WithArgs(1, "post-2", "https://example.com/posts/job-queue", "Postgres is a fine job queue", "It turns out SKIP LOCKED is all you need.", &published, StatusSuggested).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(recordSuccessQuery)).
+		WithArgs(1, "Example & Friends", "https://example.com/", `"def"`, "", pollTime, pollTime.Add(time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, Poll(db, testFeed(), testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPollFirstTime(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 200, readAsset(t, "rss.xml"))
+	defer transport.Close()
+
+	// Only what's from the last week is suggested the first time, everything else is ignored
+	feed := testFeed()
+	feed.LastPolledAt = nil
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).
+		WithArgs(1, "post-2", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), StatusSuggested).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).
+		WithArgs(1, "https://example.com/posts/relative", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), StatusSuggested).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(regexp.QuoteMeta(saveSuggestionQuery)).
+		WithArgs(1, "https://example.com/posts/guid-only", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), StatusIgnored).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(regexp.QuoteMeta(recordSuccessQuery)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, Poll(db, feed, testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPollNotModified(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 304, nil)
+	defer transport.Close()
+
+	feed := testFeed()
+	mock.ExpectExec(regexp.QuoteMeta(recordSuccessQuery)).
+		WithArgs(1, "", "", `"def"`, feed.LastModified, pollTime, pollTime.Add(time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, Poll(db, feed, testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPollFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 500, []byte("oops"))
+	defer transport.Close()
+
+	// The feed has failed twice before, so this is the third time and it waits 8 intervals
+	feed := testFeed()
+	feed.ErrorCount = 2
+	mock.ExpectExec(regexp.QuoteMeta(recordFailureQuery)).
+		WithArgs(1, pollTime, pollTime.Add(8*time.Hour), "The feed responded with 500").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Equal(t, errors.New("The feed responded with 500"), Poll(db, feed, testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPollUnreadable(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 200, []byte("<html><body>Moved!</body></html>"))
+	defer transport.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(recordFailureQuery)).
+		WithArgs(1, pollTime, pollTime.Add(2*time.Hour), "Unable to read the feed: "+ErrNotAFeed.Error()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NotNil(t, Poll(db, testFeed(), testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPollGone(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serveFeed(t, 410, nil)
+	defer transport.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(recordGoneQuery)).
+		WithArgs(1, pollTime, errGone.Error()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Equal(t, errGone, Poll(db, testFeed(), testUserAgent, pollTime))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Hour, backoff(60, 0))
+	assert.Equal(t, 2*time.Hour, backoff(60, 1))
+	assert.Equal(t, 32*time.Hour/2, backoff(60, 4))
+	assert.Equal(t, maxBackoff, backoff(60, 10))
+	assert.Equal(t, maxBackoff, backoff(MaxInterval, 0))
+}
+
+func TestPollNext(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	poller := NewPoller(db, "https://linkletter.example.com")
+	assert.Equal(t, testUserAgent, poller.userAgent)
+
+	mock.ExpectQuery(regexp.QuoteMeta(claimFeedQuery)).WillReturnRows(feedRows())
+	found, err := poller.pollNext()
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestFetchRefusesLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(readAsset(t, "rss.xml"))
+	}))
+	defer server.Close()
+
+	feed := testFeed()
+	feed.URL = server.URL
+	_, err := fetch(feed, testUserAgent)
+	assert.True(t, errors.Is(err, publicnet.ErrNotPublic))
+}
@@ -0,0 +1,128 @@
+package feeds
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+)
+
+// These are the states an item found in a feed can be in. "ignored" is for items that were
+// already in a feed when we started following it, see Poll.
+const (
+	StatusSuggested = "suggested"
+	StatusPromoted  = "promoted"
+	StatusDismissed = "dismissed"
+	StatusIgnored   = "ignored"
+)
+
+const (
+	selectSuggestions = "SELECT i.id, i.feed_id, COALESCE(NULLIF(f.title, ''), f.url), i.guid, i.url, i.title, i.summary, " +
+		"i.published_at, i.status, COALESCE(i.link_id, 0), i.created_at FROM feed_items i JOIN feeds f ON f.id = i.feed_id"
+
+	listSuggestedQuery  = selectSuggestions + " WHERE i.status = 'suggested' ORDER BY COALESCE(i.published_at, i.created_at) DESC, i.id DESC LIMIT $1"
+	getSuggestionQuery  = selectSuggestions + " WHERE i.id = $1"
+	countSuggestedQuery = "SELECT COUNT(*) FROM feed_items WHERE status = 'suggested'"
+	promoteQuery        = "UPDATE feed_items SET status = 'promoted', link_id = $2 WHERE id = $1"
+	dismissQuery        = "UPDATE feed_items SET status = 'dismissed' WHERE id = $1 AND status = 'suggested'"
+	saveSuggestionQuery = "INSERT INTO feed_items (feed_id, guid, url, title, summary, published_at, status) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (feed_id, guid) DO NOTHING"
+)
+
+// ErrNotSuggested is returned when promoting something that's already been dealt with
+var ErrNotSuggested = errors.New("That has already been promoted or dismissed")
+
+// Suggestion is an item found in a feed, waiting on (or already seen by) an editor
+type Suggestion struct {
+	ID          int64
+	FeedID      int64
+	FeedTitle   string
+	GUID        string
+	URL         string
+	Title       string
+	Summary     string
+	PublishedAt *time.Time
+	Status      string
+
+	// LinkID is the link the suggestion was promoted to, or 0
+	LinkID int64
+
+	CreatedAt time.Time
+}
+
+// DisplayTitle is the title of the suggestion, falling back to its URL
+func (suggestion Suggestion) DisplayTitle() string {
+	if suggestion.Title != "" {
+		return suggestion.Title
+	}
+	return suggestion.URL
+}
+
+func scanSuggestion(row scanner) (Suggestion, error) {
+	suggestion := Suggestion{}
+	err := row.Scan(&suggestion.ID, &suggestion.FeedID, &suggestion.FeedTitle, &suggestion.GUID, &suggestion.URL,
+		&suggestion.Title, &suggestion.Summary, &suggestion.PublishedAt, &suggestion.Status, &suggestion.LinkID,
+		&suggestion.CreatedAt)
+	return suggestion, err
+}
+
+// ListSuggested retrieves the newest suggestions still waiting on an editor
+func ListSuggested(db *sql.DB, limit int) ([]Suggestion, error) {
+	rows, err := db.Query(listSuggestedQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []Suggestion{}
+	for rows.Next() {
+		suggestion, err := scanSuggestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, suggestion)
+	}
+	return found, rows.Err()
+}
+
+// CountSuggested is how many suggestions are waiting on an editor
+func CountSuggested(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(countSuggestedQuery).Scan(&count)
+	return count, err
+}
+
+// GetSuggestion retrieves a single suggestion, or sql.ErrNoRows if there isn't one
+func GetSuggestion(db *sql.DB, id int64) (Suggestion, error) {
+	return scanSuggestion(db.QueryRow(getSuggestionQuery, id))
+}
+
+// Promote shares a suggestion as a link, submitted by the editor who promoted it
+func Promote(db *sql.DB, id, submitterID int64) (links.Link, error) {
+	suggestion, err := GetSuggestion(db, id)
+	if err != nil {
+		return links.Link{}, err
+	}
+	if suggestion.Status != StatusSuggested {
+		return links.Link{}, ErrNotSuggested
+	}
+
+	link, err := links.Create(db, links.Link{
+		URL:         suggestion.URL,
+		Title:       suggestion.Title,
+		Description: suggestion.Summary,
+		SubmitterID: submitterID,
+	})
+	if err != nil {
+		return link, err
+	}
+
+	_, err = db.Exec(promoteQuery, id, link.ID)
+	return link, err
+}
+
+// Dismiss takes a suggestion out of the queue without sharing it
+func Dismiss(db *sql.DB, id int64) error {
+	_, err := db.Exec(dismissQuery, id)
+	return err
+}
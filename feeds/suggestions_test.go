@@ -0,0 +1,60 @@
+package feeds
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var suggestionColumns = []string{"id", "feed_id", "feed_title", "guid", "url", "title", "summary", "published_at", "status", "link_id", "created_at"}
+
+func TestListSuggested(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listSuggestedQuery)).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(suggestionColumns).
+			AddRow(4, 1, "Example", "post-2", "https://example.com/posts/2", "", "", nil, StatusSuggested, 0, time.Now()))
+
+	found, err := ListSuggested(db, 10)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "https://example.com/posts/2", found[0].DisplayTitle())
+	assert.Nil(t, found[0].PublishedAt)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPromote(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getSuggestionQuery)).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(suggestionColumns).
+			AddRow(4, 1, "Example", "post-2", "https://example.com/posts/2", "Post", "About a thing", nil, StatusSuggested, 0, time.Now()))
+	mock.ExpectQuery("INSERT INTO links").
+		WithArgs("https://example.com/posts/2", "Post", "About a thing", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(42, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(promoteQuery)).WithArgs(4, 42).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	link, err := Promote(db, 4, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), link.ID)
+	assert.Equal(t, "Post", link.Title)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPromoteAlreadyDone(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getSuggestionQuery)).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(suggestionColumns).
+			AddRow(4, 1, "Example", "post-2", "https://example.com/posts/2", "Post", "", nil, StatusDismissed, 0, time.Now()))
+
+	_, err := Promote(db, 4, 7)
+	assert.Equal(t, ErrNotSuggested, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
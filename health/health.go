@@ -0,0 +1,240 @@
+// Package health tells whatever's in front of us (Heroku, Kubernetes, a load balancer) whether
+// we're alive, and whether we're ready to be sent requests.
+package health
+
+// Those are two different questions. /healthz is whether the process is alive at all, and all
+// it takes to answer it is being able to answer. If it stops answering, the process is stuck
+// and should be restarted. /readyz is whether we can actually do our job: whether we can reach
+// Postgres, whether the database is in the shape this version of the code expects (it won't be
+// while migrations are running, or while an older version is still running against a database
+// a newer one has migrated) and whether we can reach the SMTP relay. Failing it just means we
+// shouldn't be sent any requests for now; restarting us wouldn't help anything.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/database"
+	"github.com/cj-dimaggio/LinkLetter/mail"
+)
+
+// checkTimeout is as long as any one check gets. Probes usually give up after a second or
+// two themselves, and a check that's taking longer than this is as good as failing anyway.
+const checkTimeout = 2 * time.Second
+
+// mailCheckInterval is how long we trust the last check of the mail relay for. Probes tend to
+// come every few seconds, and relays don't take kindly to being connected to that often by
+// somebody who never sends anything.
+const mailCheckInterval = time.Minute
+
+// These are what a check can come back as. A check that's disabled isn't run at all, because
+// the config has turned off whatever it checks.
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDisabled = "disabled"
+)
+
+// These are what a Report can come back as
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+)
+
+// ErrMigrating is the migrations check failing because they're still running
+var ErrMigrating = errors.New("Migrations are running")
+
+// Result is how a single check went
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is how every check went. We're StatusReady only if none of them are failing.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready is whether the report says we're ready for requests
+func (report Report) Ready() bool {
+	return report.Status == StatusReady
+}
+
+// check is one of the things we check. A nil run means the check is disabled.
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Checker runs our readiness checks
+type Checker struct {
+	checks    []check
+	migrating int32
+}
+
+// NewChecker creates a Checker for the database and mail relay. If the sender doesn't have
+// a host, sending mail is turned off, and so is its check.
+func NewChecker(db *sql.DB, sender mail.SMTPSender) *Checker {
+	checker := &Checker{}
+	checker.checks = []check{
+		{"migrations", checker.checkMigrating},
+		{"database", func(ctx context.Context) error { return db.PingContext(ctx) }},
+		{"schema", func(ctx context.Context) error { return checkSchema(ctx, db) }},
+		{"mail", nil},
+	}
+	if sender.Host != "" {
+		checker.checks[3].run = cached(mailCheckInterval, func(ctx context.Context) error { return sender.Ping(checkTimeout) })
+	}
+	return checker
+}
+
+// cached remembers how a check went for a while, rather than running it every time
+func cached(interval time.Duration, run func(ctx context.Context) error) func(ctx context.Context) error {
+	mu := sync.Mutex{}
+	var checkedAt time.Time
+	var last error
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if checkedAt.IsZero() || time.Since(checkedAt) > interval {
+			last = run(ctx)
+			checkedAt = time.Now()
+		}
+		return last
+	}
+}
+
+// SetMigrating marks migrations as running (or not), which fails the readiness check while
+// they are
+func (checker *Checker) SetMigrating(migrating bool) {
+	value := int32(0)
+	if migrating {
+		value = 1
+	}
+	atomic.StoreInt32(&checker.migrating, value)
+}
+
+// Migrating is whether migrations are running
+func (checker *Checker) Migrating() bool {
+	return atomic.LoadInt32(&checker.migrating) == 1
+}
+
+func (checker *Checker) checkMigrating(ctx context.Context) error {
+	if checker.Migrating() {
+		return ErrMigrating
+	}
+	return nil
+}
+
+// migratingRetryAfter is how long we suggest waiting before trying again while migrations are
+// running. Most of them are over in a second or two.
+const migratingRetryAfter = "5"
+
+// WhileMigrating turns every request away with a 503 while migrations are running, rather than
+// handing it to next to run against a database that's half way between one schema and the
+// next. We start listening before the migrations start, so that the probes can say how
+// they're getting on, but plenty of what's in front of us (Heroku's router included) never
+// asks the probes, and sends requests along the moment we're listening. So the probes need
+// to go around this.
+func (checker *Checker) WhileMigrating(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checker.Migrating() {
+			w.Header().Set("Retry-After", migratingRetryAfter)
+			http.Error(w, "We're in the middle of an upgrade. Try again in a few seconds.", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkSchema makes sure the last migration that's been run is the last one we know about
+func checkSchema(ctx context.Context, db *sql.DB) error {
+	expected, err := database.LatestMigration()
+	if err != nil {
+		return err
+	}
+	actual, err := database.SchemaVersionContext(ctx, db)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("The database is at migration '%s' but we expect '%s'", actual, expected)
+	}
+	return nil
+}
+
+// Check runs every check, all at once so that a slow one doesn't hold up the others, and
+// reports on how they went
+func (checker *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]Result, len(checker.checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checker.checks {
+		if c.run == nil {
+			results[i] = Result{Name: c.name, Status: StatusDisabled}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.run(ctx)
+			results[i] = Result{Name: c.name, Status: StatusOK, DurationMS: float64(time.Since(start)) / float64(time.Millisecond)}
+			if err != nil {
+				results[i].Status = StatusFailing
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusFailing {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+// LiveHandler serves /healthz. If we can run it, we're alive.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, struct {
+			Status string `json:"status"`
+		}{StatusOK})
+	})
+}
+
+// ReadyHandler serves /readyz, with the Report as JSON. It's a 503 if we aren't ready, since
+// that's all most probes look at.
+func (checker *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/database"
+	"github.com/cj-dimaggio/LinkLetter/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+const schemaQuery = "SELECT version FROM _migrations_"
+
+// inRepo moves up to the top of the repository, where the migrations are
+func inRepo(t *testing.T) func() {
+	originalCWD, _ := os.Getwd()
+	os.Chdir("../")
+	return func() { os.Chdir(originalCWD) }
+}
+
+func TestReady(t *testing.T) {
+	defer inRepo(t)()
+	latest, _ := database.LatestMigration()
+
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(schemaQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(latest))
+
+	resp := httptest.NewRecorder()
+	NewChecker(db, mail.SMTPSender{}).ReadyHandler().ServeHTTP(resp, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	report := Report{}
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	assert.Equal(t, StatusReady, report.Status)
+	assert.Len(t, report.Checks, 4)
+	assert.Equal(t, "schema", report.Checks[2].Name)
+	assert.Equal(t, StatusOK, report.Checks[2].Status)
+	assert.Equal(t, "mail", report.Checks[3].Name)
+	assert.Equal(t, StatusDisabled, report.Checks[3].Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestNotReady(t *testing.T) {
+	defer inRepo(t)()
+
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(schemaQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("1_jobs.sql"))
+
+	checker := NewChecker(db, mail.SMTPSender{})
+	checker.SetMigrating(true)
+
+	resp := httptest.NewRecorder()
+	checker.ReadyHandler().ServeHTTP(resp, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+
+	report := Report{}
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	assert.Equal(t, StatusNotReady, report.Status)
+	assert.Equal(t, Result{Name: "migrations", Status: StatusFailing, Error: ErrMigrating.Error(), DurationMS: report.Checks[0].DurationMS}, report.Checks[0])
+	assert.Equal(t, StatusFailing, report.Checks[2].Status)
+	assert.Contains(t, report.Checks[2].Error, "'1_jobs.sql'")
+
+	checker.SetMigrating(false)
+	mock.ExpectQuery(schemaQuery).WillReturnError(errors.New("No database"))
+	report = checker.Check(context.Background())
+	assert.Equal(t, StatusOK, report.Checks[0].Status)
+	assert.Equal(t, "No database", report.Checks[2].Error)
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	run := cached(time.Hour, func(ctx context.Context) error {
+		calls++
+		return errors.New("Down")
+	})
+	assert.NotNil(t, run(context.Background()))
+	assert.NotNil(t, run(context.Background()))
+	assert.Equal(t, 1, calls)
+}
+
+func TestLive(t *testing.T) {
+	resp := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}\n", resp.Body.String())
+}
+
+func TestWhileMigrating(t *testing.T) {
+	checker := NewChecker(nil, mail.SMTPSender{})
+	handler := checker.WhileMigrating(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Served"))
+	}))
+
+	checker.SetMigrating(true)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "5", resp.Header().Get("Retry-After"))
+	assert.NotContains(t, resp.Body.String(), "Served")
+
+	checker.SetMigrating(false)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Served", resp.Body.String())
+}
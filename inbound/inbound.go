@@ -0,0 +1,234 @@
+// Package inbound lets people share links by emailing them to us, either through our own
+// little SMTP server or a webhook that an email provider posts raw messages to.
+package inbound
+
+// Every user has their own address, which is the instance's inbound address with a secret
+// token tacked on after a "+" (see users.InboundToken):
+//
+//     links+k3j5h2g4f6d8s7a9@linkletter.example.com
+//
+// Plus addressing like this is handled by just about every mail provider, so somebody
+// running their inbound mail through Mailgun or a catch-all mailbox doesn't have to set up
+// an address for every user. Knowing the token is what proves a message came from the user
+// it claims to. On top of that the sender has to actually be that user, so that somebody
+// who has a token but not the email account it belongs to can't do much with it either.
+//
+// Every URL in the message gets shared, with the message's subject as its description, and
+// then we reply to let the user know what we did. Messages we reject don't get a reply.
+// Replying to a sender we can't vouch for is exactly how mail servers end up spamming
+// innocent people whose addresses were forged ("backscatter").
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/mail"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+)
+
+// MaxLinks is the most links we'll share out of a single message. Forwarded newsletters
+// can easily have a hundred links in their footers alone, and nobody wants those.
+const MaxLinks = 10
+
+// MaxMessageSize is the biggest message we'll accept, in bytes
+const MaxMessageSize = 10 << 20
+
+var (
+	// ErrUnknownRecipient is returned when a message isn't addressed to any user's inbound address
+	ErrUnknownRecipient = errors.New("Message is not addressed to a known inbound address")
+
+	// ErrWrongSender is returned when a message was sent to a user's inbound address, but not by them
+	ErrWrongSender = errors.New("Message was not sent by the owner of the inbound address")
+
+	// ErrAutomated is returned for bounces, auto-replies and the like, which we ignore
+	ErrAutomated = errors.New("Message was sent automatically")
+)
+
+// Address builds a user's inbound address out of the instance's inbound address and their token
+func Address(inboundAddress, token string) string {
+	at := strings.LastIndex(inboundAddress, "@")
+	if at == -1 {
+		return ""
+	}
+	return inboundAddress[:at] + "+" + token + inboundAddress[at:]
+}
+
+// Token pulls the token out of one of our users' inbound addresses. The second value is false
+// if the address isn't one of ours.
+func Token(inboundAddress, recipient string) (string, bool) {
+	inboundAddress = strings.ToLower(strings.TrimSpace(inboundAddress))
+	recipient = strings.ToLower(strings.Trim(strings.TrimSpace(recipient), "<>"))
+
+	at := strings.LastIndex(inboundAddress, "@")
+	if at == -1 || !strings.HasSuffix(recipient, inboundAddress[at:]) {
+		return "", false
+	}
+	local := strings.TrimSuffix(recipient, inboundAddress[at:])
+	token := strings.TrimPrefix(local, inboundAddress[:at]+"+")
+	if token == local || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// Result is what came of processing a message
+type Result struct {
+	User  users.User
+	Links []links.Link
+
+	// Skipped are URLs we found but didn't share, because they weren't valid or the message
+	// had more than MaxLinks
+	Skipped []string
+}
+
+// Processor shares the links in messages sent to our inbound addresses
+type Processor struct {
+	db             *sql.DB
+	queue          *jobs.Queue
+	inboundAddress string
+	urlBase        string
+}
+
+// NewProcessor creates a Processor for messages sent to the given inbound address. urlBase is
+// where the site lives, for links in our replies.
+func NewProcessor(db *sql.DB, inboundAddress, urlBase string) *Processor {
+	return &Processor{
+		db:             db,
+		queue:          jobs.NewQueue(db),
+		inboundAddress: inboundAddress,
+		urlBase:        strings.TrimRight(urlBase, "/"),
+	}
+}
+
+// Accepts determines if a recipient looks like one of our inbound addresses, without
+// checking if the token actually belongs to anybody
+func (processor *Processor) Accepts(recipient string) bool {
+	_, ok := Token(processor.inboundAddress, recipient)
+	return ok
+}
+
+// Process shares the links in a message and queues up a reply to the user who sent it
+func (processor *Processor) Process(message Message) (Result, error) {
+	result := Result{}
+	if message.Automated {
+		return result, ErrAutomated
+	}
+
+	user, err := processor.findUser(message)
+	if err != nil {
+		return result, err
+	}
+	result.User = user
+
+	result.Links, result.Skipped, err = processor.createLinks(user, message)
+	if err != nil {
+		return result, err
+	}
+	logger.Info.Printf("Shared %d links emailed in by %s", len(result.Links), user.Email)
+
+	// The links are shared now, so nothing from here on is the sender's problem. Failing would
+	// have their server send the message again, and we'd share everything in it twice.
+	for _, link := range result.Links {
+		if err := webhooks.Dispatch(processor.db, webhooks.EventLinkCreated, webhooks.FromLink(link, processor.urlBase)); err != nil {
+			logger.Error.Printf("Unable to send %s to webhooks: %s", webhooks.EventLinkCreated, err)
+		}
+	}
+	if err := mail.Enqueue(processor.queue, processor.reply(message, result)); err != nil {
+		logger.Error.Printf("Unable to queue up the reply to %s: %s", user.Email, err)
+	}
+	return result, nil
+}
+
+// createLinks shares the links in a message, all at once or not at all, so that if the sender
+// has to try again they won't end up with the first few shared twice
+func (processor *Processor) createLinks(user users.User, message Message) ([]links.Link, []string, error) {
+	var created []links.Link
+	var skipped []string
+
+	tx, err := processor.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	note := message.Note()
+	for _, found := range links.ExtractURLs(message.Text) {
+		if len(created) >= MaxLinks {
+			skipped = append(skipped, found)
+			continue
+		}
+		link, err := links.Create(tx, links.Link{URL: found, Description: note, SubmitterID: user.ID})
+		if err == links.ErrInvalidURL {
+			skipped = append(skipped, found)
+			continue
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		link.SubmitterEmail = user.Email
+		created = append(created, link)
+	}
+	return created, skipped, tx.Commit()
+}
+
+// findUser works out whose inbound address the message was sent to, and makes sure they're
+// the one who sent it
+func (processor *Processor) findUser(message Message) (users.User, error) {
+	for _, recipient := range message.Recipients {
+		token, ok := Token(processor.inboundAddress, recipient)
+		if !ok {
+			continue
+		}
+
+		user, err := users.GetByInboundToken(processor.db, token)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return user, err
+		}
+
+		if !strings.EqualFold(user.Email, message.From) {
+			return users.User{}, ErrWrongSender
+		}
+		return user, nil
+	}
+	return users.User{}, ErrUnknownRecipient
+}
+
+// reply writes the confirmation email for a processed message
+func (processor *Processor) reply(message Message, result Result) mail.Message {
+	body := &bytes.Buffer{}
+	if len(result.Links) == 0 {
+		body.WriteString("We couldn't find any links in your email, so nothing was shared.\n")
+	} else {
+		fmt.Fprintf(body, "Thanks! We shared %d link(s) from your email:\n\n", len(result.Links))
+		for _, link := range result.Links {
+			fmt.Fprintf(body, "%s\n%s/links/%d\n\n", link.URL, processor.urlBase, link.ID)
+		}
+	}
+	if len(result.Skipped) > 0 {
+		body.WriteString("\nThese were left out:\n\n")
+		for _, skipped := range result.Skipped {
+			fmt.Fprintf(body, "%s\n", skipped)
+		}
+	}
+
+	subject := "Re: " + message.Subject
+	if message.Subject == "" {
+		subject = "Your links"
+	}
+	return mail.Message{
+		To:        result.User.Email,
+		Subject:   subject,
+		Body:      body.String(),
+		InReplyTo: message.MessageID,
+		AutoReply: true,
+	}
+}
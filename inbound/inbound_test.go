@@ -0,0 +1,189 @@
+package inbound
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testInboundAddress = "links@linkletter.example.com"
+	getUserQuery       = "FROM users WHERE inbound_token = $1"
+	createLinkQuery    = "INSERT INTO links"
+	webhooksQuery      = "FROM webhooks"
+	enqueueQuery       = "INSERT INTO jobs"
+)
+
+var userColumns = []string{"id", "email", "role", "created_at"}
+
+func TestAddress(t *testing.T) {
+	assert.Equal(t, "links+abc123@linkletter.example.com", Address(testInboundAddress, "abc123"))
+	assert.Equal(t, "", Address("not an address", "abc123"))
+}
+
+func TestToken(t *testing.T) {
+	token, ok := Token(testInboundAddress, "<Links+ABC123@LinkLetter.example.com>")
+	assert.True(t, ok)
+	assert.Equal(t, "abc123", token)
+
+	for _, recipient := range []string{
+		"links@linkletter.example.com",
+		"links+@linkletter.example.com",
+		"other+abc123@linkletter.example.com",
+		"links+abc123@example.com",
+		"links+abc123@evil-linkletter.example.com",
+	} {
+		_, ok := Token(testInboundAddress, recipient)
+		assert.False(t, ok, recipient)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "https://linkletter.example.com/")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(createLinkQuery).
+		WithArgs("https://example.com/a", "", "Good stuff", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(webhooksQuery).
+		WithArgs("link.created").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(enqueueQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	result, err := processor.Process(Message{
+		From:       "someone@example.com",
+		Recipients: []string{"someone.else@example.com", "links+abc123@linkletter.example.com"},
+		Subject:    "Fwd: Good stuff",
+		Text:       "https://example.com/a and ftp://example.com/b",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), result.User.ID)
+	assert.Len(t, result.Links, 1)
+	assert.Equal(t, int64(10), result.Links[0].ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "")
+
+	// Either every link is shared or none of them are, so that the sender trying again doesn't
+	// share the first one twice
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(createLinkQuery).
+		WithArgs("https://example.com/a", "", "", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+	mock.ExpectQuery(createLinkQuery).
+		WithArgs("https://example.com/b", "", "", 5).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err := processor.Process(Message{
+		From:       "someone@example.com",
+		Recipients: []string{"links+abc123@linkletter.example.com"},
+		Text:       "https://example.com/a https://example.com/b",
+	})
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessAfterSharing(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "")
+
+	// Once the links are in, trouble with webhooks or the reply isn't passed on to the sender,
+	// who'd only send the message again
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(createLinkQuery).
+		WithArgs("https://example.com/a", "", "", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(webhooksQuery).WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(enqueueQuery).WillReturnError(errors.New("connection reset"))
+
+	result, err := processor.Process(Message{
+		From:       "someone@example.com",
+		Recipients: []string{"links+abc123@linkletter.example.com"},
+		Text:       "https://example.com/a",
+	})
+	assert.Nil(t, err)
+	assert.Len(t, result.Links, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessWrongSender(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+
+	_, err := processor.Process(Message{
+		From:       "impostor@example.com",
+		Recipients: []string{"links+abc123@linkletter.example.com"},
+		Text:       "https://example.com/a",
+	})
+	assert.Equal(t, ErrWrongSender, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessUnknownRecipient(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("nope").
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	_, err := processor.Process(Message{
+		From:       "someone@example.com",
+		Recipients: []string{"links@linkletter.example.com", "links+nope@linkletter.example.com"},
+	})
+	assert.Equal(t, ErrUnknownRecipient, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessAutomated(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	processor := NewProcessor(db, testInboundAddress, "")
+
+	_, err := processor.Process(Message{Automated: true, Recipients: []string{"links+abc123@linkletter.example.com"}})
+	assert.Equal(t, ErrAutomated, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReply(t *testing.T) {
+	processor := NewProcessor(nil, testInboundAddress, "https://linkletter.example.com/")
+
+	reply := processor.reply(Message{Subject: "Good stuff", MessageID: "<abc@example.com>"}, Result{
+		Links:   []links.Link{{ID: 10, URL: "https://example.com/a"}},
+		Skipped: []string{"https://example.com/b"},
+	})
+	assert.Equal(t, "Re: Good stuff", reply.Subject)
+	assert.Equal(t, "<abc@example.com>", reply.InReplyTo)
+	assert.True(t, reply.AutoReply)
+	assert.Contains(t, reply.Body, "https://example.com/a\nhttps://linkletter.example.com/links/10\n")
+	assert.Contains(t, reply.Body, "left out:\n\nhttps://example.com/b\n")
+
+	reply = processor.reply(Message{}, Result{})
+	assert.Equal(t, "Your links", reply.Subject)
+	assert.Contains(t, reply.Body, "couldn't find any links")
+}
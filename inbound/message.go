@@ -0,0 +1,196 @@
+package inbound
+
+// Email is a lot more complicated than it looks. Something as simple as "here's a link you
+// might like" can show up as plain text, as HTML, as both at once (multipart/alternative),
+// or, when somebody hits "Forward as attachment", tucked away inside of a message/rfc822
+// part of a multipart/mixed message. Any of those can then be quoted-printable or base64
+// encoded on top. So rather than trying to find "the" body of a message we walk through
+// every part of it, decode whatever's text, and gather it all up. Once we have the text
+// all we need out of it are the URLs, so it doesn't much matter if it's a bit of a mess.
+//
+// The one thing we don't attempt is converting between character sets. URLs are ASCII, so
+// a message in ISO-8859-1 still gets us the right links, just with an odd character or two
+// in anything else.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxDepth is how deeply we'll dig into nested parts before giving up on them. Real email
+// doesn't get anywhere close, but somebody could very easily construct one that does.
+const maxDepth = 10
+
+// ErrNoSender is returned when a message doesn't have a usable From header
+var ErrNoSender = errors.New("Message does not have a sender")
+
+// forwardPrefix matches the "Fwd:"s and "Re:"s mail clients stack up at the start of a subject
+var forwardPrefix = regexp.MustCompile(`^(?i)((fwd?|re)\s*:\s*)+`)
+
+// Message is what we care about in an email somebody sent to us
+type Message struct {
+	// From is the bare email address of the sender, lowercased
+	From string
+
+	// Recipients is every address the message was sent to, as far as its headers say. Anything
+	// we learn about the envelope (from SMTP, or a webhook) gets added to it.
+	Recipients []string
+
+	Subject   string
+	MessageID string
+
+	// Text is all of the text in the message, from every part we could read
+	Text string
+
+	// Automated is set for bounces, vacation responders, mailing lists and the like, which we
+	// should never reply to
+	Automated bool
+}
+
+// Note is the subject with any "Fwd:" and "Re:" prefixes cleaned off, to be used as the
+// description of the links in the message
+func (message Message) Note() string {
+	return strings.TrimSpace(forwardPrefix.ReplaceAllString(message.Subject, ""))
+}
+
+// Parse reads a raw RFC 5322 email
+func Parse(r io.Reader) (Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Message{}, err
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return Message{}, ErrNoSender
+	}
+
+	decoder := &mime.WordDecoder{}
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	message := Message{
+		From:       strings.ToLower(from.Address),
+		Recipients: []string{},
+		Subject:    strings.TrimSpace(subject),
+		MessageID:  strings.TrimSpace(msg.Header.Get("Message-Id")),
+		Automated:  isAutomated(msg.Header),
+	}
+
+	for _, field := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		if msg.Header.Get(field) == "" {
+			continue
+		}
+		addresses, err := msg.Header.AddressList(field)
+		if err != nil {
+			// One malformed header shouldn't stop us from finding the address in another
+			continue
+		}
+		for _, address := range addresses {
+			message.Recipients = append(message.Recipients, strings.ToLower(address.Address))
+		}
+	}
+
+	text := &bytes.Buffer{}
+	if err := readText(text, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, 0); err != nil {
+		return message, err
+	}
+	message.Text = text.String()
+	return message, nil
+}
+
+// isAutomated checks the headers that mark a message as not having been written by a person
+// (RFC 3834's Auto-Submitted, along with the older Precedence header that mailing lists and
+// vacation responders still use)
+func isAutomated(header mail.Header) bool {
+	if submitted := strings.ToLower(header.Get("Auto-Submitted")); submitted != "" && submitted != "no" {
+		return true
+	}
+	switch strings.ToLower(header.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return true
+	}
+	return header.Get("List-Id") != ""
+}
+
+// readText writes whatever text it can find in a (possibly multipart) body into out
+func readText(out *bytes.Buffer, contentType, encoding string, body io.Reader, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Messages without a Content-Type (or with one we can't make sense of) are plain text
+		mediaType = "text/plain"
+	}
+	body = decodeTransfer(body, encoding)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		// NextPart undoes quoted-printable for us (and removes the header saying it was), so
+		// decodeTransfer won't try to do it a second time
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") &&
+				!strings.HasPrefix(part.Header.Get("Content-Type"), "message/rfc822") {
+				continue
+			}
+			err = readText(out, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		inner, err := mail.ReadMessage(body)
+		if err != nil {
+			return err
+		}
+		return readText(out, inner.Header.Get("Content-Type"), inner.Header.Get("Content-Transfer-Encoding"), inner.Body, depth+1)
+	case mediaType == "text/html":
+		raw, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		// Entities need to be undone or "&amp;" would end up in the middle of our URLs. The
+		// tags can stay, URLs stop at quotes and angle brackets anyway.
+		out.WriteString(html.UnescapeString(string(raw)))
+		out.WriteString("\n")
+	case strings.HasPrefix(mediaType, "text/"):
+		if _, err := io.Copy(out, body); err != nil {
+			return err
+		}
+		out.WriteString("\n")
+	}
+	return nil
+}
+
+// decodeTransfer undoes a part's Content-Transfer-Encoding
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
@@ -0,0 +1,56 @@
+package inbound
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseAsset(t *testing.T, name string) (Message, error) {
+	file, err := os.Open("test_assets/" + name)
+	assert.Nil(t, err)
+	defer file.Close()
+	return Parse(file)
+}
+
+func TestParse(t *testing.T) {
+	message, err := parseAsset(t, "forwarded.eml")
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", message.From)
+	assert.Equal(t, []string{"links+abc123@linkletter.example.com"}, message.Recipients)
+	assert.Equal(t, "Fwd: Café reading", message.Subject)
+	assert.Equal(t, "Café reading", message.Note())
+	assert.Equal(t, "<original@example.com>", message.MessageID)
+	assert.False(t, message.Automated)
+
+	// Both the plain text and HTML parts are read, and the duplicate URL between them is
+	// only found once
+	assert.Equal(t, []string{"https://example.com/articles/long-one?utm_source=mail&page=2", "http://example.org/other"},
+		links.ExtractURLs(message.Text))
+}
+
+func TestParseForwardedAsAttachment(t *testing.T) {
+	message, err := parseAsset(t, "attached.eml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"newsletter@example.com", "links+abc123@linkletter.example.com"}, message.Recipients)
+	assert.Equal(t, []string{"https://example.net/story"}, links.ExtractURLs(message.Text))
+}
+
+func TestParseAutomated(t *testing.T) {
+	message, err := parseAsset(t, "automated.eml")
+	assert.Nil(t, err)
+	assert.True(t, message.Automated)
+}
+
+func TestParseNoSender(t *testing.T) {
+	_, err := Parse(strings.NewReader("To: links@example.com\r\nSubject: Hi\r\n\r\nhttps://example.com\r\n"))
+	assert.Equal(t, ErrNoSender, err)
+}
+
+func TestNote(t *testing.T) {
+	assert.Equal(t, "Worth reading", Message{Subject: "Fwd: RE: fw:Worth reading"}.Note())
+	assert.Equal(t, "Reading list", Message{Subject: "Reading list"}.Note())
+}
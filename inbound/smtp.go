@@ -0,0 +1,297 @@
+package inbound
+
+// Our SMTP server is about as minimal as a mail server can get while still being something
+// real mail servers are happy to talk to. It receives mail for our inbound addresses and
+// nothing else: there's no relaying, no authentication, and no mailboxes. Every message is
+// handed straight to the Processor while the sending server waits, so if something goes
+// wrong on our end we can tell it to try again later (a 4xx reply) rather than losing the
+// message.
+//
+// If you'd rather not have LinkLetter listening on port 25, point your existing mail setup
+// (or your email provider) at the webhook instead. See web/handlers/inbound.go.
+//
+// A conversation with it looks like this, "C:" being the sending server and "S:" us:
+//
+//     S: 220 linkletter.example.com ESMTP LinkLetter
+//     C: EHLO mail.example.com
+//     S: 250-linkletter.example.com
+//     S: 250-SIZE 10485760
+//     S: 250 8BITMIME
+//     C: MAIL FROM:<someone@example.com>
+//     S: 250 OK
+//     C: RCPT TO:<links+k3j5h2g4f6d8s7a9@linkletter.example.com>
+//     S: 250 OK
+//     C: DATA
+//     S: 354 End data with <CR><LF>.<CR><LF>
+//     C: (the message, ending with a line with just a ".")
+//     S: 250 OK: shared 1 link(s)
+//     C: QUIT
+//     S: 221 Bye
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+const (
+	smtpTimeout   = 5 * time.Minute
+	maxRecipients = 100
+)
+
+// SMTPServer receives mail for our inbound addresses
+type SMTPServer struct {
+	// Hostname is what we call ourselves when greeting other servers
+	Hostname  string
+	Processor *Processor
+
+	mutex    sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// NewSMTPServer creates an SMTPServer that hands messages to the supplied Processor
+func NewSMTPServer(hostname string, processor *Processor) *SMTPServer {
+	return &SMTPServer{Hostname: hostname, Processor: processor}
+}
+
+// ListenAndServe listens on the TCP address addr and handles connections until Close is called
+func (server *SMTPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve handles connections on the supplied listener until Close is called
+func (server *SMTPServer) Serve(listener net.Listener) error {
+	server.mutex.Lock()
+	server.listener = listener
+	server.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.mutex.Lock()
+			closed := server.closed
+			server.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go server.handle(conn)
+	}
+}
+
+// Close stops the server from accepting any new connections. Conversations that are already
+// under way are left to finish.
+func (server *SMTPServer) Close() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.closed = true
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Close()
+}
+
+// smtpSession is the state of a single conversation
+type smtpSession struct {
+	server  *SMTPServer
+	conn    net.Conn
+	text    *textproto.Conn
+	greeted bool
+
+	// mailing is set once we've been given a MAIL FROM. We can't just check for from, bounces
+	// are sent from an empty address: "MAIL FROM:<>".
+	mailing    bool
+	from       string
+	recipients []string
+}
+
+func (session *smtpSession) reply(code int, format string, args ...interface{}) {
+	session.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (session *smtpSession) reset() {
+	session.mailing = false
+	session.from = ""
+	session.recipients = nil
+}
+
+func (server *SMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	session := &smtpSession{server: server, conn: conn, text: textproto.NewConn(conn)}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	session.reply(220, "%s ESMTP LinkLetter", server.Hostname)
+
+	for {
+		conn.SetDeadline(time.Now().Add(smtpTimeout))
+		line, err := session.text.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				logger.Debug.Printf("SMTP connection from %s ended: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i != -1 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			session.greeted = true
+			session.reset()
+			session.reply(250, "%s", server.Hostname)
+		case "EHLO":
+			session.greeted = true
+			session.reset()
+			session.text.PrintfLine("250-%s", server.Hostname)
+			session.text.PrintfLine("250-SIZE %d", MaxMessageSize)
+			session.text.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			session.mail(arg)
+		case "RCPT":
+			session.rcpt(arg)
+		case "DATA":
+			session.data()
+		case "RSET":
+			session.reset()
+			session.reply(250, "OK")
+		case "NOOP":
+			session.reply(250, "OK")
+		case "VRFY":
+			session.reply(252, "Send some mail and we'll see")
+		case "QUIT":
+			session.reply(221, "Bye")
+			return
+		default:
+			session.reply(502, "Command not implemented")
+		}
+	}
+}
+
+// pathArgument pulls the address out of "FROM:<someone@example.com> SIZE=1234" and the like
+func pathArgument(arg, prefix string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	end := strings.Index(arg, ">")
+	if end == -1 {
+		return "", false
+	}
+	return arg[1:end], true
+}
+
+func (session *smtpSession) mail(arg string) {
+	if !session.greeted {
+		session.reply(503, "Say hello first")
+		return
+	}
+	from, ok := pathArgument(arg, "FROM:")
+	if !ok {
+		session.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	session.reset()
+	session.mailing = true
+	session.from = from
+	session.reply(250, "OK")
+}
+
+func (session *smtpSession) rcpt(arg string) {
+	if !session.mailing {
+		session.reply(503, "Need MAIL before RCPT")
+		return
+	}
+	recipient, ok := pathArgument(arg, "TO:")
+	if !ok {
+		session.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+	if !session.server.Processor.Accepts(recipient) {
+		session.reply(550, "5.1.1 No such user here")
+		return
+	}
+	if len(session.recipients) >= maxRecipients {
+		session.reply(452, "Too many recipients")
+		return
+	}
+	session.recipients = append(session.recipients, recipient)
+	session.reply(250, "OK")
+}
+
+func (session *smtpSession) data() {
+	if len(session.recipients) == 0 {
+		session.reply(503, "Need RCPT before DATA")
+		return
+	}
+	session.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	// The DotReader takes care of spotting the "." that ends the message and undoing the
+	// extra dots the sender added to lines that started with one
+	dot := session.text.DotReader()
+	raw, err := ioutil.ReadAll(io.LimitReader(dot, MaxMessageSize+1))
+	if err != nil {
+		session.reply(451, "Error reading message")
+		return
+	}
+	if len(raw) > MaxMessageSize {
+		// We still have to read the rest of it before we can say anything else
+		io.Copy(ioutil.Discard, dot)
+		session.reply(552, "Message is too big")
+		session.reset()
+		return
+	}
+
+	code, response := session.server.deliver(session.from, session.recipients, raw)
+	session.reply(code, "%s", response)
+	session.reset()
+}
+
+// deliver processes a message and decides how to answer the server that sent it to us
+func (server *SMTPServer) deliver(from string, recipients []string, raw []byte) (int, string) {
+	message, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		logger.Warning.Printf("Unable to parse an email from %s: %s", from, err)
+		return 554, "Unable to parse message"
+	}
+	message.Recipients = append(message.Recipients, recipients...)
+
+	result, err := server.Processor.Process(message)
+	switch err {
+	case nil:
+		return 250, fmt.Sprintf("OK: shared %d link(s)", len(result.Links))
+	case ErrAutomated:
+		// Accepting these and quietly throwing them away is what keeps bounces from bouncing
+		return 250, "OK"
+	case ErrUnknownRecipient:
+		return 550, "5.1.1 No such user here"
+	case ErrWrongSender:
+		logger.Warning.Printf("Rejected an email from %s sent to somebody else's inbound address", message.From)
+		return 550, "5.7.1 Sender is not allowed to use this address"
+	}
+	logger.Error.Printf("Unable to process an email from %s: %s", message.From, err)
+	return 451, "Temporary failure, please try again later"
+}
@@ -0,0 +1,97 @@
+package inbound
+
+import (
+	"net"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// startSMTPServer runs an SMTPServer on a random local port and returns its address
+func startSMTPServer(t *testing.T, processor *Processor) (*SMTPServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := NewSMTPServer("linkletter.example.com", processor)
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func TestPathArgument(t *testing.T) {
+	address, ok := pathArgument("FROM:<someone@example.com> SIZE=1234", "FROM:")
+	assert.True(t, ok)
+	assert.Equal(t, "someone@example.com", address)
+
+	address, ok = pathArgument("from: <>", "FROM:")
+	assert.True(t, ok)
+	assert.Equal(t, "", address)
+
+	_, ok = pathArgument("TO:someone@example.com", "TO:")
+	assert.False(t, ok)
+}
+
+func TestSMTPServer(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	server, addr := startSMTPServer(t, NewProcessor(db, testInboundAddress, ""))
+	defer server.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectQuery(createLinkQuery).
+		WithArgs("https://example.com/a", "", "Good stuff", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(webhooksQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(enqueueQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	message := "From: someone@example.com\r\nTo: links+abc123@linkletter.example.com\r\nSubject: Good stuff\r\n\r\n" +
+		".Leading dots survive\r\nhttps://example.com/a\r\n"
+	err := smtp.SendMail(addr, nil, "someone@example.com", []string{"links+abc123@linkletter.example.com"}, []byte(message))
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSMTPServerRejects(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	server, addr := startSMTPServer(t, NewProcessor(db, testInboundAddress, ""))
+	defer server.Close()
+
+	// We aren't a relay, or anybody's mailbox
+	err := smtp.SendMail(addr, nil, "someone@example.com", []string{"someone.else@example.com"}, []byte("Subject: Hi\r\n\r\nHi\r\n"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "550"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(5, "someone@example.com", "member", time.Now()))
+
+	message := "From: impostor@example.com\r\nTo: links+abc123@linkletter.example.com\r\nSubject: Hi\r\n\r\nhttps://example.com/a\r\n"
+	err = smtp.SendMail(addr, nil, "impostor@example.com", []string{"links+abc123@linkletter.example.com"}, []byte(message))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "550"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSMTPServerOutOfOrder(t *testing.T) {
+	server, addr := startSMTPServer(t, NewProcessor(nil, testInboundAddress, ""))
+	defer server.Close()
+
+	client, err := smtp.Dial(addr)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	assert.Nil(t, client.Hello("mail.example.com"))
+	err = client.Rcpt("links+abc123@linkletter.example.com")
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "503"))
+	assert.Nil(t, client.Quit())
+}
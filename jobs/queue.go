@@ -0,0 +1,131 @@
+// Package jobs provides a durable, Postgres backed, queue for work that has no business
+// happening inside of an http handler.
+package jobs
+
+// There's no shortage of job queues out there. Redis has a dozen of them, RabbitMQ is
+// practically a religion, and Amazon will happily sell you SQS by the million messages.
+// But every one of those is another piece of infrastructure that somebody has to stand
+// up before they can run LinkLetter, and on Heroku each one is another add-on with
+// another bill. We already have Postgres, and since version 9.5 Postgres has had a
+// wonderful little feature called "SKIP LOCKED" that makes it a perfectly respectable
+// job queue.
+//
+// The trick is this: a worker opens a transaction and asks for the oldest job that is
+// ready to run with "SELECT ... FOR UPDATE SKIP LOCKED". The "FOR UPDATE" locks that
+// row for as long as the transaction is open, and the "SKIP LOCKED" tells every other
+// worker to simply pretend that row doesn't exist rather than waiting around for it.
+// So any number of workers, in any number of processes, can poll the same table without
+// ever grabbing the same job twice. And because the lock lives in the transaction, if a
+// worker dies halfway through a job (say Heroku restarts the dyno on us) the transaction
+// is rolled back, the lock disappears, and the job is sitting there for the next worker
+// as if nothing ever happened. Durability for free.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// These are the states a job can be in. "dead" is our dead-letter status, it means a job
+// has failed every one of its attempts and we've given up on it. Dead jobs are left in
+// the table so that a human can find out what went wrong and, if they'd like, Retry them.
+const (
+	StatusQueued = "queued"
+	StatusDone   = "done"
+	StatusDead   = "dead"
+)
+
+const defaultMaxAttempts = 5
+
+const (
+	enqueueJobQuery = "INSERT INTO jobs (type, payload, max_attempts, run_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	claimJobQuery   = "SELECT id, type, payload, attempts, max_attempts, run_at FROM jobs WHERE status = 'queued' AND run_at <= now() ORDER BY run_at LIMIT 1 FOR UPDATE SKIP LOCKED"
+	finishJobQuery  = "UPDATE jobs SET status = 'done', attempts = attempts + 1, last_error = '', updated_at = now() WHERE id = $1"
+	retryJobQuery   = "UPDATE jobs SET attempts = attempts + 1, last_error = $2, run_at = $3, updated_at = now() WHERE id = $1"
+	killJobQuery    = "UPDATE jobs SET status = 'dead', attempts = attempts + 1, last_error = $2, updated_at = now() WHERE id = $1"
+	reviveJobQuery  = "UPDATE jobs SET status = 'queued', attempts = 0, run_at = now(), updated_at = now() WHERE id = $1 AND status = 'dead'"
+	countJobsQuery  = "SELECT type, status, count(*), count(*) FILTER (WHERE attempts > 0) FROM jobs GROUP BY type, status ORDER BY type, status"
+)
+
+// Job is a single unit of work pulled off of the queue.
+type Job struct {
+	ID          int64
+	Type        string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+}
+
+// Decode unmarshals the job's JSON payload into the supplied value. Handlers are expected
+// to decode into their own payload struct, which is about as close as we can get to typed
+// jobs without making every caller deal with interface{} type assertions.
+func (job Job) Decode(v interface{}) error {
+	return json.Unmarshal(job.Payload, v)
+}
+
+// Queue is the producing side of our job queue. It's nothing more than a thin wrapper
+// around the database connection, so it's cheap to create one wherever it's needed.
+type Queue struct {
+	db *sql.DB
+}
+
+// NewQueue creates a Queue on top of the supplied database connection.
+func NewQueue(db *sql.DB) *Queue {
+	return &Queue{db: db}
+}
+
+// Enqueue adds a job of the given type to the queue to be run as soon as a worker is free.
+// The payload will be serialized as JSON.
+func (queue *Queue) Enqueue(jobType string, payload interface{}) (int64, error) {
+	return queue.Schedule(jobType, payload, time.Now())
+}
+
+// Schedule adds a job of the given type to the queue that won't be run until runAt.
+func (queue *Queue) Schedule(jobType string, payload interface{}, runAt time.Time) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = queue.db.QueryRow(enqueueJobQuery, jobType, string(data), defaultMaxAttempts, runAt).Scan(&id)
+	return id, err
+}
+
+// Retry takes a dead job and puts it back in the queue with a fresh set of attempts.
+func (queue *Queue) Retry(id int64) error {
+	_, err := queue.db.Exec(reviveJobQuery, id)
+	return err
+}
+
+// Count is how many jobs of a type are in one of the states
+type Count struct {
+	Type   string
+	Status string
+	Jobs   int
+
+	// Failed is how many of them have failed at least once. For queued jobs that means
+	// they're waiting to be retried.
+	Failed int
+}
+
+// Counts counts up the jobs in the queue by type and state, for keeping an eye on how the
+// workers are keeping up
+func Counts(db *sql.DB) ([]Count, error) {
+	rows, err := db.Query(countJobsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []Count{}
+	for rows.Next() {
+		count := Count{}
+		if err := rows.Scan(&count.Type, &count.Status, &count.Jobs, &count.Failed); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobDecode(t *testing.T) {
+	job := Job{Payload: []byte(`{"email": "test@example.com"}`)}
+
+	payload := struct {
+		Email string `json:"email"`
+	}{}
+	assert.Nil(t, job.Decode(&payload))
+	assert.Equal(t, "test@example.com", payload.Email)
+}
+
+func TestEnqueue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	queue := NewQueue(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(enqueueJobQuery)).
+		WithArgs("test", `{"value":1}`, defaultMaxAttempts, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	id, err := queue.Enqueue("test", struct {
+		Value int `json:"value"`
+	}{1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSchedule(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	queue := NewQueue(db)
+
+	runAt := time.Now().Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(enqueueJobQuery)).
+		WithArgs("test", "null", defaultMaxAttempts, runAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+
+	id, err := queue.Schedule("test", nil, runAt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRetry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	queue := NewQueue(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(reviveJobQuery)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, queue.Retry(3))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCounts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery(regexp.QuoteMeta(countJobsQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"type", "status", "count", "failed"}).
+			AddRow("mail.send", "dead", 2, 2).
+			AddRow("mail.send", "queued", 5, 1))
+
+	counts, err := Counts(db)
+	assert.Nil(t, err)
+	assert.Equal(t, []Count{{"mail.send", StatusDead, 2, 2}, {"mail.send", StatusQueued, 5, 1}}, counts)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+)
+
+// Handler does the actual work for a job. Returning an error will cause the job to be
+// retried later (or declared dead if it's out of attempts).
+type Handler func(job Job) error
+
+// Pool is the consuming side of our queue. It runs a number of workers, each of which
+// polls the database for jobs and dispatches them to the Handler registered for their type.
+type Pool struct {
+	queue    *Queue
+	workers  int
+	handlers map[string]Handler
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewPool creates a Pool that will run the given number of workers once started.
+//
+// Keep in mind that every busy worker holds a database connection open for as long as
+// its job is running (that's where the lock lives) and will usually want a second one
+// for whatever the job itself does. So don't go setting this higher than your Postgres
+// plan's connection limit can handle.
+func NewPool(queue *Queue, workers int) *Pool {
+	return &Pool{
+		queue:    queue,
+		workers:  workers,
+		handlers: map[string]Handler{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register associates a Handler with a job type. This should be done before calling Start.
+func (pool *Pool) Register(jobType string, handler Handler) {
+	pool.handlers[jobType] = handler
+}
+
+// Start kicks off the pool's workers in the background.
+func (pool *Pool) Start() {
+	logger.Info.Printf("Starting %d job workers", pool.workers)
+	for i := 0; i < pool.workers; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+}
+
+// Stop tells every worker to finish up whatever job it's working on and then waits
+// for them to do so.
+func (pool *Pool) Stop() {
+	close(pool.stop)
+	pool.wg.Wait()
+}
+
+// work is the loop each individual worker runs. As long as there are jobs ready to go
+// we'll keep grabbing them, and once the queue runs dry we'll take a little nap before
+// checking again.
+func (pool *Pool) work() {
+	defer pool.wg.Done()
+	for {
+		select {
+		case <-pool.stop:
+			return
+		default:
+		}
+
+		found, err := pool.processNext()
+		if err != nil {
+			logger.Error.Printf("Error occurred while processing job queue: %s", err)
+		}
+
+		if !found || err != nil {
+			select {
+			case <-pool.stop:
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+}
+
+// processNext claims a single job from the queue, runs it, and records the result. It
+// returns whether or not there was a job to run.
+func (pool *Pool) processNext() (bool, error) {
+	tx, err := pool.queue.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	job := Job{}
+	var payload string
+	err = tx.QueryRow(claimJobQuery).Scan(&job.ID, &job.Type, &payload, &job.Attempts, &job.MaxAttempts, &job.RunAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return false, nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	job.Payload = []byte(payload)
+
+	jobErr := pool.run(job)
+	attempts := job.Attempts + 1
+
+	switch {
+	case jobErr == nil:
+		logger.Debug.Printf("Job %d (%s) finished", job.ID, job.Type)
+		_, err = tx.Exec(finishJobQuery, job.ID)
+	case attempts >= job.MaxAttempts:
+		logger.Error.Printf("Job %d (%s) failed for the last time and is dead: %s", job.ID, job.Type, jobErr)
+		_, err = tx.Exec(killJobQuery, job.ID, jobErr.Error())
+	default:
+		delay := backoff(attempts)
+		logger.Warning.Printf("Job %d (%s) failed, will retry in %s: %s", job.ID, job.Type, delay, jobErr)
+		_, err = tx.Exec(retryJobQuery, job.ID, jobErr.Error(), time.Now().Add(delay))
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return true, err
+	}
+	return true, tx.Commit()
+}
+
+// run dispatches the job to its handler. A panicking handler shouldn't be able to take
+// the whole worker down with it, so we treat a panic just like any other failure.
+func (pool *Pool) run(job Job) (err error) {
+	handler, ok := pool.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("No handler registered for job type '%s'", job.Type)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Job panicked: %v", r)
+		}
+	}()
+
+	return handler(job)
+}
+
+// backoff determines how long to wait before retrying a job that has failed the
+// given number of times. It doubles with every attempt, up to a limit.
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
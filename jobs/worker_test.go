@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var claimColumns = []string{"id", "type", "payload", "attempts", "max_attempts", "run_at"}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, backoff(1))
+	assert.Equal(t, 2*baseBackoff, backoff(2))
+	assert.Equal(t, 4*baseBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func TestProcessNextEmpty(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	pool := NewPool(NewQueue(db), 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimJobQuery)).WillReturnRows(sqlmock.NewRows(claimColumns))
+	mock.ExpectRollback()
+
+	found, err := pool.processNext()
+	assert.False(t, found)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessNextSuccess(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	pool := NewPool(NewQueue(db), 1)
+
+	var received Job
+	pool.Register("test", func(job Job) error {
+		received = job
+		return nil
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimJobQuery)).
+		WillReturnRows(sqlmock.NewRows(claimColumns).AddRow(1, "test", "{}", 0, 5, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(finishJobQuery)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	found, err := pool.processNext()
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), received.ID)
+	assert.Equal(t, "{}", string(received.Payload))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessNextRetry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	pool := NewPool(NewQueue(db), 1)
+	pool.Register("test", func(job Job) error {
+		return errors.New("try again")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimJobQuery)).
+		WillReturnRows(sqlmock.NewRows(claimColumns).AddRow(1, "test", "{}", 1, 5, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(retryJobQuery)).WithArgs(1, "try again", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	found, err := pool.processNext()
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessNextDead(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	pool := NewPool(NewQueue(db), 1)
+	pool.Register("test", func(job Job) error {
+		panic("oh no")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimJobQuery)).
+		WillReturnRows(sqlmock.NewRows(claimColumns).AddRow(1, "test", "{}", 4, 5, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(killJobQuery)).WithArgs(1, "Job panicked: oh no").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	found, err := pool.processNext()
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessNextUnknownType(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	pool := NewPool(NewQueue(db), 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimJobQuery)).
+		WillReturnRows(sqlmock.NewRows(claimColumns).AddRow(1, "mystery", "{}", 0, 1, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(killJobQuery)).WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	found, err := pool.processNext()
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
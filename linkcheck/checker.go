@@ -0,0 +1,158 @@
+package linkcheck
+
+// The Checker is the same sort of loop as the feed poller (see feeds/poll.go), except that
+// rather than leasing its work by pushing a timestamp forward it holds on to the row it's
+// working on for the whole of the check, the way the job workers do. A check is a single
+// request with a timeout, so the lock is never held for long, and if the process dies the
+// transaction goes with it and the link is simply checked by somebody else.
+//
+// Snapshots are claimed the same way, from links shared in the last day that don't have one
+// yet. That means we don't have to remember to ask for a snapshot everywhere a link can be
+// created (the website, the API, Slack, email, feeds, bookmark imports...), and a snapshot
+// that fails still gets saved, along with why, so that we don't keep trying to take it.
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// checkerInterval is how long a Checker waits before looking for more work once it's run out
+const checkerInterval = time.Minute
+
+// Checker checks the links in sent issues as they come due, and takes snapshots of newly
+// shared links, in the background
+type Checker struct {
+	db        *sql.DB
+	userAgent string
+	interval  time.Duration
+	snapshots bool
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewChecker creates a Checker that checks each link every given number of days (or never,
+// if that's 0) and takes snapshots if asked to. urlBase is where this instance lives, and is
+// mentioned in the User-Agent so that whoever's site we're visiting knows who's asking.
+func NewChecker(db *sql.DB, urlBase string, days int, snapshots bool) *Checker {
+	return &Checker{
+		db:        db,
+		userAgent: fmt.Sprintf("LinkLetter link checker (+%s)", urlBase),
+		interval:  time.Duration(days) * 24 * time.Hour,
+		snapshots: snapshots,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start kicks off the checker in the background
+func (checker *Checker) Start() {
+	logger.Info.Printf("Starting link checker")
+	checker.wg.Add(1)
+	go checker.run()
+}
+
+// Stop tells the checker to finish whatever it's in the middle of and waits for it to do so
+func (checker *Checker) Stop() {
+	close(checker.stop)
+	checker.wg.Wait()
+}
+
+func (checker *Checker) run() {
+	defer checker.wg.Done()
+	for {
+		select {
+		case <-checker.stop:
+			return
+		default:
+		}
+
+		busy := false
+		if checker.interval > 0 {
+			found, err := checker.checkNext(time.Now())
+			if err != nil {
+				logger.Error.Printf("Error occurred while checking links: %s", err)
+			}
+			busy = busy || (found && err == nil)
+		}
+		if checker.snapshots {
+			found, err := checker.snapshotNext()
+			if err != nil {
+				logger.Error.Printf("Error occurred while taking snapshots: %s", err)
+			}
+			busy = busy || (found && err == nil)
+		}
+
+		if !busy {
+			select {
+			case <-checker.stop:
+				return
+			case <-time.After(checkerInterval):
+			}
+		}
+	}
+}
+
+// checkNext claims and checks a single link that's due. It returns whether there was one.
+func (checker *Checker) checkNext(now time.Time) (bool, error) {
+	tx, err := checker.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	health := Health{}
+	linkURL := ""
+	err = tx.QueryRow(claimCheckQuery).Scan(&health.LinkID, &linkURL, &health.StatusCode, &health.FinalURL,
+		&health.Error, &health.Failures, &health.CheckedAt, &health.LastAliveAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	result := fetch(linkURL, checker.userAgent, false)
+	health, next := record(health, linkURL, result, now, checker.interval)
+	_, err = tx.Exec(recordCheckQuery, health.LinkID, health.StatusCode, health.FinalURL, health.Error,
+		health.Failures, health.CheckedAt, health.LastAliveAt, next)
+	if err != nil {
+		return false, err
+	}
+	if health.Broken() {
+		logger.Debug.Printf("Link %d (%s) looks broken after %d failed checks", health.LinkID, linkURL, health.Failures)
+	}
+	return true, tx.Commit()
+}
+
+// snapshotNext claims a newly shared link without a snapshot and takes one. It returns
+// whether there was one.
+func (checker *Checker) snapshotNext() (bool, error) {
+	tx, err := checker.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var linkID int64
+	linkURL := ""
+	err = tx.QueryRow(claimSnapshotQuery).Scan(&linkID, &linkURL)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	snapshot := capture(linkID, fetch(linkURL, checker.userAgent, true))
+	_, err = tx.Exec(saveSnapshotQuery, snapshot.LinkID, snapshot.StatusCode, snapshot.Title, snapshot.Body, snapshot.Error)
+	if err != nil {
+		return false, err
+	}
+	if snapshot.Error != "" {
+		logger.Debug.Printf("Unable to take a snapshot of link %d (%s): %s", linkID, linkURL, snapshot.Error)
+	}
+	return true, tx.Commit()
+}
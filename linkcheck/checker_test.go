@@ -0,0 +1,76 @@
+package linkcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNext(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serve(func(req *http.Request, resp *httptest.ResponseRecorder) {
+		assert.Equal(t, "https://example.com/post", req.URL.String())
+		resp.WriteHeader(http.StatusNotFound)
+	})
+	defer transport.Close()
+
+	alive := checkTime.Add(-7 * 24 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimCheckQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"link_id", "url", "status_code", "final_url", "error", "failures", "checked_at", "last_alive_at"}).
+			AddRow(42, "https://example.com/post", 200, "", "", 0, alive, alive))
+	mock.ExpectExec(regexp.QuoteMeta(recordCheckQuery)).
+		WithArgs(42, 404, "", "", 1, checkTime, alive, checkTime.Add(recheckDelay)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	checker := NewChecker(db, "https://linkletter.example.com", 7, false)
+	found, err := checker.checkNext(checkTime)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckNextNothingDue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimCheckQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"link_id", "url", "status_code", "final_url", "error", "failures", "checked_at", "last_alive_at"}))
+	mock.ExpectRollback()
+
+	checker := NewChecker(db, "https://linkletter.example.com", 7, false)
+	found, err := checker.checkNext(checkTime)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSnapshotNext(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := serve(func(req *http.Request, resp *httptest.ResponseRecorder) {
+		assert.Equal(t, testUserAgent, req.Header.Get("User-Agent"))
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.Write(readAsset(t, "article.html"))
+	})
+	defer transport.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(claimSnapshotQuery)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "url"}).AddRow(42, "https://example.com/post"))
+	mock.ExpectExec(regexp.QuoteMeta(saveSnapshotQuery)).
+		WithArgs(42, 200, "Postgres is a fine job queue — Example Blog", sqlmock.AnyArg(), "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	checker := NewChecker(db, "https://linkletter.example.com", 0, true)
+	found, err := checker.snapshotNext()
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+)
+
+const (
+	// fetchTimeout is how long we give a page to respond, and to send the whole of itself if
+	// we're taking a snapshot
+	fetchTimeout = 20 * time.Second
+
+	// maxRedirects is how many redirects we'll follow before giving up on a link. Anything
+	// that needs more than this is stuck in a loop.
+	maxRedirects = 10
+
+	// maxPageSize is the most of a page we'll read for a snapshot
+	maxPageSize = 2 << 20
+)
+
+var errTooManyRedirects = errors.New("Too many redirects")
+
+// fetchResult is what we found when we went to a link
+type fetchResult struct {
+	StatusCode  int
+	FinalURL    string
+	ContentType string
+	Body        []byte
+
+	// Err is set when we didn't get a response at all
+	Err error
+}
+
+// fetch goes to a link, following redirects, and reads the page if asked to. Problems with
+// the link itself are in the result's Err rather than returned, since they're exactly the
+// kind of thing we're trying to find out about.
+//
+// It sends a browser's Accept header and doesn't bother with HEAD, since a remarkable number
+// of sites respond to HEAD requests (or to anything that looks like a robot) differently
+// from how they respond to people.
+func fetch(rawURL, userAgent string, readBody bool) fetchResult {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return fetchResult{Err: err}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+	// We use our own client so we can count redirects. Links come from our users, so it
+	// won't fetch anything off our own network (see publicnet).
+	client := &http.Client{
+		Transport: publicnet.Transport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errTooManyRedirects
+			}
+			return nil
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetchResult{Err: err}
+	}
+	defer resp.Body.Close()
+
+	result := fetchResult{StatusCode: resp.StatusCode, FinalURL: rawURL, ContentType: resp.Header.Get("Content-Type")}
+	if resp.Request != nil {
+		result.FinalURL = resp.Request.URL.String()
+	}
+	if readBody {
+		result.Body, result.Err = ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package linkcheck
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+	"github.com/cj-dimaggio/LinkLetter/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUserAgent = "LinkLetter link checker (+https://linkletter.example.com)"
+
+// serve answers every request with whatever respond writes, keeping track of the request the
+// response is for the way a real transport would
+func serve(respond func(req *http.Request, resp *httptest.ResponseRecorder)) testhelpers.TestingHTTPTransport {
+	return testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		resp := httptest.NewRecorder()
+		respond(req, resp)
+		result := resp.Result()
+		result.Request = req
+		return result, nil
+	})
+}
+
+func TestFetch(t *testing.T) {
+	transport := serve(func(req *http.Request, resp *httptest.ResponseRecorder) {
+		assert.Equal(t, testUserAgent, req.Header.Get("User-Agent"))
+		assert.Equal(t, "GET", req.Method)
+		resp.Header().Set("Content-Type", "text/html")
+		resp.WriteString("<p>Hello</p>")
+	})
+	defer transport.Close()
+
+	result := fetch("https://example.com/post", testUserAgent, false)
+	assert.Nil(t, result.Err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "https://example.com/post", result.FinalURL)
+	assert.Equal(t, "text/html", result.ContentType)
+	assert.Nil(t, result.Body)
+
+	result = fetch("https://example.com/post", testUserAgent, true)
+	assert.Equal(t, "<p>Hello</p>", string(result.Body))
+}
+
+func TestFetchRedirects(t *testing.T) {
+	transport := serve(func(req *http.Request, resp *httptest.ResponseRecorder) {
+		switch req.URL.Path {
+		case "/old":
+			http.Redirect(resp, req, "https://example.com/new", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(resp, req, "https://example.com/loop", http.StatusFound)
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer transport.Close()
+
+	result := fetch("https://example.com/old", testUserAgent, false)
+	assert.Nil(t, result.Err)
+	assert.Equal(t, 404, result.StatusCode)
+	assert.Equal(t, "https://example.com/new", result.FinalURL)
+
+	result = fetch("https://example.com/loop", testUserAgent, false)
+	assert.NotNil(t, result.Err)
+	assert.True(t, strings.Contains(result.Err.Error(), errTooManyRedirects.Error()))
+}
+
+func TestFetchErrors(t *testing.T) {
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("no such host")
+	})
+	defer transport.Close()
+
+	result := fetch("https://example.com/post", testUserAgent, false)
+	assert.NotNil(t, result.Err)
+	assert.Equal(t, 0, result.StatusCode)
+
+	result = fetch("://not a url", testUserAgent, false)
+	assert.NotNil(t, result.Err)
+}
+
+func TestFetchRefusesLocalAddresses(t *testing.T) {
+	// A real server, fetched with the real transport, that we shouldn't be able to reach
+	// because it's on our own machine
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Secrets"))
+	}))
+	defer server.Close()
+
+	result := fetch(server.URL, testUserAgent, true)
+	assert.True(t, errors.Is(result.Err, publicnet.ErrNotPublic))
+	assert.Nil(t, result.Body)
+}
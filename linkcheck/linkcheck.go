@@ -0,0 +1,171 @@
+// Package linkcheck keeps an eye on the links in sent issues, so that readers going back
+// through old issues know which ones have died, and keeps a readable copy of links as they
+// were when they were shared, for when they do.
+package linkcheck
+
+// Links rot. Sites get redesigned, blogs get abandoned, companies get acquired and their
+// domains parked, and the newsletter that pointed at them a year ago is left full of 404s.
+// We can't stop that, but we can at least notice. Once an issue has been sent every link in
+// it gets a row in link_health, and a Checker goes back every so often (a week, by default)
+// to see whether it's still there, keeping track of what it found, where it redirects to,
+// and the last time it was alive.
+//
+// One failed check doesn't make a link broken. Servers go down for an afternoon, and plenty
+// of sites are in the habit of falling over whenever something they wrote gets popular. So
+// a check that fails has another go the next day, and it's only after brokenAfter failures
+// in a row that the link is flagged as broken. Some responses don't tell us anything either
+// way: a 403 or a 429 is usually a site that doesn't like being visited by anything other
+// than a browser, and says nothing about whether the page is still there. Those are recorded
+// but don't count.
+//
+// Snapshots are the other half (see snapshot.go). When they're turned on, every link gets
+// its readable text saved shortly after it's shared, which is what readers get to see once
+// the original is gone.
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// brokenAfter is how many checks in a row have to fail before a link counts as broken
+const brokenAfter = 3
+
+// recheckDelay is how soon a link that failed a check is checked again
+const recheckDelay = 24 * time.Hour
+
+// These are the verdicts a single check can come to
+const (
+	verdictAlive   = "alive"
+	verdictDead    = "dead"
+	verdictUnknown = "unknown"
+)
+
+const (
+	healthQuery = "SELECT l.id, COALESCE(h.status_code, 0), COALESCE(h.final_url, ''), COALESCE(h.error, ''), " +
+		"COALESCE(h.failures, 0), h.checked_at, h.last_alive_at, " +
+		"EXISTS (SELECT 1 FROM link_snapshots s WHERE s.link_id = l.id AND s.body <> '') " +
+		"FROM links l LEFT JOIN link_health h ON h.link_id = l.id WHERE l.id = ANY($1)"
+	watchQuery      = "INSERT INTO link_health (link_id) SELECT link_id FROM issue_links WHERE issue_id = $1 ON CONFLICT (link_id) DO NOTHING"
+	claimCheckQuery = "SELECT h.link_id, l.url, h.status_code, h.final_url, h.error, h.failures, h.checked_at, h.last_alive_at " +
+		"FROM link_health h JOIN links l ON l.id = h.link_id WHERE h.next_check_at <= now() " +
+		"ORDER BY h.next_check_at LIMIT 1 FOR UPDATE OF h SKIP LOCKED"
+	recordCheckQuery = "UPDATE link_health SET status_code = $2, final_url = $3, error = $4, failures = $5, checked_at = $6, " +
+		"last_alive_at = $7, next_check_at = $8 WHERE link_id = $1"
+)
+
+// Health is what we know about whether a link is still alive
+type Health struct {
+	LinkID int64
+
+	// StatusCode is what the link (after following any redirects) responded with the last time
+	// it was checked, or 0 if it didn't respond at all, in which case Error says why
+	StatusCode int
+	Error      string
+
+	// FinalURL is where the link redirected to the last time it was checked, or "" if it didn't
+	FinalURL string
+
+	// Failures is how many checks in a row have found the link dead
+	Failures int
+
+	CheckedAt   *time.Time
+	LastAliveAt *time.Time
+
+	// Snapshotted is whether we have a readable copy of the link, see GetSnapshot
+	Snapshotted bool
+}
+
+// Checked is whether the link has been checked at all yet
+func (health Health) Checked() bool {
+	return health.CheckedAt != nil
+}
+
+// Broken is whether the link has been found dead enough times in a row that it's probably
+// not coming back
+func (health Health) Broken() bool {
+	return health.Failures >= brokenAfter
+}
+
+// HealthFor looks up the health of a number of links at once, for showing an issue's worth
+// of them. Every link that exists is in the result, whether or not it's been checked.
+func HealthFor(db *sql.DB, linkIDs []int64) (map[int64]Health, error) {
+	found := map[int64]Health{}
+	if len(linkIDs) == 0 {
+		return found, nil
+	}
+
+	rows, err := db.Query(healthQuery, pq.Array(linkIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		health := Health{}
+		err := rows.Scan(&health.LinkID, &health.StatusCode, &health.FinalURL, &health.Error, &health.Failures,
+			&health.CheckedAt, &health.LastAliveAt, &health.Snapshotted)
+		if err != nil {
+			return nil, err
+		}
+		found[health.LinkID] = health
+	}
+	return found, rows.Err()
+}
+
+// Get looks up the health of a single link, or sql.ErrNoRows if there's no such link
+func Get(db *sql.DB, linkID int64) (Health, error) {
+	found, err := HealthFor(db, []int64{linkID})
+	if err != nil {
+		return Health{}, err
+	}
+	health, ok := found[linkID]
+	if !ok {
+		return health, sql.ErrNoRows
+	}
+	return health, nil
+}
+
+// Watch starts checking every link in an issue, which should happen once it's been sent
+func Watch(db *sql.DB, issueID int64) error {
+	_, err := db.Exec(watchQuery, issueID)
+	return err
+}
+
+// verdict decides what a single check says about a link
+func verdict(result fetchResult) string {
+	switch code := result.StatusCode; {
+	case result.Err != nil:
+		return verdictDead
+	case code >= 200 && code <= 299:
+		return verdictAlive
+	case code == 404 || code == 410 || code >= 500:
+		return verdictDead
+	}
+	return verdictUnknown
+}
+
+// record works out a link's health after a check, and when it should next be checked
+func record(health Health, linkURL string, result fetchResult, now time.Time, interval time.Duration) (Health, time.Time) {
+	health.StatusCode = result.StatusCode
+	health.Error = ""
+	if result.Err != nil {
+		health.Error = result.Err.Error()
+	}
+	health.FinalURL = ""
+	if result.FinalURL != "" && result.FinalURL != linkURL {
+		health.FinalURL = result.FinalURL
+	}
+	health.CheckedAt = &now
+
+	switch verdict(result) {
+	case verdictAlive:
+		health.Failures = 0
+		health.LastAliveAt = &now
+	case verdictDead:
+		health.Failures++
+		return health, now.Add(recheckDelay)
+	}
+	return health, now.Add(interval)
+}
@@ -0,0 +1,100 @@
+package linkcheck
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var checkTime = time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func TestVerdict(t *testing.T) {
+	assert.Equal(t, verdictAlive, verdict(fetchResult{StatusCode: 200}))
+	assert.Equal(t, verdictAlive, verdict(fetchResult{StatusCode: 204}))
+	assert.Equal(t, verdictDead, verdict(fetchResult{StatusCode: 404}))
+	assert.Equal(t, verdictDead, verdict(fetchResult{StatusCode: 410}))
+	assert.Equal(t, verdictDead, verdict(fetchResult{StatusCode: 503}))
+	assert.Equal(t, verdictDead, verdict(fetchResult{Err: errors.New("no such host")}))
+
+	// Sites that don't like robots don't tell us anything
+	assert.Equal(t, verdictUnknown, verdict(fetchResult{StatusCode: 403}))
+	assert.Equal(t, verdictUnknown, verdict(fetchResult{StatusCode: 429}))
+}
+
+func TestRecord(t *testing.T) {
+	interval := 7 * 24 * time.Hour
+	health := Health{LinkID: 42, Failures: 2}
+
+	health, next := record(health, "https://example.com", fetchResult{StatusCode: 200, FinalURL: "https://example.com/"}, checkTime, interval)
+	assert.Equal(t, 0, health.Failures)
+	assert.Equal(t, &checkTime, health.LastAliveAt)
+	assert.Equal(t, "https://example.com/", health.FinalURL)
+	assert.Equal(t, checkTime.Add(interval), next)
+	assert.True(t, health.Checked())
+
+	// A failure is tried again the next day, and it takes a few of them to be broken
+	for i := 1; i <= brokenAfter; i++ {
+		assert.False(t, health.Broken())
+		health, next = record(health, "https://example.com", fetchResult{Err: errors.New("timeout")}, checkTime, interval)
+		assert.Equal(t, i, health.Failures)
+		assert.Equal(t, checkTime.Add(recheckDelay), next)
+	}
+	assert.True(t, health.Broken())
+	assert.Equal(t, "timeout", health.Error)
+	assert.Equal(t, "", health.FinalURL)
+	assert.Equal(t, &checkTime, health.LastAliveAt)
+
+	// Something inconclusive doesn't change anything either way
+	health, next = record(health, "https://example.com", fetchResult{StatusCode: 403, FinalURL: "https://example.com"}, checkTime, interval)
+	assert.Equal(t, brokenAfter, health.Failures)
+	assert.Equal(t, 403, health.StatusCode)
+	assert.Equal(t, "", health.Error)
+	assert.Equal(t, checkTime.Add(interval), next)
+}
+
+func TestHealthFor(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(healthQuery)).WithArgs("{42,43}").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "status_code", "final_url", "error", "failures", "checked_at", "last_alive_at", "snapshotted"}).
+			AddRow(42, 404, "", "", 3, checkTime, nil, true).
+			AddRow(43, 0, "", "", 0, nil, nil, false))
+
+	found, err := HealthFor(db, []int64{42, 43})
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+	assert.True(t, found[42].Broken())
+	assert.True(t, found[42].Snapshotted)
+	assert.False(t, found[43].Checked())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// Nothing to look up means nothing to ask the database
+	found, err = HealthFor(db, nil)
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+}
+
+func TestGet(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(healthQuery)).WithArgs("{42}").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "status_code", "final_url", "error", "failures", "checked_at", "last_alive_at", "snapshotted"}))
+
+	_, err := Get(db, 42)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestWatch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(watchQuery)).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 5))
+
+	assert.Nil(t, Watch(db, 3))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
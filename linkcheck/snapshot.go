@@ -0,0 +1,167 @@
+package linkcheck
+
+// A snapshot is just the words on a page, without everything a modern web page wraps around
+// them. We don't try to save pages the way the Wayback Machine does, with their images and
+// stylesheets and scripts; that's a much bigger job, and Postgres is not where any of it
+// belongs. The text is what somebody reading an old issue actually wants.
+//
+// Finding the text is done with regular expressions, which anybody who's been on the
+// internet for long will tell you is no way to parse HTML. They're right, but we aren't
+// parsing it, we're throwing most of it away: everything that's never the text (scripts,
+// styles, navigation, headers and footers), then whatever's outside of the <article> or
+// <main> if the page has one, then every tag. What's left is the text, and block-level tags
+// tell us where its paragraphs were.
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSnapshotText is the most text we'll keep for a single page, which is a long article
+const maxSnapshotText = 200000
+
+const (
+	getSnapshotQuery   = "SELECT link_id, status_code, title, body, error, captured_at FROM link_snapshots WHERE link_id = $1"
+	saveSnapshotQuery  = "INSERT INTO link_snapshots (link_id, status_code, title, body, error) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (link_id) DO NOTHING"
+	claimSnapshotQuery = "SELECT l.id, l.url FROM links l WHERE l.created_at > now() - interval '1 day' " +
+		"AND NOT EXISTS (SELECT 1 FROM link_snapshots s WHERE s.link_id = l.id) ORDER BY l.id LIMIT 1 FOR NO KEY UPDATE SKIP LOCKED"
+)
+
+var (
+	// ignoredElements are the elements that never have anything we want in them. Go's
+	// regular expressions don't do backreferences, so there's one expression per element.
+	ignoredElements = []string{"script", "style", "noscript", "template", "svg", "nav", "header", "footer", "aside", "form", "iframe", "button", "select"}
+	ignoredPatterns = func() []*regexp.Regexp {
+		patterns := []*regexp.Regexp{regexp.MustCompile(`(?s)<!--.*?-->`)}
+		for _, element := range ignoredElements {
+			patterns = append(patterns, regexp.MustCompile(`(?is)<`+element+`\b.*?</`+element+`\s*>`))
+		}
+		return patterns
+	}()
+
+	titlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title\s*>`)
+	articlePattern = regexp.MustCompile(`(?is)<article\b[^>]*>(.*?)</article\s*>`)
+	mainPattern    = regexp.MustCompile(`(?is)<main\b[^>]*>(.*?)</main\s*>`)
+	bodyPattern    = regexp.MustCompile(`(?is)<body\b[^>]*>(.*)`)
+	blockPattern   = regexp.MustCompile(`(?i)</?(p|div|br|li|h[1-6]|pre|blockquote|tr|section|article|ul|ol|table|dd|dt|figcaption|hr)\b[^>]*>`)
+	tagPattern     = regexp.MustCompile(`<[^>]*>`)
+	spacePattern   = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+	breakPattern   = regexp.MustCompile(`\n\s*\n`)
+)
+
+// Snapshot is the readable text of a link, as it was when it was shared
+type Snapshot struct {
+	LinkID     int64
+	StatusCode int
+	Title      string
+	Body       string
+
+	// Error is why we weren't able to take the snapshot, when we weren't
+	Error string
+
+	CapturedAt time.Time
+}
+
+// Paragraphs splits the snapshot's text up for showing
+func (snapshot Snapshot) Paragraphs() []string {
+	if snapshot.Body == "" {
+		return nil
+	}
+	return strings.Split(snapshot.Body, "\n\n")
+}
+
+// GetSnapshot retrieves a link's snapshot, or sql.ErrNoRows if it doesn't have one
+func GetSnapshot(db *sql.DB, linkID int64) (Snapshot, error) {
+	snapshot := Snapshot{}
+	err := db.QueryRow(getSnapshotQuery, linkID).Scan(&snapshot.LinkID, &snapshot.StatusCode, &snapshot.Title,
+		&snapshot.Body, &snapshot.Error, &snapshot.CapturedAt)
+	return snapshot, err
+}
+
+// capture makes a snapshot out of what we found at a link
+func capture(linkID int64, result fetchResult) Snapshot {
+	snapshot := Snapshot{LinkID: linkID, StatusCode: result.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(result.ContentType)
+
+	switch {
+	case result.Err != nil:
+		snapshot.Error = result.Err.Error()
+	case result.StatusCode < 200 || result.StatusCode > 299:
+		snapshot.Error = fmt.Sprintf("The page responded with %d", result.StatusCode)
+	case mediaType == "text/plain":
+		snapshot.Body = cleanParagraphs(toUTF8(result.Body))
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "":
+		snapshot.Title, snapshot.Body = Readable(toUTF8(result.Body))
+	default:
+		snapshot.Error = fmt.Sprintf("There's no text to save in %s", mediaType)
+	}
+	return snapshot
+}
+
+// Readable pulls the title and the readable text out of a page of HTML. Paragraphs in the
+// text are separated by blank lines.
+func Readable(page string) (string, string) {
+	title := ""
+	if match := titlePattern.FindStringSubmatch(page); match != nil {
+		title = strings.TrimSpace(spacePattern.ReplaceAllString(html.UnescapeString(tagPattern.ReplaceAllString(match[1], "")), " "))
+		title = strings.Replace(title, "\n", " ", -1)
+	}
+
+	for _, pattern := range ignoredPatterns {
+		page = pattern.ReplaceAllString(page, "")
+	}
+	for _, pattern := range []*regexp.Regexp{articlePattern, mainPattern, bodyPattern} {
+		if match := pattern.FindStringSubmatch(page); match != nil {
+			page = match[1]
+			break
+		}
+	}
+
+	page = blockPattern.ReplaceAllString(page, "\n\n")
+	page = html.UnescapeString(tagPattern.ReplaceAllString(page, ""))
+	return title, cleanParagraphs(page)
+}
+
+// cleanParagraphs tidies up the whitespace in some text, keeping its paragraphs apart
+func cleanParagraphs(text string) string {
+	paragraphs := []string{}
+	for _, paragraph := range breakPattern.Split(strings.Replace(text, "\r\n", "\n", -1), -1) {
+		lines := []string{}
+		for _, line := range strings.Split(paragraph, "\n") {
+			if line = strings.TrimSpace(spacePattern.ReplaceAllString(line, " ")); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, strings.Join(lines, " "))
+		}
+	}
+
+	text = strings.Join(paragraphs, "\n\n")
+	if len(text) > maxSnapshotText {
+		text = text[:maxSnapshotText]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
+
+// toUTF8 makes sure a page is UTF-8. Pages that aren't are almost always Latin-1 (or its
+// Windows cousin), whose bytes are the code points of the same numbers.
+func toUTF8(body []byte) string {
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	runes := make([]rune, len(body))
+	for i, b := range body {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
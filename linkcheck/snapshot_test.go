@@ -0,0 +1,96 @@
+package linkcheck
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAsset(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("test_assets/" + name)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestReadable(t *testing.T) {
+	title, text := Readable(string(readAsset(t, "article.html")))
+	assert.Equal(t, "Postgres is a fine job queue — Example Blog", title)
+	assert.Equal(t, strings.Join([]string{
+		"Postgres is a fine job queue",
+		"It turns out SKIP LOCKED is all you need.",
+		"Workers claim a job, do it, and commit & move on.",
+		"Nobody else sees it in the meantime.",
+		"No extra infrastructure",
+		"Jobs are transactional",
+	}, "\n\n"), text)
+}
+
+func TestReadableWithoutArticle(t *testing.T) {
+	// Without an <article> or <main> we make do with the whole body
+	title, text := Readable("<html><body><div>One</div>Two<script>three()</script></body></html>")
+	assert.Equal(t, "", title)
+	assert.Equal(t, "One\n\nTwo", text)
+
+	// Or the whole page, for a fragment without a body
+	_, text = Readable("Just <b>some</b> text")
+	assert.Equal(t, "Just some text", text)
+}
+
+func TestCapture(t *testing.T) {
+	snapshot := capture(42, fetchResult{StatusCode: 200, ContentType: "text/html; charset=iso-8859-1", Body: readAsset(t, "latin1.html")})
+	assert.Equal(t, int64(42), snapshot.LinkID)
+	assert.Equal(t, "Café", snapshot.Title)
+	assert.Equal(t, "Un café, s'il vous plaît.", snapshot.Body)
+	assert.Equal(t, "", snapshot.Error)
+
+	snapshot = capture(42, fetchResult{StatusCode: 200, ContentType: "text/plain", Body: []byte("One\nline\n\n\nTwo  ")})
+	assert.Equal(t, "One line\n\nTwo", snapshot.Body)
+	assert.Equal(t, []string{"One line", "Two"}, snapshot.Paragraphs())
+}
+
+func TestCaptureFailures(t *testing.T) {
+	// Failures are saved along with why, so that we don't keep trying
+	snapshot := capture(42, fetchResult{Err: errors.New("connection refused")})
+	assert.Equal(t, "connection refused", snapshot.Error)
+
+	snapshot = capture(42, fetchResult{StatusCode: 404, ContentType: "text/html"})
+	assert.Equal(t, "The page responded with 404", snapshot.Error)
+
+	snapshot = capture(42, fetchResult{StatusCode: 200, ContentType: "application/pdf", Body: []byte("%PDF")})
+	assert.Equal(t, "There's no text to save in application/pdf", snapshot.Error)
+	assert.Equal(t, "", snapshot.Body)
+	assert.Nil(t, snapshot.Paragraphs())
+}
+
+func TestCleanParagraphsLimit(t *testing.T) {
+	// Cutting a long page short doesn't leave half of a character at the end
+	text := cleanParagraphs("a" + strings.Repeat("é", maxSnapshotText))
+	assert.True(t, len(text) <= maxSnapshotText)
+	assert.True(t, strings.HasSuffix(text, "é"))
+}
+
+func TestGetSnapshot(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	captured := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getSnapshotQuery)).WithArgs(42).WillReturnRows(
+		sqlmock.NewRows([]string{"link_id", "status_code", "title", "body", "error", "captured_at"}).
+			AddRow(42, 200, "Example", "Some text", "", captured))
+	mock.ExpectQuery(regexp.QuoteMeta(getSnapshotQuery)).WithArgs(43).WillReturnRows(
+		sqlmock.NewRows([]string{"link_id", "status_code", "title", "body", "error", "captured_at"}))
+
+	snapshot, err := GetSnapshot(db, 42)
+	assert.Nil(t, err)
+	assert.Equal(t, Snapshot{42, 200, "Example", "Some text", "", captured}, snapshot)
+
+	_, err = GetSnapshot(db, 43)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
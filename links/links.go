@@ -0,0 +1,232 @@
+// Package links is home to the bread and butter of LinkLetter, the links people share.
+package links
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Remember the complaint in database/migrate.go about not being able to build queries out
+// of variables and still keep them constant? Well it turns out you *can* build constants
+// out of other constants, as long as all you're doing is sticking strings together. So
+// every query that needs to return links starts with selectLinks and adds on whatever
+// filtering it needs. The user's own vote needs a user id, which is always $1 (pass in 0
+// if you don't care about it).
+//
+// The category subquery picks the category the link belongs to in the newsletter (see the
+// tags package for how tags end up in categories). A link with tags in more than one
+// category goes in whichever of them comes first.
+//
+// The columns and tables are split apart so that queries like the one in search.go can add
+// a few columns of their own on the end.
+const (
+	linkColumns = "l.id, l.url, l.title, l.description, l.submitter_id, u.email, l.created_at, " +
+		"COALESCE((SELECT SUM(v.value) FROM votes v WHERE v.link_id = l.id), 0), " +
+		"COALESCE((SELECT v.value FROM votes v WHERE v.link_id = l.id AND v.user_id = $1), 0), " +
+		"(SELECT COUNT(*) FROM comments c WHERE c.link_id = l.id AND NOT c.deleted), COALESCE(l.top_comment_id, 0), " +
+		"ARRAY(SELECT t.name FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.link_id = l.id ORDER BY t.name), " +
+		"COALESCE((SELECT c.name FROM link_tags lt JOIN tags t ON t.id = lt.tag_id " +
+		"JOIN categories c ON c.id = t.category_id OR (t.category_id IS NULL AND c.slug = t.name) " +
+		"WHERE lt.link_id = l.id ORDER BY c.position, c.id LIMIT 1), '')"
+	linkTables  = "links l JOIN users u ON u.id = l.submitter_id"
+	selectLinks = "SELECT " + linkColumns + " FROM " + linkTables
+
+	getLinkQuery      = selectLinks + " WHERE l.id = $2"
+	listUnissuedQuery = selectLinks + " WHERE NOT EXISTS (SELECT 1 FROM issue_links il JOIN issues i ON i.id = il.issue_id WHERE il.link_id = l.id AND i.status = 'sent') AND NOT l.imported ORDER BY l.created_at DESC"
+	listForIssueQuery = selectLinks + " JOIN issue_links il ON il.link_id = l.id WHERE il.issue_id = $2 ORDER BY il.position"
+	listByTagQuery    = selectLinks + " WHERE EXISTS (SELECT 1 FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.link_id = l.id AND t.name = $2) ORDER BY l.created_at DESC"
+	createLinkQuery   = "INSERT INTO links (url, title, description, submitter_id) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	importLinkQuery   = "INSERT INTO links (url, title, description, submitter_id, created_at, imported) VALUES ($1, $2, $3, $4, $5, true) RETURNING id"
+	castVoteQuery     = "INSERT INTO votes (link_id, user_id, value) VALUES ($1, $2, $3) ON CONFLICT (link_id, user_id) DO UPDATE SET value = EXCLUDED.value, created_at = now()"
+	removeVoteQuery   = "DELETE FROM votes WHERE link_id = $1 AND user_id = $2"
+	markPopularQuery  = "UPDATE links SET popular_at = now() WHERE id = $1 AND popular_at IS NULL " +
+		"AND (SELECT COALESCE(SUM(value), 0) FROM votes WHERE link_id = $1) >= $2 RETURNING id"
+)
+
+// ErrInvalidURL is returned when somebody tries to share something that isn't a web page
+var ErrInvalidURL = errors.New("Links must be absolute http or https URLs")
+
+// ErrInvalidVote is returned when a vote is anything other than up, down, or nothing
+var ErrInvalidVote = errors.New("Votes must be 1, -1, or 0")
+
+// Link is a single shared link, along with its votes
+type Link struct {
+	ID             int64
+	URL            string
+	Title          string
+	Description    string
+	SubmitterID    int64
+	SubmitterEmail string
+	CreatedAt      time.Time
+
+	// Score is the sum of all the votes for the link
+	Score int
+
+	// UserVote is the vote of whichever user the link was looked up on behalf of
+	UserVote int
+
+	// CommentCount is how many (undeleted) comments there are on the link
+	CommentCount int
+
+	// TopCommentID is the comment an editor picked to quote in the newsletter, or 0
+	TopCommentID int64
+
+	// Tags are the link's tags, alphabetically
+	Tags []string
+
+	// Category is the newsletter category the link's tags put it in, or "" if none of them do
+	Category string
+}
+
+// DisplayTitle is the title of the link, falling back to the URL if nobody gave it one
+func (link Link) DisplayTitle() string {
+	if link.Title != "" {
+		return link.Title
+	}
+	return link.URL
+}
+
+// ValidateURL makes sure a URL is something we're willing to link to. We're especially
+// careful to disallow things like "javascript:" URLs, which would otherwise be a lovely
+// way to run scripts on everybody who clicks a link.
+func ValidateURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	return u.String(), nil
+}
+
+// linkFields lists where each of linkColumns should be scanned into
+func linkFields(link *Link) []interface{} {
+	return []interface{}{&link.ID, &link.URL, &link.Title, &link.Description, &link.SubmitterID,
+		&link.SubmitterEmail, &link.CreatedAt, &link.Score, &link.UserVote, &link.CommentCount, &link.TopCommentID,
+		(*pq.StringArray)(&link.Tags), &link.Category}
+}
+
+// scanLinks reads every link out of the supplied rows, which are expected to have been
+// produced by a query starting with selectLinks.
+func scanLinks(rows *sql.Rows) ([]Link, error) {
+	defer rows.Close()
+
+	found := []Link{}
+	for rows.Next() {
+		link := Link{}
+		if err := rows.Scan(linkFields(&link)...); err != nil {
+			return nil, err
+		}
+		found = append(found, link)
+	}
+	return found, rows.Err()
+}
+
+// Querier is what *sql.DB and *sql.Tx have in common, for creating links as part of somebody
+// else's transaction
+type Querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Create saves a newly shared link
+func Create(db Querier, link Link) (Link, error) {
+	cleaned, err := ValidateURL(link.URL)
+	if err != nil {
+		return link, err
+	}
+	link.URL = cleaned
+
+	err = db.QueryRow(createLinkQuery, link.URL, link.Title, link.Description, link.SubmitterID).Scan(&link.ID, &link.CreatedAt)
+	return link, err
+}
+
+// Import is Create for links that were shared somewhere else first, keeping the CreatedAt
+// they came with. A link without one is treated as being shared just now. Imported links are
+// marked as such, so that they don't all turn up in the next issue.
+func Import(db *sql.DB, link Link) (Link, error) {
+	cleaned, err := ValidateURL(link.URL)
+	if err != nil {
+		return link, err
+	}
+	link.URL = cleaned
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+
+	err = db.QueryRow(importLinkQuery, link.URL, link.Title, link.Description, link.SubmitterID, link.CreatedAt).Scan(&link.ID)
+	return link, err
+}
+
+// Get retrieves a single link, with the vote of the given user
+func Get(db *sql.DB, id, userID int64) (Link, error) {
+	rows, err := db.Query(getLinkQuery, userID, id)
+	if err != nil {
+		return Link{}, err
+	}
+	found, err := scanLinks(rows)
+	if err != nil {
+		return Link{}, err
+	}
+	if len(found) == 0 {
+		return Link{}, sql.ErrNoRows
+	}
+	return found[0], nil
+}
+
+// ListUnissued lists every link that hasn't yet gone out in a sent issue, newest first. Links
+// that were imported never go out, so they're left out.
+func ListUnissued(db *sql.DB, userID int64) ([]Link, error) {
+	rows, err := db.Query(listUnissuedQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// ListForIssue lists the links in an issue, in the order they've been placed in it.
+func ListForIssue(db *sql.DB, issueID, userID int64) ([]Link, error) {
+	rows, err := db.Query(listForIssueQuery, userID, issueID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// ListByTag lists every link with the given tag, sent or not, newest first.
+func ListByTag(db *sql.DB, tag string, userID int64) ([]Link, error) {
+	rows, err := db.Query(listByTagQuery, userID, tag)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// Vote records a user's vote for a link. A value of 1 is an upvote, -1 a downvote, and 0
+// takes back whatever vote the user had made. The primary key on the votes table makes
+// sure nobody gets to vote twice; voting again simply changes your vote.
+func Vote(db *sql.DB, linkID, userID int64, value int) error {
+	switch value {
+	case 0:
+		_, err := db.Exec(removeVoteQuery, linkID, userID)
+		return err
+	case 1, -1:
+		_, err := db.Exec(castVoteQuery, linkID, userID, value)
+		return err
+	}
+	return ErrInvalidVote
+}
+
+// MarkPopular checks if a link has reached the given score for the first time, in which case
+// it's marked as popular and we return true. Doing the check and the marking in a single
+// UPDATE means two votes landing at the same time can't both be the one that made it popular.
+func MarkPopular(db *sql.DB, linkID int64, threshold int) (bool, error) {
+	var id int64
+	err := db.QueryRow(markPopularQuery, linkID, threshold).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
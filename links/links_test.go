@@ -0,0 +1,154 @@
+package links
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var linkRowColumns = []string{"id", "url", "title", "description", "submitter_id", "email", "created_at", "score", "user_vote", "comments", "top_comment_id", "tags", "category"}
+
+func TestValidateURL(t *testing.T) {
+	cleaned, err := ValidateURL(" https://example.com/article ")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/article", cleaned)
+
+	for _, bad := range []string{"javascript:alert(1)", "/relative", "ftp://example.com", "http://", ""} {
+		_, err = ValidateURL(bad)
+		assert.Equal(t, ErrInvalidURL, err, bad)
+	}
+}
+
+func TestDisplayTitle(t *testing.T) {
+	assert.Equal(t, "A Title", Link{URL: "http://example.com", Title: "A Title"}.DisplayTitle())
+	assert.Equal(t, "http://example.com", Link{URL: "http://example.com"}.DisplayTitle())
+}
+
+func TestCreate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(createLinkQuery)).
+		WithArgs("http://example.com", "Title", "", 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, now))
+
+	link, err := Create(db, Link{URL: "http://example.com", Title: "Title", SubmitterID: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), link.ID)
+	assert.Equal(t, now, link.CreatedAt)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, err = Create(db, Link{URL: "javascript:alert(1)"})
+	assert.Equal(t, ErrInvalidURL, err)
+}
+
+func TestImport(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	shared := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(importLinkQuery)).
+		WithArgs("http://example.com", "Title", "", 3, shared).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	link, err := Import(db, Link{URL: "http://example.com", Title: "Title", SubmitterID: 3, CreatedAt: shared})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), link.ID)
+	assert.Equal(t, shared, link.CreatedAt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(importLinkQuery)).
+		WithArgs("http://example.com", "", "", 3, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+	link, err = Import(db, Link{URL: "http://example.com", SubmitterID: 3})
+	assert.Nil(t, err)
+	assert.False(t, link.CreatedAt.IsZero())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGet(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getLinkQuery)).
+		WithArgs(2, 5).
+		WillReturnRows(sqlmock.NewRows(linkRowColumns).AddRow(5, "http://example.com", "", "", 3, "a@example.com", time.Now(), 4, 1, 2, 7, "{go,rust}", "Engineering"))
+
+	link, err := Get(db, 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, link.Score)
+	assert.Equal(t, 1, link.UserVote)
+	assert.Equal(t, "a@example.com", link.SubmitterEmail)
+	assert.Equal(t, 2, link.CommentCount)
+	assert.Equal(t, int64(7), link.TopCommentID)
+	assert.Equal(t, []string{"go", "rust"}, link.Tags)
+	assert.Equal(t, "Engineering", link.Category)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getLinkQuery)).WithArgs(2, 6).WillReturnRows(sqlmock.NewRows(linkRowColumns))
+	_, err = Get(db, 6, 2)
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListUnissued(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listUnissuedQuery)).
+		WithArgs(0).
+		WillReturnRows(sqlmock.NewRows(linkRowColumns).
+			AddRow(1, "http://example.com/1", "", "", 3, "a@example.com", time.Now(), 0, 0, 0, 0, "{}", "").
+			AddRow(2, "http://example.com/2", "", "", 3, "a@example.com", time.Now(), 2, 0, 0, 0, "{}", ""))
+
+	found, err := ListUnissued(db, 0)
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestVote(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(castVoteQuery)).WithArgs(1, 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Vote(db, 1, 2, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(castVoteQuery)).WithArgs(1, 2, -1).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Vote(db, 1, 2, -1))
+
+	mock.ExpectExec(regexp.QuoteMeta(removeVoteQuery)).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Vote(db, 1, 2, 0))
+
+	assert.Equal(t, ErrInvalidVote, Vote(db, 1, 2, 5))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkPopular(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(markPopularQuery)).WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	popular, err := MarkPopular(db, 1, 5)
+	assert.Nil(t, err)
+	assert.True(t, popular)
+
+	mock.ExpectQuery(regexp.QuoteMeta(markPopularQuery)).WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	popular, err = MarkPopular(db, 1, 5)
+	assert.Nil(t, err)
+	assert.False(t, popular)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListByTag(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listByTagQuery)).
+		WithArgs(2, "go").
+		WillReturnRows(sqlmock.NewRows(linkRowColumns).
+			AddRow(1, "http://example.com/1", "", "", 3, "a@example.com", time.Now(), 0, 0, 0, 0, "{go}", ""))
+
+	found, err := ListByTag(db, "go", 2)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, []string{"go"}, found[0].Tags)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package links
+
+// The same page can be written down a surprising number of ways. "http://Example.com/a/",
+// "https://www.example.com/a" and "https://example.com/a?utm_source=twitter#comments" are
+// all, for our purposes, the same link. NormalizeURL boils a URL down to a key that all of
+// those share, which is what lets an import tell somebody "you've already shared that".
+//
+// The key is only ever used for comparing, it's never what gets saved or linked to. It
+// throws away things (the scheme, a "www.") that usually don't matter but occasionally do,
+// and we'd rather not send anybody to the wrong page because two of them happened to boil
+// down to the same key.
+
+import (
+	"database/sql"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const listURLsQuery = "SELECT id, url FROM links ORDER BY id"
+
+// trackingParams are query parameters that only exist to tell somebody's analytics where a
+// click came from. Anything starting with "utm_" is thrown away as well.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ref_src": true,
+}
+
+// NormalizeURL works out the key a URL shares with every other way of writing the same
+// link. It returns "" for anything that isn't a valid link.
+func NormalizeURL(raw string) string {
+	cleaned, err := ValidateURL(raw)
+	if err != nil {
+		return ""
+	}
+	u, _ := url.Parse(cleaned)
+
+	host := strings.ToLower(u.Host)
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		host = h
+	}
+	host = strings.TrimPrefix(host, "www.")
+
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+
+	// Encode sorts the parameters by name, so their order doesn't matter either
+	key := "//" + host + strings.TrimRight(u.EscapedPath(), "/")
+	if encoded := query.Encode(); encoded != "" {
+		key += "?" + encoded
+	}
+	return key
+}
+
+// NormalizedURLs retrieves every link we have, keyed by NormalizeURL. If the same link has
+// been shared more than once, the first time is the one that's kept.
+func NormalizedURLs(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query(listURLsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		if key := NormalizeURL(raw); key != "" {
+			if _, seen := found[key]; !seen {
+				found[key] = id
+			}
+		}
+	}
+	return found, rows.Err()
+}
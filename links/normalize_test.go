@@ -0,0 +1,50 @@
+package links
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	key := NormalizeURL("https://example.com/a?b=2&c=3")
+	assert.Equal(t, "//example.com/a?b=2&c=3", key)
+
+	for _, same := range []string{
+		"http://Example.com/a/?c=3&b=2",
+		"https://www.example.com:443/a?b=2&c=3#comments",
+		"https://example.com/a?utm_source=twitter&b=2&utm_medium=social&c=3&fbclid=abc",
+		"  https://example.com/a?b=2&c=3  ",
+	} {
+		assert.Equal(t, key, NormalizeURL(same), same)
+	}
+
+	for _, different := range []string{
+		"https://example.com/a?b=2",
+		"https://example.com/A?b=2&c=3",
+		"https://blog.example.com/a?b=2&c=3",
+		"https://example.com:8080/a?b=2&c=3",
+	} {
+		assert.NotEqual(t, key, NormalizeURL(different), different)
+	}
+
+	assert.Equal(t, "//example.com", NormalizeURL("https://example.com/"))
+	assert.Equal(t, "", NormalizeURL("javascript:alert(1)"))
+	assert.Equal(t, "", NormalizeURL(""))
+}
+
+func TestNormalizedURLs(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listURLsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url"}).
+			AddRow(1, "https://example.com/a").
+			AddRow(2, "http://www.example.com/a/").
+			AddRow(3, "https://example.com/b"))
+	found, err := NormalizedURLs(db)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"//example.com/a": 1, "//example.com/b": 3}, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,57 @@
+package links
+
+// How do you decide which of sixty links is the "best"? Sorting by votes alone means the
+// link shared on Monday has had four more days to collect votes than the one shared on
+// Friday, and the Monday link will win every time. Sorting by newest means votes don't
+// matter at all. What we want is somewhere in between, and, like most people, we're going
+// to steal the answer from Hacker News:
+//
+//     rank = (votes + 1) / (age in hours + 2) ^ gravity
+//
+// Every link starts with a point (the "+ 1", think of it as the submitter's vote) and as
+// the link gets older it gets divided by a larger and larger number. The "+ 2" keeps brand
+// new links from dividing by something tiny and shooting to the top, and "gravity" decides
+// how quickly old links sink. Hacker News uses 1.8, and since our links only need to hold
+// their own for a week or so rather than a few hours, that seems like plenty.
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	gravity        = 1.8
+	ageOffsetHours = 2.0
+)
+
+// RankScore calculates a link's rank from its score and age. Higher is better.
+func RankScore(score int, createdAt, now time.Time) float64 {
+	hours := now.Sub(createdAt).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	return float64(score+1) / math.Pow(hours+ageOffsetHours, gravity)
+}
+
+// byRank sorts links from the highest to the lowest rank, as of "now"
+type byRank struct {
+	links []Link
+	now   time.Time
+}
+
+func (ranked byRank) Len() int {
+	return len(ranked.links)
+}
+func (ranked byRank) Swap(i, j int) {
+	ranked.links[i], ranked.links[j] = ranked.links[j], ranked.links[i]
+}
+func (ranked byRank) Less(i, j int) bool {
+	return RankScore(ranked.links[i].Score, ranked.links[i].CreatedAt, ranked.now) >
+		RankScore(ranked.links[j].Score, ranked.links[j].CreatedAt, ranked.now)
+}
+
+// Rank sorts the links, in place, from the highest rank to the lowest.
+func Rank(links []Link, now time.Time) {
+	sort.Stable(byRank{links, now})
+}
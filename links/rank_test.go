@@ -0,0 +1,38 @@
+package links
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankScore(t *testing.T) {
+	now := time.Now()
+
+	// More votes is better
+	assert.True(t, RankScore(5, now, now) > RankScore(1, now, now))
+
+	// Older is worse
+	assert.True(t, RankScore(1, now, now) > RankScore(1, now.Add(-24*time.Hour), now))
+
+	// But enough votes can make up for age
+	assert.True(t, RankScore(20, now.Add(-12*time.Hour), now) > RankScore(0, now.Add(-1*time.Hour), now))
+
+	// Links from the "future" (clock skew) are treated as brand new
+	assert.Equal(t, RankScore(1, now, now), RankScore(1, now.Add(time.Hour), now))
+}
+
+func TestRank(t *testing.T) {
+	now := time.Now()
+	links := []Link{
+		{ID: 1, Score: 0, CreatedAt: now.Add(-48 * time.Hour)},
+		{ID: 2, Score: 3, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: 3, Score: 0, CreatedAt: now.Add(-1 * time.Hour)},
+	}
+
+	Rank(links, now)
+	assert.Equal(t, int64(2), links[0].ID)
+	assert.Equal(t, int64(3), links[1].ID)
+	assert.Equal(t, int64(1), links[2].ID)
+}
@@ -0,0 +1,66 @@
+package links
+
+import (
+	"database/sql"
+	"html/template"
+
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/lib/pq"
+)
+
+// searchLinksQuery matches links against a search (see the search package, and the
+// triggers in migrations/6_search.sql that keep search_vector up to date). As always $1 is
+// the user whose votes we want and $2 is what's being searched for. $3 through $6 are the
+// tag, submitter, and date range filters, which are always in the query and get switched
+// off by passing in an empty string or a NULL. $7 and $8 are the ts_headline options for
+// the snippet and title, and $9 is the most results to return.
+const searchLinksQuery = "SELECT " + linkColumns + ", ts_rank(l.search_vector, query), " +
+	"ts_headline('english', l.title, query, $8), " +
+	"ts_headline('english', l.description || ' ' || COALESCE((SELECT string_agg(c.body, ' ') FROM comments c WHERE c.link_id = l.id AND NOT c.deleted AND NOT c.hidden), ''), query, $7) " +
+	"FROM " + linkTables + " CROSS JOIN websearch_to_tsquery('english', $2) query " +
+	"WHERE l.search_vector @@ query " +
+	"AND ($3 = '' OR EXISTS (SELECT 1 FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.link_id = l.id AND t.name = $3)) " +
+	"AND ($4 = '' OR u.email = $4) " +
+	"AND ($5::timestamptz IS NULL OR l.created_at >= $5) " +
+	"AND ($6::timestamptz IS NULL OR l.created_at < $6) " +
+	"ORDER BY ts_rank(l.search_vector, query) DESC, l.created_at DESC LIMIT $9"
+
+// SearchResult is a link that matched a search
+type SearchResult struct {
+	Link
+
+	// Rank is how well the link matched, higher is better
+	Rank float64
+
+	// TitleHTML is the link's title with any matches highlighted
+	TitleHTML template.HTML
+
+	// Snippet is the part of the link's description and comments that matched, highlighted
+	Snippet template.HTML
+}
+
+// Search finds the links that best match a query, best match first.
+func Search(db *sql.DB, query search.Query, userID int64) ([]SearchResult, error) {
+	rows, err := db.Query(searchLinksQuery, userID, query.Text, query.Tag, query.Submitter,
+		pq.NullTime{Time: query.From, Valid: !query.From.IsZero()},
+		pq.NullTime{Time: query.To, Valid: !query.To.IsZero()},
+		search.SnippetOptions, search.TitleOptions, search.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []SearchResult{}
+	for rows.Next() {
+		result := SearchResult{}
+		var title, snippet string
+		fields := append(linkFields(&result.Link), &result.Rank, &title, &snippet)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		result.TitleHTML = search.Highlight(title)
+		result.Snippet = search.Highlight(snippet)
+		found = append(found, result)
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,34 @@
+package links
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	from := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	columns := append(append([]string{}, linkRowColumns...), "rank", "title_headline", "snippet")
+	mock.ExpectQuery(regexp.QuoteMeta(searchLinksQuery)).
+		WithArgs(2, "postgres", "databases", "", pq.NullTime{Time: from, Valid: true}, pq.NullTime{},
+			search.SnippetOptions, search.TitleOptions, search.MaxResults).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "http://example.com/1", "All about Postgres", "", 3, "a@example.com", time.Now(), 0, 0, 0, 0, "{databases}", "",
+				0.5, "All about \x01Postgres\x02", "why <b>\x01postgres\x02</b> rocks"))
+
+	found, err := Search(db, search.Query{Text: "postgres", Tag: "databases", From: from}, 2)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, int64(1), found[0].ID)
+	assert.Equal(t, 0.5, found[0].Rank)
+	assert.Equal(t, "All about <mark>Postgres</mark>", string(found[0].TitleHTML))
+	assert.Equal(t, "why &lt;b&gt;<mark>postgres</mark>&lt;/b&gt; rocks", string(found[0].Snippet))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,53 @@
+package links
+
+import (
+	"regexp"
+	"strings"
+)
+
+// urlInText finds something that looks like a web address in the middle of some text
+var urlInText = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ExtractURLs finds every web address in some text, in the order they show up, without any
+// repeats. Punctuation at the end of one is much more likely to belong to the sentence than
+// the URL, so it's left off.
+func ExtractURLs(text string) []string {
+	found := []string{}
+	seen := map[string]bool{}
+	for _, match := range urlInText.FindAllString(text, -1) {
+		match = strings.TrimRight(match, ".,;:!?)'")
+		if !seen[match] {
+			seen[match] = true
+			found = append(found, match)
+		}
+	}
+	return found
+}
+
+// FromShare turns whatever a browser or phone handed to /share into a link, ready to be
+// looked over and submitted. Web share targets aren't very consistent about where they put
+// the URL: Android tends to leave "url" empty and stick the address into "text" along with
+// whatever else the app felt like sharing, so if we weren't given a URL we go looking for
+// one. Whatever text is left over makes a decent start on a description.
+func FromShare(rawURL, title, text string) Link {
+	link := Link{
+		URL:         strings.TrimSpace(rawURL),
+		Title:       strings.TrimSpace(title),
+		Description: strings.TrimSpace(text),
+	}
+
+	if link.URL == "" {
+		if found := ExtractURLs(link.Description); len(found) > 0 {
+			link.URL = found[0]
+		}
+	}
+	if link.URL != "" {
+		link.Description = strings.TrimSpace(strings.Replace(link.Description, link.URL, "", -1))
+	}
+
+	// Some apps use the URL as the title when they don't have anything better
+	if link.Title == link.URL {
+		link.Title = ""
+	}
+	return link
+}
@@ -0,0 +1,33 @@
+package links
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromShare(t *testing.T) {
+	link := FromShare("https://example.com/post", "A Post", "Worth a read")
+	assert.Equal(t, "https://example.com/post", link.URL)
+	assert.Equal(t, "A Post", link.Title)
+	assert.Equal(t, "Worth a read", link.Description)
+
+	link = FromShare("", "A Post", "Have you seen this? https://example.com/post.")
+	assert.Equal(t, "https://example.com/post", link.URL)
+	assert.Equal(t, "Have you seen this? .", link.Description)
+
+	link = FromShare("", "https://example.com/post", "https://example.com/post")
+	assert.Equal(t, "https://example.com/post", link.URL)
+	assert.Equal(t, "", link.Title)
+	assert.Equal(t, "", link.Description)
+
+	link = FromShare("", "", "No links here")
+	assert.Equal(t, "", link.URL)
+	assert.Equal(t, "No links here", link.Description)
+}
+
+func TestExtractURLs(t *testing.T) {
+	assert.Equal(t, []string{"https://example.com/a", "http://example.com/b?c=d"},
+		ExtractURLs("First https://example.com/a, then (http://example.com/b?c=d) and https://example.com/a again."))
+	assert.Equal(t, []string{}, ExtractURLs("Nothing to see here"))
+}
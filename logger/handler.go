@@ -0,0 +1,166 @@
+package logger
+
+// slog comes with a text handler of its own, but it writes "time=... level=INFO msg=...", which
+// is a lot less pleasant to read in a terminal than what we've always had, so text is written
+// by our own handler instead. JSON is slog's, with a few of its keys renamed to what our log
+// pipeline expects.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newHandler creates the handler for a level's logger. decorate is whether text has the time
+// and caller on every line, JSON always does.
+func newHandler(level slog.Level, output io.Writer, format string, decorate bool) slog.Handler {
+	if format == JSONFormat {
+		return slog.NewJSONHandler(output, &slog.HandlerOptions{
+			AddSource:   true,
+			Level:       slog.LevelDebug,
+			ReplaceAttr: replaceJSONAttr,
+		})
+	}
+	return &textHandler{
+		output:   output,
+		prefix:   strings.ToUpper(levelName(level)) + ": ",
+		decorate: decorate,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// replaceJSONAttr renames slog's built in keys: "time" is "ts", "source" is "caller" (and just
+// a file and line, rather than an object), and levels are ours rather than slog's ("warning"
+// instead of "WARN")
+func replaceJSONAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+	switch attr.Key {
+	case slog.TimeKey:
+		attr.Key = "ts"
+	case slog.LevelKey:
+		if level, ok := attr.Value.Any().(slog.Level); ok {
+			attr.Value = slog.StringValue(levelName(level))
+		}
+	case slog.SourceKey:
+		if source, ok := attr.Value.Any().(*slog.Source); ok {
+			attr = slog.String("caller", caller(source.File, source.Line))
+		}
+	}
+	return attr
+}
+
+// caller is where something was logged from, as its package's directory, file and line,
+// like "handlers/issues.go:42"
+func caller(file string, line int) string {
+	return fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
+}
+
+// textHandler writes each message as a line of text: "INFO: 2017/03/01 12:00:00
+// handlers/issues.go:42: Message key=value"
+type textHandler struct {
+	output   io.Writer
+	prefix   string
+	decorate bool
+	attrs    []slog.Attr
+	group    string
+
+	// mu is shared between a handler and all of the handlers made from it with WithAttrs, so
+	// that lines don't get mixed up with each other
+	mu *sync.Mutex
+}
+
+// Enabled is always true, since our Loggers check the level for themselves
+func (handler *textHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+// Handle writes out a message
+func (handler *textHandler) Handle(_ context.Context, record slog.Record) error {
+	line := &bytes.Buffer{}
+	line.WriteString(handler.prefix)
+	if handler.decorate {
+		line.WriteString(record.Time.Format("2006/01/02 15:04:05 "))
+		if record.PC != 0 {
+			frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+			line.WriteString(caller(frame.File, frame.Line) + ": ")
+		}
+	}
+	line.WriteString(record.Message)
+
+	for _, attr := range handler.attrs {
+		writeAttr(line, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(line, handler.group, attr)
+		return true
+	})
+	line.WriteString("\n")
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	_, err := handler.output.Write(line.Bytes())
+	return err
+}
+
+// WithAttrs returns a handler that adds some attributes to everything it writes
+func (handler *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	copied := *handler
+	copied.attrs = append([]slog.Attr{}, handler.attrs...)
+	for _, attr := range attrs {
+		if handler.group != "" {
+			attr.Key = handler.group + attr.Key
+		}
+		copied.attrs = append(copied.attrs, attr)
+	}
+	return &copied
+}
+
+// WithGroup returns a handler whose attributes from now on go in a group, which in text just
+// means putting the group's name in front of their keys: "group.key=value"
+func (handler *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	copied := *handler
+	copied.group = handler.group + name + "."
+	return &copied
+}
+
+// writeAttr writes " key=value", quoting the value if it needs it. Groups are written as each
+// of their attributes, with the group's name in front of their keys.
+func writeAttr(line *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix = prefix + attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			writeAttr(line, prefix, member)
+		}
+		return
+	}
+
+	value := ""
+	if attr.Value.Kind() == slog.KindTime {
+		value = attr.Value.Time().Format(time.RFC3339)
+	} else {
+		value = attr.Value.String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") || !strconv.CanBackquote(value) {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(line, " %s%s=%s", prefix, attr.Key, value)
+}
@@ -2,12 +2,15 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"runtime"
 	"strings"
+	"time"
 )
 
 // I've been firmly indoctrinated in the current understanding that global variables are evil. I don't
@@ -19,56 +22,206 @@ import (
 // injection just to satisfy programming dogma, the end result is that person will probably just
 // not use the logger. Which is the worst result. It's also, generally, easy and benign enough
 // to not make writing tests a chore.
+//
+// These used to be plain old log.Loggers, which was fine until we started running somewhere whose
+// log pipeline wants JSON, one object per line, with fields it can search on. So now they sit on
+// top of log/slog instead. The Printf family still works exactly the way it did, since that's
+// how nearly everything logs and there's nothing wrong with it, and Log adds fields on the end
+// of a message. Where the logs go, and what they look like, is up to the config (see Configure).
 var (
 	// Debug logs verbose messages for use in debugging
-	Debug = log.New(ioutil.Discard, "", 0)
+	Debug = newLogger(slog.LevelDebug, ioutil.Discard, TextFormat, false)
 
 	// Info logs regular messages to keep track of status of application
-	Info = log.New(ioutil.Discard, "", 0)
+	Info = newLogger(slog.LevelInfo, ioutil.Discard, TextFormat, false)
 
 	// Warning logs messages that might lead to disrupt behavior of the application
-	Warning = log.New(ioutil.Discard, "", 0)
+	Warning = newLogger(slog.LevelWarn, ioutil.Discard, TextFormat, false)
 
 	// Error logs messages when things go very wrong and will screw up the application
-	Error = log.New(ioutil.Discard, "", 0)
+	Error = newLogger(slog.LevelError, ioutil.Discard, TextFormat, false)
+
+	// minimum is the lowest level that gets logged, see SetLogLevel. Everything is, to begin with.
+	minimum = func() *slog.LevelVar {
+		level := new(slog.LevelVar)
+		level.Set(slog.LevelDebug)
+		return level
+	}()
+)
+
+const (
+	// TextFormat logs a line of text for each message, the way we always have: "INFO: ", when
+	// and where it was logged, the message and then any fields, as key=value
+	TextFormat = "text"
+
+	// JSONFormat logs a JSON object for each message, with its level, ts (the time), msg,
+	// caller and any fields
+	JSONFormat = "json"
 )
 
-// InitLogging initializes the global logging variables for use.
-func InitLogging(debugOutput io.Writer, infoOutput io.Writer, warningOutput io.Writer, errorOutput io.Writer, logFormat int) {
-	Debug = log.New(debugOutput, "DEBUG: ", logFormat)
-	Info = log.New(infoOutput, "INFO: ", logFormat)
-	Warning = log.New(warningOutput, "WARNING: ", logFormat)
-	Error = log.New(errorOutput, "ERROR: ", logFormat)
+// levels are the names of our levels, which are also what SetLogLevel understands
+var levels = map[string]slog.Level{
+	"debug":   slog.LevelDebug,
+	"info":    slog.LevelInfo,
+	"warning": slog.LevelWarn,
+	"error":   slog.LevelError,
 }
 
-// InitLoggingDefault initializes logging with the default settings of logging everything to standard out.
-func InitLoggingDefault() {
-	InitLogging(os.Stdout, os.Stdout, os.Stdout, os.Stdout, log.Ldate|log.Ltime|log.Lshortfile)
+func levelName(level slog.Level) string {
+	for name, l := range levels {
+		if l == level {
+			return name
+		}
+	}
+	return strings.ToLower(level.String())
 }
 
-// SetLogLevel sets the lowest log level of which to show and suppresses all those lower.
-func SetLogLevel(level string) {
-	//This guy needs a lot of work. For one, it's not very DRY, I imagine a lot of it can be
-	// factored out into functions. More so, it's not idemportent. If you call SetLogLevel(WARNING)
-	// and then SetLogLevel(INFO), info still remains pointed to Discard.
-
-	switch strings.ToLower(level) {
-	case "info":
-		Debug.SetOutput(ioutil.Discard)
-	case "warning":
-		Debug.SetOutput(ioutil.Discard)
-		Info.SetOutput(ioutil.Discard)
-	case "error":
-		Debug.SetOutput(ioutil.Discard)
-		Info.SetOutput(ioutil.Discard)
-		Warning.SetOutput(ioutil.Discard)
+// Logger logs messages at a single level. It has the same Print, Printf and Println as the
+// standard library's log.Logger, along with Log and LogContext for messages with fields.
+type Logger struct {
+	level   slog.Level
+	handler slog.Handler
+}
+
+func newLogger(level slog.Level, output io.Writer, format string, decorate bool) *Logger {
+	return &Logger{level: level, handler: newHandler(level, output, format, decorate)}
+}
+
+// New creates a Logger at the info level of its own, separate from Debug, Info, Warning and
+// Error, for when something needs to log somewhere else (or in another format) than the rest
+// of the app does
+func New(output io.Writer, format string) *Logger {
+	return newLogger(slog.LevelInfo, output, format, true)
+}
+
+// Print logs a message, formatted like fmt.Print
+func (logger *Logger) Print(v ...interface{}) {
+	logger.log(context.Background(), fmt.Sprint(v...), nil)
+}
+
+// Printf logs a message, formatted like fmt.Printf
+func (logger *Logger) Printf(format string, v ...interface{}) {
+	logger.log(context.Background(), fmt.Sprintf(format, v...), nil)
+}
+
+// PrintfContext is Printf, plus whatever fields have been added to the context (see WithFields)
+func (logger *Logger) PrintfContext(ctx context.Context, format string, v ...interface{}) {
+	logger.log(ctx, fmt.Sprintf(format, v...), nil)
+}
+
+// Println logs a message, formatted like fmt.Println (every message is a line of its own
+// anyway, so there's no difference from Print other than the spaces)
+func (logger *Logger) Println(v ...interface{}) {
+	logger.log(context.Background(), strings.TrimSuffix(fmt.Sprintln(v...), "\n"), nil)
+}
+
+// Log logs a message with fields, which are given as alternating keys and values:
+// logger.Info.Log("Sent issue", "issue", issue.ID, "recipients", 120)
+func (logger *Logger) Log(msg string, fields ...interface{}) {
+	logger.log(context.Background(), msg, fields)
+}
+
+// LogContext is Log, plus whatever fields have been added to the context (see WithFields),
+// which is how everything logged while handling a request can say which request it was
+func (logger *Logger) LogContext(ctx context.Context, msg string, fields ...interface{}) {
+	logger.log(ctx, msg, fields)
+}
+
+// With returns a logger at the same level that adds the given fields to everything it logs
+func (logger *Logger) With(fields ...interface{}) *Logger {
+	return &Logger{level: logger.level, handler: logger.handler.WithAttrs(toAttrs(fields))}
+}
+
+// Enabled is whether anything logged at this level is going to be kept, for when working
+// out what to log is expensive
+func (logger *Logger) Enabled() bool {
+	return logger.level >= minimum.Level()
+}
+
+// log does the actual logging. It has to be called directly by one of the exported functions,
+// since it counts its way back up the stack to find where the message was logged from.
+func (logger *Logger) log(ctx context.Context, msg string, fields []interface{}) {
+	if !logger.Enabled() {
+		return
 	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), logger.level, msg, pcs[0])
+	record.AddAttrs(contextFields(ctx)...)
+	record.Add(fields...)
+	logger.handler.Handle(ctx, record)
 }
 
-// LogHTTPRequests wraps an http handler to log every request that comes in.
-func LogHTTPRequests(logger *log.Logger, handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Printf("%s %s %s", r.RemoteAddr, r.Method, r.URL)
-		handler.ServeHTTP(w, r)
+// toAttrs turns alternating keys and values into attributes. slog already knows how to do
+// that (including what to do with a key that's missing its value), it just doesn't export it.
+func toAttrs(fields []interface{}) []slog.Attr {
+	record := slog.Record{}
+	record.Add(fields...)
+	attrs := []slog.Attr{}
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
 	})
+	return attrs
+}
+
+// contextKey is what the fields for a context are kept under
+type contextKey struct{}
+
+// WithFields returns a copy of a context carrying some fields (as alternating keys and
+// values), which get added to anything logged with it through LogContext
+func WithFields(ctx context.Context, fields ...interface{}) context.Context {
+	attrs := append(append([]slog.Attr{}, contextFields(ctx)...), toAttrs(fields)...)
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+func contextFields(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
+
+// InitLogging initializes the global logging variables for use, in the given format (TextFormat or
+// JSONFormat). Everything gets logged again afterwards, whatever SetLogLevel was set to.
+func InitLogging(debugOutput io.Writer, infoOutput io.Writer, warningOutput io.Writer, errorOutput io.Writer, format string) {
+	initLogging(debugOutput, infoOutput, warningOutput, errorOutput, format, true)
+}
+
+// initLogging is InitLogging, optionally without the time and caller on every line of text, which
+// is only really useful in tests
+func initLogging(debugOutput io.Writer, infoOutput io.Writer, warningOutput io.Writer, errorOutput io.Writer, format string, decorate bool) {
+	Debug = newLogger(slog.LevelDebug, debugOutput, format, decorate)
+	Info = newLogger(slog.LevelInfo, infoOutput, format, decorate)
+	Warning = newLogger(slog.LevelWarn, warningOutput, format, decorate)
+	Error = newLogger(slog.LevelError, errorOutput, format, decorate)
+	minimum.Set(slog.LevelDebug)
+}
+
+// InitLoggingDefault initializes logging with the default settings of logging everything to standard out,
+// as text. That's what we use until we've read the config, which can then change it with Configure.
+func InitLoggingDefault() {
+	InitLogging(os.Stdout, os.Stdout, os.Stdout, os.Stdout, TextFormat)
+}
+
+// Configure switches logging (still to standard out) over to the given format and level, as set in
+// the config
+func Configure(format string, level string) error {
+	format = strings.ToLower(format)
+	if format != TextFormat && format != JSONFormat {
+		return fmt.Errorf("Unknown log format '%s', it should be '%s' or '%s'", format, TextFormat, JSONFormat)
+	}
+	if _, ok := levels[strings.ToLower(level)]; !ok {
+		return fmt.Errorf("Unknown log level '%s', it should be one of debug, info, warning or error", level)
+	}
+
+	InitLogging(os.Stdout, os.Stdout, os.Stdout, os.Stdout, format)
+	SetLogLevel(level)
+	return nil
+}
+
+// SetLogLevel sets the lowest log level of which to show and suppresses all those lower. Levels it
+// doesn't know about are ignored.
+func SetLogLevel(level string) {
+	if l, ok := levels[strings.ToLower(level)]; ok {
+		minimum.Set(l)
+	}
 }
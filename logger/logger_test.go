@@ -1,8 +1,8 @@
 package logger
 
 import (
-	"net/http"
-	"net/http/httptest"
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,17 +38,53 @@ func TestSetLogLevel(t *testing.T) {
 	SetLogLevel("ERROR")
 	Warning.Println("SUPPRESSED?")
 	assert.Equal(t, "", log.Warning.Last())
+
+	// Going back down should let everything through again
+	SetLogLevel("DEBUG")
+	Debug.Println("NOT SUPPRESSED")
+	assert.Equal(t, "DEBUG: NOT SUPPRESSED\n", log.Debug.Last())
 }
 
-func TestLogHTTPRequests(t *testing.T) {
+func TestLogFields(t *testing.T) {
 	log := CreateDummyLogger()
 
-	mux := http.NewServeMux()
-	handler := LogHTTPRequests(Debug, mux)
+	Info.Log("Sent issue", "issue", 3, "title", "Issue #3", "draft", false)
+	assert.Equal(t, "INFO: Sent issue issue=3 title=\"Issue #3\" draft=false\n", log.Info.Last())
+
+	Warning.With("feed", 6).Printf("Unable to poll: %s", "timeout")
+	assert.Equal(t, "WARNING: Unable to poll: timeout feed=6\n", log.Warning.Last())
+
+	ctx := WithFields(WithFields(context.Background(), "request_id", "abc"), "user", 2)
+	Error.LogContext(ctx, "Failed", "status", 500)
+	assert.Equal(t, "ERROR: Failed request_id=abc user=2 status=500\n", log.Error.Last())
+
+	Error.PrintfContext(ctx, "Unable to load link %d", 42)
+	assert.Equal(t, "ERROR: Unable to load link 42 request_id=abc user=2\n", log.Error.Last())
+}
+
+func TestJSONFormat(t *testing.T) {
+	writer := CreateTestingWriter()
+	InitLogging(writer, writer, writer, writer, JSONFormat)
+	defer CreateDummyLogger()
+
+	Warning.LogContext(WithFields(context.Background(), "request_id", "abc"), "Slow", "ms", 1200)
+
+	line := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(writer.Last()), &line))
+	assert.Equal(t, "warning", line["level"])
+	assert.Equal(t, "Slow", line["msg"])
+	assert.Equal(t, "abc", line["request_id"])
+	assert.Equal(t, float64(1200), line["ms"])
+	assert.NotEmpty(t, line["ts"])
+	assert.Regexp(t, `^logger/logger_test\.go:\d+$`, line["caller"])
+}
 
-	req := httptest.NewRequest("GET", "/test", nil)
-	resp := httptest.NewRecorder()
+func TestConfigure(t *testing.T) {
+	defer CreateDummyLogger()
 
-	handler.ServeHTTP(resp, req)
-	assert.Contains(t, log.Debug.Last(), "GET /test")
+	assert.NotNil(t, Configure("xml", "info"))
+	assert.NotNil(t, Configure("json", "loud"))
+	assert.Nil(t, Configure("JSON", "Warning"))
+	assert.False(t, Info.Enabled())
+	assert.True(t, Warning.Enabled())
 }
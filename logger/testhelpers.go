@@ -101,6 +101,6 @@ func CreateDummyLogger() DummyLogger {
 		Warning: CreateTestingWriter(),
 		Error:   CreateTestingWriter(),
 	}
-	InitLogging(logger.Debug, logger.Info, logger.Warning, logger.Error, 0)
+	initLogging(logger.Debug, logger.Info, logger.Warning, logger.Error, TextFormat, false)
 	return logger
 }
@@ -0,0 +1,158 @@
+// Package mail sends the odd email on LinkLetter's behalf, like the confirmation we reply
+// with when somebody emails us a link.
+package mail
+
+// Sending mail is slow, and the server on the other end is allowed to be flaky, so nothing
+// should ever send an email from inside of a request. Instead Enqueue it, and one of the
+// background workers (see the jobs package) will pick it up and retry it if it fails.
+//
+// We speak plain old SMTP to whatever relay is in the config, which covers just about every
+// provider out there, along with a local postfix if that's more your speed.
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// SendJob is the type of job that sends a single Message
+const SendJob = "mail.send"
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+
+	// InReplyTo is the Message-ID of the email this is a reply to, if it is one, so that it
+	// shows up in the same thread
+	InReplyTo string
+
+	// AutoReply marks the message as having been sent automatically in response to another
+	// one (RFC 3834). Well behaved mail servers won't auto-reply to it in turn, which saves
+	// us from getting stuck in a loop with somebody's vacation responder.
+	AutoReply bool
+}
+
+// header strips line breaks out of a header value, so that nobody can sneak in headers of
+// their own by, say, putting a newline in the subject of an email they sent us, and encodes
+// it if it isn't plain ASCII.
+func header(value string) string {
+	value = strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+	return mime.QEncoding.Encode("utf-8", value)
+}
+
+// Bytes formats the message, ready to be handed to an SMTP server
+func (message Message) Bytes(from string, now time.Time) []byte {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "From: %s\r\n", header(from))
+	fmt.Fprintf(buffer, "To: %s\r\n", header(message.To))
+	fmt.Fprintf(buffer, "Subject: %s\r\n", header(message.Subject))
+	fmt.Fprintf(buffer, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	if message.InReplyTo != "" {
+		fmt.Fprintf(buffer, "In-Reply-To: %s\r\n", header(message.InReplyTo))
+		fmt.Fprintf(buffer, "References: %s\r\n", header(message.InReplyTo))
+	}
+	if message.AutoReply {
+		buffer.WriteString("Auto-Submitted: auto-replied\r\n")
+	}
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buffer.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(buffer)
+	body.Write([]byte(strings.Replace(message.Body, "\n", "\r\n", -1)))
+	body.Close()
+	return buffer.Bytes()
+}
+
+// Sender is anything that can send a Message. Outside of tests that's an SMTPSender.
+type Sender interface {
+	Send(message Message) error
+}
+
+// SMTPSender sends messages through an SMTP relay. If it doesn't have a Host, sending mail
+// is turned off, and messages are logged and thrown away.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// From is who our emails come from, such as "LinkLetter <links@example.com>"
+	From string
+}
+
+// Send sends a message through the relay
+func (sender SMTPSender) Send(message Message) error {
+	if sender.Host == "" {
+		logger.Warning.Printf("Sending mail isn't configured, so '%s' to %s is being thrown away", message.Subject, message.To)
+		return nil
+	}
+
+	// net/smtp won't send credentials over a connection that isn't encrypted, unless it's to
+	// localhost, so there's no danger of us leaking the password to the network here.
+	var auth smtp.Auth
+	if sender.Username != "" {
+		auth = smtp.PlainAuth("", sender.Username, sender.Password, sender.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", sender.Host, sender.Port), auth, envelopeAddress(sender.From),
+		[]string{envelopeAddress(message.To)}, message.Bytes(sender.From, time.Now()))
+}
+
+// Ping checks that the relay is there and answering, by connecting and waiting for it to say
+// hello, without sending anything or logging in
+func (sender SMTPSender) Ping(timeout time.Duration) error {
+	address := net.JoinHostPort(sender.Host, strconv.Itoa(sender.Port))
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, sender.Host)
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// envelopeAddress pulls the bare address out of something like "Someone <someone@example.com>"
+func envelopeAddress(address string) string {
+	if start := strings.LastIndex(address, "<"); start != -1 {
+		if end := strings.Index(address[start:], ">"); end != -1 {
+			return address[start+1 : start+end]
+		}
+	}
+	return strings.TrimSpace(address)
+}
+
+// Enqueue queues a message up to be sent by a background worker
+func Enqueue(queue *jobs.Queue, message Message) error {
+	_, err := queue.Enqueue(SendJob, message)
+	return err
+}
+
+// SendHandler is the jobs.Handler for SendJob
+func SendHandler(sender Sender) jobs.Handler {
+	return func(job jobs.Job) error {
+		message := Message{}
+		if err := job.Decode(&message); err != nil {
+			// Retrying isn't going to make the payload any less broken
+			logger.Error.Printf("Unable to decode email in job %d, giving up on it: %s", job.ID, err)
+			return nil
+		}
+		return sender.Send(message)
+	}
+}
@@ -0,0 +1,109 @@
+package mail
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSender struct {
+	sent []Message
+	err  error
+}
+
+func (sender *fakeSender) Send(message Message) error {
+	sender.sent = append(sender.sent, message)
+	return sender.err
+}
+
+func TestBytes(t *testing.T) {
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	raw := string(Message{
+		To:        "someone@example.com",
+		Subject:   "Got it\r\nBcc: everyone@example.com",
+		Body:      "Thanks!\nSee you later",
+		InReplyTo: "<abc@example.com>",
+		AutoReply: true,
+	}.Bytes("LinkLetter <links@example.com>", now))
+
+	assert.Contains(t, raw, "From: LinkLetter <links@example.com>\r\n")
+	assert.Contains(t, raw, "To: someone@example.com\r\n")
+	assert.Contains(t, raw, "Subject: Got it Bcc: everyone@example.com\r\n")
+	assert.NotContains(t, raw, "\r\nBcc:")
+	assert.Contains(t, raw, "Date: Sat, 04 Mar 2017 05:06:07 +0000\r\n")
+	assert.Contains(t, raw, "In-Reply-To: <abc@example.com>\r\n")
+	assert.Contains(t, raw, "Auto-Submitted: auto-replied\r\n")
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\nThanks!\r\nSee you later"))
+
+	raw = string(Message{To: "someone@example.com", Subject: "Café"}.Bytes("links@example.com", now))
+	assert.Contains(t, raw, "Subject: =?utf-8?q?Caf=C3=A9?=\r\n")
+	assert.NotContains(t, raw, "In-Reply-To")
+	assert.NotContains(t, raw, "Auto-Submitted")
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	assert.Equal(t, "links@example.com", envelopeAddress("LinkLetter <links@example.com>"))
+	assert.Equal(t, "links@example.com", envelopeAddress(" links@example.com "))
+}
+
+func TestSendHandler(t *testing.T) {
+	sender := &fakeSender{}
+	handler := SendHandler(sender)
+
+	assert.Nil(t, handler(jobs.Job{Payload: []byte(`{"To": "someone@example.com", "Subject": "Hi"}`)}))
+	assert.Equal(t, []Message{{To: "someone@example.com", Subject: "Hi"}}, sender.sent)
+
+	// Broken payloads are dropped rather than retried
+	assert.Nil(t, handler(jobs.Job{Payload: []byte(`nope`)}))
+	assert.Len(t, sender.sent, 1)
+
+	sender.err = errors.New("Relay is down")
+	assert.Equal(t, sender.err, handler(jobs.Job{Payload: []byte(`{}`)}))
+}
+
+func TestSendUnconfigured(t *testing.T) {
+	assert.Nil(t, SMTPSender{}.Send(Message{To: "someone@example.com"}))
+}
+
+func TestPing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	quit := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("220 relay.example.com ESMTP\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			// net/smtp says hello before it says goodbye
+			if line == "QUIT\r\n" {
+				conn.Write([]byte("221 Bye\r\n"))
+				quit <- line
+				return
+			}
+			conn.Write([]byte("250 relay.example.com\r\n"))
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	assert.Nil(t, SMTPSender{Host: "127.0.0.1", Port: address.Port}.Ping(time.Second))
+	assert.Equal(t, "QUIT\r\n", <-quit)
+
+	listener.Close()
+	assert.NotNil(t, SMTPSender{Host: "127.0.0.1", Port: address.Port}.Ping(time.Second))
+}
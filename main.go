@@ -119,13 +119,43 @@ package main
 // They did end up, begrudgingly, adding vendoring support, which at least provides the shadow of an idea of
 // versioning. This project takes advantage of this by way of the grea GoDeps library.
 import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/cj-dimaggio/LinkLetter/acme"
+	"github.com/cj-dimaggio/LinkLetter/archive"
+	"github.com/cj-dimaggio/LinkLetter/bookmarks"
+	"github.com/cj-dimaggio/LinkLetter/bounces"
 	"github.com/cj-dimaggio/LinkLetter/config"
 	"github.com/cj-dimaggio/LinkLetter/database"
+	"github.com/cj-dimaggio/LinkLetter/feeds"
+	"github.com/cj-dimaggio/LinkLetter/health"
+	"github.com/cj-dimaggio/LinkLetter/inbound"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/linkcheck"
 	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/mail"
+	"github.com/cj-dimaggio/LinkLetter/metrics"
+	"github.com/cj-dimaggio/LinkLetter/slack"
+	"github.com/cj-dimaggio/LinkLetter/users"
 	"github.com/cj-dimaggio/LinkLetter/web"
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
 )
 
 // Here it is, the entry point into our system. It's a main function just like most other programming languages.
@@ -141,13 +171,16 @@ import (
 // and lulls potential contributors into the project, unaware of the horrors that await them a few folders away.
 func main() {
 
-	// Shouldn't logging be initialized after we've gotten our configs? So that the config can determine things
-	// like the log level and log location? Yeah, but we don't have any of those options anyway, so that simplifies
-	// things.
+	// Logging starts out with the defaults, so that there's somewhere for anything that goes wrong while we're
+	// reading the config to go, and then the config gets to decide on its format and level.
 	logger.InitLoggingDefault()
 
 	logger.Debug.Printf("Determining configs...")
 	conf := config.ParseForConfig()
+	if err := logger.Configure(conf.LogFormat, conf.LogLevel); err != nil {
+		logger.Error.Printf("Unable to configure logging: %s", err)
+		os.Exit(1)
+	}
 
 	db := database.ConnectToDB(conf)
 
@@ -156,14 +189,574 @@ func main() {
 	// her database migrations with another program. But this project is a constant balancing act between being
 	// easy and straightforward to encourage contribution, and establishing good habits. In this case, for such
 	// a simple scoped application, I think having it so that the application "just works" when you run it is
-	// worth it. I'll happily deal with the looks of scorn from my DBA friends. We should, however, add flags
-	// so that you can suppress this behavior, or run the migrations without starting the webapp, as it would
-	// assist in debugging and management.
-	database.DoMigrations(db)
+	// worth it. I'll happily deal with the looks of scorn from my DBA friends. The web server runs them itself,
+	// once it's already listening, so that /readyz can tell whatever's in front of us that it isn't ready yet
+	// rather than it looking like we never came up at all.
+	if command := flag.Arg(0); command != "" && command != "web" {
+		database.DoMigrations(db)
+	}
+
+	// Whatever is left over after the flags have been parsed we treat as a command. No command at all means
+	// we do what we've always done and start up the web server. The Procfile uses "worker" to run a process
+	// that does nothing but churn through background jobs. Keep in mind that Go's flag package stops parsing
+	// at the first non-flag argument, so flags need to come *before* the command: "LinkLetter -workers 4 worker"
+	switch flag.Arg(0) {
+	case "", "web":
+		runWeb(conf, db)
+	case "worker":
+		runWorker(conf, db)
+	case "process-dsn":
+		runProcessDSN(conf, db, flag.Args()[1:])
+	case "import-bookmarks":
+		runImportBookmarks(conf, db, flag.Args()[1:])
+	case "export":
+		runExport(db, flag.Args()[1:])
+	case "import":
+		runImport(db, flag.Args()[1:])
+	default:
+		logger.Error.Printf("Unknown command: '%s'", flag.Arg(0))
+		os.Exit(1)
+	}
+}
+
+// runWeb starts the web server, along with a few background workers (and the feed poller and link checker) if the
+// config asks for them. Running the workers in the same process as the web server is a bit of a cheat, but it means the app still
+// "just works" for somebody running a single Heroku dyno or a single binary on their laptop.
+//
+// It runs until it's told to stop, with a SIGTERM (which is how Heroku says goodbye, on every deploy and every
+// restart) or a Ctrl-C. Then the requests that are under way get to finish, the workers get to finish their jobs,
+// and only then do we go.
+func runWeb(conf config.Config, db *sql.DB) {
+	checker := health.NewChecker(db, smtpSender(conf))
+	checker.SetMigrating(true)
+
+	tlsConfig, certs, err := configureTLS(conf)
+	if err != nil {
+		logger.Error.Printf("Unable to set up TLS: %s", err)
+		os.Exit(1)
+	}
 
 	logger.Debug.Println("Creating server...")
 	server := web.CreateServer(conf, db)
 
+	registry := newMetrics(db)
+	handler := middleware.Instrument(metrics.NewHTTP(registry), server.RouteTemplate, server.Route())
+	if !serveMetrics(conf, registry) && conf.MetricsToken != "" {
+		handler = withRoutes(map[string]http.Handler{"/metrics": registry.Handler(conf.MetricsToken)}, handler)
+	}
+	// We start listening before the migrations are done, so that the probes can answer, but nothing else gets
+	// through until they are
+	handler = checker.WhileMigrating(handler)
+	handler = middleware.RequestID(middleware.AccessLog(os.Stdout, conf.AccessLogFormat, handler))
+
+	// The probes go around the access log and the metrics, since they're asked every few seconds, forever, and
+	// would drown out everything else in both. They go around the migrations too, of course.
+	handler = withRoutes(map[string]http.Handler{"/healthz": health.LiveHandler(), "/readyz": checker.ReadyHandler()}, handler)
+
 	logger.Info.Printf("Starting server...")
-	http.ListenAndServe(fmt.Sprintf(":%d", conf.WebPort), logger.LogHTTPRequests(logger.Info, server.Route()))
+	errs := make(chan error, 2)
+	servers := []*http.Server{newHTTPServer(conf, conf.WebPort, handler)}
+	servers[0].TLSConfig = tlsConfig
+	if port := redirectPort(conf); tlsConfig != nil && port > 0 {
+		var redirect http.Handler = redirectToHTTPS(conf.WebPort)
+		if certs != nil {
+			redirect = certs.HTTPHandler(redirect)
+		}
+		servers = append(servers, newHTTPServer(conf, port, redirect))
+	}
+	// We listen before anything else gets started, so that if we can't (because something else already has the
+	// port, say) we can give up before running migrations or starting workers that would only have to be stopped
+	// again
+	listeners := []net.Listener{}
+	for _, httpServer := range servers {
+		listener, err := net.Listen("tcp", httpServer.Addr)
+		if err != nil {
+			logger.Error.Printf("Unable to listen on %s: %s", httpServer.Addr, err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, listener)
+	}
+	for i, httpServer := range servers {
+		go func(httpServer *http.Server, listener net.Listener) {
+			errs <- serve(httpServer, listener)
+		}(httpServer, listeners[i])
+	}
+
+	database.DoMigrations(db)
+	checker.SetMigrating(false)
+
+	stopBackground := func() {}
+	if conf.Workers > 0 {
+		stopBackground = startBackground(conf, db)
+	}
+	if certs != nil {
+		certs.Start()
+	}
+	inboundSMTP := startInboundSMTP(conf, db)
+
+	// A server that stops by itself is a failure, and we say so on the way out, so that whatever's running us knows
+	// to start us again
+	stopped := waitForSignal(errs)
+	if stopped != nil {
+		logger.Error.Printf("Server stopped: %s", stopped)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf.ShutdownTimeout)*time.Second)
+	defer cancel()
+	for _, httpServer := range servers {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Warning.Printf("Gave up waiting on requests to finish: %s", err)
+		}
+	}
+	if inboundSMTP != nil {
+		inboundSMTP.Close()
+	}
+	if certs != nil {
+		certs.Stop()
+	}
+	stopBackground()
+	db.Close()
+	if stopped != nil {
+		os.Exit(1)
+	}
+	logger.Info.Printf("Stopped")
+}
+
+// newHTTPServer creates a server for handler on port, with the config's timeouts. Without them, a client that opens
+// a connection and then sends nothing (or sends it a byte at a time) gets to hold on to it forever.
+func newHTTPServer(conf config.Config, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
+		ReadTimeout:  time.Duration(conf.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(conf.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(conf.IdleTimeout) * time.Second,
+	}
+}
+
+// serve serves HTTPS on listener if the server has TLS configured, and HTTP if it doesn't. Shutting it down isn't an
+// error.
+func serve(server *http.Server, listener net.Listener) error {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// waitForSignal waits until we're told to stop, or one of our servers stops on its own (returning why)
+func waitForSignal(errs <-chan error) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		logger.Info.Printf("Received %s, shutting down...", sig)
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// configureTLS works out whether we're serving HTTPS ourselves, and with what. Most of the time we aren't: Heroku, or
+// whatever proxy is in front of us, takes care of it. Somebody running LinkLetter out in the open can either give
+// us a certificate and its key, or a list of domains to get one for over ACME. The Manager is only returned in the
+// second case, and needs starting and stopping along with everything else.
+func configureTLS(conf config.Config) (*tls.Config, *acme.Manager, error) {
+	switch {
+	case conf.ACMEDomains != "":
+		httpClient, err := acme.HTTPClient(conf.ACMECA)
+		if err != nil {
+			return nil, nil, err
+		}
+		domains := []string{}
+		for _, domain := range strings.Split(conf.ACMEDomains, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				domains = append(domains, domain)
+			}
+		}
+		certs := acme.NewManager(conf.ACMEDirectory, conf.ACMEEmail, conf.ACMECacheDir, domains, httpClient)
+		return &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}, certs, nil
+
+	case conf.TLSCert != "" || conf.TLSKey != "":
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil, nil
+	}
+	return nil, nil, nil
+}
+
+// redirectPort is the port we serve plain HTTP on when we're serving HTTPS. ACME's challenges always come in on port
+// 80, so that's where it is if we're getting our certificates that way and the config doesn't say otherwise.
+func redirectPort(conf config.Config) int {
+	if conf.HTTPPort == 0 && conf.ACMEDomains != "" {
+		return 80
+	}
+	return conf.HTTPPort
+}
+
+// redirectToHTTPS sends everybody who comes in over plain HTTP over to the same page on HTTPS
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// newMetrics creates the registry of everything we report to Prometheus, apart from the metrics about requests, which
+// only the web server has.
+func newMetrics(db *sql.DB) *metrics.Registry {
+	registry := metrics.NewRegistry()
+	registry.Register(metrics.Pool(db), metrics.Schema(db), metrics.Jobs(db), metrics.Email(db))
+	return registry
+}
+
+// serveMetrics serves /metrics on an address of its own, if the config gives it one, and returns whether it did. That
+// address is usually one that only Prometheus can get to, like a private network or localhost.
+func serveMetrics(conf config.Config, registry *metrics.Registry) bool {
+	if conf.MetricsAddress == "" {
+		return false
+	}
+
+	routes := http.NewServeMux()
+	routes.Handle("/metrics", registry.Handler(conf.MetricsToken))
+	go func() {
+		logger.Info.Printf("Serving metrics on %s", conf.MetricsAddress)
+		err := http.ListenAndServe(conf.MetricsAddress, routes)
+		logger.Error.Printf("Unable to serve metrics on %s: %s", conf.MetricsAddress, err)
+	}()
+	return true
+}
+
+// withRoutes serves a few paths, like /metrics when there isn't an address of its own to serve it on, alongside the rest
+// of the app. They're in front of the rest of our routes so that they don't need to know how to get past logging in.
+func withRoutes(routes map[string]http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := routes[r.URL.Path]; ok {
+			route.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runWorker runs nothing but background job workers, the feed poller and the link checker, along with /metrics if the
+// config has an address for it, until it's told to stop.
+func runWorker(conf config.Config, db *sql.DB) {
+	workers := conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	conf.Workers = workers
+
+	stopBackground := startBackground(conf, db)
+	serveMetrics(conf, newMetrics(db))
+	waitForSignal(nil)
+
+	stopBackground()
+	db.Close()
+	logger.Info.Printf("Stopped")
+}
+
+// startBackground starts the job workers, the feed poller and the link checker, and returns a function that stops them
+// all again. Each of them finishes whatever it's in the middle of first, so they're stopped all at once rather than
+// one after the other, since all of that waiting has to fit in before we're killed.
+func startBackground(conf config.Config, db *sql.DB) func() {
+	pool := createJobPool(conf, db)
+	pool.Start()
+	poller := feeds.NewPoller(db, conf.URLBase)
+	poller.Start()
+	stops := []func(){pool.Stop, poller.Stop}
+	if conf.LinkCheckDays > 0 || conf.Snapshots {
+		checker := linkcheck.NewChecker(db, conf.URLBase, conf.LinkCheckDays, conf.Snapshots)
+		checker.Start()
+		stops = append(stops, checker.Stop)
+	}
+
+	return func() {
+		logger.Info.Printf("Waiting on background work to finish...")
+		wg := sync.WaitGroup{}
+		for _, stop := range stops {
+			wg.Add(1)
+			go func(stop func()) {
+				defer wg.Done()
+				stop()
+			}(stop)
+		}
+		wg.Wait()
+	}
+}
+
+// runProcessDSN feeds bounce emails (RFC 3464 delivery status notifications) through our bounce processing.
+// It takes a list of files containing raw emails, or reads a single email from stdin if there aren't any, so
+// it's easy to hook up to something like a procmail rule or a mailbox dump: "LinkLetter process-dsn < bounce.eml"
+func runProcessDSN(conf config.Config, db *sql.DB, files []string) {
+	processor := bounces.NewProcessor(db, conf.SoftBounceThreshold)
+
+	process := func(name string, r io.Reader) {
+		found, err := bounces.ParseDSN(r)
+		if err != nil {
+			logger.Error.Printf("Unable to parse %s: %s", name, err)
+			return
+		}
+		for _, bounce := range found {
+			if err := processor.Process(bounce); err != nil {
+				logger.Error.Printf("Unable to process bounce for %s from %s: %s", bounce.Email, name, err)
+			}
+		}
+		logger.Info.Printf("Processed %d bounces from %s", len(found), name)
+	}
+
+	if len(files) == 0 {
+		process("stdin", os.Stdin)
+		return
+	}
+
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			logger.Error.Printf("Unable to open %s: %s", name, err)
+			continue
+		}
+		process(name, file)
+		file.Close()
+	}
+}
+
+// runImportBookmarks shares everything in one or more bookmark exports as somebody, for when a group shows up with
+// years of links they shared somewhere else: "LinkLetter import-bookmarks -dry-run someone@example.com pinboard.json"
+// Unlike the global flags, this command's flags come *after* the command, since it parses them with a FlagSet of its
+// own. The format of each file is guessed unless it's given with -format, see the bookmarks package for the formats.
+func runImportBookmarks(conf config.Config, db *sql.DB, args []string) {
+	flags := flag.NewFlagSet("import-bookmarks", flag.ExitOnError)
+	format := flags.String("format", "", "The format of the files, one of "+strings.Join(bookmarks.Formats, ", ")+", guessed if it isn't given")
+	dryRun := flags.Bool("dry-run", false, "Report what would be imported without actually importing anything")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		logger.Error.Printf("Usage: LinkLetter import-bookmarks [-format format] [-dry-run] email file...")
+		os.Exit(1)
+	}
+
+	email := strings.TrimSpace(flags.Arg(0))
+	user, err := users.GetOrCreate(db, email, users.RoleFor(email, conf.Editors, conf.Admins))
+	if err != nil {
+		logger.Error.Printf("Unable to look up %s: %s", email, err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, name := range flags.Args()[1:] {
+		if err := importBookmarkFile(db, user.ID, name, *format, *dryRun); err != nil {
+			logger.Error.Printf("Unable to import %s: %s", name, err)
+			failed = true
+		}
+	}
+
+	if *dryRun {
+		logger.Info.Printf("That was a dry run, nothing was actually imported")
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// importBookmarkFile imports a single file for runImportBookmarks, logging what happened to everything in it.
+func importBookmarkFile(db *sql.DB, userID int64, name, format string, dryRun bool) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	found, err := bookmarks.Parse(format, data)
+	if err != nil {
+		return err
+	}
+
+	report, err := bookmarks.Import(db, userID, found, dryRun)
+	for _, duplicate := range report.Duplicates {
+		logger.Info.Printf("Skipping %s, it's a duplicate", duplicate.Bookmark.URL)
+	}
+	for _, invalid := range report.Invalid {
+		logger.Info.Printf("Skipping %s, it isn't a link we can share", invalid.URL)
+	}
+	logger.Info.Printf("%s: %s", name, report)
+	return err
+}
+
+// runExport writes everything in the instance to an archive, for moving it somewhere else: "LinkLetter export
+// backup.jsonl.gz" It needs a file to write to rather than stdout, since that's where our logging goes. Names ending
+// in ".gz" get gzipped. See the archive package for what is and isn't in there; our configuration isn't, since it
+// all lives in the environment rather than the database.
+func runExport(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		logger.Error.Printf("Usage: LinkLetter export file")
+		os.Exit(1)
+	}
+
+	if err := exportArchive(db, args[0]); err != nil {
+		logger.Error.Printf("Unable to export to %s: %s", args[0], err)
+		os.Remove(args[0])
+		os.Exit(1)
+	}
+}
+
+// exportArchive does the actual work for runExport
+func exportArchive(db *sql.DB, name string) error {
+	schema, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	var zipped *gzip.Writer
+	if strings.HasSuffix(name, ".gz") {
+		zipped = gzip.NewWriter(file)
+		out = zipped
+	}
+
+	summary, err := archive.Export(db, schema, out)
+	if err != nil {
+		return err
+	}
+	if zipped != nil {
+		if err := zipped.Close(); err != nil {
+			return err
+		}
+	}
+	logger.Info.Printf("Exported %s", describeArchive(summary))
+	return file.Close()
+}
+
+// runImport restores an archive made by runExport into a fresh instance: "LinkLetter import backup.jsonl.gz" The
+// whole archive is checked before anything is imported, and with -check that's all that happens. The instance has
+// to be empty, and at the same migration as the one the archive came from.
+func runImport(db *sql.DB, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	check := flags.Bool("check", false, "Check the archive without importing anything")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		logger.Error.Printf("Usage: LinkLetter import [-check] file")
+		os.Exit(1)
+	}
+	name := flags.Arg(0)
+
+	schema, err := database.SchemaVersion(db)
+	if err != nil {
+		logger.Error.Printf("Unable to determine the database's migration: %s", err)
+		os.Exit(1)
+	}
+
+	// The whole archive gets read through once to make sure it's all there before we import any of it, so that a
+	// broken archive gets caught before it can tie up the database.
+	if err := readArchive(name, schema, archive.Validate); err != nil {
+		logger.Error.Printf("Unable to import %s: %s", name, err)
+		os.Exit(1)
+	}
+	if *check {
+		logger.Info.Printf("That was only a check, nothing was actually imported")
+		return
+	}
+
+	restore := func(r io.Reader, schema string) (archive.Summary, error) {
+		return archive.Import(db, r, schema)
+	}
+	if err := readArchive(name, schema, restore); err != nil {
+		logger.Error.Printf("Unable to import %s: %s", name, err)
+		os.Exit(1)
+	}
+	logger.Info.Printf("Imported %s", name)
+}
+
+// readArchive opens an archive and hands it to either archive.Validate or archive.Import
+func readArchive(name, schema string, read func(io.Reader, string) (archive.Summary, error)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	summary, err := read(file, schema)
+	if err != nil {
+		return err
+	}
+	logger.Info.Printf("%s: %s", name, describeArchive(summary))
+	return nil
+}
+
+// describeArchive sums up what's in an archive for the logs
+func describeArchive(summary archive.Summary) string {
+	counts := []string{}
+	for _, recordType := range archive.RecordTypes() {
+		counts = append(counts, fmt.Sprintf("%d %s", summary.Counts[recordType], recordType))
+	}
+	return fmt.Sprintf("an archive made %s at migration %s with %s", summary.Header.CreatedAt.Format(time.RFC1123),
+		summary.Header.Schema, strings.Join(counts, ", "))
+}
+
+// startInboundSMTP starts receiving links emailed to our inbound addresses, if the config has a port for it, and returns
+// the server so that it can be closed again. It's just as happy to run in the web process as on its own, so like the
+// workers it comes along with the web server when it's been configured.
+func startInboundSMTP(conf config.Config, db *sql.DB) *inbound.SMTPServer {
+	if conf.InboundSMTPPort == 0 {
+		return nil
+	}
+	if conf.InboundAddress == "" {
+		logger.Warning.Printf("An inbound SMTP port was configured without an inbound address, so it won't be started")
+		return nil
+	}
+
+	// We greet other mail servers as whatever domain our inbound address is at, since that's
+	// where they're going to have been told to deliver to.
+	hostname := conf.InboundAddress[strings.LastIndex(conf.InboundAddress, "@")+1:]
+	server := inbound.NewSMTPServer(hostname, inbound.NewProcessor(db, conf.InboundAddress, conf.URLBase))
+
+	logger.Info.Printf("Receiving email on port %d", conf.InboundSMTPPort)
+	go func() {
+		if err := server.ListenAndServe(fmt.Sprintf(":%d", conf.InboundSMTPPort)); err != nil {
+			logger.Error.Printf("Inbound SMTP server stopped: %s", err)
+		}
+	}()
+	return server
+}
+
+// createJobPool creates the pool of background job workers and registers every job handler the application
+// knows about.
+func createJobPool(conf config.Config, db *sql.DB) *jobs.Pool {
+	pool := jobs.NewPool(jobs.NewQueue(db), conf.Workers)
+	pool.Register(mail.SendJob, mail.SendHandler(smtpSender(conf)))
+	pool.Register(slack.PostJob, slack.PostHandler(conf.SlackWebhookURL))
+	pool.Register(webhooks.DeliverJob, webhooks.DeliverHandler(db))
+	return pool
+}
+
+// smtpSender is how we send mail, as far as the config is concerned
+func smtpSender(conf config.Config) mail.SMTPSender {
+	return mail.SMTPSender{
+		Host:     conf.SMTPHost,
+		Port:     conf.SMTPPort,
+		Username: conf.SMTPUsername,
+		Password: conf.SMTPPassword,
+		From:     conf.MailFrom,
+	}
 }
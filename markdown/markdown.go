@@ -0,0 +1,196 @@
+// Package markdown renders a small, safe, subset of Markdown into HTML.
+package markdown
+
+// Why on earth would we write our own Markdown renderer? There are perfectly good ones out
+// there. The problem is that a Markdown renderer, by design, lets raw HTML straight through,
+// which means every one of them needs to be paired with an HTML sanitizer to be safe to use
+// on text that anybody can type in. That's two sizeable dependencies, and a sanitizer is the
+// kind of thing where a subtle bug becomes a security hole.
+//
+// So we're going the other way around. Before we do anything else we escape *everything*,
+// so the text can't contain a single tag. Then we add back only the handful of tags we know
+// about, built by us, with any URLs checked first. The result can't contain anything we
+// didn't put there ourselves, so it's safe to hand to html/template as-is. What we lose is
+// most of Markdown, but for comments you really only need:
+//
+//     *emphasis*, **strong**, `code`, [links](https://example.com), bare https://links,
+//     > quotes
+//     - bulleted lists
+//     1. numbered lists
+//     ``` fenced code blocks ```
+//
+// and paragraphs, where single line breaks are kept rather than being joined together,
+// because that's what people typing into a comment box expect.
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	orderedItem   = regexp.MustCompile(`^\d+\.\s+`)
+	unorderedItem = regexp.MustCompile(`^[-*+]\s+`)
+	codeSpan      = regexp.MustCompile("`([^`]+)`")
+	linkSyntax    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	bareURL       = regexp.MustCompile(`https?://[^\s<]+[^\s<.,:;"')\]!?]`)
+	strong        = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasis      = regexp.MustCompile(`(^|[^\w*])[*_]([^*_]+)[*_]`)
+	placeholder   = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// Render converts Markdown text into safe HTML.
+func Render(text string) template.HTML {
+	text = strings.Replace(text, "\x00", "", -1)
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return template.HTML(renderBlocks(strings.Split(text, "\n")))
+}
+
+// renderBlocks groups lines into blocks (separated by blank lines, or fenced code) and
+// renders each of them.
+func renderBlocks(lines []string) string {
+	out := []string{}
+	block := []string{}
+
+	flush := func() {
+		if len(block) > 0 {
+			out = append(out, renderBlock(block))
+			block = []string{}
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(line), "```"):
+			flush()
+			code := []string{}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			block = append(block, line)
+		}
+	}
+	flush()
+
+	return strings.Join(out, "\n")
+}
+
+// allMatch checks if every line in a block matches a test
+func allMatch(lines []string, test func(string) bool) bool {
+	for _, line := range lines {
+		if !test(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderBlock renders a single block of lines as a quote, a list, or a paragraph.
+func renderBlock(lines []string) string {
+	isQuote := func(line string) bool { return strings.HasPrefix(strings.TrimSpace(line), ">") }
+
+	switch {
+	case allMatch(lines, isQuote):
+		inner := []string{}
+		for _, line := range lines {
+			inner = append(inner, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(line), ">"), " "))
+		}
+		return "<blockquote>" + renderBlocks(inner) + "</blockquote>"
+
+	case allMatch(lines, unorderedItem.MatchString):
+		return renderList("ul", lines, unorderedItem)
+
+	case allMatch(lines, orderedItem.MatchString):
+		return renderList("ol", lines, orderedItem)
+	}
+
+	rendered := []string{}
+	for _, line := range lines {
+		rendered = append(rendered, renderInline(strings.TrimSpace(line)))
+	}
+	return "<p>" + strings.Join(rendered, "<br>\n") + "</p>"
+}
+
+func renderList(tag string, lines []string, marker *regexp.Regexp) string {
+	items := []string{}
+	for _, line := range lines {
+		items = append(items, "<li>"+renderInline(marker.ReplaceAllString(line, ""))+"</li>")
+	}
+	return fmt.Sprintf("<%s>%s</%s>", tag, strings.Join(items, ""), tag)
+}
+
+// safeURL only lets through URLs that can't be used to run scripts.
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return u.String(), true
+}
+
+func anchor(href, text string) string {
+	return fmt.Sprintf(`<a href="%s" rel="nofollow noopener">%s</a>`, html.EscapeString(href), text)
+}
+
+// emphasize adds strong and emphasized text to text that's already been escaped
+func emphasize(escaped string) string {
+	escaped = strong.ReplaceAllString(escaped, "<strong>$1</strong>")
+	return emphasis.ReplaceAllString(escaped, "$1<em>$2</em>")
+}
+
+// renderInline escapes a single line of text and then applies the inline formatting. Code
+// spans and links are pulled out into placeholders as soon as they're rendered so that none
+// of the other formatting can reach inside of them.
+func renderInline(text string) string {
+	stash := []string{}
+	hold := func(rendered string) string {
+		stash = append(stash, rendered)
+		return fmt.Sprintf("\x00%d\x00", len(stash)-1)
+	}
+
+	text = codeSpan.ReplaceAllStringFunc(text, func(match string) string {
+		return hold("<code>" + html.EscapeString(codeSpan.FindStringSubmatch(match)[1]) + "</code>")
+	})
+
+	text = linkSyntax.ReplaceAllStringFunc(text, func(match string) string {
+		parts := linkSyntax.FindStringSubmatch(match)
+		href, ok := safeURL(parts[2])
+		if !ok {
+			return match
+		}
+		return hold(anchor(href, emphasize(html.EscapeString(parts[1]))))
+	})
+
+	text = bareURL.ReplaceAllStringFunc(text, func(match string) string {
+		href, ok := safeURL(match)
+		if !ok {
+			return match
+		}
+		return hold(anchor(href, html.EscapeString(match)))
+	})
+
+	text = emphasize(html.EscapeString(text))
+
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		var index int
+		fmt.Sscanf(placeholder.FindStringSubmatch(match)[1], "%d", &index)
+		return stash[index]
+	})
+}
@@ -0,0 +1,47 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderInline(t *testing.T) {
+	assert.Equal(t, "<p>some <em>emphasis</em> and <strong>strong</strong> words</p>", string(Render("some *emphasis* and **strong** words")))
+	assert.Equal(t, "<p>use <code>*ptr &lt; 2</code></p>", string(Render("use `*ptr < 2`")))
+	assert.Equal(t, "<p>snake_case_names stay put</p>", string(Render("snake_case_names stay put")))
+}
+
+func TestRenderLinks(t *testing.T) {
+	assert.Equal(t,
+		`<p>read <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener">this <em>post</em></a></p>`,
+		string(Render("read [this *post*](https://example.com/a?b=1&c=2)")))
+
+	assert.Equal(t,
+		`<p>see <a href="https://example.com/x" rel="nofollow noopener">https://example.com/x</a>.</p>`,
+		string(Render("see https://example.com/x.")))
+}
+
+func TestRenderBlocks(t *testing.T) {
+	assert.Equal(t, "<p>one<br>\ntwo</p>\n<p>three</p>", string(Render("one\ntwo\n\nthree")))
+	assert.Equal(t, "<ul><li>a</li><li>b</li></ul>", string(Render("- a\n- b")))
+	assert.Equal(t, "<ol><li>a</li><li>b</li></ol>", string(Render("1. a\n2. b")))
+	assert.Equal(t, "<blockquote><p>quoted<br>\ntext</p></blockquote>", string(Render("> quoted\n> text")))
+	assert.Equal(t, "<pre><code>if a &lt; b {\n\n}</code></pre>", string(Render("```\nif a < b {\n\n}\n```")))
+}
+
+// TestRenderUnsafe is really the whole point of this package
+func TestRenderUnsafe(t *testing.T) {
+	unsafe := map[string]string{
+		"<script>alert(1)</script>":                    "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		"[click](javascript:alert(1))":                 "<p>[click](javascript:alert(1))</p>",
+		`[click](http://x.com/"onmouseover="alert(1))`: `<p><a href="http://x.com/%22onmouseover=%22alert%281" rel="nofollow noopener">click</a>)</p>`,
+		"<img src=x onerror=alert(1)>":                 "<p>&lt;img src=x onerror=alert(1)&gt;</p>",
+		"**<b>bold</b>**":                              "<p><strong>&lt;b&gt;bold&lt;/b&gt;</strong></p>",
+		"`</code><script>`":                            "<p><code>&lt;/code&gt;&lt;script&gt;</code></p>",
+		"\x000\x00":                                    "<p>0</p>",
+	}
+	for in, out := range unsafe {
+		assert.Equal(t, out, string(Render(in)), in)
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/bounces"
+	"github.com/cj-dimaggio/LinkLetter/database"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/mail"
+)
+
+// emailStatuses are what the state of a job that sends an email means for the email
+var emailStatuses = map[string]string{
+	jobs.StatusQueued: "pending",
+	jobs.StatusDone:   "sent",
+	jobs.StatusDead:   "failed",
+}
+
+// Pool reports on the database connection pool, which is the first place to look when
+// requests start queueing up
+func Pool(db *sql.DB) Collector {
+	return CollectorFunc(func(w *Writer) error {
+		stats := db.Stats()
+		gauges := []struct {
+			name  string
+			help  string
+			value float64
+		}{
+			{"linkletter_db_connections_max", "The most connections the pool will open (0 is no limit)", float64(stats.MaxOpenConnections)},
+			{"linkletter_db_connections_open", "Connections the pool has open", float64(stats.OpenConnections)},
+			{"linkletter_db_connections_in_use", "Connections being used", float64(stats.InUse)},
+			{"linkletter_db_connections_idle", "Connections sitting idle", float64(stats.Idle)},
+		}
+		for _, gauge := range gauges {
+			w.Family(gauge.name, gauge.help, "gauge")
+			w.Sample(gauge.name, nil, gauge.value)
+		}
+
+		counters := []struct {
+			name  string
+			help  string
+			value float64
+		}{
+			{"linkletter_db_waits_total", "Times a connection had to be waited for", float64(stats.WaitCount)},
+			{"linkletter_db_wait_seconds_total", "Time spent waiting for connections", stats.WaitDuration.Seconds()},
+			{"linkletter_db_closed_max_idle_total", "Connections closed because there were too many idle", float64(stats.MaxIdleClosed)},
+			{"linkletter_db_closed_max_lifetime_total", "Connections closed because they'd been open too long", float64(stats.MaxLifetimeClosed)},
+		}
+		for _, counter := range counters {
+			w.Family(counter.name, counter.help, "counter")
+			w.Sample(counter.name, nil, counter.value)
+		}
+		return nil
+	})
+}
+
+// Schema reports the last migration that's been run, by its number, with its name as a label
+func Schema(db *sql.DB) Collector {
+	return CollectorFunc(func(w *Writer) error {
+		migration, err := database.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		version, _ := strconv.Atoi(strings.SplitN(migration, "_", 2)[0])
+
+		w.Family("linkletter_schema_version", "The number of the last migration run against the database", "gauge")
+		w.Sample("linkletter_schema_version", []string{"migration", migration}, float64(version))
+		return nil
+	})
+}
+
+// Jobs reports on the job queue: how many jobs of each type are waiting, done or dead, and
+// how many of the waiting ones are waiting to be retried after failing
+func Jobs(db *sql.DB) Collector {
+	return CollectorFunc(func(w *Writer) error {
+		counts, err := jobs.Counts(db)
+		if err != nil {
+			return err
+		}
+
+		w.Family("linkletter_jobs", "Jobs in the queue, by type and state", "gauge")
+		for _, count := range counts {
+			w.Sample("linkletter_jobs", []string{"type", count.Type, "status", count.Status}, float64(count.Jobs))
+		}
+		w.Family("linkletter_jobs_retrying", "Queued jobs that have failed at least once", "gauge")
+		for _, count := range counts {
+			if count.Status == jobs.StatusQueued {
+				w.Sample("linkletter_jobs_retrying", []string{"type", count.Type}, float64(count.Failed))
+			}
+		}
+		return nil
+	})
+}
+
+// Email reports on the emails we've sent (or tried to), which are the jobs that send them,
+// and on the bounces we've been told about
+func Email(db *sql.DB) Collector {
+	return CollectorFunc(func(w *Writer) error {
+		counts, err := jobs.Counts(db)
+		if err != nil {
+			return err
+		}
+		bounced, err := bounces.CountByKind(db)
+		if err != nil {
+			return err
+		}
+
+		emails := map[string]int{"pending": 0, "sent": 0, "failed": 0}
+		for _, count := range counts {
+			if status, ok := emailStatuses[count.Status]; ok && count.Type == mail.SendJob {
+				emails[status] += count.Jobs
+			}
+		}
+		w.Family("linkletter_emails", "Emails we've sent, are waiting to send, or gave up on", "gauge")
+		for _, status := range []string{"sent", "pending", "failed"} {
+			w.Sample("linkletter_emails", []string{"status", status}, float64(emails[status]))
+		}
+
+		w.Family("linkletter_email_bounces_total", "Bounces and complaints we've been told about, by kind", "counter")
+		for _, kind := range []string{bounces.KindHard, bounces.KindSoft, bounces.KindComplaint} {
+			w.Sample("linkletter_email_bounces_total", []string{"kind", kind}, float64(bounced[kind]))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	mock.ExpectQuery("SELECT version FROM _migrations_").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("13_opens.sql"))
+
+	w := &Writer{}
+	assert.Nil(t, Schema(db).Collect(w))
+	assert.Contains(t, w.buffer.String(), `linkletter_schema_version{migration="13_opens.sql"} 13`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestJobsAndEmail(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	jobRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"type", "status", "count", "failed"}).
+			AddRow("mail.send", "done", 40, 3).
+			AddRow("mail.send", "dead", 2, 2).
+			AddRow("mail.send", "queued", 5, 1).
+			AddRow("webhook.deliver", "queued", 7, 0)
+	}
+	mock.ExpectQuery("SELECT type, status").WillReturnRows(jobRows())
+	mock.ExpectQuery("SELECT type, status").WillReturnRows(jobRows())
+	mock.ExpectQuery("SELECT kind, count").WillReturnRows(sqlmock.NewRows([]string{"kind", "count"}).AddRow("hard", 4))
+
+	w := &Writer{}
+	assert.Nil(t, Jobs(db).Collect(w))
+	assert.Nil(t, Email(db).Collect(w))
+	out := w.buffer.String()
+	assert.Contains(t, out, `linkletter_jobs{type="webhook.deliver",status="queued"} 7`)
+	assert.Contains(t, out, `linkletter_jobs_retrying{type="mail.send"} 1`)
+	assert.NotContains(t, out, `linkletter_jobs_retrying{type="mail.send"} 3`)
+	assert.Contains(t, out, `linkletter_emails{status="sent"} 40`)
+	assert.Contains(t, out, `linkletter_emails{status="pending"} 5`)
+	assert.Contains(t, out, `linkletter_emails{status="failed"} 2`)
+	assert.Contains(t, out, `linkletter_email_bounces_total{kind="hard"} 4`)
+	assert.Contains(t, out, `linkletter_email_bounces_total{kind="complaint"} 0`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
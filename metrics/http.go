@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knownMethods are the methods that get a label of their own. Anything else is "other", so
+// that nobody can make up methods to fill Prometheus up with junk.
+var knownMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true}
+
+// HTTP is what we keep track of about the requests we serve. Requests are told apart by the
+// template of the route they matched ("/links/{id}") rather than their path, since every link
+// having a metric of its own would be more than Prometheus is willing to put up with.
+type HTTP struct {
+	requests  *CounterVec
+	durations *HistogramVec
+}
+
+// NewHTTP creates the HTTP metrics and registers them
+func NewHTTP(registry *Registry) *HTTP {
+	m := &HTTP{
+		requests: NewCounterVec("linkletter_http_requests_total", "HTTP requests served",
+			"method", "route", "status"),
+		durations: NewHistogramVec("linkletter_http_request_duration_seconds", "How long HTTP requests took to serve",
+			DefaultBuckets, "method", "route"),
+	}
+	registry.Register(m.requests, m.durations)
+	return m
+}
+
+// Observe counts a request that's been served
+func (m *HTTP) Observe(method, route string, status int, elapsed time.Duration) {
+	if !knownMethods[method] {
+		method = "other"
+	}
+	m.requests.Inc(method, route, strconv.Itoa(status))
+	m.durations.Observe(elapsed.Seconds(), method, route)
+}
+
+// Handler serves the registry's metrics to Prometheus. If token isn't empty then it has to
+// be sent along as a bearer token, which Prometheus can do with "authorization" (or
+// "bearer_token" in older versions) in its scrape config.
+func (registry *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.WriteTo(w)
+	})
+}
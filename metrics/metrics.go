@@ -0,0 +1,271 @@
+// Package metrics keeps track of how LinkLetter is doing, and serves it up for Prometheus.
+package metrics
+
+// There's an official Prometheus client library for Go, and it's very good, but it's also a
+// lot: protobufs, a dozen packages of dependencies, and a registry that does far more than we
+// need. What we need is a handful of counters and histograms, plus some numbers we look up
+// when we're scraped, written out in Prometheus's text format, which is simple enough to
+// write by hand (https://prometheus.io/docs/instrumenting/exposition_formats/).
+//
+// Anything that lives in the database (the job queue, emails, bounces) is looked up when
+// we're scraped rather than counted as it happens. Jobs are run by the worker processes as
+// often as by the web process, so the web process couldn't count them itself, and looking
+// them up means every process reports the same thing.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// Collector is anything that has metrics to report
+type Collector interface {
+	Collect(w *Writer) error
+}
+
+// CollectorFunc lets a plain function be a Collector
+type CollectorFunc func(w *Writer) error
+
+// Collect calls the function
+func (collector CollectorFunc) Collect(w *Writer) error {
+	return collector(w)
+}
+
+// Registry is every Collector that's reporting metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds Collectors to the registry. Their metrics are written in the order they're
+// registered.
+func (registry *Registry) Register(collectors ...Collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors = append(registry.collectors, collectors...)
+}
+
+// WriteTo writes out every metric, in Prometheus's text format. A Collector that fails is
+// logged and left out, rather than failing the whole scrape, and the number of them that
+// failed is reported as linkletter_scrape_errors.
+func (registry *Registry) WriteTo(out io.Writer) (int64, error) {
+	registry.mu.Lock()
+	collectors := append([]Collector{}, registry.collectors...)
+	registry.mu.Unlock()
+
+	w := &Writer{}
+	failed := 0
+	for _, collector := range collectors {
+		collected := &Writer{}
+		if err := collector.Collect(collected); err != nil {
+			logger.Error.Printf("Unable to collect metrics: %s", err)
+			failed++
+			continue
+		}
+		w.buffer.Write(collected.buffer.Bytes())
+	}
+
+	w.Family("linkletter_scrape_errors", "Collectors that failed while these metrics were gathered", "gauge")
+	w.Sample("linkletter_scrape_errors", nil, float64(failed))
+	return w.buffer.WriteTo(out)
+}
+
+// Writer writes metrics in Prometheus's text format. A Collector should write the family
+// of each metric (its help and type) and then all of its samples.
+type Writer struct {
+	buffer bytes.Buffer
+}
+
+// Family starts a metric, which is a "counter", "gauge" or "histogram"
+func (w *Writer) Family(name, help, kind string) {
+	fmt.Fprintf(&w.buffer, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(&w.buffer, "# TYPE %s %s\n", name, kind)
+}
+
+// Sample writes a single value. labels are alternating names and values.
+func (w *Writer) Sample(name string, labels []string, value float64) {
+	w.buffer.WriteString(name)
+	if len(labels) > 0 {
+		w.buffer.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buffer.WriteString(",")
+			}
+			fmt.Fprintf(&w.buffer, `%s="%s"`, labels[i], escapeLabel(labels[i+1]))
+		}
+		w.buffer.WriteString("}")
+	}
+	w.buffer.WriteString(" " + formatValue(value) + "\n")
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// labelKey joins label values into a map key. \xff can't show up in a valid UTF-8 string, so
+// there's no way for two different sets of values to end up with the same key.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// pairs zips label names up with their values, ready for Sample
+func pairs(names, values []string) []string {
+	labels := make([]string, 0, len(names)*2)
+	for i, name := range names {
+		labels = append(labels, name, values[i])
+	}
+	return labels
+}
+
+// CounterVec is a counter for each combination of its labels' values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	keys   map[string][]string
+}
+
+// NewCounterVec creates a CounterVec. Remember to Register it.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: map[string]float64{}, keys: map[string][]string{}}
+}
+
+// Inc adds one to the counter for the given label values, which must be in the same order
+// as the labels the CounterVec was created with
+func (counter *CounterVec) Inc(values ...string) {
+	counter.Add(1, values...)
+}
+
+// Add adds to the counter for the given label values
+func (counter *CounterVec) Add(delta float64, values ...string) {
+	key := labelKey(values)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if _, ok := counter.keys[key]; !ok {
+		counter.keys[key] = append([]string{}, values...)
+	}
+	counter.values[key] += delta
+}
+
+// Collect writes out every counter
+func (counter *CounterVec) Collect(w *Writer) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	w.Family(counter.name, counter.help, "counter")
+	for _, key := range sortedKeys(counter.keys) {
+		w.Sample(counter.name, pairs(counter.labels, counter.keys[key]), counter.values[key])
+	}
+	return nil
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets that a histogram of how
+// long something took is divided up into. They're the same as the official client library's.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a single histogram of a HistogramVec
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a histogram for each combination of its labels' values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu         sync.Mutex
+	histograms map[string]*histogram
+}
+
+// NewHistogramVec creates a HistogramVec with the given bucket upper bounds, in increasing
+// order. Remember to Register it.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, histograms: map[string]*histogram{}}
+}
+
+// Observe adds a value to the histogram for the given label values
+func (vec *HistogramVec) Observe(value float64, values ...string) {
+	key := labelKey(values)
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	h, ok := vec.histograms[key]
+	if !ok {
+		h = &histogram{labels: append([]string{}, values...), counts: make([]uint64, len(vec.buckets))}
+		vec.histograms[key] = h
+	}
+	for i, bound := range vec.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Collect writes out every histogram. Prometheus's buckets are cumulative, each one counts
+// everything less than or equal to its bound, which is how Observe keeps them too.
+func (vec *HistogramVec) Collect(w *Writer) error {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	w.Family(vec.name, vec.help, "histogram")
+	keys := map[string][]string{}
+	for key, h := range vec.histograms {
+		keys[key] = h.labels
+	}
+	for _, key := range sortedKeys(keys) {
+		h := vec.histograms[key]
+		labels := pairs(vec.labels, h.labels)
+		for i, bound := range vec.buckets {
+			w.Sample(vec.name+"_bucket", append(labels, "le", formatValue(bound)), float64(h.counts[i]))
+		}
+		w.Sample(vec.name+"_bucket", append(labels, "le", "+Inf"), float64(h.count))
+		w.Sample(vec.name+"_sum", labels, h.sum)
+		w.Sample(vec.name+"_count", labels, float64(h.count))
+	}
+	return nil
+}
+
+// sortedKeys keeps the samples of a metric in the same order from one scrape to the next,
+// which isn't something Prometheus cares about but does make them a lot easier to read
+func sortedKeys(keys map[string][]string) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
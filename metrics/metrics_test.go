@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	logger.CreateDummyLogger()
+
+	registry := NewRegistry()
+	counter := NewCounterVec("test_total", "Things that \\ happened", "kind")
+	registry.Register(counter, CollectorFunc(func(w *Writer) error {
+		return errors.New("Nope")
+	}))
+	counter.Inc("b")
+	counter.Add(2, `say "hi"`)
+	counter.Inc("b")
+
+	out := &bytes.Buffer{}
+	registry.WriteTo(out)
+	assert.Equal(t, `# HELP test_total Things that \\ happened
+# TYPE test_total counter
+test_total{kind="b"} 2
+test_total{kind="say \"hi\""} 2
+# HELP linkletter_scrape_errors Collectors that failed while these metrics were gathered
+# TYPE linkletter_scrape_errors gauge
+linkletter_scrape_errors 1
+`, out.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	histogram := NewHistogramVec("test_seconds", "How long", []float64{0.1, 1}, "route")
+	histogram.Observe(0.05, "/")
+	histogram.Observe(0.5, "/")
+	histogram.Observe(5, "/")
+
+	w := &Writer{}
+	histogram.Collect(w)
+	assert.Equal(t, `# HELP test_seconds How long
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/",le="0.1"} 1
+test_seconds_bucket{route="/",le="1"} 2
+test_seconds_bucket{route="/",le="+Inf"} 3
+test_seconds_sum{route="/"} 5.55
+test_seconds_count{route="/"} 3
+`, w.buffer.String())
+}
+
+func TestHTTP(t *testing.T) {
+	registry := NewRegistry()
+	m := NewHTTP(registry)
+	m.Observe("GET", "/links/{id}", 200, 30*time.Millisecond)
+	m.Observe("BREW", "/links/{id}", 405, time.Millisecond)
+
+	out := &bytes.Buffer{}
+	registry.WriteTo(out)
+	assert.Contains(t, out.String(), `linkletter_http_requests_total{method="GET",route="/links/{id}",status="200"} 1`)
+	assert.Contains(t, out.String(), `linkletter_http_requests_total{method="other",route="/links/{id}",status="405"} 1`)
+	assert.Contains(t, out.String(), `linkletter_http_request_duration_seconds_bucket{method="GET",route="/links/{id}",le="0.05"} 1`)
+	assert.Contains(t, out.String(), `linkletter_http_request_duration_seconds_bucket{method="GET",route="/links/{id}",le="0.025"} 0`)
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	handler := registry.Handler("shh")
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer shh")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, resp.Body.String(), "linkletter_scrape_errors 0")
+
+	// No token at all means whoever can reach it can scrape it
+	resp = httptest.NewRecorder()
+	registry.Handler("").ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
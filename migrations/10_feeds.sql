@@ -0,0 +1,36 @@
+-- RSS and Atom feeds that editors follow, see the feeds package. Everything that turns up in
+-- a feed gets a row in feed_items, which is both the queue of suggestions waiting on an editor
+-- and how we remember what we've already seen.
+CREATE TABLE feeds (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL DEFAULT '',
+    site_url TEXT NOT NULL DEFAULT '',
+    interval_minutes INTEGER NOT NULL DEFAULT 60,
+    active BOOLEAN NOT NULL DEFAULT true,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    next_poll_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_polled_at TIMESTAMP WITH TIME ZONE,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX feeds_due_idx ON feeds (next_poll_at) WHERE active;
+
+CREATE TABLE feed_items (
+    id BIGSERIAL PRIMARY KEY,
+    feed_id BIGINT NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    url TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    summary TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMP WITH TIME ZONE,
+    status TEXT NOT NULL DEFAULT 'suggested',
+    link_id BIGINT REFERENCES links (id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (feed_id, guid)
+);
+
+CREATE INDEX feed_items_status_idx ON feed_items (status, created_at);
@@ -0,0 +1,28 @@
+-- How the links in sent issues are holding up, see the linkcheck package. A link gets a row
+-- here once it's gone out in an issue, which the checker then keeps up to date.
+CREATE TABLE link_health (
+    link_id BIGINT PRIMARY KEY REFERENCES links (id) ON DELETE CASCADE,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    final_url TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    failures INTEGER NOT NULL DEFAULT 0,
+    checked_at TIMESTAMP WITH TIME ZONE,
+    last_alive_at TIMESTAMP WITH TIME ZONE,
+    next_check_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX link_health_due_idx ON link_health (next_check_at);
+
+-- Everything that's already gone out gets checked too
+INSERT INTO link_health (link_id)
+    SELECT DISTINCT il.link_id FROM issue_links il JOIN issues i ON i.id = il.issue_id WHERE i.status = 'sent';
+
+-- The readable text of a link, saved when it was shared, for when the original is gone
+CREATE TABLE link_snapshots (
+    link_id BIGINT PRIMARY KEY REFERENCES links (id) ON DELETE CASCADE,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    title TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    captured_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
@@ -0,0 +1,16 @@
+-- Clicks on the links in sent issues, see the clicks package. Subscribers are only ever
+-- recorded as a hash, and not at all if they've asked not to be tracked.
+CREATE TABLE clicks (
+    id BIGSERIAL PRIMARY KEY,
+    issue_id BIGINT NOT NULL REFERENCES issues (id) ON DELETE CASCADE,
+    link_id BIGINT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    subscriber_hash TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX clicks_issue_idx ON clicks (issue_id, link_id);
+
+ALTER TABLE subscribers ADD COLUMN tracking BOOLEAN NOT NULL DEFAULT true;
+
+-- How many subscribers an issue went out to, for working out what fraction of them clicked
+ALTER TABLE issues ADD COLUMN recipients INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Opens of sent issues, see the opens package. Rather than a row for every time the tracking
+-- image is loaded there's a running count for each subscriber (by hash, or '' for whoever we
+-- can't identify), kept apart from what looked like a mail provider fetching it ahead of time.
+CREATE TABLE opens (
+    issue_id BIGINT NOT NULL REFERENCES issues (id) ON DELETE CASCADE,
+    subscriber_hash TEXT NOT NULL DEFAULT '',
+    prefetched BOOLEAN NOT NULL DEFAULT false,
+    opens INTEGER NOT NULL DEFAULT 1,
+    first_opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (issue_id, subscriber_hash, prefetched)
+);
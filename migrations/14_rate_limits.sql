@@ -0,0 +1,9 @@
+-- Token buckets for rate limiting, when they're kept in the database so that every web
+-- process shares them (see the ratelimit package). A bucket is how many tokens it had when it
+-- was last taken from; the rest is worked out from how long ago that was.
+CREATE TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+CREATE INDEX rate_limits_updated_at ON rate_limits (updated_at);
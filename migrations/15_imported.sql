@@ -0,0 +1,4 @@
+-- Links that were brought in from somewhere else (a bookmarks export, say) rather than shared
+-- here. They're there to be found and voted on, but they're old news, so they're never put in
+-- an issue.
+ALTER TABLE links ADD COLUMN imported BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,20 @@
+CREATE TABLE subscribers (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'active',
+    suppressed_reason TEXT NOT NULL DEFAULT '',
+    soft_bounces INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE bounces (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    diagnostic TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX bounces_email_idx ON bounces (email);
@@ -0,0 +1,15 @@
+CREATE TABLE comments (
+    id BIGSERIAL PRIMARY KEY,
+    link_id BIGINT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    parent_id BIGINT REFERENCES comments (id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL REFERENCES users (id),
+    body TEXT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX comments_link_id_idx ON comments (link_id);
+
+ALTER TABLE links ADD COLUMN top_comment_id BIGINT REFERENCES comments (id) ON DELETE SET NULL;
@@ -0,0 +1,20 @@
+CREATE TABLE categories (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    slug TEXT NOT NULL UNIQUE,
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE tags (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    category_id BIGINT REFERENCES categories (id) ON DELETE SET NULL
+);
+
+CREATE TABLE link_tags (
+    link_id BIGINT NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (link_id, tag_id)
+);
+
+CREATE INDEX link_tags_tag_id_idx ON link_tags (tag_id);
@@ -0,0 +1,101 @@
+-- StatementBegin
+-- Full-text search. Rather than remembering to update search vectors every time we touch
+-- a link, a comment, or an issue in Go, triggers keep them up to date for us. Since the
+-- functions below are full of semicolons, statements in this file are split on the
+-- StatementBegin comments instead.
+ALTER TABLE links ADD COLUMN search_vector tsvector NOT NULL DEFAULT ''::tsvector
+
+-- StatementBegin
+ALTER TABLE issues ADD COLUMN search_vector tsvector NOT NULL DEFAULT ''::tsvector
+
+-- StatementBegin
+CREATE INDEX links_search_vector_idx ON links USING GIN (search_vector)
+
+-- StatementBegin
+CREATE INDEX issues_search_vector_idx ON issues USING GIN (search_vector)
+
+-- StatementBegin
+-- A link is searchable by its title, description, the discussion about it, and its URL, in
+-- that order of importance. Deleted and hidden comments are left out.
+CREATE FUNCTION link_search_vector(link_id BIGINT, title TEXT, description TEXT, url TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', description), 'B') ||
+        setweight(to_tsvector('english', COALESCE((SELECT string_agg(c.body, ' ') FROM comments c WHERE c.link_id = $1 AND NOT c.deleted AND NOT c.hidden), '')), 'C') ||
+        setweight(to_tsvector('simple', url), 'D')
+$$ LANGUAGE SQL STABLE
+
+-- StatementBegin
+-- An issue is searchable by its title and the titles of the links in it.
+CREATE FUNCTION issue_search_vector(issue_id BIGINT, title TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', COALESCE((SELECT string_agg(l.title, ' ') FROM issue_links il JOIN links l ON l.id = il.link_id WHERE il.issue_id = $1), '')), 'B')
+$$ LANGUAGE SQL STABLE
+
+-- StatementBegin
+CREATE FUNCTION links_search_trigger() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := link_search_vector(NEW.id, NEW.title, NEW.description, NEW.url);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql
+
+-- StatementBegin
+CREATE TRIGGER links_search_update BEFORE INSERT OR UPDATE OF title, description, url ON links
+    FOR EACH ROW EXECUTE PROCEDURE links_search_trigger()
+
+-- StatementBegin
+CREATE FUNCTION comments_search_trigger() RETURNS trigger AS $$
+DECLARE
+    changed BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD.link_id;
+    ELSE
+        changed := NEW.link_id;
+    END IF;
+    UPDATE links SET search_vector = link_search_vector(id, title, description, url) WHERE id = changed;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql
+
+-- StatementBegin
+CREATE TRIGGER comments_search_update AFTER INSERT OR UPDATE OR DELETE ON comments
+    FOR EACH ROW EXECUTE PROCEDURE comments_search_trigger()
+
+-- StatementBegin
+CREATE FUNCTION issues_search_trigger() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := issue_search_vector(NEW.id, NEW.title);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql
+
+-- StatementBegin
+CREATE TRIGGER issues_search_update BEFORE INSERT OR UPDATE OF title ON issues
+    FOR EACH ROW EXECUTE PROCEDURE issues_search_trigger()
+
+-- StatementBegin
+CREATE FUNCTION issue_links_search_trigger() RETURNS trigger AS $$
+DECLARE
+    changed BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD.issue_id;
+    ELSE
+        changed := NEW.issue_id;
+    END IF;
+    UPDATE issues SET search_vector = issue_search_vector(id, title) WHERE id = changed;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql
+
+-- StatementBegin
+CREATE TRIGGER issue_links_search_update AFTER INSERT OR DELETE ON issue_links
+    FOR EACH ROW EXECUTE PROCEDURE issue_links_search_trigger()
+
+-- StatementBegin
+-- Everything that was already here before search existed needs its vectors filled in
+UPDATE links SET search_vector = link_search_vector(id, title, description, url)
+
+-- StatementBegin
+UPDATE issues SET search_vector = issue_search_vector(id, title)
@@ -0,0 +1,3 @@
+-- Every user gets their own secret inbound email address, see users.InboundToken. The token
+-- is only filled in the first time somebody asks for it.
+ALTER TABLE users ADD COLUMN inbound_token TEXT UNIQUE;
@@ -0,0 +1,3 @@
+-- When a link was first announced as popular, so that it's only ever announced once no
+-- matter how many votes go back and forth around the threshold.
+ALTER TABLE links ADD COLUMN popular_at TIMESTAMP WITH TIME ZONE;
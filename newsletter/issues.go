@@ -0,0 +1,257 @@
+// Package newsletter puts shared links together into issues of the newsletter.
+package newsletter
+
+// An "issue" is exactly what it sounds like, a single edition of the newsletter. Compiling
+// an issue gathers up every link that hasn't been sent out yet and puts them in order, best
+// first, using the ranking in links/rank.go, split up into sections (see sections.go). That
+// order is only a suggestion though. Until
+// the issue is sent, editors can shuffle the links around however they see fit, at which
+// point we stop second guessing them and keep their order. If they change their mind, they
+// can always reset back to the ranked order.
+//
+// Editors can also pick a "top comment" for any link (see comments.SetTopComment), which
+// gets pulled into the link's entry in the issue as a quote.
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/comments"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+)
+
+// The states an issue can be in
+const (
+	StatusDraft = "draft"
+	StatusSent  = "sent"
+)
+
+const (
+	selectIssues        = "SELECT id, title, status, manual_order, created_at, sent_at FROM issues"
+	getIssueQuery       = selectIssues + " WHERE id = $1"
+	listIssuesQuery     = selectIssues + " ORDER BY created_at DESC"
+	createIssueQuery    = "INSERT INTO issues (title) VALUES ($1) RETURNING id, title, status, manual_order, created_at, sent_at"
+	addIssueLinkQuery   = "INSERT INTO issue_links (issue_id, link_id, position) VALUES ($1, $2, $3)"
+	setPositionQuery    = "UPDATE issue_links SET position = $3 WHERE issue_id = $1 AND link_id = $2"
+	setManualOrderQuery = "UPDATE issues SET manual_order = $2 WHERE id = $1"
+	markSentQuery       = "UPDATE issues SET status = 'sent', sent_at = $2, " +
+		"recipients = (SELECT count(*) FROM subscribers WHERE status = 'active') WHERE id = $1 AND status = 'draft'"
+)
+
+// ErrNoLinks is returned when trying to compile an issue when there's nothing new to put in it
+var ErrNoLinks = errors.New("There are no new links to put in an issue")
+
+// ErrAlreadySent is returned when trying to change an issue that has already gone out
+var ErrAlreadySent = errors.New("The issue has already been sent")
+
+// ErrLinkNotInIssue is returned when trying to move a link that isn't in the issue
+var ErrLinkNotInIssue = errors.New("The link is not in the issue")
+
+// Issue is a single edition of the newsletter
+type Issue struct {
+	ID          int64
+	Title       string
+	Status      string
+	ManualOrder bool
+	CreatedAt   time.Time
+	SentAt      *time.Time
+	Links       []links.Link
+
+	// Sections are the issue's links, grouped up by category. Links has the same links in
+	// the same order, just without the grouping.
+	Sections []Section
+
+	// Quotes are the top comments of the issue's links, keyed by the link's id. They're only
+	// filled in by Get.
+	Quotes map[int64]*comments.Comment
+}
+
+// IsDraft determines whether the issue can still be changed
+func (issue Issue) IsDraft() bool {
+	return issue.Status == StatusDraft
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIssue(row scanner) (Issue, error) {
+	issue := Issue{}
+	err := row.Scan(&issue.ID, &issue.Title, &issue.Status, &issue.ManualOrder, &issue.CreatedAt, &issue.SentAt)
+	return issue, err
+}
+
+// Compile creates a new draft issue out of every link that hasn't been sent yet, ranked
+// as of "now".
+func Compile(db *sql.DB, title string, now time.Time) (Issue, error) {
+	candidates, err := links.ListUnissued(db, 0)
+	if err != nil {
+		return Issue{}, err
+	}
+	if len(candidates) == 0 {
+		return Issue{}, ErrNoLinks
+	}
+	links.Rank(candidates, now)
+
+	categories, err := tags.ListCategories(db)
+	if err != nil {
+		return Issue{}, err
+	}
+	sections := Sectioned(candidates, categories)
+	candidates = flatten(sections)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Issue{}, err
+	}
+
+	issue, err := scanIssue(tx.QueryRow(createIssueQuery, title))
+	if err != nil {
+		tx.Rollback()
+		return Issue{}, err
+	}
+
+	for position, link := range candidates {
+		if _, err := tx.Exec(addIssueLinkQuery, issue.ID, link.ID, position); err != nil {
+			tx.Rollback()
+			return Issue{}, err
+		}
+	}
+
+	issue.Links = candidates
+	issue.Sections = sections
+	return issue, tx.Commit()
+}
+
+// Get retrieves an issue along with its links and their quotes. The links in a draft that
+// hasn't been manually ordered get re-ranked as of "now", since votes keep coming in right
+// up until the issue is sent.
+func Get(db *sql.DB, id, userID int64, now time.Time) (Issue, error) {
+	issue, err := getWithLinks(db, id, userID, now)
+	if err != nil {
+		return issue, err
+	}
+
+	issue.Quotes, err = comments.TopForIssue(db, id)
+	return issue, err
+}
+
+// getWithLinks is Get without bothering to look up the quotes
+func getWithLinks(db *sql.DB, id, userID int64, now time.Time) (Issue, error) {
+	issue, err := scanIssue(db.QueryRow(getIssueQuery, id))
+	if err != nil {
+		return issue, err
+	}
+
+	issue.Links, err = links.ListForIssue(db, id, userID)
+	if err != nil {
+		return issue, err
+	}
+
+	if issue.IsDraft() && !issue.ManualOrder {
+		links.Rank(issue.Links, now)
+	}
+
+	categories, err := tags.ListCategories(db)
+	if err != nil {
+		return issue, err
+	}
+	issue.Sections = Sectioned(issue.Links, categories)
+	issue.Links = flatten(issue.Sections)
+	return issue, nil
+}
+
+// List retrieves every issue, newest first, without their links.
+func List(db *sql.DB) ([]Issue, error) {
+	rows, err := db.Query(listIssuesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []Issue{}
+	for rows.Next() {
+		issue, err := scanIssue(rows)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, rows.Err()
+}
+
+// Move moves a link up (a negative offset) or down (a positive one) in a draft issue and
+// locks the issue into its manual ordering. Links can only be moved around within their
+// own section, so moving a link past either end of its section just leaves it where it is.
+func Move(db *sql.DB, id, linkID int64, offset int, now time.Time) error {
+	issue, err := getWithLinks(db, id, 0, now)
+	if err != nil {
+		return err
+	}
+	if !issue.IsDraft() {
+		return ErrAlreadySent
+	}
+
+	index := -1
+	for i, link := range issue.Links {
+		if link.ID == linkID {
+			index = i
+		}
+	}
+	if index == -1 {
+		return ErrLinkNotInIssue
+	}
+
+	first, last := sectionBounds(issue.Sections, linkID)
+	target := index + offset
+	if target < first {
+		target = first
+	}
+	if target > last {
+		target = last
+	}
+
+	moved := issue.Links[index]
+	ordered := append([]links.Link{}, issue.Links[:index]...)
+	ordered = append(ordered, issue.Links[index+1:]...)
+	ordered = append(ordered[:target], append([]links.Link{moved}, ordered[target:]...)...)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for position, link := range ordered {
+		if _, err := tx.Exec(setPositionQuery, id, link.ID, position); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(setManualOrderQuery, id, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetOrder throws away an editor's manual ordering and goes back to ranking the links.
+func ResetOrder(db *sql.DB, id int64) error {
+	_, err := db.Exec(setManualOrderQuery, id, false)
+	return err
+}
+
+// MarkSent records that a draft issue has gone out, which freezes it the way it is. We don't
+// do the sending ourselves, editors paste the issue into whatever they send the newsletter
+// with, and then come back here to let everybody know it went out. We do take note of how
+// many subscribers it went out to, as best we know, for the click analytics.
+func MarkSent(db *sql.DB, id int64, now time.Time) error {
+	result, err := db.Exec(markSentQuery, id, now)
+	if err != nil {
+		return err
+	}
+	if changed, err := result.RowsAffected(); err == nil && changed == 0 {
+		return ErrAlreadySent
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package newsletter
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	linkColumns     = []string{"id", "url", "title", "description", "submitter_id", "email", "created_at", "score", "user_vote", "comments", "top_comment_id", "tags", "category"}
+	issueColumns    = []string{"id", "title", "status", "manual_order", "created_at", "sent_at"}
+	categoryColumns = []string{"id", "name", "slug", "position"}
+	commentColumns  = []string{"id", "link_id", "parent_id", "author_id", "email", "body", "deleted", "hidden", "created_at", "updated_at"}
+)
+
+const (
+	unissuedLinksQuery = "WHERE NOT EXISTS \\(SELECT 1 FROM issue_links"
+	issueLinksQuery    = "JOIN issue_links il ON il.link_id = l.id WHERE il.issue_id"
+	issueQuotesQuery   = "JOIN links l ON l.top_comment_id = c.id"
+	categoriesQuery    = "FROM categories ORDER BY position"
+)
+
+// threeLinks returns rows where link 1 is old, link 2 is popular, and link 3 is new, so
+// that the ranked order is 2, 3, 1
+func threeLinks(now time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows(linkColumns).
+		AddRow(1, "http://example.com/1", "", "", 1, "a@example.com", now.Add(-72*time.Hour), 0, 0, 0, 0, "{}", "").
+		AddRow(2, "http://example.com/2", "", "", 1, "a@example.com", now.Add(-2*time.Hour), 5, 0, 0, 0, "{}", "").
+		AddRow(3, "http://example.com/3", "", "", 1, "a@example.com", now.Add(-1*time.Hour), 0, 0, 0, 0, "{}", "")
+}
+
+func TestCompile(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(unissuedLinksQuery).WithArgs(0).WillReturnRows(threeLinks(now))
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(createIssueQuery)).
+		WithArgs("Issue #1").
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusDraft, false, now, nil))
+	mock.ExpectExec(regexp.QuoteMeta(addIssueLinkQuery)).WithArgs(9, 2, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(addIssueLinkQuery)).WithArgs(9, 3, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(addIssueLinkQuery)).WithArgs(9, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	issue, err := Compile(db, "Issue #1", now)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), issue.ID)
+	assert.True(t, issue.IsDraft())
+	assert.Nil(t, issue.SentAt)
+	assert.Len(t, issue.Links, 3)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCompileNothingNew(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(unissuedLinksQuery).WithArgs(0).WillReturnRows(sqlmock.NewRows(linkColumns))
+	_, err := Compile(db, "Issue #1", time.Now())
+	assert.Equal(t, ErrNoLinks, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCompileIgnoresImported(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	// Imported links are left out by the database, so an instance that's only got a bookmarks
+	// import to its name has nothing to put in an issue
+	mock.ExpectQuery(unissuedLinksQuery + ".* AND NOT l.imported").WithArgs(0).WillReturnRows(sqlmock.NewRows(linkColumns))
+	_, err := Compile(db, "Issue #1", time.Now())
+	assert.Equal(t, ErrNoLinks, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGet(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	// An automatically ordered draft is re-ranked
+	mock.ExpectQuery(regexp.QuoteMeta(getIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusDraft, false, now, nil))
+	mock.ExpectQuery(issueLinksQuery).WithArgs(4, 9).WillReturnRows(threeLinks(now))
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns))
+	mock.ExpectQuery(issueQuotesQuery).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(commentColumns).AddRow(7, 3, 0, 1, "a@example.com", "So good", false, false, now, now))
+
+	issue, err := Get(db, 9, 4, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 3, 1}, linkIDs(issue))
+	assert.Len(t, issue.Quotes, 1)
+	assert.Equal(t, "So good", issue.Quotes[3].Body)
+
+	// A manually ordered one is left alone
+	mock.ExpectQuery(regexp.QuoteMeta(getIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusDraft, true, now, nil))
+	mock.ExpectQuery(issueLinksQuery).WithArgs(4, 9).WillReturnRows(threeLinks(now))
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns))
+	mock.ExpectQuery(issueQuotesQuery).WithArgs(9).WillReturnRows(sqlmock.NewRows(commentColumns))
+
+	issue, err = Get(db, 9, 4, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, linkIDs(issue))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestList(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listIssuesQuery)).
+		WillReturnRows(sqlmock.NewRows(issueColumns).
+			AddRow(2, "Issue #2", StatusDraft, false, now, nil).
+			AddRow(1, "Issue #1", StatusSent, false, now, now))
+
+	issues, err := List(db)
+	assert.Nil(t, err)
+	assert.Len(t, issues, 2)
+	assert.False(t, issues[1].IsDraft())
+	assert.NotNil(t, issues[1].SentAt)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMove(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	// Ranked order is 2, 3, 1. Moving 1 up one spot should give 2, 1, 3
+	mock.ExpectQuery(regexp.QuoteMeta(getIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusDraft, false, now, nil))
+	mock.ExpectQuery(issueLinksQuery).WithArgs(0, 9).WillReturnRows(threeLinks(now))
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 2, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 3, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setManualOrderQuery)).WithArgs(9, true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, Move(db, 9, 1, -1, now))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMoveSent(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusSent, false, now, now))
+	mock.ExpectQuery(issueLinksQuery).WithArgs(0, 9).WillReturnRows(threeLinks(now))
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns))
+
+	assert.Equal(t, ErrAlreadySent, Move(db, 9, 1, -1, now))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestResetOrder(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(setManualOrderQuery)).WithArgs(9, false).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, ResetOrder(db, 9))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkSent(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(markSentQuery)).WithArgs(9, now).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, MarkSent(db, 9, now))
+
+	mock.ExpectExec(regexp.QuoteMeta(markSentQuery)).WithArgs(9, now).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, ErrAlreadySent, MarkSent(db, 9, now))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func linkIDs(issue Issue) []int64 {
+	ids := []int64{}
+	for _, link := range issue.Links {
+		ids = append(ids, link.ID)
+	}
+	return ids
+}
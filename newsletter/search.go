@@ -0,0 +1,70 @@
+package newsletter
+
+import (
+	"database/sql"
+	"html/template"
+
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/lib/pq"
+)
+
+// searchIssuesQuery matches issues that have been sent against a search. Drafts are left
+// out, anything in them will already turn up in the link results. $1 is what's being
+// searched for, $2 and $3 the date range (NULL for no limit), $4 and $5 the ts_headline
+// options for the snippet and title, and $6 the most results to return. The snippet is
+// made out of the titles of the links in the issue.
+const searchIssuesQuery = "SELECT i.id, i.title, i.status, i.manual_order, i.created_at, i.sent_at, ts_rank(i.search_vector, query), " +
+	"ts_headline('english', i.title, query, $5), " +
+	"ts_headline('english', COALESCE((SELECT string_agg(l.title, ' | ' ORDER BY il.position) FROM issue_links il JOIN links l ON l.id = il.link_id WHERE il.issue_id = i.id), ''), query, $4) " +
+	"FROM issues i CROSS JOIN websearch_to_tsquery('english', $1) query " +
+	"WHERE i.status = 'sent' AND i.search_vector @@ query " +
+	"AND ($2::timestamptz IS NULL OR i.sent_at >= $2) " +
+	"AND ($3::timestamptz IS NULL OR i.sent_at < $3) " +
+	"ORDER BY ts_rank(i.search_vector, query) DESC, i.sent_at DESC LIMIT $6"
+
+// SearchResult is a sent issue that matched a search
+type SearchResult struct {
+	Issue
+
+	// Rank is how well the issue matched, higher is better
+	Rank float64
+
+	// TitleHTML is the issue's title with any matches highlighted
+	TitleHTML template.HTML
+
+	// Snippet is the titles of the links in the issue that matched, highlighted
+	Snippet template.HTML
+}
+
+// Search finds the sent issues that best match a query, best match first. Tags and
+// submitters belong to links rather than issues, so a query filtered by either of those
+// doesn't match any issues at all.
+func Search(db *sql.DB, query search.Query) ([]SearchResult, error) {
+	found := []SearchResult{}
+	if query.FiltersLinks() {
+		return found, nil
+	}
+
+	rows, err := db.Query(searchIssuesQuery, query.Text,
+		pq.NullTime{Time: query.From, Valid: !query.From.IsZero()},
+		pq.NullTime{Time: query.To, Valid: !query.To.IsZero()},
+		search.SnippetOptions, search.TitleOptions, search.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := SearchResult{}
+		var title, snippet string
+		err := rows.Scan(&result.ID, &result.Title, &result.Status, &result.ManualOrder, &result.CreatedAt, &result.SentAt,
+			&result.Rank, &title, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		result.TitleHTML = search.Highlight(title)
+		result.Snippet = search.Highlight(snippet)
+		found = append(found, result)
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,39 @@
+package newsletter
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	columns := append(append([]string{}, issueColumns...), "rank", "title_headline", "snippet")
+	mock.ExpectQuery(regexp.QuoteMeta(searchIssuesQuery)).
+		WithArgs("postgres", pq.NullTime{}, pq.NullTime{}, search.SnippetOptions, search.TitleOptions, search.MaxResults).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(9, "Issue #1", StatusSent, false, now, now, 0.25, "Issue #1", "All about \x01Postgres\x02 | Something else"))
+
+	found, err := Search(db, search.Query{Text: "postgres"})
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, int64(9), found[0].ID)
+	assert.Equal(t, "All about <mark>Postgres</mark> | Something else", string(found[0].Snippet))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchFilteredByLinks(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	found, err := Search(db, search.Query{Text: "postgres", Submitter: "a@example.com"})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,72 @@
+package newsletter
+
+// Issues are split up into sections, one for each category (see the tags package), in the
+// order the admins have put the categories in. Anything that doesn't fit in a category goes
+// in a catch-all section at the end. Within each section the links keep whatever order the
+// issue has them in, ranked or by hand.
+
+import (
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+)
+
+// OtherSection is the name of the section for links that aren't in any category
+const OtherSection = "Other"
+
+// Section is a group of links in an issue that share a category
+type Section struct {
+	Name  string
+	Links []links.Link
+}
+
+// Sectioned groups links into sections by category. Sections that would be empty are left
+// out entirely.
+func Sectioned(issueLinks []links.Link, categories []tags.Category) []Section {
+	index := map[string]int{}
+	sections := []Section{}
+	for i, category := range categories {
+		index[category.Name] = i
+		sections = append(sections, Section{Name: category.Name})
+	}
+	other := Section{Name: OtherSection}
+
+	for _, link := range issueLinks {
+		if i, ok := index[link.Category]; ok && link.Category != "" {
+			sections[i].Links = append(sections[i].Links, link)
+		} else {
+			other.Links = append(other.Links, link)
+		}
+	}
+
+	found := []Section{}
+	for _, section := range append(sections, other) {
+		if len(section.Links) > 0 {
+			found = append(found, section)
+		}
+	}
+	return found
+}
+
+// flatten puts sectioned links back into a single list, in the order they'll appear in
+func flatten(sections []Section) []links.Link {
+	flat := []links.Link{}
+	for _, section := range sections {
+		flat = append(flat, section.Links...)
+	}
+	return flat
+}
+
+// sectionBounds finds the first and last index of the section a link is in, in the
+// flattened list of an issue's links.
+func sectionBounds(sections []Section, linkID int64) (int, int) {
+	start := 0
+	for _, section := range sections {
+		for _, link := range section.Links {
+			if link.ID == linkID {
+				return start, start + len(section.Links) - 1
+			}
+		}
+		start += len(section.Links)
+	}
+	return -1, -1
+}
@@ -0,0 +1,66 @@
+package newsletter
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSectioned(t *testing.T) {
+	categories := []tags.Category{{ID: 1, Name: "Engineering"}, {ID: 2, Name: "Design"}, {ID: 3, Name: "Empty"}}
+	issueLinks := []links.Link{
+		{ID: 1, Category: "Design"},
+		{ID: 2},
+		{ID: 3, Category: "Engineering"},
+		{ID: 4, Category: "Design"},
+		{ID: 5, Category: "Deleted Since"},
+	}
+
+	sections := Sectioned(issueLinks, categories)
+	names := []string{}
+	for _, section := range sections {
+		names = append(names, section.Name)
+	}
+	assert.Equal(t, []string{"Engineering", "Design", OtherSection}, names)
+
+	ids := []int64{}
+	for _, link := range flatten(sections) {
+		ids = append(ids, link.ID)
+	}
+	assert.Equal(t, []int64{3, 1, 4, 2, 5}, ids)
+
+	first, last := sectionBounds(sections, 4)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, last)
+}
+
+func TestMoveWithinSection(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	// Link 2 is the only one in Engineering, so it's first and can't be moved down any
+	// further than where it already is.
+	sectioned := sqlmock.NewRows(linkColumns).
+		AddRow(1, "http://example.com/1", "", "", 1, "a@example.com", now, 0, 0, 0, 0, "{}", "").
+		AddRow(2, "http://example.com/2", "", "", 1, "a@example.com", now, 0, 0, 0, 0, "{go}", "Engineering").
+		AddRow(3, "http://example.com/3", "", "", 1, "a@example.com", now, 0, 0, 0, 0, "{}", "")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getIssueQuery)).WithArgs(9).
+		WillReturnRows(sqlmock.NewRows(issueColumns).AddRow(9, "Issue #1", StatusDraft, true, now, nil))
+	mock.ExpectQuery(issueLinksQuery).WithArgs(0, 9).WillReturnRows(sectioned)
+	mock.ExpectQuery(categoriesQuery).WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, "Engineering", "engineering", 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 2, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setPositionQuery)).WithArgs(9, 3, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setManualOrderQuery)).WithArgs(9, true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, Move(db, 9, 2, 1, now))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,96 @@
+// Package opens counts how many readers open each issue, using the oldest trick in the email
+// marketing book: an invisible image.
+package opens
+
+// The email version of an issue can include a 1x1 image (see Pixel) which mail clients load
+// from us when the issue is opened. Its token is signed the same way our session cookie is,
+// with gorilla/securecookie and our SecretKey, and just like clicks (see the clicks package)
+// the mailing tool can tell us who's opening it by adding "?s=" and their email address.
+//
+// Open tracking has a fair amount of baggage though, which is why it's off unless the config
+// turns it on (OpenTracking). It's never been especially accurate, since plenty of people
+// don't load images, and these days a lot of mail providers load every image in an email
+// themselves, as soon as it arrives, whether or not anybody ever reads it. Apple's Mail
+// Privacy Protection is the famous one, and it's a big share of most newsletters' readers. So
+// opens that look like that (see Prefetched) are counted separately, and don't count as
+// anybody having read the issue.
+//
+// We also keep as little as we can. There's no row for each time the image was loaded, just a
+// running count for each subscriber (by hash) and issue, and nothing about where the request
+// came from. Subscribers who've asked not to be tracked aren't counted at all.
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/cj-dimaggio/LinkLetter/clicks"
+	"github.com/cj-dimaggio/LinkLetter/subscribers"
+	"github.com/gorilla/securecookie"
+)
+
+// tokenName is what the token is signed as, which keeps a token for anything else we sign
+// with securecookie (like the session cookie) from passing as one of ours
+const tokenName = "open"
+
+const recordOpenQuery = "INSERT INTO opens (issue_id, subscriber_hash, prefetched) SELECT $1, $2, $3 " +
+	"WHERE NOT EXISTS (SELECT 1 FROM subscribers WHERE email = $4 AND NOT tracking) " +
+	"ON CONFLICT (issue_id, subscriber_hash, prefetched) DO UPDATE SET opens = opens.opens + 1"
+
+// Image is a transparent 1x1 GIF, the smallest image there is
+var Image = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// prefetchAgents are the User-Agents of things that load images without anybody reading
+// anything: link scanners, security gateways, and the odd script. Gmail and Yahoo aren't in
+// here, they fetch images through their proxies too, but only once the email is opened.
+var prefetchAgents = regexp.MustCompile(`(?i)bot|spider|crawler|preview|scanner|proofpoint|mimecast|barracuda|ironport|symantec|python|curl|wget|go-http-client|java/`)
+
+// codec signs and checks tokens. Unlike a session cookie they never expire, an old issue
+// sitting in somebody's inbox should still be counted if they open it.
+func codec(secret string) *securecookie.SecureCookie {
+	return securecookie.New([]byte(secret), nil).MaxAge(0).SetSerializer(securecookie.JSONEncoder{})
+}
+
+// Token creates the token for an issue's tracking image
+func Token(secret string, issueID int64) (string, error) {
+	return codec(secret).Encode(tokenName, issueID)
+}
+
+// ParseToken checks a token and returns the issue it's for
+func ParseToken(secret, token string) (int64, error) {
+	var issueID int64
+	err := codec(secret).Decode(tokenName, token, &issueID)
+	return issueID, err
+}
+
+// Pixel is the URL of an issue's tracking image
+func Pixel(urlBase, secret string, issueID int64) (string, error) {
+	token, err := Token(secret, issueID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/o/%s.gif", urlBase, token), nil
+}
+
+// Prefetched guesses, from its User-Agent, whether the image was loaded by a mail provider or
+// a scanner rather than because somebody opened the issue. Apple's Mail Privacy Protection
+// is the big one, and it says nothing more about itself than "Mozilla/5.0".
+func Prefetched(userAgent string) bool {
+	return userAgent == "" || userAgent == "Mozilla/5.0" || prefetchAgents.MatchString(userAgent)
+}
+
+// Record counts an open of an issue. email is who opened it, as far as the image's URL tells
+// us, and may well be empty.
+func Record(db *sql.DB, secret string, issueID int64, email, userAgent string) error {
+	email = subscribers.NormalizeEmail(email)
+	hash := ""
+	if email != "" {
+		hash = clicks.HashSubscriber(secret, email)
+	}
+	_, err := db.Exec(recordOpenQuery, issueID, hash, Prefetched(userAgent), email)
+	return err
+}
@@ -0,0 +1,86 @@
+package opens
+
+import (
+	"bytes"
+	"image/gif"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/clicks"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "secret123"
+
+func TestToken(t *testing.T) {
+	token, err := Token(testSecret, 9)
+	assert.Nil(t, err)
+
+	issueID, err := ParseToken(testSecret, token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), issueID)
+
+	pixel, err := Pixel("https://linkletter.example.com", testSecret, 9)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(pixel, "https://linkletter.example.com/o/"))
+	assert.True(t, strings.HasSuffix(pixel, ".gif"))
+}
+
+func TestParseTokenInvalid(t *testing.T) {
+	token, _ := Token(testSecret, 9)
+
+	_, err := ParseToken("guessed", token)
+	assert.NotNil(t, err)
+	_, err = ParseToken(testSecret, token[:len(token)-4])
+	assert.NotNil(t, err)
+	_, err = ParseToken(testSecret, "")
+	assert.NotNil(t, err)
+
+	// A click token, or anything else we've signed for some other reason, isn't one of ours
+	_, err = ParseToken(testSecret, clicks.Token(testSecret, 9, 42))
+	assert.NotNil(t, err)
+}
+
+func TestPrefetched(t *testing.T) {
+	for _, userAgent := range []string{
+		"",
+		"Mozilla/5.0",
+		"Mozilla/5.0 (compatible; Proofpoint URL Defense)",
+		"python-requests/2.18.4",
+		"Mozilla/5.0 (compatible; bingbot/2.0)",
+	} {
+		assert.True(t, Prefetched(userAgent), userAgent)
+	}
+
+	for _, userAgent := range []string{
+		"Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_3) AppleWebKit/603.1.30 (KHTML, like Gecko)",
+		"Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.4266; Pro)",
+	} {
+		assert.False(t, Prefetched(userAgent), userAgent)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(recordOpenQuery)).
+		WithArgs(9, clicks.HashSubscriber(testSecret, "someone@example.com"), false, "someone@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(recordOpenQuery)).
+		WithArgs(9, "", true, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, Record(db, testSecret, 9, " Someone@Example.com", "Microsoft Outlook 16.0"))
+	assert.Nil(t, Record(db, testSecret, 9, "", "Mozilla/5.0"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestImage(t *testing.T) {
+	image, err := gif.Decode(bytes.NewReader(Image))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, image.Bounds().Dx())
+	assert.Equal(t, 1, image.Bounds().Dy())
+}
@@ -0,0 +1,125 @@
+package opens
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	issueOpensQuery = "SELECT i.recipients, o.subscriber_hash, o.prefetched, o.opens " +
+		"FROM issues i LEFT JOIN opens o ON o.issue_id = i.id WHERE i.id = $1"
+
+	// trendQuery is ForIssue for a number of sent issues at once, done in the database. A row
+	// for a subscriber (with a hash) is one person, everybody else is one person per open.
+	trendQuery = "SELECT i.id, i.title, i.sent_at, i.recipients, " +
+		"COUNT(*) FILTER (WHERE NOT o.prefetched AND o.subscriber_hash <> '') + " +
+		"COALESCE(SUM(o.opens) FILTER (WHERE NOT o.prefetched AND o.subscriber_hash = ''), 0), " +
+		"COALESCE(SUM(o.opens) FILTER (WHERE NOT o.prefetched), 0), " +
+		"COALESCE(SUM(o.opens) FILTER (WHERE o.prefetched), 0) " +
+		"FROM issues i LEFT JOIN opens o ON o.issue_id = i.id WHERE i.status = 'sent' " +
+		"GROUP BY i.id ORDER BY i.sent_at DESC LIMIT $1"
+)
+
+// Report is what we know about the opens of an issue
+type Report struct {
+	// Opened is how many different people opened the issue, as best we can tell. Opens from
+	// people we can't tell apart each count as somebody different.
+	Opened int
+
+	// Opens is how many times the issue was opened in all
+	Opens int
+
+	// Prefetched is how many times the image was loaded by something other than a reader,
+	// which don't count towards Opened or Opens
+	Prefetched int
+
+	Recipients int
+}
+
+// HasRate is whether we know enough to work out an open rate
+func (report Report) HasRate() bool {
+	return report.Recipients > 0
+}
+
+// Rate is the open rate, as a percentage
+func (report Report) Rate() float64 {
+	if !report.HasRate() {
+		return 0
+	}
+	return float64(report.Opened) * 100 / float64(report.Recipients)
+}
+
+// add counts one subscriber's opens (or everybody we can't identify's) into the report
+func (report *Report) add(hash string, prefetched bool, opens int) {
+	switch {
+	case prefetched:
+		report.Prefetched += opens
+	case hash == "":
+		report.Opened += opens
+		report.Opens += opens
+	default:
+		report.Opened++
+		report.Opens += opens
+	}
+}
+
+// ForIssue reports on the opens of an issue, or sql.ErrNoRows if there's no such issue
+func ForIssue(db *sql.DB, issueID int64) (Report, error) {
+	rows, err := db.Query(issueOpensQuery, issueID)
+	if err != nil {
+		return Report{}, err
+	}
+	defer rows.Close()
+
+	report := Report{}
+	found := false
+	for rows.Next() {
+		var hash sql.NullString
+		var prefetched sql.NullBool
+		var opens sql.NullInt64
+		if err := rows.Scan(&report.Recipients, &hash, &prefetched, &opens); err != nil {
+			return Report{}, err
+		}
+		found = true
+		if hash.Valid {
+			report.add(hash.String, prefetched.Bool, int(opens.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+	if !found {
+		return Report{}, sql.ErrNoRows
+	}
+	return report, nil
+}
+
+// IssueReport is a Report for one of a number of issues
+type IssueReport struct {
+	IssueID int64
+	Title   string
+	SentAt  *time.Time
+	Report
+}
+
+// Trend reports on the opens of the most recently sent issues, newest first, so that editors
+// can see which way things are going
+func Trend(db *sql.DB, limit int) ([]IssueReport, error) {
+	rows, err := db.Query(trendQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []IssueReport{}
+	for rows.Next() {
+		report := IssueReport{}
+		err := rows.Scan(&report.IssueID, &report.Title, &report.SentAt, &report.Recipients,
+			&report.Opened, &report.Opens, &report.Prefetched)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
@@ -0,0 +1,66 @@
+package opens
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForIssue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(issueOpensQuery)).WithArgs(9).WillReturnRows(
+		sqlmock.NewRows([]string{"recipients", "subscriber_hash", "prefetched", "opens"}).
+			AddRow(10, "alice", false, 3).
+			AddRow(10, "bob", false, 1).
+			// Bob's mail provider fetched it too, which doesn't count
+			AddRow(10, "bob", true, 1).
+			AddRow(10, "carol", true, 1).
+			AddRow(10, "", false, 2))
+
+	report, err := ForIssue(db, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, Report{Opened: 4, Opens: 6, Prefetched: 2, Recipients: 10}, report)
+	assert.Equal(t, 40.0, report.Rate())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestForIssueWithoutOpens(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(issueOpensQuery)).WithArgs(9).WillReturnRows(
+		sqlmock.NewRows([]string{"recipients", "subscriber_hash", "prefetched", "opens"}).AddRow(0, nil, nil, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(issueOpensQuery)).WithArgs(10).WillReturnRows(
+		sqlmock.NewRows([]string{"recipients", "subscriber_hash", "prefetched", "opens"}))
+
+	report, err := ForIssue(db, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, Report{}, report)
+	assert.False(t, report.HasRate())
+	assert.Equal(t, 0.0, report.Rate())
+
+	_, err = ForIssue(db, 10)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTrend(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	sent := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(trendQuery)).WithArgs(10).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "title", "sent_at", "recipients", "opened", "opens", "prefetched"}).
+			AddRow(9, "Issue #9", sent, 10, 4, 6, 2).
+			AddRow(8, "Issue #8", sent, 0, 1, 1, 0))
+
+	reports, err := Trend(db, 10)
+	assert.Nil(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, IssueReport{9, "Issue #9", &sent, Report{4, 6, 2, 10}}, reports[0])
+	assert.False(t, reports[1].HasRate())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,139 @@
+// Package publicnet is for fetching URLs that somebody else gave us, without letting them use
+// us to get at anything they couldn't get at themselves.
+package publicnet
+
+// Plenty of what we fetch comes from our users: links (for the link checker and snapshots),
+// feeds, and webhooks. Left to itself, the server would happily fetch any of those from our
+// own machine or network: the database's admin page, some internal service, or the cloud
+// provider's metadata service at 169.254.169.254, which hands out credentials to anybody who
+// asks. We'd then show whoever gave us the URL what we found, as a snapshot, a feed error or a
+// webhook's response. So anything fetching a URL from a user should go through Transport (or
+// Client), which refuses to connect to any address that isn't out on the internet.
+//
+// The check is on the address we're actually connecting to, after the host name's been looked
+// up, and for every connection, redirects included. Checking the URL before fetching it
+// wouldn't be enough: a host name can point wherever it likes, and can be changed to point
+// somewhere else between us checking it and connecting to it. CheckHost is there for turning
+// a URL away up front, with a better error than a failed fetch, but it's no substitute.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is what connecting to an address that isn't on the internet fails with
+var ErrNotPublic = errors.New("isn't on the internet, won't connect to it")
+
+// privateNetworks are the addresses we won't connect to, on top of the ones net.IP can spot by
+// itself (see IsPublic): private networks, carrier-grade NAT, "this" network, and IPv6's
+// unique local addresses
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsPublic is whether ip is somewhere out on the internet, rather than on our own machine or
+// network
+func IsPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddress refuses to connect to anywhere that IsPublic says isn't. It's a dialer's
+// Control hook, so it sees every address we connect to, once the host name's been looked up.
+func checkAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s isn't an IP address", host)
+	}
+	if !IsPublic(ip) {
+		return fmt.Errorf("%s %w", ip, ErrNotPublic)
+	}
+	return nil
+}
+
+// transport is http.DefaultTransport, other than that it won't connect to anything that isn't
+// public, and that it ignores any proxy in the environment (since the proxy is what we'd be
+// connecting to, and it could be anywhere)
+var transport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkAddress,
+	}).DialContext,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// Transport is the transport to fetch anything a user gave us with. Tests swap out the
+// default client's transport (see testhelpers.FakeTransport), so if it's been swapped we hand
+// over theirs instead.
+func Transport() http.RoundTripper {
+	if http.DefaultClient.Transport != nil {
+		return http.DefaultClient.Transport
+	}
+	return transport
+}
+
+// Client is a client that fetches with Transport, for anybody who doesn't need a client of
+// their own
+func Client() *http.Client {
+	return &http.Client{Transport: Transport()}
+}
+
+// CheckHost turns away a host that's on our own machine or network, for saying so when a URL
+// is first given to us. A host name we can't look up gets the benefit of the doubt, since its
+// DNS may just not be set up yet, and Transport will still check it when we get to it.
+func CheckHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublic(ip) {
+			return fmt.Errorf("%s %w", ip, ErrNotPublic)
+		}
+		return nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if !IsPublic(ip) {
+			return fmt.Errorf("%s (%s) %w", host, ip, ErrNotPublic)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package publicnet
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublic(t *testing.T) {
+	for _, address := range []string{"93.184.216.34", "8.8.8.8", "2606:2800:220:1:248:1893:25c8:1946"} {
+		assert.True(t, IsPublic(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{
+		"127.0.0.1", "127.1.2.3", "::1", "169.254.169.254", "fe80::1", "10.1.2.3", "172.16.0.1",
+		"172.31.255.255", "192.168.1.1", "100.64.0.1", "0.0.0.0", "0.1.2.3", "::", "fd00::1",
+		"224.0.0.1", "::ffff:127.0.0.1", "::ffff:169.254.169.254",
+	} {
+		assert.False(t, IsPublic(net.ParseIP(address)), address)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	assert.Nil(t, checkAddress("tcp4", "93.184.216.34:443", nil))
+	assert.True(t, errors.Is(checkAddress("tcp4", "169.254.169.254:80", nil), ErrNotPublic))
+	assert.True(t, errors.Is(checkAddress("tcp6", "[::1]:8080", nil), ErrNotPublic))
+}
+
+func TestCheckHost(t *testing.T) {
+	assert.Nil(t, CheckHost("93.184.216.34"))
+	assert.True(t, errors.Is(CheckHost("169.254.169.254"), ErrNotPublic))
+	assert.True(t, errors.Is(CheckHost("::1"), ErrNotPublic))
+	assert.True(t, errors.Is(CheckHost("localhost"), ErrNotPublic))
+	// Somewhere that doesn't exist (yet) is left for Transport to check
+	assert.Nil(t, CheckHost("nowhere.invalid"))
+}
+
+func TestClient(t *testing.T) {
+	// A real server, that we shouldn't be able to reach because it's on our own machine
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Secrets"))
+	}))
+	defer server.Close()
+
+	_, err := Client().Get(server.URL)
+	assert.True(t, errors.Is(err, ErrNotPublic))
+}
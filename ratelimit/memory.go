@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often a MemoryStore clears out the buckets that have filled back up
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+
+	// fullAt is when the bucket will have filled back up, at which point it's no different
+	// from a bucket we've never seen and we can forget about it
+	fullAt time.Time
+}
+
+// MemoryStore keeps buckets in memory, which is all a single process needs
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+
+	// now is time.Now, other than in tests
+	now func() time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take takes a token out of key's bucket, if there's one there. It never fails.
+func (store *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	store.prune(now)
+
+	b, ok := store.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.Burst, updatedAt: now}
+		store.buckets[key] = b
+	}
+
+	tokens, result := take(refill(b.tokens, now.Sub(b.updatedAt), limit), limit)
+	b.tokens = tokens
+	b.updatedAt = now
+	if limit.Rate > 0 {
+		b.fullAt = now.Add(time.Duration((limit.Burst - tokens) / limit.Rate * float64(time.Second)))
+	} else {
+		b.fullAt = now.Add(24 * time.Hour)
+	}
+	return result, nil
+}
+
+// prune forgets the buckets that have filled back up, every so often, so that every IP
+// address that's ever visited us isn't sitting around in memory forever
+func (store *MemoryStore) prune(now time.Time) {
+	if now.Sub(store.lastPrune) < pruneInterval {
+		return
+	}
+	store.lastPrune = now
+	for key, b := range store.buckets {
+		if !now.Before(b.fullAt) {
+			delete(store.buckets, key)
+		}
+	}
+}
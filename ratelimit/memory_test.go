@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clockedStore is a MemoryStore whose clock only moves when the test says so
+func clockedStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, now := clockedStore()
+	limit := PerMinute(3)
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take("ip:10.0.0.1", limit)
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, _ := store.Take("ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+
+	// Somebody else has a bucket of their own
+	result, _ = store.Take("ip:10.0.0.2", limit)
+	assert.True(t, result.Allowed)
+
+	// A token every 20 seconds
+	*now = now.Add(10 * time.Second)
+	result, _ = store.Take("ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+	*now = now.Add(10 * time.Second)
+	result, _ = store.Take("ip:10.0.0.1", limit)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+
+	// However long they stay away, they can't save up more than a burst
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		result, _ = store.Take("ip:10.0.0.1", limit)
+		assert.True(t, result.Allowed)
+	}
+	result, _ = store.Take("ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	store, now := clockedStore()
+	limit := PerMinute(60)
+
+	store.Take("ip:10.0.0.1", limit)
+	*now = now.Add(30 * time.Second)
+	store.Take("ip:10.0.0.2", limit)
+	assert.Len(t, store.buckets, 2)
+
+	// The first bucket filled back up a second after it was taken from, the second's still
+	// a token short
+	*now = now.Add(pruneInterval)
+	store.prune(*now)
+	assert.Len(t, store.buckets, 0)
+
+	store.Take("ip:10.0.0.1", limit)
+	store.Take("ip:10.0.0.1", limit)
+	*now = now.Add(time.Second)
+	store.prune(*now)
+	assert.Len(t, store.buckets, 1, "it isn't time to prune again yet")
+}
+
+func TestNoRate(t *testing.T) {
+	store, _ := clockedStore()
+	limit := Limit{Burst: 1}
+
+	result, _ := store.Take("ip:10.0.0.1", limit)
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 24*time.Hour, result.RetryAfter)
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// Refilling the bucket and taking a token out of it have to happen together, or two of us
+// could both see the last token and both hand it out. The upsert locks the row until the
+// transaction's done, so whoever comes second waits for the first to finish. Going by the
+// database's clock rather than ours keeps us all agreeing on how long it's been.
+const refillQuery = "INSERT INTO rate_limits AS bucket (key, tokens, updated_at) VALUES ($1, $2, now()) " +
+	"ON CONFLICT (key) DO UPDATE SET " +
+	"tokens = LEAST($2, bucket.tokens + GREATEST(0, EXTRACT(EPOCH FROM (now() - bucket.updated_at))) * $3), " +
+	"updated_at = now() RETURNING tokens"
+
+const takeQuery = "UPDATE rate_limits SET tokens = $2 WHERE key = $1"
+
+// Once a bucket's been left alone for an hour every limit we have (a few requests a minute)
+// has filled it back up, so it's no different from not having a row at all
+const pruneQuery = "DELETE FROM rate_limits WHERE updated_at < now() - interval '1 hour'"
+
+// PostgresStore keeps buckets in the rate_limits table, so that everybody's limits are the
+// same whichever of us they happen to get
+type PostgresStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewPostgresStore creates a PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take takes a token out of key's bucket, if there's one there
+func (store *PostgresStore) Take(key string, limit Limit) (Result, error) {
+	store.prune()
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	var tokens float64
+	if err := tx.QueryRow(refillQuery, key, limit.Burst, limit.Rate).Scan(&tokens); err != nil {
+		return Result{}, err
+	}
+	tokens, result := take(tokens, limit)
+	if result.Allowed {
+		if _, err := tx.Exec(takeQuery, key, tokens); err != nil {
+			return Result{}, err
+		}
+	}
+	return result, tx.Commit()
+}
+
+// prune deletes the buckets that have filled back up, every so often. Each of us does it on
+// our own schedule, which is more often than it needs doing, but it's cheap.
+func (store *PostgresStore) prune() {
+	store.mu.Lock()
+	due := time.Since(store.lastPrune) >= pruneInterval
+	if due {
+		store.lastPrune = time.Now()
+	}
+	store.mu.Unlock()
+
+	if due {
+		// Not getting around to it this time isn't worth turning anybody away over, we'll
+		// get it next time
+		if _, err := store.db.Exec(pruneQuery); err != nil {
+			logger.Warning.Printf("Unable to prune rate limits: %s", err)
+		}
+	}
+}
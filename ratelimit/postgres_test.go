@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresStore(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	limit := PerMinute(3)
+
+	mock.ExpectExec(regexp.QuoteMeta(pruneQuery)).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(refillQuery)).WithArgs("ip:10.0.0.1", 3.0, 0.05).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(2.5))
+	mock.ExpectExec(regexp.QuoteMeta(takeQuery)).WithArgs("ip:10.0.0.1", 1.5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Pruning only happens every so often, and an empty bucket isn't taken from
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(refillQuery)).WithArgs("ip:10.0.0.1", 3.0, 0.05).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.5))
+	mock.ExpectCommit()
+
+	store := NewPostgresStore(db)
+	result, err := store.Take("ip:10.0.0.1", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Allowed: true}, result)
+
+	result, err = store.Take("ip:10.0.0.1", limit)
+	assert.Nil(t, err)
+	assert.Equal(t, Result{RetryAfter: 10 * time.Second}, result)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresStoreError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(pruneQuery)).WillReturnError(errors.New("pruning failed"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(refillQuery)).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err := NewPostgresStore(db).Take("ip:10.0.0.1", PerMinute(3))
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,76 @@
+// Package ratelimit keeps anybody from doing any one thing to us too often, with token buckets.
+package ratelimit
+
+// A token bucket is about the simplest rate limit there is that still lets people be a little
+// bursty. Everybody (everybody being whatever a key stands for: an IP address, a user, an API
+// token) starts with a full bucket of Burst tokens, every request takes one out, and the bucket
+// fills back up at Rate tokens a second. Somebody who comes to an empty bucket is turned away,
+// and told how long it'll be before there's a token for them.
+//
+// We don't actually drip tokens into anything, of course. A bucket is just how many tokens it
+// had the last time we looked and when that was, and whenever somebody takes from it we work
+// out how many it's gained since.
+//
+// Buckets are kept in a Store. MemoryStore is all a single process needs, but once there's
+// more than one of us behind a load balancer each would have a bucket of its own for everybody,
+// and limits would be however many of us there are times what they're meant to be. So there's
+// also PostgresStore, which shares them through the database.
+
+import (
+	"math"
+	"time"
+)
+
+// Limit is how many requests somebody can make
+type Limit struct {
+	// Rate is how many tokens a bucket gains a second
+	Rate float64
+
+	// Burst is how many tokens a bucket holds, which is how many requests somebody can make
+	// all at once after they've been away for a while
+	Burst float64
+}
+
+// PerMinute is a Limit of n requests a minute, all of which can be made at once
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: float64(n)}
+}
+
+// Result is whether a request can go ahead, and if it can't, how long until it could
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Store keeps track of everybody's buckets
+type Store interface {
+	// Take takes a token out of key's bucket, if there's one there
+	Take(key string, limit Limit) (Result, error)
+}
+
+// refill works out how many tokens a bucket that had tokens elapsed ago has now
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed < 0 {
+		// Somebody's clock has gone backwards, which is no reason to take tokens away
+		elapsed = 0
+	}
+	return math.Min(limit.Burst, tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// take takes a token out of a bucket that has tokens in it now, and returns how many are
+// left along with the Result
+func take(tokens float64, limit Limit) (float64, Result) {
+	if tokens >= 1 {
+		return tokens - 1, Result{Allowed: true}
+	}
+	return tokens, Result{RetryAfter: wait(tokens, limit)}
+}
+
+// wait is how long it'll be until a bucket with tokens in it gets up to a whole one
+func wait(tokens float64, limit Limit) time.Duration {
+	if limit.Rate <= 0 {
+		// It's never going to fill back up. Come back tomorrow, and we'll see.
+		return 24 * time.Hour
+	}
+	return time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+}
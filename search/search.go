@@ -0,0 +1,114 @@
+// Package search holds what's shared between searching links (links.Search) and searching
+// past issues (newsletter.Search).
+package search
+
+// The heavy lifting of search is all done by Postgres. Every link and issue has a tsvector
+// column that's kept up to date by the triggers in migrations/6_search.sql, and searching is
+// a matter of matching those against a tsquery and sorting by ts_rank.
+//
+// The one thing worth being careful about is the highlighted snippets. Postgres' ts_headline
+// will happily wrap matches in whatever tags we ask it to, but it doesn't escape anything
+// else, so if we asked for <mark> tags and somebody described their link as
+// "<script>...</script>" we'd be serving that script right back up. Instead we have Postgres
+// mark matches with a pair of control characters that can't show up in normal text, escape
+// the whole snippet ourselves, and only then turn the control characters into tags.
+
+import (
+	"errors"
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/tags"
+)
+
+// These are what ts_headline marks the start and end of a match with. See Highlight.
+const (
+	StartMatch = "\x01"
+	StopMatch  = "\x02"
+)
+
+// The options we give ts_headline. Snippets are a couple of short fragments from around the
+// matches, while titles are kept whole.
+const (
+	SnippetOptions = "StartSel=\x01, StopSel=\x02, MaxFragments=2, MaxWords=25, MinWords=10"
+	TitleOptions   = "StartSel=\x01, StopSel=\x02, HighlightAll=true"
+)
+
+// MaxResults is the most results we return of each kind
+const MaxResults = 50
+
+const dateFormat = "2006-01-02"
+
+// ErrNoQuery is returned when there's nothing to search for
+var ErrNoQuery = errors.New("Enter something to search for")
+
+// ErrInvalidDate is returned when a date filter isn't a YYYY-MM-DD date
+var ErrInvalidDate = errors.New("Dates must look like 2006-01-02")
+
+// Query is something to search for, and what to narrow the results down to. Any filters
+// left empty aren't applied.
+type Query struct {
+	Text string
+
+	// Tag only finds links with this tag
+	Tag string
+
+	// Submitter only finds links shared by the user with this email
+	Submitter string
+
+	// From and To only find things from between these dates. From is inclusive, To is not.
+	From time.Time
+	To   time.Time
+}
+
+// FiltersLinks determines if the query narrows down links in a way that doesn't make sense
+// for anything else, which means issues shouldn't be searched at all.
+func (query Query) FiltersLinks() bool {
+	return query.Tag != "" || query.Submitter != ""
+}
+
+// ParseQuery reads a query out of URL parameters, the way they'd come from the search form
+// or an API call: "q", "tag", "submitter", "from" and "to". Dates are YYYY-MM-DD, and "to"
+// includes the whole of the day it names.
+func ParseQuery(values url.Values) (Query, error) {
+	query := Query{
+		Text:      strings.TrimSpace(values.Get("q")),
+		Tag:       tags.Normalize(values.Get("tag")),
+		Submitter: strings.TrimSpace(strings.ToLower(values.Get("submitter"))),
+	}
+	if query.Text == "" {
+		return query, ErrNoQuery
+	}
+
+	var err error
+	if from := values.Get("from"); from != "" {
+		if query.From, err = time.Parse(dateFormat, from); err != nil {
+			return query, ErrInvalidDate
+		}
+	}
+	if to := values.Get("to"); to != "" {
+		if query.To, err = time.Parse(dateFormat, to); err != nil {
+			return query, ErrInvalidDate
+		}
+		query.To = query.To.AddDate(0, 0, 1)
+	}
+	return query, nil
+}
+
+// Highlight escapes a snippet from ts_headline and turns its match markers into <mark> tags.
+func Highlight(snippet string) template.HTML {
+	escaped := html.EscapeString(snippet)
+
+	// Markers should always come in pairs, but just in case one of them got cut off we make
+	// sure we never leave a <mark> open.
+	opened := strings.Count(escaped, StartMatch) - strings.Count(escaped, StopMatch)
+	escaped = strings.Replace(escaped, StartMatch, "<mark>", -1)
+	escaped = strings.Replace(escaped, StopMatch, "</mark>", -1)
+	if opened > 0 {
+		escaped += strings.Repeat("</mark>", opened)
+	}
+	return template.HTML(escaped)
+}
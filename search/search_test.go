@@ -0,0 +1,48 @@
+package search
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("q=+postgres+indexes+&tag=Industry+News&submitter=A@Example.com&from=2017-03-01&to=2017-03-31")
+	query, err := ParseQuery(values)
+	assert.Nil(t, err)
+	assert.Equal(t, "postgres indexes", query.Text)
+	assert.Equal(t, "industry-news", query.Tag)
+	assert.Equal(t, "a@example.com", query.Submitter)
+	assert.Equal(t, time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC), query.From)
+	assert.Equal(t, time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC), query.To)
+	assert.True(t, query.FiltersLinks())
+
+	query, err = ParseQuery(url.Values{"q": {"postgres"}})
+	assert.Nil(t, err)
+	assert.True(t, query.From.IsZero())
+	assert.True(t, query.To.IsZero())
+	assert.False(t, query.FiltersLinks())
+
+	_, err = ParseQuery(url.Values{"q": {"  "}})
+	assert.Equal(t, ErrNoQuery, err)
+
+	_, err = ParseQuery(url.Values{"q": {"postgres"}, "from": {"March"}})
+	assert.Equal(t, ErrInvalidDate, err)
+
+	_, err = ParseQuery(url.Values{"q": {"postgres"}, "to": {"03/31/2017"}})
+	assert.Equal(t, ErrInvalidDate, err)
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "all about <mark>Postgres</mark> &amp; <mark>indexes</mark>",
+		string(Highlight("all about \x01Postgres\x02 & \x01indexes\x02")))
+
+	// Anything that isn't one of our markers gets escaped
+	assert.Equal(t, "&lt;script&gt;<mark>alert</mark>(1)&lt;/script&gt;",
+		string(Highlight("<script>\x01alert\x02(1)</script>")))
+
+	// And we never leave a tag open
+	assert.Equal(t, "cut <mark>off</mark>", string(Highlight("cut \x01off")))
+}
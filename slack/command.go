@@ -0,0 +1,150 @@
+// Package slack lets a team share links from Slack with a slash command, and tells them
+// about new issues and popular links through an incoming webhook.
+package slack
+
+// Slack sends us a slash command as a form encoded POST, along with a signature made out of
+// the request body and a secret only Slack and us know (the app's "signing secret"):
+//
+//     X-Slack-Request-Timestamp: 1531420618
+//     X-Slack-Signature: v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503
+//
+// The signature is an HMAC-SHA256 of "v0:<timestamp>:<body>", and checking it is the only
+// thing standing between our slash command and anybody on the internet who'd like to share
+// links as one of our users. The timestamp is part of what's signed, so we also turn away
+// anything more than a few minutes old, otherwise somebody who got their hands on an old
+// request could just keep sending it to us.
+//
+// None of this is Slack specific in any interesting way, Mattermost and friends speak the
+// same protocol, so those should work too.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSkew is how old (or, if somebody's clock is off, how far in the future) a request is
+// allowed to be
+const maxSkew = 5 * time.Minute
+
+// The kinds of responses to a slash command. Ephemeral ones are only shown to whoever used
+// the command, in channel ones are shown to everybody.
+const (
+	ResponseEphemeral = "ephemeral"
+	ResponseInChannel = "in_channel"
+)
+
+// ErrInvalidSignature is returned when a request wasn't signed with our signing secret
+var ErrInvalidSignature = errors.New("Invalid request signature")
+
+// ErrStaleRequest is returned when a request's timestamp is too far from the current time
+var ErrStaleRequest = errors.New("Request timestamp is too old")
+
+// ErrUsage is returned when a command doesn't make sense. Its message is the help text.
+var ErrUsage = errors.New("Usage: /linkletter share <url> [a note about it]")
+
+// Sign computes the signature Slack would send for a request body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks that a request came from Slack. An empty secret means the command
+// hasn't been set up, so nothing is valid.
+func VerifySignature(secret string, header http.Header, body []byte, now time.Time) error {
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > maxSkew || skew < -maxSkew {
+		return ErrStaleRequest
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(header.Get("X-Slack-Signature"))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Command is a slash command somebody used
+type Command struct {
+	Command  string
+	Text     string
+	UserID   string
+	UserName string
+	TeamID   string
+}
+
+// ParseCommand reads a slash command out of the body of Slack's request
+func ParseCommand(values url.Values) Command {
+	return Command{
+		Command:  values.Get("command"),
+		Text:     strings.TrimSpace(values.Get("text")),
+		UserID:   values.Get("user_id"),
+		UserName: values.Get("user_name"),
+		TeamID:   values.Get("team_id"),
+	}
+}
+
+// Share is what somebody asked to share with "/linkletter share <url> <note>"
+type Share struct {
+	URL  string
+	Note string
+}
+
+// ParseShare reads the arguments of a share command. Depending on how the command is set up,
+// Slack may send URLs the way they're written in its markup, such as
+// "<https://example.com|example.com>", so those are unwrapped.
+func ParseShare(text string) (Share, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || strings.ToLower(fields[0]) != "share" {
+		return Share{}, ErrUsage
+	}
+
+	rawURL := fields[1]
+	if strings.HasPrefix(rawURL, "<") && strings.HasSuffix(rawURL, ">") {
+		rawURL = strings.TrimSuffix(strings.TrimPrefix(rawURL, "<"), ">")
+		if bar := strings.Index(rawURL, "|"); bar != -1 {
+			rawURL = rawURL[:bar]
+		}
+	}
+
+	// Everything after the URL is the note, spacing and all
+	note := strings.TrimSpace(text)
+	note = strings.TrimSpace(note[strings.Index(note, fields[1])+len(fields[1]):])
+	return Share{URL: rawURL, Note: note}, nil
+}
+
+// Response is what we answer a slash command with
+type Response struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// Escape escapes the characters that mean something in Slack's markup
+func Escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// Link formats a link in Slack's markup. Anything in the URL that would end the link early
+// gets percent encoded.
+func Link(url, text string) string {
+	url = strings.NewReplacer("|", "%7C", "<", "%3C", ">", "%3E").Replace(url)
+	if text == "" {
+		return "<" + url + ">"
+	}
+	return "<" + url + "|" + Escape(text) + ">"
+}
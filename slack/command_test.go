@@ -0,0 +1,71 @@
+package slack
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signedHeader(secret string, body []byte, at time.Time) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", timestamp)
+	header.Set("X-Slack-Signature", Sign(secret, timestamp, body))
+	return header
+}
+
+func TestSign(t *testing.T) {
+	// The example from Slack's documentation
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c")
+	assert.Equal(t, "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503",
+		Sign("8f742231b10e8888abcd99yyyzzz85a5", "1531420618", body))
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	body := []byte("text=share+https%3A%2F%2Fexample.com")
+
+	assert.Nil(t, VerifySignature("secret", signedHeader("secret", body, now), body, now))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("secret", signedHeader("wrong", body, now), body, now))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("secret", signedHeader("secret", body, now), []byte("text=tampered"), now))
+	assert.Equal(t, ErrStaleRequest, VerifySignature("secret", signedHeader("secret", body, now.Add(-10*time.Minute)), body, now))
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("secret", http.Header{}, body, now))
+
+	// Without a secret nothing gets through, not even a request "signed" with an empty one
+	assert.Equal(t, ErrInvalidSignature, VerifySignature("", signedHeader("", body, now), body, now))
+}
+
+func TestParseCommand(t *testing.T) {
+	values, _ := url.ParseQuery("command=%2Flinkletter&text=+share+x+&user_id=U1&user_name=someone&team_id=T1")
+	assert.Equal(t, Command{Command: "/linkletter", Text: "share x", UserID: "U1", UserName: "someone", TeamID: "T1"}, ParseCommand(values))
+}
+
+func TestParseShare(t *testing.T) {
+	share, err := ParseShare("share https://example.com/a  A really  good read")
+	assert.Nil(t, err)
+	assert.Equal(t, Share{URL: "https://example.com/a", Note: "A really  good read"}, share)
+
+	share, err = ParseShare("Share <https://example.com/a|example.com/a>")
+	assert.Nil(t, err)
+	assert.Equal(t, Share{URL: "https://example.com/a"}, share)
+
+	share, err = ParseShare("share <https://example.com/a> nice")
+	assert.Nil(t, err)
+	assert.Equal(t, Share{URL: "https://example.com/a", Note: "nice"}, share)
+
+	_, err = ParseShare("help")
+	assert.Equal(t, ErrUsage, err)
+	_, err = ParseShare("share")
+	assert.Equal(t, ErrUsage, err)
+	_, err = ParseShare("")
+	assert.Equal(t, ErrUsage, err)
+}
+
+func TestLink(t *testing.T) {
+	assert.Equal(t, "<https://example.com/a|Tom &amp; Jerry &lt;3>", Link("https://example.com/a", "Tom & Jerry <3"))
+	assert.Equal(t, "<https://example.com/a%7Cb>", Link("https://example.com/a|b", ""))
+}
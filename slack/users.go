@@ -0,0 +1,53 @@
+package slack
+
+// A slash command only tells us who somebody is in Slack, which doesn't help us much. To
+// share a link as one of our users we need their email address, so we ask Slack's API for
+// it, using a bot token with the "users:read.email" scope.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// usersInfoURL is Slack's API method for looking up a user
+const usersInfoURL = "https://slack.com/api/users.info"
+
+// ErrNoEmail is returned when Slack won't tell us a user's email address. Bots don't have
+// one, and neither does anybody when the token is missing the "users:read.email" scope.
+var ErrNoEmail = errors.New("Slack did not give us an email address for the user")
+
+type usersInfoResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	User  struct {
+		Profile struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+	} `json:"user"`
+}
+
+// LookupEmail asks Slack for the email address of one of its users
+func LookupEmail(token, userID string) (string, error) {
+	req, _ := http.NewRequest("GET", usersInfoURL+"?user="+url.QueryEscape(userID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data := usersInfoResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	if !data.OK {
+		return "", fmt.Errorf("Slack was unable to look up user %s: %s", userID, data.Error)
+	}
+	if data.User.Profile.Email == "" {
+		return "", ErrNoEmail
+	}
+	return data.User.Profile.Email, nil
+}
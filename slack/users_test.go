@@ -0,0 +1,49 @@
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeSlackAPI(t *testing.T, response string) testhelpers.TestingHTTPTransport {
+	return testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "slack.com", req.URL.Host)
+		assert.Equal(t, "U123", req.URL.Query().Get("user"))
+		assert.Equal(t, "Bearer xoxb-token", req.Header.Get("Authorization"))
+
+		resp := httptest.NewRecorder()
+		resp.Code = 200
+		resp.WriteString(response)
+		return resp.Result(), nil
+	})
+}
+
+func TestLookupEmail(t *testing.T) {
+	transport := fakeSlackAPI(t, `{"ok": true, "user": {"id": "U123", "profile": {"email": "someone@example.com"}}}`)
+	defer transport.Close()
+
+	email, err := LookupEmail("xoxb-token", "U123")
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", email)
+}
+
+func TestLookupEmailMissing(t *testing.T) {
+	transport := fakeSlackAPI(t, `{"ok": true, "user": {"id": "U123", "profile": {}}}`)
+	defer transport.Close()
+
+	_, err := LookupEmail("xoxb-token", "U123")
+	assert.Equal(t, ErrNoEmail, err)
+}
+
+func TestLookupEmailError(t *testing.T) {
+	transport := fakeSlackAPI(t, `{"ok": false, "error": "user_not_found"}`)
+	defer transport.Close()
+
+	_, err := LookupEmail("xoxb-token", "U123")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "user_not_found")
+}
@@ -0,0 +1,88 @@
+package slack
+
+// Telling the team about things goes through an incoming webhook, which is just a URL Slack
+// gives you that posts whatever JSON you send it to a channel. Posting happens in the
+// background (see the jobs package) so that Slack being slow, or down, doesn't hold up
+// whoever voted or sent the issue, and so it gets retried.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+)
+
+// PostJob is the type of job that posts a Message to the webhook
+const PostJob = "slack.post"
+
+// Message is something to post to a channel
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Post sends a message to an incoming webhook
+func Post(webhookURL string, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Slack responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+	}
+	return nil
+}
+
+// Enqueue queues a message up to be posted by a background worker. If there's no webhook
+// configured there's nowhere to post it, so it's dropped.
+func Enqueue(queue *jobs.Queue, webhookURL string, message Message) error {
+	if webhookURL == "" {
+		return nil
+	}
+	_, err := queue.Enqueue(PostJob, message)
+	return err
+}
+
+// PostHandler is the jobs.Handler for PostJob
+func PostHandler(webhookURL string) jobs.Handler {
+	return func(job jobs.Job) error {
+		message := Message{}
+		if err := job.Decode(&message); err != nil {
+			logger.Error.Printf("Unable to decode Slack message in job %d, giving up on it: %s", job.ID, err)
+			return nil
+		}
+		if webhookURL == "" {
+			logger.Warning.Printf("The Slack webhook has been turned off, so job %d is being thrown away", job.ID)
+			return nil
+		}
+		return Post(webhookURL, message)
+	}
+}
+
+// IssueSentMessage announces that an issue of the newsletter has gone out
+func IssueSentMessage(issue newsletter.Issue, urlBase string) Message {
+	return Message{Text: fmt.Sprintf(":newspaper: %s just went out with %d links",
+		Link(fmt.Sprintf("%s/issues/%d", strings.TrimRight(urlBase, "/"), issue.ID), issue.Title), len(issue.Links))}
+}
+
+// PopularLinkMessage lets everybody know a link is catching on
+func PopularLinkMessage(link links.Link, urlBase string) Message {
+	return Message{Text: fmt.Sprintf(":fire: %s is up to %d votes (%s)",
+		Link(link.URL, link.DisplayTitle()), link.Score,
+		Link(fmt.Sprintf("%s/links/%d", strings.TrimRight(urlBase, "/"), link.ID), "discuss"))}
+}
@@ -0,0 +1,95 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/cj-dimaggio/LinkLetter/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testWebhookURL = "https://hooks.slack.com/services/T000/B000/XXXX"
+
+func TestPost(t *testing.T) {
+	var received Message
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, testWebhookURL, req.URL.String())
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		json.NewDecoder(req.Body).Decode(&received)
+
+		resp := httptest.NewRecorder()
+		resp.Code = 200
+		resp.WriteString("ok")
+		return resp.Result(), nil
+	})
+	defer transport.Close()
+
+	assert.Nil(t, Post(testWebhookURL, Message{Text: "Hello"}))
+	assert.Equal(t, Message{Text: "Hello"}, received)
+}
+
+func TestPostFailure(t *testing.T) {
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		resp := httptest.NewRecorder()
+		resp.WriteHeader(404)
+		resp.WriteString("no_service\n")
+		return resp.Result(), nil
+	})
+	defer transport.Close()
+
+	err := Post(testWebhookURL, Message{Text: "Hello"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "Slack responded with 404: no_service", err.Error())
+}
+
+func TestPostHandler(t *testing.T) {
+	posted := 0
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		posted++
+		resp := httptest.NewRecorder()
+		resp.Code = 200
+		return resp.Result(), nil
+	})
+	defer transport.Close()
+
+	assert.Nil(t, PostHandler(testWebhookURL)(jobs.Job{Payload: []byte(`{"text": "Hello"}`)}))
+	assert.Equal(t, 1, posted)
+
+	// With the webhook turned off, or a broken payload, there's nothing to retry
+	assert.Nil(t, PostHandler("")(jobs.Job{Payload: []byte(`{"text": "Hello"}`)}))
+	assert.Nil(t, PostHandler(testWebhookURL)(jobs.Job{Payload: []byte(`nope`)}))
+	assert.Equal(t, 1, posted)
+}
+
+func TestEnqueue(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	queue := jobs.NewQueue(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO jobs")).
+		WithArgs(PostJob, `{"text":"Hello"}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	assert.Nil(t, Enqueue(queue, testWebhookURL, Message{Text: "Hello"}))
+
+	// Nothing is queued when there's no webhook
+	assert.Nil(t, Enqueue(queue, "", Message{Text: "Hello"}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMessages(t *testing.T) {
+	issue := newsletter.Issue{ID: 3, Title: "Issue <3>", Links: []links.Link{{}, {}}}
+	assert.Equal(t, ":newspaper: <https://linkletter.example.com/issues/3|Issue &lt;3&gt;> just went out with 2 links",
+		IssueSentMessage(issue, "https://linkletter.example.com/").Text)
+
+	link := links.Link{ID: 7, URL: "https://example.com/a", Score: 5, CreatedAt: time.Now()}
+	assert.Equal(t, ":fire: <https://example.com/a|https://example.com/a> is up to 5 votes (<https://linkletter.example.com/links/7|discuss>)",
+		PopularLinkMessage(link, "https://linkletter.example.com").Text)
+}
@@ -0,0 +1,141 @@
+// Package subscribers manages the people our newsletter actually gets sent to.
+package subscribers
+
+// It's worth drawing a distinction early on between a "user" and a "subscriber". A user
+// is somebody who can log in to the site and share links, and is going to be limited to
+// whoever passes our AuthorizationPattern. A subscriber is just an email address that
+// wants to receive the newsletter. Plenty of people will be both, but there's no reason
+// to force somebody through OAuth2 just to get an email every week.
+
+import (
+	"database/sql"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// The status of a subscriber determines whether or not we'll send them anything.
+// "suppressed" is reserved for addresses that we've been told, in no uncertain terms,
+// not to send to anymore (hard bounces and spam complaints). Continuing to mail those
+// is the fastest way to get every email we send filed under spam.
+const (
+	StatusActive       = "active"
+	StatusSuppressed   = "suppressed"
+	StatusUnsubscribed = "unsubscribed"
+)
+
+const (
+	selectSubscribers = "SELECT id, email, status, suppressed_reason, soft_bounces, tracking, created_at FROM subscribers"
+
+	listSubscribersQuery = selectSubscribers + " ORDER BY created_at DESC, id DESC"
+	getByEmailQuery      = selectSubscribers + " WHERE email = $1"
+
+	// ON CONFLICT DO NOTHING doesn't return anything for a row that was already there, which
+	// is exactly how Add tells a new subscriber from one we already had
+	addSubscriberQuery = "INSERT INTO subscribers (email) VALUES ($1) ON CONFLICT (email) DO NOTHING RETURNING id, email, status, suppressed_reason, soft_bounces, tracking, created_at"
+
+	suppressSubscriberQuery = "UPDATE subscribers SET status = 'suppressed', suppressed_reason = $2, updated_at = now() WHERE email = $1"
+	recordSoftBounceQuery   = "UPDATE subscribers SET soft_bounces = soft_bounces + 1, updated_at = now() WHERE email = $1 RETURNING soft_bounces"
+	setTrackingQuery        = "UPDATE subscribers SET tracking = $2, updated_at = now() WHERE id = $1"
+)
+
+// ErrInvalidEmail is returned when trying to subscribe something that isn't an email address
+var ErrInvalidEmail = errors.New("That doesn't look like an email address")
+
+// Subscriber is somebody who gets the newsletter, or did until they stopped
+type Subscriber struct {
+	ID               int64
+	Email            string
+	Status           string
+	SuppressedReason string
+	SoftBounces      int
+
+	// Tracking is whether we're allowed to keep track of which links the subscriber clicks
+	// and which issues they open, see the clicks and opens packages
+	Tracking bool
+
+	CreatedAt time.Time
+}
+
+// NormalizeEmail cleans up an email address so that "Someone@Example.com " and
+// "someone@example.com" are treated as the same subscriber.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Querier is what *sql.DB and *sql.Tx have in common, for the functions in here that are
+// happy to be part of somebody else's transaction
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Suppress marks a subscriber as suppressed so that they'll no longer receive any
+// email from us. It's not an error to suppress an address we don't know about.
+func Suppress(db Querier, email, reason string) error {
+	_, err := db.Exec(suppressSubscriberQuery, NormalizeEmail(email), reason)
+	return err
+}
+
+// RecordSoftBounce increments the soft bounce count for a subscriber and returns the
+// new total. If we don't have a subscriber with that email the count will be 0.
+func RecordSoftBounce(db Querier, email string) (int, error) {
+	var count int
+	err := db.QueryRow(recordSoftBounceQuery, NormalizeEmail(email)).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return count, err
+}
+
+// SetTracking turns tracking of a subscriber's clicks and opens on or off
+func SetTracking(db *sql.DB, id int64, tracking bool) error {
+	_, err := db.Exec(setTrackingQuery, id, tracking)
+	return err
+}
+
+func scanSubscriber(row interface {
+	Scan(...interface{}) error
+}) (Subscriber, error) {
+	subscriber := Subscriber{}
+	err := row.Scan(&subscriber.ID, &subscriber.Email, &subscriber.Status, &subscriber.SuppressedReason,
+		&subscriber.SoftBounces, &subscriber.Tracking, &subscriber.CreatedAt)
+	return subscriber, err
+}
+
+// Add subscribes an email address to the newsletter. It returns whether they're a new
+// subscriber, if we already had them they're left exactly as they were. In particular,
+// adding somebody again doesn't undo a suppression or an unsubscribe.
+func Add(db *sql.DB, email string) (Subscriber, bool, error) {
+	email = NormalizeEmail(email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return Subscriber{}, false, ErrInvalidEmail
+	}
+
+	subscriber, err := scanSubscriber(db.QueryRow(addSubscriberQuery, email))
+	if err == sql.ErrNoRows {
+		subscriber, err = scanSubscriber(db.QueryRow(getByEmailQuery, email))
+		return subscriber, false, err
+	}
+	return subscriber, err == nil, err
+}
+
+// List retrieves every subscriber, newest first
+func List(db *sql.DB) ([]Subscriber, error) {
+	rows, err := db.Query(listSubscribersQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscribers := []Subscriber{}
+	for rows.Next() {
+		subscriber, err := scanSubscriber(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers, rows.Err()
+}
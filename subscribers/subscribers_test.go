@@ -0,0 +1,105 @@
+package subscribers
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "someone@example.com", NormalizeEmail("  Someone@Example.COM "))
+}
+
+func TestSuppress(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(suppressSubscriberQuery)).
+		WithArgs("someone@example.com", "hard bounce").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, Suppress(db, "Someone@example.com", "hard bounce"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRecordSoftBounce(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(recordSoftBounceQuery)).
+		WithArgs("someone@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}).AddRow(2))
+	count, err := RecordSoftBounce(db, "someone@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	mock.ExpectQuery(regexp.QuoteMeta(recordSoftBounceQuery)).
+		WithArgs("nobody@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"soft_bounces"}))
+	count, err = RecordSoftBounce(db, "nobody@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+var subscriberColumns = []string{"id", "email", "status", "suppressed_reason", "soft_bounces", "tracking", "created_at"}
+
+func TestAdd(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(addSubscriberQuery)).
+		WithArgs("someone@example.com").
+		WillReturnRows(sqlmock.NewRows(subscriberColumns).AddRow(1, "someone@example.com", StatusActive, "", 0, true, now))
+	subscriber, created, err := Add(db, " Someone@Example.com")
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, int64(1), subscriber.ID)
+
+	// Somebody we already had is left alone, suppression and all
+	mock.ExpectQuery(regexp.QuoteMeta(addSubscriberQuery)).
+		WithArgs("bounced@example.com").
+		WillReturnRows(sqlmock.NewRows(subscriberColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(getByEmailQuery)).
+		WithArgs("bounced@example.com").
+		WillReturnRows(sqlmock.NewRows(subscriberColumns).AddRow(2, "bounced@example.com", StatusSuppressed, "hard bounce", 0, true, now))
+	subscriber, created, err = Add(db, "bounced@example.com")
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, StatusSuppressed, subscriber.Status)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestAddInvalid(t *testing.T) {
+	db, _, _ := sqlmock.New()
+
+	for _, email := range []string{"", "someone", "Someone <someone@example.com>", "a@b@c"} {
+		_, _, err := Add(db, email)
+		assert.Equal(t, ErrInvalidEmail, err, email)
+	}
+}
+
+func TestList(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listSubscribersQuery)).
+		WillReturnRows(sqlmock.NewRows(subscriberColumns).
+			AddRow(2, "b@example.com", StatusActive, "", 0, true, time.Now()).
+			AddRow(1, "a@example.com", StatusUnsubscribed, "", 1, false, time.Now()))
+	subscribers, err := List(db)
+	assert.Nil(t, err)
+	assert.Len(t, subscribers, 2)
+	assert.Equal(t, "a@example.com", subscribers[1].Email)
+	assert.False(t, subscribers[1].Tracking)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSetTracking(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(setTrackingQuery)).WithArgs(2, false).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, SetTracking(db, 2, false))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
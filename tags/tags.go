@@ -0,0 +1,234 @@
+// Package tags handles the tags people put on links, and the categories editors sort
+// them into for the newsletter.
+package tags
+
+// There are two different things going on here. Tags are free-form, anybody sharing a link
+// can tag it with whatever they'd like, and we make no attempt to stop people from using
+// "golang", "go", and "go-lang" to mean the same thing. Categories are the opposite. They're
+// a short list, managed by admins, of the sections the newsletter is split into, in the
+// order they appear in.
+//
+// Tags get sorted into categories in one of two ways. The easy way is by name, a tag with
+// the same slug as a category belongs to it, so tagging a link "industry-news" will put it
+// in the "Industry News" category without anybody needing to do a thing. For everything
+// else, admins can assign tags to categories by hand, which is how "go" and "go-lang" end
+// up in "Engineering" with "golang".
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	upsertTagQuery     = "INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id"
+	clearLinkTagsQuery = "DELETE FROM link_tags WHERE link_id = $1"
+	addLinkTagQuery    = "INSERT INTO link_tags (link_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	assignTagQuery     = "INSERT INTO tags (name, category_id) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET category_id = EXCLUDED.category_id"
+	listTagsQuery      = "SELECT t.name, COALESCE(c.name, ''), t.category_id IS NOT NULL, COUNT(lt.link_id) FROM tags t " +
+		"LEFT JOIN categories c ON c.id = t.category_id OR (t.category_id IS NULL AND c.slug = t.name) " +
+		"LEFT JOIN link_tags lt ON lt.tag_id = t.id GROUP BY t.id, t.name, c.name ORDER BY t.name"
+
+	selectCategories         = "SELECT id, name, slug, position FROM categories"
+	listCategoriesQuery      = selectCategories + " ORDER BY position, id"
+	createCategoryQuery      = "INSERT INTO categories (name, slug, position) VALUES ($1, $2, (SELECT COALESCE(MAX(position), -1) + 1 FROM categories)) RETURNING id, position"
+	deleteCategoryQuery      = "DELETE FROM categories WHERE id = $1"
+	setCategoryPositionQuery = "UPDATE categories SET position = $2 WHERE id = $1"
+)
+
+// ErrInvalidName is returned when a tag or category name has nothing usable in it
+var ErrInvalidName = errors.New("Names need at least one letter or number in them")
+
+// ErrCategoryNotFound is returned when trying to move a category that doesn't exist
+var ErrCategoryNotFound = errors.New("The category does not exist")
+
+var (
+	separators = regexp.MustCompile(`[\s_]+`)
+	unwanted   = regexp.MustCompile(`[^a-z0-9-]+`)
+	dashes     = regexp.MustCompile(`-{2,}`)
+)
+
+// Tag is a tag, along with how it's been categorized and how many links it's on
+type Tag struct {
+	Name     string
+	Category string
+
+	// Assigned is whether an admin put the tag in its category, rather than it landing there
+	// by having the same name
+	Assigned bool
+
+	Links int
+}
+
+// Category is one of the sections of the newsletter
+type Category struct {
+	ID       int64
+	Name     string
+	Slug     string
+	Position int
+}
+
+// Normalize turns a name into a tag (or a category's slug) by lower casing it and replacing
+// anything that isn't a letter, number, or dash. So "Industry News" becomes "industry-news"
+// and "#Go" becomes "go".
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = separators.ReplaceAllString(name, "-")
+	name = unwanted.ReplaceAllString(name, "")
+	name = dashes.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-")
+}
+
+// Parse splits a comma separated list of tags, as somebody would type it into a form,
+// normalizing them and throwing out any that are blank or repeated.
+func Parse(input string) []string {
+	seen := map[string]bool{}
+	parsed := []string{}
+	for _, raw := range strings.Split(input, ",") {
+		tag := Normalize(raw)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			parsed = append(parsed, tag)
+		}
+	}
+	return parsed
+}
+
+// SetForLink replaces all of a link's tags with the supplied ones, creating any tags that
+// don't exist yet. The tags are expected to have already been through Parse.
+func SetForLink(db *sql.DB, linkID int64, names []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(clearLinkTagsQuery, linkID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, name := range names {
+		var tagID int64
+		if err := tx.QueryRow(upsertTagQuery, name).Scan(&tagID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(addLinkTagQuery, linkID, tagID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListTags lists every tag, alphabetically
+func ListTags(db *sql.DB) ([]Tag, error) {
+	rows, err := db.Query(listTagsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []Tag{}
+	for rows.Next() {
+		tag := Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Category, &tag.Assigned, &tag.Links); err != nil {
+			return nil, err
+		}
+		found = append(found, tag)
+	}
+	return found, rows.Err()
+}
+
+// AssignTag puts a tag in a category, creating the tag if nobody has used it yet. A
+// categoryID of 0 takes the tag back out, leaving it to be categorized by name.
+func AssignTag(db *sql.DB, name string, categoryID int64) error {
+	name = Normalize(name)
+	if name == "" {
+		return ErrInvalidName
+	}
+	category := sql.NullInt64{Int64: categoryID, Valid: categoryID != 0}
+	_, err := db.Exec(assignTagQuery, name, category)
+	return err
+}
+
+// ListCategories lists every category, in the order they appear in the newsletter
+func ListCategories(db *sql.DB) ([]Category, error) {
+	rows, err := db.Query(listCategoriesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []Category{}
+	for rows.Next() {
+		category := Category{}
+		if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.Position); err != nil {
+			return nil, err
+		}
+		found = append(found, category)
+	}
+	return found, rows.Err()
+}
+
+// CreateCategory adds a new category, at the end of the newsletter
+func CreateCategory(db *sql.DB, name string) (Category, error) {
+	category := Category{Name: strings.TrimSpace(name), Slug: Normalize(name)}
+	if category.Slug == "" {
+		return category, ErrInvalidName
+	}
+	err := db.QueryRow(createCategoryQuery, category.Name, category.Slug).Scan(&category.ID, &category.Position)
+	return category, err
+}
+
+// DeleteCategory removes a category. Any links in it will end up in whatever other category
+// their tags put them in, or "Other" if there isn't one.
+func DeleteCategory(db *sql.DB, id int64) error {
+	_, err := db.Exec(deleteCategoryQuery, id)
+	return err
+}
+
+// MoveCategory moves a category earlier (a negative offset) or later (a positive one) in the
+// newsletter. This works just like moving links around in an issue, see newsletter.Move.
+func MoveCategory(db *sql.DB, id int64, offset int) error {
+	categories, err := ListCategories(db)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, category := range categories {
+		if category.ID == id {
+			index = i
+		}
+	}
+	if index == -1 {
+		return ErrCategoryNotFound
+	}
+
+	target := index + offset
+	if target < 0 {
+		target = 0
+	}
+	if target >= len(categories) {
+		target = len(categories) - 1
+	}
+
+	moved := categories[index]
+	ordered := append([]Category{}, categories[:index]...)
+	ordered = append(ordered, categories[index+1:]...)
+	ordered = append(ordered[:target], append([]Category{moved}, ordered[target:]...)...)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for position, category := range ordered {
+		if _, err := tx.Exec(setCategoryPositionQuery, category.ID, position); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,107 @@
+package tags
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var categoryColumns = []string{"id", "name", "slug", "position"}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "industry-news", Normalize(" Industry News "))
+	assert.Equal(t, "go", Normalize("#Go"))
+	assert.Equal(t, "c-plus-plus", Normalize("c_plus -- plus"))
+	assert.Equal(t, "", Normalize(" !!! "))
+}
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, []string{"go", "industry-news"}, Parse("Go, industry news,, GO ,  "))
+	assert.Equal(t, []string{}, Parse(""))
+}
+
+func TestSetForLink(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(clearLinkTagsQuery)).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(upsertTagQuery)).WithArgs("go").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(addLinkTagQuery)).WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(upsertTagQuery)).WithArgs("design").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(addLinkTagQuery)).WithArgs(5, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, SetForLink(db, 5, []string{"go", "design"}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListTags(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(listTagsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "category", "assigned", "links"}).
+			AddRow("design", "Design", false, 3).
+			AddRow("go", "Engineering", true, 5).
+			AddRow("misc", "", false, 1))
+
+	found, err := ListTags(db)
+	assert.Nil(t, err)
+	assert.Len(t, found, 3)
+	assert.Equal(t, Tag{Name: "go", Category: "Engineering", Assigned: true, Links: 5}, found[1])
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestAssignTag(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectExec(regexp.QuoteMeta(assignTagQuery)).WithArgs("golang", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, AssignTag(db, "GoLang", 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(assignTagQuery)).WithArgs("golang", nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, AssignTag(db, "golang", 0))
+
+	assert.Equal(t, ErrInvalidName, AssignTag(db, "!!", 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCategory(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(createCategoryQuery)).
+		WithArgs("Industry News", "industry-news").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow(4, 2))
+
+	category, err := CreateCategory(db, " Industry News")
+	assert.Nil(t, err)
+	assert.Equal(t, Category{ID: 4, Name: "Industry News", Slug: "industry-news", Position: 2}, category)
+
+	_, err = CreateCategory(db, "  ")
+	assert.Equal(t, ErrInvalidName, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMoveCategory(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	categories := func() *sqlmock.Rows {
+		return sqlmock.NewRows(categoryColumns).
+			AddRow(1, "Engineering", "engineering", 0).
+			AddRow(2, "Design", "design", 1).
+			AddRow(3, "Industry News", "industry-news", 2)
+	}
+
+	// Moving the last category up two should put it first
+	mock.ExpectQuery(regexp.QuoteMeta(listCategoriesQuery)).WillReturnRows(categories())
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(setCategoryPositionQuery)).WithArgs(3, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setCategoryPositionQuery)).WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(setCategoryPositionQuery)).WithArgs(2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, MoveCategory(db, 3, -2))
+
+	mock.ExpectQuery(regexp.QuoteMeta(listCategoriesQuery)).WillReturnRows(categories())
+	assert.Equal(t, ErrCategoryNotFound, MoveCategory(db, 9, 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,62 @@
+package users
+
+// Anybody can put whatever they'd like in the From header of an email, so an inbound
+// address that accepted links from anyone claiming to be one of our users would be an
+// open invitation. Instead everybody gets their own address with a secret token in it
+// (see the inbound package for what it looks like), and somebody who doesn't know the
+// token can't submit anything as them. If a token gets out it can be reset, which
+// immediately retires the old address.
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+)
+
+const (
+	// The COALESCE means we only ever fill the token in once, the first time it's asked for
+	inboundTokenQuery      = "UPDATE users SET inbound_token = COALESCE(inbound_token, $2) WHERE id = $1 RETURNING inbound_token"
+	resetInboundTokenQuery = "UPDATE users SET inbound_token = $2 WHERE id = $1 RETURNING inbound_token"
+	getByInboundTokenQuery = "SELECT id, email, role, created_at FROM users WHERE inbound_token = $1"
+	inboundTokenBytes      = 10
+)
+
+// newInboundToken generates a random token. It ends up in an email address, and plenty of
+// mail servers don't bother preserving case, so it's lowercase base32 rather than base64.
+func newInboundToken() (string, error) {
+	raw := make([]byte, inboundTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(raw)), nil
+}
+
+// InboundToken retrieves the secret token for a user's inbound email address, creating it
+// if they've never had one.
+func InboundToken(db *sql.DB, userID int64) (string, error) {
+	token, err := newInboundToken()
+	if err != nil {
+		return "", err
+	}
+	err = db.QueryRow(inboundTokenQuery, userID, token).Scan(&token)
+	return token, err
+}
+
+// ResetInboundToken gives a user a new inbound token, so that their old address stops working
+func ResetInboundToken(db *sql.DB, userID int64) (string, error) {
+	token, err := newInboundToken()
+	if err != nil {
+		return "", err
+	}
+	err = db.QueryRow(resetInboundTokenQuery, userID, token).Scan(&token)
+	return token, err
+}
+
+// GetByInboundToken retrieves the user an inbound token belongs to. Like Get, it returns
+// sql.ErrNoRows if there isn't one.
+func GetByInboundToken(db *sql.DB, token string) (User, error) {
+	user := User{}
+	err := db.QueryRow(getByInboundTokenQuery, strings.ToLower(token)).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+	return user, err
+}
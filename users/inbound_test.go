@@ -0,0 +1,58 @@
+package users
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInboundToken(t *testing.T) {
+	token, err := newInboundToken()
+	assert.Nil(t, err)
+	assert.Regexp(t, "^[a-z2-7]{16}$", token)
+
+	other, _ := newInboundToken()
+	assert.NotEqual(t, token, other)
+}
+
+func TestInboundToken(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(inboundTokenQuery)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inbound_token"}).AddRow("existingtoken"))
+
+	token, err := InboundToken(db, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "existingtoken", token)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestResetInboundToken(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(resetInboundTokenQuery)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inbound_token"}).AddRow("newtoken"))
+
+	token, err := ResetInboundToken(db, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "newtoken", token)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByInboundToken(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getByInboundTokenQuery)).
+		WithArgs("sometoken").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "someone@example.com", RoleMember, time.Now()))
+
+	user, err := GetByInboundToken(db, "SomeToken")
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", user.Email)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
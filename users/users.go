@@ -0,0 +1,100 @@
+// Package users keeps track of the people who log in to LinkLetter.
+package users
+
+// We don't actually manage any accounts ourselves, Google does all of that for us (see
+// web/auth/oauth2). All we need is a row to hang votes, links, and comments off of, so a
+// user is created the first time we see somebody's email address and that's that.
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// A user's role determines what they're allowed to do. Members can share, vote on, and
+// discuss links. Editors can also put together and send issues of the newsletter and
+// moderate discussion. Admins can do all of that and manage the instance itself.
+const (
+	RoleMember = "member"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// The CASE in getOrCreateUserQuery means a role from the config can promote somebody but
+// will never demote them. If you'd like to take somebody's admin privileges away you'll
+// need to do it in the database, which seems like an appropriate amount of friction.
+const (
+	getUserByEmailQuery  = "SELECT id, email, role, created_at FROM users WHERE email = $1"
+	getOrCreateUserQuery = "INSERT INTO users (email, role) VALUES ($1, $2) ON CONFLICT (email) DO UPDATE SET role = CASE WHEN EXCLUDED.role = 'member' THEN users.role ELSE EXCLUDED.role END RETURNING id, email, role, created_at"
+	getUserQuery         = "SELECT id, email, role, created_at FROM users WHERE id = $1"
+)
+
+// User is somebody who has logged in to the site
+type User struct {
+	ID        int64
+	Email     string
+	Role      string
+	CreatedAt time.Time
+}
+
+// IsEditor determines if the user is allowed to do editorial work
+func (user User) IsEditor() bool {
+	return user.Role == RoleEditor || user.Role == RoleAdmin
+}
+
+// IsAdmin determines if the user is allowed to manage the instance
+func (user User) IsAdmin() bool {
+	return user.Role == RoleAdmin
+}
+
+// inList checks if an email is in a comma separated list of emails
+func inList(email, list string) bool {
+	for _, entry := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(entry), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleFor determines the role somebody should have based on comma separated lists of
+// editor and admin emails (as they're found in the config).
+func RoleFor(email, editors, admins string) string {
+	switch {
+	case inList(email, admins):
+		return RoleAdmin
+	case inList(email, editors):
+		return RoleEditor
+	}
+	return RoleMember
+}
+
+// GetOrCreate retrieves the user with the given email, creating them if they don't exist
+// yet. If role is anything other than RoleMember, the user will be promoted to it.
+//
+// It's called for pretty much every request, and nearly every time the user's already there
+// with the role they should have, so we look for them first. The upsert is a write (and a
+// row lock) even when it doesn't change anything, so it's only for when something needs
+// changing.
+func GetOrCreate(db *sql.DB, email, role string) (User, error) {
+	email = strings.ToLower(email)
+	user := User{}
+	err := db.QueryRow(getUserByEmailQuery, email).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+	if err == nil && (role == RoleMember || role == user.Role) {
+		return user, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return user, err
+	}
+
+	user = User{}
+	err = db.QueryRow(getOrCreateUserQuery, email, role).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+	return user, err
+}
+
+// Get retrieves a user by their id
+func Get(db *sql.DB, id int64) (User, error) {
+	user := User{}
+	err := db.QueryRow(getUserQuery, id).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt)
+	return user, err
+}
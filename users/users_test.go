@@ -0,0 +1,86 @@
+package users
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var userColumns = []string{"id", "email", "role", "created_at"}
+
+func TestRoles(t *testing.T) {
+	assert.True(t, User{Role: RoleAdmin}.IsEditor())
+	assert.True(t, User{Role: RoleAdmin}.IsAdmin())
+	assert.True(t, User{Role: RoleEditor}.IsEditor())
+	assert.False(t, User{Role: RoleEditor}.IsAdmin())
+	assert.False(t, User{Role: RoleMember}.IsEditor())
+}
+
+func TestRoleFor(t *testing.T) {
+	editors := "editor@example.com, both@example.com"
+	admins := "Admin@example.com,both@example.com"
+
+	assert.Equal(t, RoleAdmin, RoleFor("admin@example.com", editors, admins))
+	assert.Equal(t, RoleAdmin, RoleFor("both@example.com", editors, admins))
+	assert.Equal(t, RoleEditor, RoleFor("editor@example.com", editors, admins))
+	assert.Equal(t, RoleMember, RoleFor("someone@example.com", editors, admins))
+	assert.Equal(t, RoleMember, RoleFor("someone@example.com", "", ""))
+}
+
+func TestGetOrCreate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	// Somebody we've seen before, with the role they should have, is only looked up
+	mock.ExpectQuery(regexp.QuoteMeta(getUserByEmailQuery)).
+		WithArgs("someone@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "someone@example.com", RoleEditor, time.Now()))
+
+	user, err := GetOrCreate(db, "Someone@example.com", RoleMember)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), user.ID)
+	assert.Equal(t, RoleEditor, user.Role)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// Somebody new is created
+	mock.ExpectQuery(regexp.QuoteMeta(getUserByEmailQuery)).
+		WithArgs("new@example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(getOrCreateUserQuery)).
+		WithArgs("new@example.com", RoleMember).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(2, "new@example.com", RoleMember, time.Now()))
+
+	user, err = GetOrCreate(db, "new@example.com", RoleMember)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), user.ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// And somebody who's been made an editor in the config since is promoted
+	mock.ExpectQuery(regexp.QuoteMeta(getUserByEmailQuery)).
+		WithArgs("someone@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "someone@example.com", RoleMember, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(getOrCreateUserQuery)).
+		WithArgs("someone@example.com", RoleEditor).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "someone@example.com", RoleEditor, time.Now()))
+
+	user, err = GetOrCreate(db, "someone@example.com", RoleEditor)
+	assert.Nil(t, err)
+	assert.Equal(t, RoleEditor, user.Role)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGet(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getUserQuery)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "someone@example.com", RoleMember, time.Now()))
+
+	user, err := Get(db, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", user.Email)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -1,7 +1,9 @@
 package authentication
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/cj-dimaggio/LinkLetter/logger"
 	"github.com/gorilla/sessions"
@@ -11,18 +13,72 @@ const (
 	loginPage         string = "/login"
 	sessionName       string = "session"
 	authenticationKey string = "isAuthenticated"
+	emailKey          string = "email"
+	returnToKey       string = "returnTo"
 )
 
-// LogInUser sets the user's cookies so that their session represents them as logged in
-func LogInUser(cookies *sessions.CookieStore, req *http.Request, w http.ResponseWriter) (err error) {
+// DevelopmentUser is who everybody is assumed to be when authentication is disabled. That
+// way somebody hacking on the site without OAuth2 credentials can still submit and vote on
+// links like anybody else.
+const DevelopmentUser = "developer@localhost"
+
+// ErrUnidentified is returned when a session doesn't tell us who the user is
+var ErrUnidentified = errors.New("The session does not identify a user")
+
+// LogInUser sets the user's cookies so that their session represents them as logged in. Once
+// they're logged in we don't need to remember where they were going anymore (see ReturnPath).
+func LogInUser(cookies *sessions.CookieStore, req *http.Request, w http.ResponseWriter, email string) (err error) {
 	session, err := cookies.Get(req, sessionName)
 	if err == nil {
 		session.Values[authenticationKey] = true
+		session.Values[emailKey] = email
+		delete(session.Values, returnToKey)
 		session.Save(req, w)
 	}
 	return
 }
 
+// ReturnPath is where the user was trying to go when ProtectedFunc sent them off to log in,
+// or "/" if they weren't going anywhere in particular. Getting bounced to the front page after
+// logging in is annoying at the best of times, but it's especially bad when somebody shared
+// a link to us from their phone and it got lost along the way.
+func ReturnPath(cookies *sessions.CookieStore, req *http.Request) string {
+	session, err := cookies.Get(req, sessionName)
+	if err != nil {
+		return "/"
+	}
+	path, _ := session.Values[returnToKey].(string)
+	return LocalPath(path, "/")
+}
+
+// rememberReturnPath keeps track of where the user was going so that ReturnPath can send them
+// back there after they've logged in. Only GETs are remembered, there's no sensible way to
+// replay a form submission after a trip through Google.
+func rememberReturnPath(login Login, r *http.Request, w http.ResponseWriter) {
+	if r.Method != "GET" {
+		return
+	}
+	session, err := login.GetCookies().Get(r, sessionName)
+	if session == nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to remember where the user was going: %s", err)
+		return
+	}
+	// If err isn't nil here it's the malformed cookie from requestIsAuthenticated. Gorilla
+	// still hands us a fresh session in that case, and saving it will overwrite the bad one.
+	session.Values[returnToKey] = r.URL.RequestURI()
+	session.Save(r, w)
+}
+
+// LocalPath makes sure a path we're about to redirect to stays on our own site, falling back
+// to the supplied path if it doesn't. Otherwise anybody could craft a link to us that bounces
+// our users off to wherever they'd like, which is what's known as an "open redirect".
+func LocalPath(path, fallback string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return fallback
+	}
+	return path
+}
+
 // Login is a general interface for determining if a user is logged in or not
 type Login interface {
 	// ShouldAuthenticate tries to determine if the authentication process should even be attempted.
@@ -63,7 +119,7 @@ type Login interface {
 func IsAuthenticated(req *http.Request, cookies *sessions.CookieStore) (bool, error) {
 	session, err := cookies.Get(req, sessionName)
 	if err != nil {
-		logger.Error.Printf("Encountered error while getting session: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Encountered error while getting session: %s", err)
 		return false, err
 	}
 
@@ -75,6 +131,44 @@ func IsAuthenticated(req *http.Request, cookies *sessions.CookieStore) (bool, er
 	return false, nil
 }
 
+// CurrentUserEmail returns the email address of the logged in user. Sessions created before
+// we started keeping track of email addresses will return ErrUnidentified, and those users
+// will simply need to log in again.
+func CurrentUserEmail(login Login, req *http.Request) (string, error) {
+	if !login.ShouldAuthenticate() {
+		return DevelopmentUser, nil
+	}
+
+	session, err := login.GetCookies().Get(req, sessionName)
+	if err != nil {
+		return "", err
+	}
+
+	if email, ok := session.Values[emailKey].(string); ok && email != "" {
+		return email, nil
+	}
+	return "", ErrUnidentified
+}
+
+// requestIsAuthenticated checks whether the user making a request has logged in
+func requestIsAuthenticated(login Login, r *http.Request) bool {
+	auth, err := IsAuthenticated(r, login.GetCookies())
+
+	if err != nil {
+		// I noticed an interesting problem where, because I had been developing another
+		// server on the same port I was testing this application on, I just so happened
+		// to have a cookie set to our same "sessionName" and it was causing me 500 errors
+		// because mux.SecureCookies couldn't decode this unknown format. For this reason,
+		// instead of sending out a 500 error as we originally had it, we'll just treat
+		// it as if it were an unauthenticated state but not fault. This way, if the user
+		// chooses to sign in naturally, their bogus cookie will instead just be overwritten.
+		// Obviously the chances of this coming up "in the field" is unlikely, but as it's
+		// something that came up already, it would be good not to regress
+		logger.Error.PrintfContext(r.Context(), "Was unable to determine if user is authenticated, their '%s' cookie may be malformed: %s", sessionName, err)
+	}
+	return auth
+}
+
 // ProtectedFunc is an http middleware that wraps an http.handlerfunc and checks if a user is authenticated. If the user
 // isn't then he/she is redirected to /login, if the user is, then the request continues
 // normally
@@ -83,26 +177,12 @@ func ProtectedFunc(login Login, wrap func(w http.ResponseWriter, r *http.Request
 		return wrap
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth, err := IsAuthenticated(r, login.GetCookies())
-
-		if err != nil {
-			// I noticed an interesting problem where, because I had been developing another
-			// server on the same port I was testing this application on, I just so happened
-			// to have a cookie set to our same "sessionName" and it was causing me 500 errors
-			// because mux.SecureCookies couldn't decode this unknown format. For this reason,
-			// instead of sending out a 500 error as we originally had it, we'll just treat
-			// it as if it were an unauthenticated state but not fault. This way, if the user
-			// chooses to sign in naturally, their bogus cookie will instead just be overwritten.
-			// Obviously the chances of this coming up "in the field" is unlikely, but as it's
-			// something that came up already, it would be good not to regress
-			logger.Error.Printf("Was unable to determine if user is authenticated, their '%s' cookie may be malformed: %s", sessionName, err)
-		}
-
-		if !auth {
+		if !requestIsAuthenticated(login, r) {
 			// I kind of think this should be a 303 ("See Other") rather than
 			// a 302 ("Found"), but after doing some research it looks like 302s
 			// are the standard for cases like this (I believe it's what google uses)
 			// so we'll just go with that.
+			rememberReturnPath(login, r, w)
 			http.Redirect(w, r, loginPage, 302)
 			return
 		}
@@ -111,6 +191,24 @@ func ProtectedFunc(login Login, wrap func(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// ProtectedAPIHandler is ProtectedHandler for our JSON API. Redirecting a script to a login
+// page it can't do anything with isn't very helpful, so it gets a 401 instead.
+func ProtectedAPIHandler(login Login, next http.Handler) http.Handler {
+	if !login.ShouldAuthenticate() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requestIsAuthenticated(login, r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Not logged in"}`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // ProtectedHandler is a piece of middleware that wraps an http.handler with the behavior
 // of ProtectedFunc
 //
@@ -26,8 +26,12 @@ func (login dummyLogin) GetCookies() *sessions.CookieStore {
 }
 
 func authenticatedRequest(cookies *sessions.CookieStore, authenticated bool) *http.Request {
+	return sessionRequest(cookies, sessionData{"isAuthenticated": authenticated})
+}
+
+func sessionRequest(cookies *sessions.CookieStore, data sessionData) *http.Request {
 	req, _ := http.NewRequest("GET", "http://localhost/", nil)
-	token, _ := securecookie.EncodeMulti("session", sessionData{"isAuthenticated": authenticated}, cookies.Codecs...)
+	token, _ := securecookie.EncodeMulti("session", data, cookies.Codecs...)
 	req.AddCookie(&http.Cookie{
 		Name:  "session",
 		Value: token,
@@ -115,3 +119,103 @@ func TestProtectedHandler(t *testing.T) {
 	assert.Equal(t, 302, w.Code)
 	assert.Equal(t, "/login", w.Header().Get("Location"))
 }
+
+func TestProtectedAPIHandler(t *testing.T) {
+	cookies := sessions.NewCookieStore([]byte("testing"))
+	login := dummyLogin{
+		Cookies:      cookies,
+		authenticate: true,
+	}
+
+	handler := ProtectedAPIHandler(login, http.NewServeMux())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/api", nil))
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, "", w.Header().Get("Location"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, authenticatedRequest(cookies, true))
+	assert.Equal(t, 404, w.Code)
+
+	login.authenticate = false
+	handler = ProtectedAPIHandler(login, http.NewServeMux())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/api", nil))
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestCurrentUserEmail(t *testing.T) {
+	cookies := sessions.NewCookieStore([]byte("testing"))
+	login := dummyLogin{
+		Cookies:      cookies,
+		authenticate: true,
+	}
+
+	email, err := CurrentUserEmail(login, sessionRequest(cookies, sessionData{"isAuthenticated": true, "email": "someone@example.com"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", email)
+
+	_, err = CurrentUserEmail(login, authenticatedRequest(cookies, true))
+	assert.Equal(t, ErrUnidentified, err)
+
+	login.authenticate = false
+	email, err = CurrentUserEmail(login, authenticatedRequest(cookies, false))
+	assert.Nil(t, err)
+	assert.Equal(t, DevelopmentUser, email)
+}
+
+func TestLogInUser(t *testing.T) {
+	cookies := sessions.NewCookieStore([]byte("testing"))
+	w := httptest.NewRecorder()
+	assert.Nil(t, LogInUser(cookies, httptest.NewRequest("GET", "http://localhost/", nil), w, "someone@example.com"))
+
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+	email, err := CurrentUserEmail(dummyLogin{Cookies: cookies, authenticate: true}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "someone@example.com", email)
+}
+
+func TestReturnPath(t *testing.T) {
+	cookies := sessions.NewCookieStore([]byte("testing"))
+	login := dummyLogin{
+		Cookies:      cookies,
+		authenticate: true,
+	}
+	wrapped := ProtectedFunc(login, func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	wrapped(w, httptest.NewRequest("GET", "http://localhost/share?url=http%3A%2F%2Fexample.com", nil))
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+
+	req := httptest.NewRequest("GET", "http://localhost/login/auth/oauth2/google", nil)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	assert.Equal(t, "/share?url=http%3A%2F%2Fexample.com", ReturnPath(cookies, req))
+
+	// Logging in forgets where they were going
+	w = httptest.NewRecorder()
+	assert.Nil(t, LogInUser(cookies, req, w, "someone@example.com"))
+	req = httptest.NewRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	assert.Equal(t, "/", ReturnPath(cookies, req))
+
+	// Form submissions aren't remembered
+	w = httptest.NewRecorder()
+	wrapped(w, httptest.NewRequest("POST", "http://localhost/links", nil))
+	assert.Equal(t, "", w.Header().Get("Set-Cookie"))
+
+	assert.Equal(t, "/", ReturnPath(cookies, sessionRequest(cookies, sessionData{"returnTo": "//evil.example.com"})))
+	assert.Equal(t, "/", ReturnPath(cookies, httptest.NewRequest("GET", "http://localhost/", nil)))
+}
+
+func TestLocalPath(t *testing.T) {
+	assert.Equal(t, "/links/1", LocalPath("/links/1", "/"))
+	assert.Equal(t, "/", LocalPath("http://evil.example.com", "/"))
+	assert.Equal(t, "/", LocalPath("//evil.example.com", "/"))
+	assert.Equal(t, "/", LocalPath("/\\evil.example.com", "/"))
+	assert.Equal(t, "/", LocalPath("", "/"))
+}
@@ -51,7 +51,7 @@ func (google Google) GenerateAuthorizationURL(redirectURI, clientID, scope strin
 func (google Google) ExtractAuthorizationCode(req *http.Request) (string, error) {
 	err := req.URL.Query().Get("error")
 	if err != "" {
-		logger.Error.Printf("Google authorization error: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Google authorization error: %s", err)
 		return "", errors.New(err)
 	}
 
@@ -125,20 +125,20 @@ func (google Google) ExtractAccessToken(resp *http.Response) (string, error) {
 }
 
 // Authenticate matches the passed in regexp with the user's hosted domain to see if they have access
-// to log in.
+// to log in, and returns the email address on their Google account.
 //
 // This is another place where the generalization kind of breaks down. I mean how do we plan to reuse
 // this function signature for something like github where they don't even validate email addresses?
 // We probably won't be able to and we'll need to revise our entire system. But for now, we're just
 // working on our first pass.
-func (google Google) Authenticate(accessToken string, pattern *regexp.Regexp) (bool, error) {
+func (google Google) Authenticate(accessToken string, pattern *regexp.Regexp) (string, bool, error) {
 	profile, err := getProfileData(accessToken)
 	if err != nil {
 		logger.Error.Printf("Could not get profile data: %s", err)
-		return false, err
+		return "", false, err
 	}
 
-	return pattern.Match([]byte(profile.HostedDomain)), nil
+	return profile.Email, pattern.Match([]byte(profile.HostedDomain)), nil
 }
 
 // getProfileData retrieves a person's profile data from Google's API.
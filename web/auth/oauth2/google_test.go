@@ -76,7 +76,8 @@ func TestGoogleAuthenticate(t *testing.T) {
 		resp.Code = 200
 		resp.WriteString(`
 		{
-			"hd": "localprojects.com" 
+			"hd": "localprojects.com",
+			"email": "someone@localprojects.com"
 			}
 		`)
 		return resp.Result(), nil
@@ -86,12 +87,13 @@ func TestGoogleAuthenticate(t *testing.T) {
 	google := Google{}
 
 	pattern, _ := regexp.Compile("localprojects\\.(com|net)")
-	auth, err := google.Authenticate("abcd", pattern)
+	email, auth, err := google.Authenticate("abcd", pattern)
 	assert.Nil(t, err)
 	assert.True(t, auth)
+	assert.Equal(t, "someone@localprojects.com", email)
 
 	pattern, _ = regexp.Compile("helloWorld")
-	auth, err = google.Authenticate("abcd", pattern)
+	_, auth, err = google.Authenticate("abcd", pattern)
 	assert.Nil(t, err)
 	assert.False(t, auth)
 }
@@ -172,7 +172,11 @@ type OAuth2 interface {
 	// like allowing logins from someplace like github where they don't validate email addresses? I don't freaking know, man, but
 	// I wasted so much time trying to think of how to generalize this that I just wasn't doing anything so I'm putting those problems
 	// off until the future.
-	Authenticate(accessToken string, pattern *regexp.Regexp) (bool, error)
+	//
+	// Being allowed in is only half of it though, once people can vote on and discuss links we need to know
+	// *who* is logged in, not just that somebody is. So Authenticate also hands back the email address the
+	// provider has on file for the user, which is what we'll identify them by from here on.
+	Authenticate(accessToken string, pattern *regexp.Regexp) (email string, authenticated bool, err error)
 }
 
 // OAuth2Login implements the OAuth2 login logic using the OAuth2Provider of the user's choice
@@ -208,7 +212,7 @@ func (login OAuth2Login) GetAuthorizationURL() string {
 func (login OAuth2Login) AuthorizationCallbackHandler(w http.ResponseWriter, req *http.Request) {
 	authCode, err := login.OAuth2Provider.ExtractAuthorizationCode(req)
 	if err != nil {
-		logger.Error.Printf("Was unable to get authorization code for login: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Was unable to get authorization code for login: %s", err)
 		http.Error(w, "Was unable to log you into the system", 500)
 		return
 	}
@@ -216,21 +220,21 @@ func (login OAuth2Login) AuthorizationCallbackHandler(w http.ResponseWriter, req
 	tokenReq := login.OAuth2Provider.GenerateAccessTokenRequest(authCode, login.RedirectURL, login.ClientID, login.ClientSecret)
 	tokenResp, err := http.DefaultClient.Do(tokenReq)
 	if err != nil {
-		logger.Error.Printf("Was unable to get access token code for login: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Was unable to get access token code for login: %s", err)
 		http.Error(w, "Was unable to log you into the system", 500)
 		return
 	}
 
 	token, err := login.OAuth2Provider.ExtractAccessToken(tokenResp)
 	if err != nil {
-		logger.Error.Printf("Was unable to extract access token code for login: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Was unable to extract access token code for login: %s", err)
 		http.Error(w, "Was unable to log you into the system", 500)
 		return
 	}
 
-	authenticated, err := login.OAuth2Provider.Authenticate(token, login.AuthorizationPattern)
+	email, authenticated, err := login.OAuth2Provider.Authenticate(token, login.AuthorizationPattern)
 	if err != nil {
-		logger.Error.Printf("Error occurred while authenticating: %s", err)
+		logger.Error.PrintfContext(req.Context(), "Error occurred while authenticating: %s", err)
 		http.Error(w, "An error occurred while trying to authenticate you", 500)
 		return
 	}
@@ -240,7 +244,9 @@ func (login OAuth2Login) AuthorizationCallbackHandler(w http.ResponseWriter, req
 		return
 	}
 
-	// Redirect the, now authenticated, user back to the index page
-	authentication.LogInUser(login.Cookies, req, w)
-	http.Redirect(w, req, "/", 302)
+	// Redirect the, now authenticated, user back to wherever they were trying to go, which is
+	// usually just the index page
+	returnTo := authentication.ReturnPath(login.Cookies, req)
+	authentication.LogInUser(login.Cookies, req, w, email)
+	http.Redirect(w, req, returnTo, 302)
 }
@@ -82,12 +82,12 @@ func (oauth2 *testOAuth2Provider) ExtractAccessToken(resp *http.Response) (strin
 	return "token", nil
 }
 
-func (oauth2 *testOAuth2Provider) Authenticate(accessToken string, pattern *regexp.Regexp) (bool, error) {
+func (oauth2 *testOAuth2Provider) Authenticate(accessToken string, pattern *regexp.Regexp) (string, bool, error) {
 	oauth2.AuthenticateCalled = true
 	if oauth2.AuthenticateError {
-		return false, errors.New("Authenticate Errored")
+		return "", false, errors.New("Authenticate Errored")
 	}
-	return oauth2.AuthenticationResult, nil
+	return "someone@example.com", oauth2.AuthenticationResult, nil
 }
 
 func authorizationCallbackHandlerRun(extractAuthorizationCodeError, extractAccessTokenError, authenticateError, authenticationResult bool) (*httptest.ResponseRecorder, testOAuth2Provider) {
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// APIHandlerManager is responsible for our JSON API, for scripts and integrations that
+// would rather not scrape HTML. It uses the same login as the rest of the site, but
+// responds with a 401 rather than a redirect when you aren't logged in.
+//
+// Rather than encoding our internal structs directly, everything the API returns has its
+// own type below. That way renaming a field in Go doesn't quietly break everybody's scripts.
+type APIHandlerManager struct {
+	BaseHandlerManager
+}
+
+type apiLink struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Submitter   string    `json:"submitter"`
+	CreatedAt   time.Time `json:"created_at"`
+	Score       int       `json:"score"`
+	Comments    int       `json:"comments"`
+	Tags        []string  `json:"tags"`
+	Category    string    `json:"category"`
+}
+
+type apiLinkResult struct {
+	apiLink
+	Rank      float64 `json:"rank"`
+	TitleHTML string  `json:"title_html"`
+	Snippet   string  `json:"snippet_html"`
+}
+
+type apiIssueResult struct {
+	ID        int64      `json:"id"`
+	Title     string     `json:"title"`
+	SentAt    *time.Time `json:"sent_at"`
+	Rank      float64    `json:"rank"`
+	TitleHTML string     `json:"title_html"`
+	Snippet   string     `json:"snippet_html"`
+}
+
+func toAPILink(link links.Link) apiLink {
+	return apiLink{link.ID, link.URL, link.Title, link.Description, link.SubmitterEmail, link.CreatedAt,
+		link.Score, link.CommentCount, link.Tags, link.Category}
+}
+
+// writeJSON responds with a value encoded as JSON
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to write JSON response: %s", err)
+	}
+}
+
+// writeJSONError responds with an error message as JSON
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, r, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// searchFunc takes the same parameters as the search page, see search.ParseQuery.
+func (manager APIHandlerManager) searchFunc(w http.ResponseWriter, r *http.Request) {
+	user, err := manager.currentUser(r)
+	if err == authentication.ErrUnidentified {
+		// The same as ProtectedAPIHandler says when there's no session at all
+		writeJSONError(w, r, http.StatusUnauthorized, "Not logged in")
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to look up current user: %s", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Unable to look up your account")
+		return
+	}
+
+	query, err := search.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	linkResults, issueResults, err := runSearch(manager.BaseHandlerManager, query, user)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to search for '%s': %s", query.Text, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Unable to search")
+		return
+	}
+
+	response := struct {
+		Links  []apiLinkResult  `json:"links"`
+		Issues []apiIssueResult `json:"issues"`
+	}{[]apiLinkResult{}, []apiIssueResult{}}
+
+	for _, result := range linkResults {
+		response.Links = append(response.Links, apiLinkResult{toAPILink(result.Link), result.Rank,
+			string(result.TitleHTML), string(result.Snippet)})
+	}
+	for _, result := range issueResults {
+		response.Issues = append(response.Issues, apiIssueResult{result.ID, result.Title, result.SentAt, result.Rank,
+			string(result.TitleHTML), string(result.Snippet)})
+	}
+
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+func (manager *APIHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("/search", manager.searchFunc).Methods("GET")
+	return authentication.ProtectedAPIHandler(manager.login, router)
+}
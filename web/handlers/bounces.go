@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/bounces"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/gorilla/mux"
+)
+
+// BounceHandlerManager is responsible for the webhook that email providers post bounces
+// and complaints to. See bounces/webhook.go for the format we expect.
+//
+// This obviously can't sit behind our OAuth2 authentication, a mail provider isn't going
+// to log in with Google. Instead the provider has to know a shared secret token, passed
+// either as "Authorization: Bearer <token>" or, for the many providers that only let you
+// configure a URL, as a "token" query parameter.
+type BounceHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager BounceHandlerManager) bounceWebhookFunc(w http.ResponseWriter, r *http.Request) {
+	if !validWebhookToken(r, manager.conf.BounceWebhookToken) {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	found, err := bounces.ParseWebhook(r.Body)
+	if err != nil {
+		logger.Warning.PrintfContext(r.Context(), "Received an invalid bounce webhook: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// All or nothing, since if we fail the provider will send us the whole lot again
+	processor := bounces.NewProcessor(manager.db, manager.conf.SoftBounceThreshold)
+	if err := processor.ProcessAll(found); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to process bounces: %s", err)
+		http.Error(w, "Unable to process bounces", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Processed int `json:"processed"`
+	}{len(found)})
+}
+
+func (manager *BounceHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.bounceWebhookFunc).Methods("POST")
+	return router
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// CategoryHandlerManager is responsible for the admin page where the newsletter's
+// categories are managed, and tags are sorted into them.
+type CategoryHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager CategoryHandlerManager) listCategoriesFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := tags.ListCategories(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list categories: %s", err)
+		http.Error(w, "Unable to list categories", http.StatusInternalServerError)
+		return
+	}
+	found, err := tags.ListTags(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list tags: %s", err)
+		http.Error(w, "Unable to list tags", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "categories/list.tmpl", struct {
+		User       users.User
+		Categories []tags.Category
+		Tags       []tags.Tag
+	}{user, categories, found})
+}
+
+func (manager CategoryHandlerManager) createCategoryFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	_, err := tags.CreateCategory(manager.db, r.FormValue("name"))
+	if err == tags.ErrInvalidName {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to create category: %s", err)
+		http.Error(w, "Unable to create category", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/categories", 302)
+}
+
+func (manager CategoryHandlerManager) deleteCategoryFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := tags.DeleteCategory(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to delete category %d: %s", id, err)
+		http.Error(w, "Unable to delete category", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/categories", 302)
+}
+
+func (manager CategoryHandlerManager) moveCategoryFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+
+	err := tags.MoveCategory(manager.db, id, offset)
+	if err == tags.ErrCategoryNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to move category %d: %s", id, err)
+		http.Error(w, "Unable to move category", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/categories", 302)
+}
+
+// assignTagFunc puts a tag into a category. A "category" of 0 puts it back to being
+// categorized by its name.
+func (manager CategoryHandlerManager) assignTagFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	categoryID, _ := strconv.ParseInt(r.FormValue("category"), 10, 64)
+	err := tags.AssignTag(manager.db, r.FormValue("tag"), categoryID)
+	if err == tags.ErrInvalidName {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to assign tag: %s", err)
+		http.Error(w, "Unable to assign tag", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/categories", 302)
+}
+
+func (manager *CategoryHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listCategoriesFunc).Methods("GET")
+	router.HandleFunc("", manager.createCategoryFunc).Methods("POST")
+	router.HandleFunc("/tags", manager.assignTagFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/delete", manager.deleteCategoryFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/move", manager.moveCategoryFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/clicks"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/gorilla/mux"
+)
+
+// ClickHandlerManager is responsible for the redirects that the links in issues go through
+// so that we can count clicks on them, see the clicks package. Newsletter readers aren't
+// users, so none of this is behind a login.
+type ClickHandlerManager struct {
+	BaseHandlerManager
+}
+
+// redirectFunc sends a reader on to the link they clicked, making a note of it along the
+// way. Failing to make a note of it is no reason to keep anybody from their link, so that's
+// only logged.
+func (manager ClickHandlerManager) redirectFunc(w http.ResponseWriter, r *http.Request) {
+	issueID, linkID, err := clicks.ParseToken(manager.conf.SecretKey, mux.Vars(r)["token"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	destination, err := clicks.Destination(manager.db, issueID, linkID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to find link %d in issue %d: %s", linkID, issueID, err)
+		http.Error(w, "Unable to find link", http.StatusInternalServerError)
+		return
+	}
+
+	// Plenty of mail servers follow every link in an email to check it for anything nasty,
+	// and the polite ones do it with a HEAD, which we don't count
+	if manager.conf.ClickTracking && r.Method == "GET" {
+		if err := clicks.Record(manager.db, manager.conf.SecretKey, issueID, linkID, r.URL.Query().Get("s")); err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to record click on link %d in issue %d: %s", linkID, issueID, err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, destination, 302)
+}
+
+func (manager *ClickHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("/{token}", manager.redirectFunc).Methods("GET", "HEAD")
+	return router
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cj-dimaggio/LinkLetter/comments"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// CommentHandlerManager is responsible for writing, editing, and moderating comments. The
+// comments themselves are shown on the link's page, see LinkHandlerManager.
+type CommentHandlerManager struct {
+	BaseHandlerManager
+}
+
+// commentPath is where to send somebody after they've done something to a comment, back to
+// the link it's on and scrolled down to the comment.
+func commentPath(comment comments.Comment) string {
+	return fmt.Sprintf("/links/%d#comment-%d", comment.LinkID, comment.ID)
+}
+
+// loadComment looks up the comment in the request's path, taking care of responding if it
+// can't be found.
+func (manager CommentHandlerManager) loadComment(w http.ResponseWriter, r *http.Request) (comments.Comment, bool) {
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	comment, err := comments.Get(manager.db, id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return comment, false
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get comment %d: %s", id, err)
+		http.Error(w, "Unable to get comment", http.StatusInternalServerError)
+		return comment, false
+	}
+	return comment, true
+}
+
+func (manager CommentHandlerManager) createCommentFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, _ := strconv.ParseInt(r.FormValue("link"), 10, 64)
+	parentID, _ := strconv.ParseInt(r.FormValue("parent"), 10, 64)
+
+	comment, err := comments.Create(manager.db, linkID, parentID, user.ID, r.FormValue("body"))
+	if err == comments.ErrEmpty || err == comments.ErrTooLong || err == comments.ErrInvalidParent {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to create comment: %s", err)
+		http.Error(w, "Unable to save your comment", http.StatusInternalServerError)
+		return
+	}
+	comment.AuthorEmail = user.Email
+	manager.dispatch(r, webhooks.EventCommentCreated, webhooks.FromComment(comment, manager.conf.URLBase))
+
+	http.Redirect(w, r, commentPath(comment), 302)
+}
+
+func (manager CommentHandlerManager) editCommentFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := manager.loadComment(w, r)
+	if !ok {
+		return
+	}
+	if !comment.CanEdit(user) {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	err := comments.Update(manager.db, comment.ID, r.FormValue("body"))
+	if err == comments.ErrEmpty || err == comments.ErrTooLong {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to update comment %d: %s", comment.ID, err)
+		http.Error(w, "Unable to save your comment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, commentPath(comment), 302)
+}
+
+func (manager CommentHandlerManager) deleteCommentFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := manager.loadComment(w, r)
+	if !ok {
+		return
+	}
+	if !comment.CanDelete(user) {
+		http.Error(w, "Only the author or an editor can delete a comment", http.StatusForbidden)
+		return
+	}
+
+	if err := comments.Delete(manager.db, comment.ID); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to delete comment %d: %s", comment.ID, err)
+		http.Error(w, "Unable to delete comment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, commentPath(comment), 302)
+}
+
+// hideCommentFunc hides a comment when "value" is true, and unhides it when it isn't.
+func (manager CommentHandlerManager) hideCommentFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+	comment, ok := manager.loadComment(w, r)
+	if !ok {
+		return
+	}
+
+	hidden, _ := strconv.ParseBool(r.FormValue("value"))
+	if err := comments.SetHidden(manager.db, comment.ID, hidden); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to hide comment %d: %s", comment.ID, err)
+		http.Error(w, "Unable to hide comment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, commentPath(comment), 302)
+}
+
+// featureCommentFunc makes a comment its link's top comment when "value" is true, and
+// takes it back when it isn't.
+func (manager CommentHandlerManager) featureCommentFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+	comment, ok := manager.loadComment(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if featured, _ := strconv.ParseBool(r.FormValue("value")); featured {
+		err = comments.SetTopComment(manager.db, comment.LinkID, comment.ID)
+	} else {
+		err = comments.ClearTopComment(manager.db, comment.LinkID, comment.ID)
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to set top comment of link %d: %s", comment.LinkID, err)
+		http.Error(w, "Unable to set top comment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, commentPath(comment), 302)
+}
+
+func (manager *CommentHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.createCommentFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/edit", manager.editCommentFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/delete", manager.deleteCommentFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/hide", manager.hideCommentFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/feature", manager.featureCommentFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
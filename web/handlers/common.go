@@ -5,12 +5,19 @@ package handlers
 // in web/server.go is suggested for a more thorough explanation.
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"net/http"
+	"strings"
 
 	"github.com/cj-dimaggio/LinkLetter/config"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
 	"github.com/cj-dimaggio/LinkLetter/web/auth/oauth2"
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
 	"github.com/cj-dimaggio/LinkLetter/web/template"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
 	"github.com/gorilla/mux"
 )
 
@@ -115,3 +122,87 @@ func (manager *BaseHandlerManager) InitializeResources(db *sql.DB, templator *te
 func (manager *BaseHandlerManager) InitRoutes(router *mux.Router) http.Handler {
 	return router
 }
+
+// currentUser looks up the user making the request, creating them if this is the first time
+// we've seen them. Their role is kept in sync with the editors and admins in our config, and
+// when authentication is disabled everybody is an admin, because it's just you and your laptop.
+func (manager BaseHandlerManager) currentUser(r *http.Request) (users.User, error) {
+	email, err := authentication.CurrentUserEmail(manager.login, r)
+	if err != nil {
+		return users.User{}, err
+	}
+	middleware.SetUser(r.Context(), email)
+
+	role := users.RoleFor(email, manager.conf.Editors, manager.conf.Admins)
+	if !manager.login.ShouldAuthenticate() {
+		role = users.RoleAdmin
+	}
+	user, err := users.GetOrCreate(manager.db, email, role)
+	if err == nil {
+		template.SetUser(r.Context(), user)
+	}
+	return user, err
+}
+
+// requireUser is a convenience wrapper around currentUser for handlers. If we can't figure
+// out who the user is it takes care of responding, either by sending them to log in again or
+// with a 500, and returns false so the handler knows to stop.
+func (manager BaseHandlerManager) requireUser(w http.ResponseWriter, r *http.Request) (users.User, bool) {
+	user, err := manager.currentUser(r)
+	if err == authentication.ErrUnidentified {
+		http.Redirect(w, r, "/login", 302)
+		return user, false
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to look up current user: %s", err)
+		http.Error(w, "Unable to look up your account", http.StatusInternalServerError)
+		return user, false
+	}
+	return user, true
+}
+
+// requireEditor is requireUser for handlers that only editors are allowed to use.
+func (manager BaseHandlerManager) requireEditor(w http.ResponseWriter, r *http.Request) (users.User, bool) {
+	user, ok := manager.requireUser(w, r)
+	if ok && !user.IsEditor() {
+		http.Error(w, "Only editors are allowed to do that", http.StatusForbidden)
+		return user, false
+	}
+	return user, ok
+}
+
+// requireAdmin is requireUser for handlers that only admins are allowed to use.
+func (manager BaseHandlerManager) requireAdmin(w http.ResponseWriter, r *http.Request) (users.User, bool) {
+	user, ok := manager.requireUser(w, r)
+	if ok && !user.IsAdmin() {
+		http.Error(w, "Only admins are allowed to do that", http.StatusForbidden)
+		return user, false
+	}
+	return user, ok
+}
+
+// dispatch lets any webhooks subscribed to an event know about it. Whatever the event was has
+// already happened by the time we get here, so a problem is only logged, against the request
+// that made it happen.
+func (manager BaseHandlerManager) dispatch(r *http.Request, event string, data interface{}) {
+	if err := webhooks.Dispatch(manager.db, event, data); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to send %s to webhooks: %s", event, err)
+	}
+}
+
+// validWebhookToken checks a webhook request's token against the one in our config, passed
+// either as "Authorization: Bearer <token>" or, for the many providers that only let you
+// configure a URL, as a "token" query parameter. If we don't have a token configured then
+// nothing is valid, and the webhook is effectively disabled.
+func validWebhookToken(r *http.Request, expected string) bool {
+	if expected == "" {
+		return false
+	}
+
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
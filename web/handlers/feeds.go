@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/feeds"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// suggestionsShown is how much of the suggestion queue its page shows at once
+	suggestionsShown = 100
+
+	// maxOPMLUpload is the biggest OPML file we'll accept, which is a great many feeds
+	maxOPMLUpload = 4 << 20
+)
+
+// FeedHandlerManager is responsible for the editor pages where RSS and Atom feeds are
+// followed, and where what turns up in them can be promoted to links, see the feeds package.
+type FeedHandlerManager struct {
+	BaseHandlerManager
+}
+
+// feedsPage is everything feeds/list.tmpl needs. Report is only filled in once an OPML file
+// has been imported.
+type feedsPage struct {
+	User      users.User
+	Feeds     []feeds.Feed
+	Suggested int
+	Report    *feeds.OPMLReport
+
+	MinInterval     int
+	DefaultInterval int
+	MaxInterval     int
+}
+
+func (manager FeedHandlerManager) renderFeeds(w http.ResponseWriter, r *http.Request, user users.User, report *feeds.OPMLReport) {
+	found, err := feeds.List(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list feeds: %s", err)
+		http.Error(w, "Unable to list feeds", http.StatusInternalServerError)
+		return
+	}
+	suggested, err := feeds.CountSuggested(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to count suggestions: %s", err)
+		http.Error(w, "Unable to list feeds", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "feeds/list.tmpl", feedsPage{user, found, suggested, report,
+		feeds.MinInterval, feeds.DefaultInterval, feeds.MaxInterval})
+}
+
+func (manager FeedHandlerManager) listFeedsFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return
+	}
+	manager.renderFeeds(w, r, user, nil)
+}
+
+func (manager FeedHandlerManager) addFeedFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	interval, _ := strconv.Atoi(r.FormValue("interval"))
+	_, _, err := feeds.Add(manager.db, r.FormValue("url"), "", "", interval)
+	if err == feeds.ErrInvalidURL {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to add feed: %s", err)
+		http.Error(w, "Unable to add feed", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds", 302)
+}
+
+// importOPMLFunc follows every feed in an uploaded OPML file
+func (manager FeedHandlerManager) importOPMLFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Choose an OPML file to import (up to 4MB)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	// The CSRF middleware may well have read the form already, before the limit above was
+	// in place, so the size is checked again
+	if header.Size > maxOPMLUpload {
+		http.Error(w, "Choose an OPML file to import (up to 4MB)", http.StatusBadRequest)
+		return
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Unable to read your file", http.StatusBadRequest)
+		return
+	}
+	outlines, err := feeds.ParseOPML(data)
+	if err != nil {
+		http.Error(w, "Unable to read your OPML file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := feeds.ImportOPML(manager.db, outlines)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to import OPML: %s", err)
+		http.Error(w, "Unable to import your feeds", http.StatusInternalServerError)
+		return
+	}
+	logger.Info.PrintfContext(r.Context(), "%s imported %d feeds from OPML", user.Email, len(report.Added))
+
+	manager.renderFeeds(w, r, user, &report)
+}
+
+// exportOPMLFunc downloads every feed as OPML, for importing into a feed reader
+func (manager FeedHandlerManager) exportOPMLFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	found, err := feeds.List(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list feeds: %s", err)
+		http.Error(w, "Unable to export feeds", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="linkletter-feeds.opml"`)
+	if err := feeds.WriteOPML(w, found, time.Now()); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to write OPML: %s", err)
+	}
+}
+
+// updateFeedFunc handles each of the buttons next to a feed, which one is in the URL
+func (manager FeedHandlerManager) updateFeedFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var err error
+	switch mux.Vars(r)["action"] {
+	case "active":
+		err = feeds.SetActive(manager.db, id, r.FormValue("active") == "true")
+	case "interval":
+		interval, _ := strconv.Atoi(r.FormValue("interval"))
+		err = feeds.SetInterval(manager.db, id, interval)
+	case "poll":
+		err = feeds.PollSoon(manager.db, id)
+	case "delete":
+		err = feeds.Delete(manager.db, id)
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to update feed %d: %s", id, err)
+		http.Error(w, "Unable to update feed", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds", 302)
+}
+
+// listSuggestedFunc shows the queue of things found in feeds that are waiting on an editor
+func (manager FeedHandlerManager) listSuggestedFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return
+	}
+
+	suggestions, err := feeds.ListSuggested(manager.db, suggestionsShown)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list suggestions: %s", err)
+		http.Error(w, "Unable to list suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "feeds/suggested.tmpl", struct {
+		User        users.User
+		Suggestions []feeds.Suggestion
+	}{user, suggestions})
+}
+
+// promoteFunc shares a suggestion as a link, which is just as if the editor had shared it
+// themselves, webhooks and all
+func (manager FeedHandlerManager) promoteFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	link, err := feeds.Promote(manager.db, id, user.ID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err == feeds.ErrNotSuggested || err == links.ErrInvalidURL {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to promote suggestion %d: %s", id, err)
+		http.Error(w, "Unable to promote suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	link.SubmitterEmail = user.Email
+	manager.dispatch(r, webhooks.EventLinkCreated, webhooks.FromLink(link, manager.conf.URLBase))
+
+	http.Redirect(w, r, "/feeds/suggested", 302)
+}
+
+func (manager FeedHandlerManager) dismissFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := feeds.Dismiss(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to dismiss suggestion %d: %s", id, err)
+		http.Error(w, "Unable to dismiss suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/suggested", 302)
+}
+
+func (manager *FeedHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listFeedsFunc).Methods("GET")
+	router.HandleFunc("", manager.addFeedFunc).Methods("POST")
+	router.HandleFunc("/opml", manager.exportOPMLFunc).Methods("GET")
+	router.HandleFunc("/opml", manager.importOPMLFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/{action:active|interval|poll|delete}", manager.updateFeedFunc).Methods("POST")
+	router.HandleFunc("/suggested", manager.listSuggestedFunc).Methods("GET")
+	router.HandleFunc("/suggested/{id:[0-9]+}/promote", manager.promoteFunc).Methods("POST")
+	router.HandleFunc("/suggested/{id:[0-9]+}/dismiss", manager.dismissFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/bookmarks"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// maxBookmarkUpload is the biggest export we'll accept. Years of bookmarks come to a few
+// megabytes at most, so this is plenty.
+const maxBookmarkUpload = 32 << 20
+
+// ImportHandlerManager is responsible for the admin page where bookmarks exported from
+// somewhere else can be uploaded and shared, see the bookmarks package. It's the same as
+// the import-bookmarks command, for anybody who doesn't have a shell on the server.
+type ImportHandlerManager struct {
+	BaseHandlerManager
+}
+
+// importPage is everything import.tmpl needs. Report is only filled in once something has
+// been uploaded.
+type importPage struct {
+	User    users.User
+	Formats []string
+	Email   string
+	Report  *bookmarks.Report
+	DryRun  bool
+}
+
+func (manager ImportHandlerManager) showImportFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "import.tmpl", importPage{User: user, Formats: bookmarks.Formats, Email: user.Email})
+}
+
+func (manager ImportHandlerManager) importFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBookmarkUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Choose a file of bookmarks to import (up to 32MB)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	// The CSRF middleware may well have read the form already, before the limit above was
+	// in place, so the size is checked again
+	if header.Size > maxBookmarkUpload {
+		http.Error(w, "Choose a file of bookmarks to import (up to 32MB)", http.StatusBadRequest)
+		return
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Unable to read your file", http.StatusBadRequest)
+		return
+	}
+
+	found, err := bookmarks.Parse(r.FormValue("format"), data)
+	if err != nil {
+		http.Error(w, "Unable to read your bookmarks: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		email = user.Email
+	}
+	submitter, err := users.GetOrCreate(manager.db, email, users.RoleFor(email, manager.conf.Editors, manager.conf.Admins))
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to look up %s: %s", email, err)
+		http.Error(w, "Unable to look up who to share the bookmarks as", http.StatusInternalServerError)
+		return
+	}
+
+	dryRun := r.FormValue("dry-run") != ""
+	report, err := bookmarks.Import(manager.db, submitter.ID, found, dryRun)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to import bookmarks for %s: %s", submitter.Email, err)
+		http.Error(w, "Unable to import your bookmarks, "+report.String(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info.PrintfContext(r.Context(), "%s imported bookmarks as %s: %s", user.Email, submitter.Email, report)
+
+	manager.templator.RenderTemplate(w, r, "import.tmpl", importPage{user, bookmarks.Formats, submitter.Email, &report, dryRun})
+}
+
+func (manager *ImportHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.showImportFunc).Methods("GET")
+	router.HandleFunc("", manager.importFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
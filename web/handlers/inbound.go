@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/inbound"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/gorilla/mux"
+)
+
+// InboundHandlerManager is responsible for the webhook that raw emails sent to our inbound
+// addresses can be posted to, for anybody who would rather have their email provider (or
+// their own mail server) receive mail than run our SMTP server. See the inbound package.
+//
+// The body of the request is the message exactly as it was received (RFC 5322, headers and
+// all). Most providers put the envelope recipient in the message's Delivered-To header, but
+// for the ones that don't it can also be passed as a "recipient" query parameter. Like the
+// bounce webhook it's protected by a shared secret token rather than a login.
+//
+// Rejected messages get a 4xx response rather than a 5xx, which tells most providers not to
+// bother retrying them.
+type InboundHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager InboundHandlerManager) inboundWebhookFunc(w http.ResponseWriter, r *http.Request) {
+	if manager.conf.InboundAddress == "" || !validWebhookToken(r, manager.conf.InboundWebhookToken) {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	message, err := inbound.Parse(http.MaxBytesReader(w, r.Body, inbound.MaxMessageSize))
+	if err != nil {
+		logger.Warning.PrintfContext(r.Context(), "Received an invalid inbound email: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message.Recipients = append(message.Recipients, r.URL.Query()["recipient"]...)
+
+	processor := inbound.NewProcessor(manager.db, manager.conf.InboundAddress, manager.conf.URLBase)
+	result, err := processor.Process(message)
+	switch err {
+	case nil:
+	case inbound.ErrAutomated:
+		// Accepted and ignored, there's nothing the provider could do differently
+	case inbound.ErrUnknownRecipient:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case inbound.ErrWrongSender:
+		logger.Warning.PrintfContext(r.Context(), "Rejected an email from %s sent to somebody else's inbound address", message.From)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	default:
+		logger.Error.PrintfContext(r.Context(), "Unable to process an email from %s: %s", message.From, err)
+		http.Error(w, "Unable to process email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Shared int `json:"shared"`
+	}{len(result.Links)})
+}
+
+func (manager *InboundHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.inboundWebhookFunc).Methods("POST")
+	return router
+}
@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
 	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
 	"github.com/gorilla/mux"
 )
@@ -12,8 +16,34 @@ type IndexHandlerManager struct {
 	BaseHandlerManager
 }
 
+// indexFunc lists every link that hasn't gone out in a newsletter yet. By default they're
+// in ranked order, the same order the issue compiler would put them in, but "?sort=new"
+// shows the newest first for people who just want to see what they've missed.
 func (manager IndexHandlerManager) indexFunc(w http.ResponseWriter, r *http.Request) {
-	manager.templator.RenderTemplate(w, "index.tmpl", nil)
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := links.ListUnissued(manager.db, user.ID)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list links: %s", err)
+		http.Error(w, "Unable to list links", http.StatusInternalServerError)
+		return
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort != "new" {
+		sort = "top"
+		links.Rank(found, time.Now())
+	}
+
+	manager.templator.RenderTemplate(w, r, "index.tmpl", struct {
+		User           users.User
+		Links          []links.Link
+		Sort           string
+		AllowDownvotes bool
+	}{user, found, sort, manager.conf.AllowDownvotes})
 }
 
 func (manager *IndexHandlerManager) InitRoutes(router *mux.Router) http.Handler {
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// deliveriesShown is how much of a webhook's delivery log its page shows
+const deliveriesShown = 50
+
+// IntegrationHandlerManager is responsible for the admin pages where outbound webhooks are
+// registered, and where their delivery logs can be looked through (and redelivered from).
+type IntegrationHandlerManager struct {
+	BaseHandlerManager
+}
+
+// webhookPath is where a webhook's page lives
+func webhookPath(id int64) string {
+	return fmt.Sprintf("/integrations/webhooks/%d", id)
+}
+
+func (manager IntegrationHandlerManager) listWebhooksFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := webhooks.List(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list webhooks: %s", err)
+		http.Error(w, "Unable to list webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "integrations/list.tmpl", struct {
+		User     users.User
+		Webhooks []webhooks.Webhook
+		Events   []string
+	}{user, found, webhooks.Events})
+}
+
+func (manager IntegrationHandlerManager) createWebhookFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+	r.ParseForm()
+
+	webhook, err := webhooks.Create(manager.db, r.FormValue("url"), r.Form["events"])
+	if err == webhooks.ErrInvalidURL || err == webhooks.ErrPrivateURL || err == webhooks.ErrNoEvents {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to create webhook: %s", err)
+		http.Error(w, "Unable to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, webhookPath(webhook.ID), 302)
+}
+
+// showWebhookFunc shows a webhook, its secret, and its most recent deliveries
+func (manager IntegrationHandlerManager) showWebhookFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	webhook, err := webhooks.Get(manager.db, id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get webhook %d: %s", id, err)
+		http.Error(w, "Unable to get webhook", http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := webhooks.ListDeliveries(manager.db, id, deliveriesShown)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list deliveries for webhook %d: %s", id, err)
+		http.Error(w, "Unable to list deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "integrations/show.tmpl", struct {
+		User       users.User
+		Webhook    webhooks.Webhook
+		Deliveries []webhooks.Delivery
+	}{user, webhook, deliveries})
+}
+
+// setActiveFunc pauses or resumes a webhook
+func (manager IntegrationHandlerManager) setActiveFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := webhooks.SetActive(manager.db, id, r.FormValue("active") == "true"); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to pause or resume webhook %d: %s", id, err)
+		http.Error(w, "Unable to update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, webhookPath(id), 302)
+}
+
+func (manager IntegrationHandlerManager) resetSecretFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if _, err := webhooks.ResetSecret(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to reset the secret for webhook %d: %s", id, err)
+		http.Error(w, "Unable to reset secret", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, webhookPath(id), 302)
+}
+
+func (manager IntegrationHandlerManager) deleteWebhookFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := webhooks.Delete(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to delete webhook %d: %s", id, err)
+		http.Error(w, "Unable to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/integrations", 302)
+}
+
+// redeliverFunc sends a delivery again, see webhooks.Redeliver
+func (manager IntegrationHandlerManager) redeliverFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	delivery, err := webhooks.GetDelivery(manager.db, id)
+	if err == nil {
+		_, err = webhooks.Redeliver(manager.db, id)
+	}
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to redeliver delivery %d: %s", id, err)
+		http.Error(w, "Unable to redeliver", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, webhookPath(delivery.WebhookID), 302)
+}
+
+func (manager *IntegrationHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listWebhooksFunc).Methods("GET")
+	router.HandleFunc("/webhooks", manager.createWebhookFunc).Methods("POST")
+	router.HandleFunc("/webhooks/{id:[0-9]+}", manager.showWebhookFunc).Methods("GET")
+	router.HandleFunc("/webhooks/{id:[0-9]+}/active", manager.setActiveFunc).Methods("POST")
+	router.HandleFunc("/webhooks/{id:[0-9]+}/secret", manager.resetSecretFunc).Methods("POST")
+	router.HandleFunc("/webhooks/{id:[0-9]+}/delete", manager.deleteWebhookFunc).Methods("POST")
+	router.HandleFunc("/deliveries/{id:[0-9]+}/redeliver", manager.redeliverFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
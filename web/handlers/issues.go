@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/clicks"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/linkcheck"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/cj-dimaggio/LinkLetter/opens"
+	"github.com/cj-dimaggio/LinkLetter/slack"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// openTrendIssues is how many recent issues the analytics page compares open rates across
+const openTrendIssues = 10
+
+// IssueHandlerManager is responsible for putting together issues of the newsletter. Anybody
+// can look at issues, but only editors can compile or rearrange them.
+type IssueHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager IssueHandlerManager) listIssuesFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	issues, err := newsletter.List(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list issues: %s", err)
+		http.Error(w, "Unable to list issues", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "issues/list.tmpl", struct {
+		User   users.User
+		Issues []newsletter.Issue
+	}{user, issues})
+}
+
+func (manager IssueHandlerManager) compileIssueFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	now := time.Now()
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = fmt.Sprintf("LinkLetter for %s", now.Format("January 2, 2006"))
+	}
+
+	issue, err := newsletter.Compile(manager.db, title, now)
+	if err == newsletter.ErrNoLinks {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to compile issue: %s", err)
+		http.Error(w, "Unable to compile issue", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/issues/%d", issue.ID), 302)
+}
+
+func (manager IssueHandlerManager) showIssueFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	issue, err := newsletter.Get(manager.db, id, user.ID, time.Now())
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get issue %d: %s", id, err)
+		http.Error(w, "Unable to get issue", http.StatusInternalServerError)
+		return
+	}
+
+	// Only sent issues have their links checked, but it's simpler to just ask either way
+	linkIDs := []int64{}
+	for _, link := range issue.Links {
+		linkIDs = append(linkIDs, link.ID)
+	}
+	health, err := linkcheck.HealthFor(manager.db, linkIDs)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get link health for issue %d: %s", id, err)
+		http.Error(w, "Unable to get issue", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "issues/show.tmpl", struct {
+		User   users.User
+		Issue  newsletter.Issue
+		Health map[int64]linkcheck.Health
+	}{user, issue, health})
+}
+
+func (manager IssueHandlerManager) moveLinkFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	linkID, _ := strconv.ParseInt(r.FormValue("link"), 10, 64)
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+
+	err := newsletter.Move(manager.db, id, linkID, offset, time.Now())
+	if err == newsletter.ErrAlreadySent || err == newsletter.ErrLinkNotInIssue {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to move link %d in issue %d: %s", linkID, id, err)
+		http.Error(w, "Unable to move link", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/issues/%d", id), 302)
+}
+
+func (manager IssueHandlerManager) resetOrderFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireEditor(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := newsletter.ResetOrder(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to reset order of issue %d: %s", id, err)
+		http.Error(w, "Unable to reset order", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/issues/%d", id), 302)
+}
+
+// sendIssueFunc marks an issue as having been sent (see newsletter.MarkSent) and lets the
+// team know about it in Slack, along with any webhooks that are interested. From here on the
+// issue's links are checked every so often to make sure they're still alive.
+func (manager IssueHandlerManager) sendIssueFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	now := time.Now()
+	err := newsletter.MarkSent(manager.db, id, now)
+	if err == newsletter.ErrAlreadySent {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to mark issue %d as sent: %s", id, err)
+		http.Error(w, "Unable to mark issue as sent", http.StatusInternalServerError)
+		return
+	}
+
+	// The issue went out either way, so a problem telling Slack about it (or watching its
+	// links) is only logged
+	if err := linkcheck.Watch(manager.db, id); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to start checking the links in issue %d: %s", id, err)
+	}
+	issue, err := newsletter.Get(manager.db, id, user.ID, now)
+	if err == nil {
+		manager.dispatch(r, webhooks.EventIssueSent, webhooks.FromIssue(issue, manager.conf.URLBase))
+		err = slack.Enqueue(jobs.NewQueue(manager.db), manager.conf.SlackWebhookURL, slack.IssueSentMessage(issue, manager.conf.URLBase))
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to announce issue %d: %s", id, err)
+	}
+
+	manager.templator.Flash(w, r, "The issue has been marked as sent.")
+	http.Redirect(w, r, fmt.Sprintf("/issues/%d", id), 302)
+}
+
+// getIssueForEditor looks up an issue for one of the editor-only pages about it, taking care
+// of the response if anything goes wrong
+func (manager IssueHandlerManager) getIssueForEditor(w http.ResponseWriter, r *http.Request) (users.User, newsletter.Issue, bool) {
+	user, ok := manager.requireEditor(w, r)
+	if !ok {
+		return user, newsletter.Issue{}, false
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	issue, err := newsletter.Get(manager.db, id, user.ID, time.Now())
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return user, issue, false
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get issue %d: %s", id, err)
+		http.Error(w, "Unable to get issue", http.StatusInternalServerError)
+		return user, issue, false
+	}
+	return user, issue, true
+}
+
+// emailIssueFunc shows an issue the way it should go out, ready to be copied into whatever
+// the newsletter gets sent with. When click tracking is on, its links go through us first,
+// and when open tracking is on it gets a tracking image.
+func (manager IssueHandlerManager) emailIssueFunc(w http.ResponseWriter, r *http.Request) {
+	_, issue, ok := manager.getIssueForEditor(w, r)
+	if !ok {
+		return
+	}
+
+	destinations := map[int64]string{}
+	for _, link := range issue.Links {
+		destinations[link.ID] = link.URL
+		if manager.conf.ClickTracking {
+			destinations[link.ID] = clicks.URL(manager.conf.URLBase, manager.conf.SecretKey, issue.ID, link.ID)
+		}
+	}
+
+	// The tracking image is left out if we can't make one, rather than holding up the issue
+	pixel := ""
+	if manager.conf.OpenTracking {
+		var err error
+		if pixel, err = opens.Pixel(manager.conf.URLBase, manager.conf.SecretKey, issue.ID); err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to create tracking image for issue %d: %s", issue.ID, err)
+		}
+	}
+
+	manager.templator.RenderTemplate(w, r, "issues/email.tmpl", struct {
+		Issue         newsletter.Issue
+		Destinations  map[int64]string
+		ClickTracking bool
+		Pixel         string
+	}{issue, destinations, manager.conf.ClickTracking, pixel})
+}
+
+// analyticsFunc shows how many readers opened an issue and clicked on each of its links, along
+// with how opens have been going for the last few issues
+func (manager IssueHandlerManager) analyticsFunc(w http.ResponseWriter, r *http.Request) {
+	user, issue, ok := manager.getIssueForEditor(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := clicks.ForIssue(manager.db, issue)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to report on clicks for issue %d: %s", issue.ID, err)
+		http.Error(w, "Unable to report on clicks", http.StatusInternalServerError)
+		return
+	}
+	opened, err := opens.ForIssue(manager.db, issue.ID)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to report on opens for issue %d: %s", issue.ID, err)
+		http.Error(w, "Unable to report on opens", http.StatusInternalServerError)
+		return
+	}
+	trend, err := opens.Trend(manager.db, openTrendIssues)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to report on opens of recent issues: %s", err)
+		http.Error(w, "Unable to report on opens", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "issues/analytics.tmpl", struct {
+		User          users.User
+		Issue         newsletter.Issue
+		Report        clicks.Report
+		Opens         opens.Report
+		Trend         []opens.IssueReport
+		ClickTracking bool
+		OpenTracking  bool
+	}{user, issue, report, opened, trend, manager.conf.ClickTracking, manager.conf.OpenTracking})
+}
+
+func (manager *IssueHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listIssuesFunc).Methods("GET")
+	router.HandleFunc("", manager.compileIssueFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}", manager.showIssueFunc).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}/move", manager.moveLinkFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/reset-order", manager.resetOrderFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/send", manager.sendIssueFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/email", manager.emailIssueFunc).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}/analytics", manager.analyticsFunc).Methods("GET")
+	return authentication.ProtectedHandler(manager.login, router)
+}
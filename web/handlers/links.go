@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/comments"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/linkcheck"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/slack"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// LinkHandlerManager is responsible for sharing links, tagging and voting on them, and
+// showing them along with their comments.
+type LinkHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager LinkHandlerManager) createLinkFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	link, err := links.Create(manager.db, links.Link{
+		URL:         r.FormValue("url"),
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		SubmitterID: user.ID,
+	})
+	if err == links.ErrInvalidURL {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to create link: %s", err)
+		http.Error(w, "Unable to share your link", http.StatusInternalServerError)
+		return
+	}
+
+	link.SubmitterEmail = user.Email
+	link.Tags = tags.Parse(r.FormValue("tags"))
+	if err := tags.SetForLink(manager.db, link.ID, link.Tags); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to tag link %d: %s", link.ID, err)
+		http.Error(w, "Your link was shared, but we were unable to tag it", http.StatusInternalServerError)
+		return
+	}
+	manager.dispatch(r, webhooks.EventLinkCreated, webhooks.FromLink(link, manager.conf.URLBase))
+
+	http.Redirect(w, r, "/?sort=new", 302)
+}
+
+func (manager LinkHandlerManager) voteFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	value, err := strconv.Atoi(r.FormValue("value"))
+	if err != nil {
+		http.Error(w, "Invalid vote", http.StatusBadRequest)
+		return
+	}
+	if value < 0 && !manager.conf.AllowDownvotes {
+		http.Error(w, "Downvotes are not allowed", http.StatusForbidden)
+		return
+	}
+
+	err = links.Vote(manager.db, linkID, user.ID, value)
+	if err == links.ErrInvalidVote {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to record vote: %s", err)
+		http.Error(w, "Unable to record your vote", http.StatusInternalServerError)
+		return
+	}
+
+	if value > 0 {
+		manager.announceIfPopular(r, linkID, user.ID)
+	}
+
+	http.Redirect(w, r, authentication.LocalPath(r.FormValue("next"), "/"), 302)
+}
+
+// announceIfPopular lets Slack know when a link reaches the configured number of votes. The
+// vote has already been counted by the time we get here, so if anything goes wrong it's only
+// logged.
+func (manager LinkHandlerManager) announceIfPopular(r *http.Request, linkID, userID int64) {
+	if manager.conf.SlackWebhookURL == "" {
+		return
+	}
+
+	popular, err := links.MarkPopular(manager.db, linkID, manager.conf.SlackPopularVotes)
+	if err != nil || !popular {
+		if err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to check if link %d is popular: %s", linkID, err)
+		}
+		return
+	}
+
+	link, err := links.Get(manager.db, linkID, userID)
+	if err == nil {
+		err = slack.Enqueue(jobs.NewQueue(manager.db), manager.conf.SlackWebhookURL, slack.PopularLinkMessage(link, manager.conf.URLBase))
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to announce popular link %d: %s", linkID, err)
+	}
+}
+
+// tagLinkFunc replaces a link's tags. Only whoever shared the link, or an editor, is
+// allowed to change them.
+func (manager LinkHandlerManager) tagLinkFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	link, err := links.Get(manager.db, id, user.ID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get link %d: %s", id, err)
+		http.Error(w, "Unable to get link", http.StatusInternalServerError)
+		return
+	}
+	if link.SubmitterID != user.ID && !user.IsEditor() {
+		http.Error(w, "Only whoever shared a link or an editor can change its tags", http.StatusForbidden)
+		return
+	}
+
+	if err := tags.SetForLink(manager.db, id, tags.Parse(r.FormValue("tags"))); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to tag link %d: %s", id, err)
+		http.Error(w, "Unable to change tags", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/links/%d", id), 302)
+}
+
+// showLinkFunc shows a link and the discussion about it. Comments themselves are handled
+// over in CommentHandlerManager.
+func (manager LinkHandlerManager) showLinkFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	link, err := links.Get(manager.db, id, user.ID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get link %d: %s", id, err)
+		http.Error(w, "Unable to get link", http.StatusInternalServerError)
+		return
+	}
+
+	found, err := comments.ListForLink(manager.db, id)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list comments for link %d: %s", id, err)
+		http.Error(w, "Unable to list comments", http.StatusInternalServerError)
+		return
+	}
+
+	health, err := linkcheck.Get(manager.db, id)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get health of link %d: %s", id, err)
+		http.Error(w, "Unable to get link", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "links/show.tmpl", struct {
+		User           users.User
+		Link           links.Link
+		Health         linkcheck.Health
+		Comments       []comments.Comment
+		AllowDownvotes bool
+	}{user, link, health, comments.Thread(found), manager.conf.AllowDownvotes})
+}
+
+// showSnapshotFunc shows the text of a link as it was when it was shared, which is mostly
+// useful once the original has gone away, see the linkcheck package
+func (manager LinkHandlerManager) showSnapshotFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	link, err := links.Get(manager.db, id, user.ID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get link %d: %s", id, err)
+		http.Error(w, "Unable to get link", http.StatusInternalServerError)
+		return
+	}
+
+	snapshot, err := linkcheck.GetSnapshot(manager.db, id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get snapshot of link %d: %s", id, err)
+		http.Error(w, "Unable to get snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "links/snapshot.tmpl", struct {
+		User     users.User
+		Link     links.Link
+		Snapshot linkcheck.Snapshot
+	}{user, link, snapshot})
+}
+
+func (manager *LinkHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.createLinkFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}", manager.showLinkFunc).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}/vote", manager.voteFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/tags", manager.tagLinkFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/snapshot", manager.showSnapshotFunc).Methods("GET")
+	return authentication.ProtectedHandler(manager.login, router)
+}
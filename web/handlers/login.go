@@ -12,7 +12,7 @@ type LoginHandlerManager struct {
 }
 
 func (manager LoginHandlerManager) loginFunc(w http.ResponseWriter, r *http.Request) {
-	manager.templator.RenderTemplate(w, "login.tmpl", struct{ OAuth2URL string }{manager.login.GetAuthorizationURL()})
+	manager.templator.RenderTemplate(w, r, "login.tmpl", struct{ OAuth2URL string }{manager.login.GetAuthorizationURL()})
 }
 
 func (manager *LoginHandlerManager) InitRoutes(router *mux.Router) http.Handler {
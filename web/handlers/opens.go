@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/opens"
+	"github.com/gorilla/mux"
+)
+
+// OpenHandlerManager is responsible for the tracking image in the email version of an issue,
+// see the opens package. Like the click redirects, it's for newsletter readers rather than
+// users, so there's no login.
+type OpenHandlerManager struct {
+	BaseHandlerManager
+}
+
+// pixelFunc serves the tracking image, counting an open if open tracking is turned on. The
+// image is served either way, a broken image in an old issue doesn't help anybody.
+func (manager OpenHandlerManager) pixelFunc(w http.ResponseWriter, r *http.Request) {
+	issueID, err := opens.ParseToken(manager.conf.SecretKey, mux.Vars(r)["token"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if manager.conf.OpenTracking && r.Method == "GET" {
+		err := opens.Record(manager.db, manager.conf.SecretKey, issueID, r.URL.Query().Get("s"), r.UserAgent())
+		if err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to record open of issue %d: %s", issueID, err)
+		}
+	}
+
+	// Every open has to come back to us rather than a cache for it to be counted
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, private")
+	w.Header().Set("Expires", "0")
+	w.Write(opens.Image)
+}
+
+func (manager *OpenHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("/{token}.gif", manager.pixelFunc).Methods("GET", "HEAD")
+	return router
+}
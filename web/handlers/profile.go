@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/inbound"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// ProfileHandlerManager is responsible for the user's profile page, which is where they'll
+// find their bookmarklet and the address they can email links to.
+type ProfileHandlerManager struct {
+	BaseHandlerManager
+}
+
+// bookmarklet builds the javascript: URL that sends whatever page you're on, along with its
+// title and anything you've highlighted, over to /share. It has to know where we live, since
+// it runs on somebody else's site.
+//
+// html/template won't put a javascript: URL into an href unless we swear it's safe by
+// making it a template.URL, so everything that goes into it needs to be something we
+// control. The base URL comes from our own config, but we still JSON encode it so a stray
+// quote can't break out of the string.
+func bookmarklet(urlBase string) template.URL {
+	share, _ := json.Marshal(strings.TrimRight(urlBase, "/") + "/share")
+	return template.URL(fmt.Sprintf("javascript:(function(){"+
+		"var e=encodeURIComponent;"+
+		"location.href=%s+'?url='+e(location.href)+'&title='+e(document.title)+'&text='+e(String(window.getSelection()));"+
+		"})();", share))
+}
+
+func (manager ProfileHandlerManager) profileFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Sharing by email is optional, so there's only an address to show if it's been set up
+	address := ""
+	if manager.conf.InboundAddress != "" {
+		token, err := users.InboundToken(manager.db, user.ID)
+		if err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to get inbound token for user %d: %s", user.ID, err)
+			http.Error(w, "Unable to get your inbound email address", http.StatusInternalServerError)
+			return
+		}
+		address = inbound.Address(manager.conf.InboundAddress, token)
+	}
+
+	manager.templator.RenderTemplate(w, r, "profile.tmpl", struct {
+		User           users.User
+		Bookmarklet    template.URL
+		InboundAddress string
+	}{user, bookmarklet(manager.conf.URLBase), address})
+}
+
+// resetInboundFunc gives the user a new inbound address, for when their old one has gotten
+// out into the world
+func (manager ProfileHandlerManager) resetInboundFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := users.ResetInboundToken(manager.db, user.ID); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to reset inbound token for user %d: %s", user.ID, err)
+		http.Error(w, "Unable to reset your inbound email address", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.Flash(w, r, "You have a new inbound email address. The old one won't work any more.")
+	http.Redirect(w, r, "/profile", 302)
+}
+
+func (manager *ProfileHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.profileFunc).Methods("GET")
+	router.HandleFunc("/inbound/reset", manager.resetInboundFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/cj-dimaggio/LinkLetter/search"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// SearchHandlerManager is responsible for the search page. The same search is also
+// available as JSON, see APIHandlerManager.
+type SearchHandlerManager struct {
+	BaseHandlerManager
+}
+
+// runSearch searches both links and sent issues. It's shared with the API.
+func runSearch(manager BaseHandlerManager, query search.Query, user users.User) ([]links.SearchResult, []newsletter.SearchResult, error) {
+	linkResults, err := links.Search(manager.db, query, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	issueResults, err := newsletter.Search(manager.db, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return linkResults, issueResults, nil
+}
+
+func (manager SearchHandlerManager) searchFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	data := struct {
+		User     users.User
+		Searched bool
+		Error    string
+		Form     map[string]string
+		Links    []links.SearchResult
+		Issues   []newsletter.SearchResult
+	}{User: user, Form: map[string]string{}}
+
+	// We hand the form back exactly as it was filled in, rather than the parsed query, so
+	// that nobody's dates get shifted around on them
+	for _, field := range []string{"q", "tag", "submitter", "from", "to"} {
+		data.Form[field] = r.URL.Query().Get(field)
+	}
+
+	query, err := search.ParseQuery(r.URL.Query())
+	switch err {
+	case nil:
+		data.Searched = true
+		data.Links, data.Issues, err = runSearch(manager.BaseHandlerManager, query, user)
+		if err != nil {
+			logger.Error.PrintfContext(r.Context(), "Unable to search for '%s': %s", query.Text, err)
+			http.Error(w, "Unable to search", http.StatusInternalServerError)
+			return
+		}
+	case search.ErrNoQuery:
+		// Nothing to do, they just haven't searched for anything yet
+	default:
+		data.Error = err.Error()
+	}
+
+	manager.templator.RenderTemplate(w, r, "search.tmpl", data)
+}
+
+func (manager *SearchHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.searchFunc).Methods("GET")
+	return authentication.ProtectedHandler(manager.login, router)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// ShareHandlerManager is responsible for /share, which is where the bookmarklet on the
+// profile page and "Share to LinkLetter" on people's phones send them. It doesn't share
+// anything by itself, it just fills in the submit form with whatever it was given so the
+// user can add a description and some tags before posting it.
+//
+// If they aren't logged in yet, ProtectedFunc remembers the whole URL, query and all, so
+// they end up right back here once Google is done with them.
+type ShareHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager ShareHandlerManager) shareFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	manager.templator.RenderTemplate(w, r, "share.tmpl", struct {
+		User users.User
+		Link links.Link
+	}{user, links.FromShare(query.Get("url"), query.Get("title"), query.Get("text"))})
+}
+
+func (manager *ShareHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.shareFunc).Methods("GET")
+	return authentication.ProtectedHandler(manager.login, router)
+}
+
+// ManifestHandlerManager serves our Web App Manifest, which is what lets people add
+// LinkLetter to their home screen and, more importantly, lists us as somewhere they can
+// share things to. Browsers fetch the manifest without any cookies, so unlike nearly
+// everything else it can't be behind a login. There's nothing in it that isn't already on
+// the login page anyway.
+type ManifestHandlerManager struct {
+	BaseHandlerManager
+}
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+type manifestShareTarget struct {
+	Action string            `json:"action"`
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+type manifest struct {
+	Name        string              `json:"name"`
+	ShortName   string              `json:"short_name"`
+	StartURL    string              `json:"start_url"`
+	Scope       string              `json:"scope"`
+	Display     string              `json:"display"`
+	ThemeColor  string              `json:"theme_color"`
+	Background  string              `json:"background_color"`
+	Icons       []manifestIcon      `json:"icons"`
+	ShareTarget manifestShareTarget `json:"share_target"`
+}
+
+func (manager ManifestHandlerManager) manifestFunc(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	err := json.NewEncoder(w).Encode(manifest{
+		Name:       manager.conf.InstanceName,
+		ShortName:  manager.conf.InstanceName,
+		StartURL:   "/",
+		Scope:      "/",
+		Display:    "standalone",
+		ThemeColor: "#33C3F0",
+		Background: "#ffffff",
+		Icons:      []manifestIcon{{Src: "/static/icons/linkletter.svg", Sizes: "any", Type: "image/svg+xml"}},
+		ShareTarget: manifestShareTarget{
+			// A GET keeps things simple: /share is just a form being pre-filled, so there's
+			// nothing about it that needs to be a POST
+			Action: "/share",
+			Method: "GET",
+			Params: map[string]string{"url": "url", "title": "title", "text": "text"},
+		},
+	})
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to write manifest: %s", err)
+	}
+}
+
+func (manager *ManifestHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.manifestFunc).Methods("GET")
+	return router
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/slack"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// maxCommandSize is the biggest slash command request we'll read. They're a handful of form
+// fields, so anything close to this isn't from Slack.
+const maxCommandSize = 64 << 10
+
+// SlackHandlerManager is responsible for our Slack slash command. Like the webhooks it can't
+// sit behind a login, instead every request has to be signed by Slack (see the slack package).
+//
+// Slack shows whatever we respond with to the user, and treats anything but a 200 as the
+// command having failed with no explanation. So once we know the request really is from
+// Slack, even the errors get a 200 and a friendly message.
+type SlackHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager SlackHandlerManager) respond(w http.ResponseWriter, r *http.Request, responseType, format string, args ...interface{}) {
+	writeJSON(w, r, http.StatusOK, slack.Response{ResponseType: responseType, Text: fmt.Sprintf(format, args...)})
+}
+
+// slackUser works out which of our users used the slash command. We'll only create a user for
+// somebody whose email is in a domain they'd be allowed to log in from.
+func (manager SlackHandlerManager) slackUser(r *http.Request, command slack.Command) (users.User, string) {
+	if manager.conf.SlackBotToken == "" {
+		return users.User{}, "LinkLetter hasn't been given a bot token, so it can't tell who you are."
+	}
+
+	email, err := slack.LookupEmail(manager.conf.SlackBotToken, command.UserID)
+	if err == slack.ErrNoEmail {
+		return users.User{}, "Slack wouldn't tell us your email address, so we can't tell who you are."
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to look up Slack user %s: %s", command.UserID, err)
+		return users.User{}, "We weren't able to look you up in Slack, try again in a bit."
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if manager.login.ShouldAuthenticate() && !manager.login.AuthorizationPattern.MatchString(domain) {
+		return users.User{}, "Unfortunately you aren't allowed to share links here."
+	}
+
+	user, err := users.GetOrCreate(manager.db, email, users.RoleFor(email, manager.conf.Editors, manager.conf.Admins))
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to get user %s: %s", email, err)
+		return users.User{}, "We weren't able to look up your account, try again in a bit."
+	}
+	return user, ""
+}
+
+func (manager SlackHandlerManager) commandFunc(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCommandSize))
+	if err != nil {
+		http.Error(w, "Unable to read request", http.StatusBadRequest)
+		return
+	}
+	if err := slack.VerifySignature(manager.conf.SlackSigningSecret, r.Header, body, time.Now()); err != nil {
+		logger.Warning.PrintfContext(r.Context(), "Rejected a Slack command: %s", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+	command := slack.ParseCommand(values)
+
+	share, err := slack.ParseShare(command.Text)
+	if err != nil {
+		manager.respond(w, r, slack.ResponseEphemeral, "%s", err)
+		return
+	}
+
+	user, problem := manager.slackUser(r, command)
+	if problem != "" {
+		manager.respond(w, r, slack.ResponseEphemeral, "%s", problem)
+		return
+	}
+
+	link, err := links.Create(manager.db, links.Link{URL: share.URL, Description: share.Note, SubmitterID: user.ID})
+	if err == links.ErrInvalidURL {
+		manager.respond(w, r, slack.ResponseEphemeral, "%s", err)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to create link from Slack: %s", err)
+		manager.respond(w, r, slack.ResponseEphemeral, "We weren't able to share your link, try again in a bit.")
+		return
+	}
+	link.SubmitterEmail = user.Email
+	manager.dispatch(r, webhooks.EventLinkCreated, webhooks.FromLink(link, manager.conf.URLBase))
+
+	discuss := fmt.Sprintf("%s/links/%d", strings.TrimRight(manager.conf.URLBase, "/"), link.ID)
+	manager.respond(w, r, slack.ResponseInChannel, "%s shared %s on LinkLetter (%s)",
+		slack.Escape(command.UserName), slack.Link(link.URL, ""), slack.Link(discuss, "discuss"))
+}
+
+func (manager *SlackHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("/command", manager.commandFunc).Methods("POST")
+	return router
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/subscribers"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/cj-dimaggio/LinkLetter/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// SubscriberHandlerManager is responsible for the admin page listing who gets the
+// newsletter, where new subscribers can be added by hand.
+type SubscriberHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager SubscriberHandlerManager) listSubscribersFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := subscribers.List(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list subscribers: %s", err)
+		http.Error(w, "Unable to list subscribers", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "subscribers/list.tmpl", struct {
+		User        users.User
+		Subscribers []subscribers.Subscriber
+	}{user, found})
+}
+
+// addSubscriberFunc subscribes an email address. Adding somebody who's already subscribed
+// doesn't do anything, and in particular isn't a subscriber.added event.
+func (manager SubscriberHandlerManager) addSubscriberFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	subscriber, created, err := subscribers.Add(manager.db, r.FormValue("email"))
+	if err == subscribers.ErrInvalidEmail {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to add subscriber: %s", err)
+		http.Error(w, "Unable to add subscriber", http.StatusInternalServerError)
+		return
+	}
+	if created {
+		manager.dispatch(r, webhooks.EventSubscriberAdded, webhooks.FromSubscriber(subscriber))
+		manager.templator.Flash(w, r, fmt.Sprintf("Subscribed %s.", subscriber.Email))
+	} else {
+		manager.templator.Flash(w, r, fmt.Sprintf("%s was already subscribed.", subscriber.Email))
+	}
+
+	http.Redirect(w, r, "/subscribers", 302)
+}
+
+// trackingFunc turns tracking of a subscriber's clicks on or off, for when they ask not to be
+// tracked, see the clicks package
+func (manager SubscriberHandlerManager) trackingFunc(w http.ResponseWriter, r *http.Request) {
+	if _, ok := manager.requireAdmin(w, r); !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err := subscribers.SetTracking(manager.db, id, r.FormValue("tracking") == "true"); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to change tracking for subscriber %d: %s", id, err)
+		http.Error(w, "Unable to change tracking", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/subscribers", 302)
+}
+
+func (manager *SubscriberHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listSubscribersFunc).Methods("GET")
+	router.HandleFunc("", manager.addSubscriberFunc).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/tracking", manager.trackingFunc).Methods("POST")
+	return authentication.ProtectedHandler(manager.login, router)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/tags"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
+	"github.com/gorilla/mux"
+)
+
+// TagHandlerManager is responsible for browsing links by their tags.
+type TagHandlerManager struct {
+	BaseHandlerManager
+}
+
+func (manager TagHandlerManager) listTagsFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := tags.ListTags(manager.db)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list tags: %s", err)
+		http.Error(w, "Unable to list tags", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "tags/list.tmpl", struct {
+		User users.User
+		Tags []tags.Tag
+	}{user, found})
+}
+
+// showTagFunc lists every link with a tag, including the ones that have already gone out
+// in the newsletter, since "what have we shared about Postgres?" is a perfectly reasonable
+// thing to want to know.
+func (manager TagHandlerManager) showTagFunc(w http.ResponseWriter, r *http.Request) {
+	user, ok := manager.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	tag := tags.Normalize(mux.Vars(r)["tag"])
+	found, err := links.ListByTag(manager.db, tag, user.ID)
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to list links tagged %s: %s", tag, err)
+		http.Error(w, "Unable to list links", http.StatusInternalServerError)
+		return
+	}
+
+	manager.templator.RenderTemplate(w, r, "tags/show.tmpl", struct {
+		User  users.User
+		Tag   string
+		Links []links.Link
+	}{user, tag, found})
+}
+
+func (manager *TagHandlerManager) InitRoutes(router *mux.Router) http.Handler {
+	router.HandleFunc("", manager.listTagsFunc).Methods("GET")
+	router.HandleFunc("/{tag}", manager.showTagFunc).Methods("GET")
+	return authentication.ProtectedHandler(manager.login, router)
+}
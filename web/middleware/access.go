@@ -0,0 +1,142 @@
+package middleware
+
+// An access log line is written once a request is done with, rather than when it comes in,
+// since that's the only time we know how it went: the status, how much we sent back and how
+// long it took. It also knows who the user was, if the handler found out (see SetUser).
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+const (
+	// CombinedFormat is the Combined Log Format that Apache and nginx write, which every log
+	// tool under the sun can read, followed by the request's id and how long it took in
+	// seconds:
+	//     127.0.0.1 - reader@example.com [01/Mar/2017:12:00:00 +0000] "GET /links HTTP/1.1" 200 512 "-" "curl/7.52" "1f2e3d4c5b6a7988" 0.012
+	CombinedFormat = "combined"
+
+	// JSONFormat logs each request as a JSON object, the same way logger does in its own
+	// JSON format
+	JSONFormat = "json"
+)
+
+// access is what we know about a request that only the handler can tell us
+type access struct {
+	user string
+}
+
+type accessKey struct{}
+
+// SetUser makes a note of who made a request, for its access log line
+func SetUser(ctx context.Context, user string) {
+	if entry, ok := ctx.Value(accessKey{}).(*access); ok {
+		entry.user = user
+	}
+}
+
+// responseRecorder keeps track of the status and the size of a response as it's written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(b []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	n, err := recorder.ResponseWriter.Write(b)
+	recorder.bytes += n
+	return n, err
+}
+
+// Flush passes flushes through, for handlers that stream their responses
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// statusCode is the status the response went out with. A handler that never wrote anything
+// at all still sent a 200.
+func (recorder *responseRecorder) statusCode() int {
+	if recorder.status == 0 {
+		return http.StatusOK
+	}
+	return recorder.status
+}
+
+// AccessLog writes a line to output for every request, in either CombinedFormat or
+// JSONFormat (anything else is taken to mean combined). It should go inside of RequestID, so
+// that there's an id to log.
+func AccessLog(output io.Writer, format string, next http.Handler) http.Handler {
+	jsonLogger := logger.New(output, logger.JSONFormat)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &access{}
+		recorder := &responseRecorder{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, entry))
+
+		next.ServeHTTP(recorder, r)
+
+		elapsed := time.Since(start)
+		if format == JSONFormat {
+			jsonLogger.LogContext(r.Context(), "Request", "method", r.Method, "url", r.URL.RequestURI(),
+				"proto", r.Proto, "status", recorder.statusCode(), "bytes", recorder.bytes,
+				"duration_ms", float64(elapsed)/float64(time.Millisecond), "remote_addr", remoteHost(r),
+				"user", entry.user, "referer", r.Referer(), "user_agent", r.UserAgent())
+			return
+		}
+		fmt.Fprintln(output, combinedLine(r, start, elapsed, recorder, entry.user))
+	})
+}
+
+// combinedLine formats a request in CombinedFormat
+func combinedLine(r *http.Request, start time.Time, elapsed time.Duration, recorder *responseRecorder, user string) string {
+	size := "-"
+	if recorder.bytes > 0 {
+		size = fmt.Sprintf("%d", recorder.bytes)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s" "%s" %.3f`,
+		remoteHost(r), orDash(user), start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, escape(r.URL.RequestURI()), r.Proto, recorder.statusCode(), size,
+		escape(orDash(r.Referer())), escape(orDash(r.UserAgent())), orDash(RequestIDFrom(r.Context())),
+		elapsed.Seconds())
+}
+
+// remoteHost is the address a request came from, without its port
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// escape keeps whatever's in a quoted field from breaking out of its quotes
+func escape(value string) string {
+	return strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1)
+}
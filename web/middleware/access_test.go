@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// accessTestHandler is a handler that finds out who the user is and sends back a 404
+var accessTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	SetUser(r.Context(), "reader@example.com")
+	http.Error(w, "Not here", http.StatusNotFound)
+})
+
+func accessTestRequest() *http.Request {
+	req := httptest.NewRequest("GET", "/links?page=2", nil)
+	req.RemoteAddr = "10.0.0.1:5123"
+	req.Header.Set("User-Agent", `Test "Agent"`)
+	req.Header.Set(RequestIDHeader, "abc123")
+	return req
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := RequestID(AccessLog(out, CombinedFormat, accessTestHandler))
+	handler.ServeHTTP(httptest.NewRecorder(), accessTestRequest())
+
+	assert.Regexp(t, regexp.MustCompile(`^10\.0\.0\.1 - reader@example\.com \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] `+
+		`"GET /links\?page=2 HTTP/1\.1" 404 9 "-" "Test \\"Agent\\"" "abc123" \d+\.\d{3}\n$`), out.String())
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := RequestID(AccessLog(out, JSONFormat, accessTestHandler))
+	handler.ServeHTTP(httptest.NewRecorder(), accessTestRequest())
+
+	line := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "abc123", line["request_id"])
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/links?page=2", line["url"])
+	assert.Equal(t, float64(404), line["status"])
+	assert.Equal(t, float64(9), line["bytes"])
+	assert.Equal(t, "10.0.0.1", line["remote_addr"])
+	assert.Equal(t, "reader@example.com", line["user"])
+}
+
+func TestAccessLogDefaultStatus(t *testing.T) {
+	out := &bytes.Buffer{}
+	handler := AccessLog(out, CombinedFormat, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), accessTestRequest())
+	assert.Contains(t, out.String(), `"GET /links?page=2 HTTP/1.1" 200 - "-"`)
+	assert.Contains(t, out.String(), ` "-" 0.`)
+}
@@ -0,0 +1,114 @@
+package middleware
+
+// Cross-site request forgery is somebody else's page getting our users' browsers to submit
+// forms to us. The browser sends our cookies along with them, so as far as we can tell it's
+// the user doing it, and there goes their vote, or an issue being sent to every subscriber.
+//
+// The usual defence, and ours, is a "synchronizer token". Every visitor gets a random token,
+// kept in a signed cookie of its own, and every one of our forms carries it in a hidden field
+// (that's what {{ csrfField }} is for, see web/template). A POST without it gets turned away.
+// Somebody else's page can get a browser to send us a POST, but it can't read our pages, so
+// it has no way of finding out what the token is.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// CSRFFieldName is the form field the token comes in on
+	CSRFFieldName = "csrf_token"
+
+	// CSRFHeader is where the token can come in instead, for a script posting something
+	// other than a form
+	CSRFHeader = "X-CSRF-Token"
+
+	csrfSessionName = "csrf"
+	csrfTokenKey    = "token"
+
+	// maxFormSize is as big a form as we'll read looking for the token. It's the size of
+	// the biggest upload we take (bookmark exports, see web/handlers/import.go), since once
+	// we've read the form there's no going back and reading it with a smaller limit.
+	maxFormSize = 32 << 20
+)
+
+type csrfKey struct{}
+
+// CSRF turns away any request that could change something (anything but a GET, HEAD, OPTIONS
+// or TRACE) that doesn't carry the visitor's token. Paths starting with one of the exempt
+// prefixes are let through, for things like webhooks, which are posted to us by other
+// servers that have never seen one of our forms and check a token of their own.
+//
+// An Authorization header doesn't get anything past it. It's tempting to think a browser
+// only sends one when a script of ours asks it to, but behind HTTP Basic auth it sends one
+// with everything, cross-site forms included.
+func CSRF(cookies *sessions.CookieStore, exempt []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range exempt {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// A cookie we can't decode (signed with an old secret key, say) gets us a fresh
+		// session, and a new token, which is what we want anyway
+		session, _ := cookies.New(r, csrfSessionName)
+		token, _ := session.Values[csrfTokenKey].(string)
+		if token == "" {
+			token = newCSRFToken()
+			session.Values[csrfTokenKey] = token
+			if err := cookies.Save(r, w, session); err != nil {
+				logger.Error.PrintfContext(r.Context(), "Unable to save CSRF token: %s", err)
+			}
+		}
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey{}, token))
+
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !validCSRFToken(w, r, token) {
+			logger.Warning.PrintfContext(r.Context(), "Turned away a %s to %s without a valid CSRF token", r.Method, r.URL.Path)
+			http.Error(w, "That form has expired. Go back, reload the page and try again.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken is the token for the visitor making a request, for putting in a form
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+// validCSRFToken checks the token a request came with against the visitor's. Comparing them
+// in constant time keeps anybody from working it out a character at a time by timing us.
+func validCSRFToken(w http.ResponseWriter, r *http.Request, token string) bool {
+	submitted := r.Header.Get(CSRFHeader)
+	if submitted == "" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		submitted = r.PostFormValue(CSRFFieldName)
+	}
+	return submitted != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1
+}
+
+// newCSRFToken makes up a token. Unlike request ids (see newRequestID) these have to be
+// impossible to guess, so it's 256 bits and a failure to get them is fatal.
+func newCSRFToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+)
+
+// csrfTestHandler sends back the token the request had, so that we know what it is
+var csrfTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(CSRFToken(r.Context())))
+})
+
+func csrfTestServer() http.Handler {
+	return CSRF(sessions.NewCookieStore([]byte("secret")), []string{"/webhooks/"}, csrfTestHandler)
+}
+
+// csrfVisit GETs a page, like a visitor would before submitting a form on it, and returns
+// their token and cookie
+func csrfVisit(t *testing.T, handler http.Handler) (string, *http.Cookie) {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/links", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	cookies := (&http.Response{Header: resp.Header()}).Cookies()
+	assert.Len(t, cookies, 1)
+	return resp.Body.String(), cookies[0]
+}
+
+func csrfPost(handler http.Handler, path string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestCSRF(t *testing.T) {
+	handler := csrfTestServer()
+	token, cookie := csrfVisit(t, handler)
+	assert.Len(t, token, 43)
+	assert.Equal(t, csrfSessionName, cookie.Name)
+
+	resp := csrfPost(handler, "/links", cookie, url.Values{CSRFFieldName: {token}})
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, token, resp.Body.String())
+	// The visitor already has a token, so they aren't given another
+	assert.Empty(t, resp.Header().Get("Set-Cookie"))
+
+	// It can come in a header instead
+	req := httptest.NewRequest("DELETE", "/links/1", nil)
+	req.AddCookie(cookie)
+	req.Header.Set(CSRFHeader, token)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestCSRFRejected(t *testing.T) {
+	handler := csrfTestServer()
+	token, cookie := csrfVisit(t, handler)
+	otherToken, _ := csrfVisit(t, handler)
+
+	assert.Equal(t, http.StatusForbidden, csrfPost(handler, "/links", cookie, url.Values{}).Code)
+	assert.Equal(t, http.StatusForbidden, csrfPost(handler, "/links", cookie, url.Values{CSRFFieldName: {otherToken}}).Code)
+	assert.Equal(t, http.StatusForbidden, csrfPost(handler, "/links", nil, url.Values{CSRFFieldName: {token}}).Code)
+
+	// A cookie that's been tampered with is as good as no cookie at all
+	tampered := *cookie
+	tampered.Value = "x" + tampered.Value
+	assert.Equal(t, http.StatusForbidden, csrfPost(handler, "/links", &tampered, url.Values{CSRFFieldName: {token}}).Code)
+}
+
+func TestCSRFExempt(t *testing.T) {
+	handler := csrfTestServer()
+
+	resp := csrfPost(handler, "/webhooks/bounces", nil, url.Values{})
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Set-Cookie"))
+
+	// Browsers send Authorization with everything behind Basic auth, so it doesn't count
+	req := httptest.NewRequest("POST", "/links", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/metrics"
+)
+
+// Instrument counts every request, and how long it took, in m. route works out which of our
+// routes a request is for, as its template.
+func Instrument(m *metrics.HTTP, route func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		m.Observe(r.Method, route(r), recorder.statusCode(), time.Since(start))
+	})
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	registry := metrics.NewRegistry()
+	route := func(r *http.Request) string { return "/links/{id}" }
+	handler := Instrument(metrics.NewHTTP(registry), route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Nope", http.StatusForbidden)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/links/42", nil))
+
+	out := &bytes.Buffer{}
+	registry.WriteTo(out)
+	assert.Contains(t, out.String(), `linkletter_http_requests_total{method="POST",route="/links/{id}",status="403"} 1`)
+}
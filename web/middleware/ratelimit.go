@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/ratelimit"
+)
+
+// RateLimitRule is a limit for a group of routes
+type RateLimitRule struct {
+	// Name keeps each rule's buckets apart from the others', so that somebody who's used up
+	// their logins can still get on with their submissions
+	Name  string
+	Limit ratelimit.Limit
+
+	// Match says whether a request is one of the rule's
+	Match func(r *http.Request) bool
+
+	// Key is who a request counts against: their IP address, their user, their API token
+	Key func(r *http.Request) string
+}
+
+// RateLimit holds each request to the first of the rules that matches it, turning it away
+// with a 429 once whoever's making it has used up their limit. Requests that don't match any
+// of the rules aren't limited at all.
+//
+// If the store can't tell us (because the database is down, say) the request goes ahead.
+// Somebody getting a few more requests than they should is better than nobody getting any.
+func RateLimit(store ratelimit.Store, rules []RateLimitRule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if !rule.Match(r) {
+				continue
+			}
+
+			result, err := store.Take(rule.Name+":"+rule.Key(r), rule.Limit)
+			if err != nil {
+				logger.Error.PrintfContext(r.Context(), "Unable to check the %s rate limit: %s", rule.Name, err)
+			} else if !result.Allowed {
+				logger.Warning.PrintfContext(r.Context(), "Turned away a %s to %s over the %s rate limit", r.Method, r.URL.Path, rule.Name)
+				// Retry-After only does whole seconds, and rounding down would have them
+				// come back a little too soon
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(result.RetryAfter.Seconds()))))
+				http.Error(w, "You're doing that too often. Wait a little while and try again.", http.StatusTooManyRequests)
+				return
+			}
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP is the IP address a request came from. Behind a proxy (like Heroku's router) that's
+// the proxy's, and the client's is the last one the proxy added to X-Forwarded-For. It has to
+// be the last: anybody can send us an X-Forwarded-For of their own, with whatever they like
+// in it, and the proxy just adds to the end of it. So it's only any use if trustProxy is set,
+// because without a proxy there it's all whatever the client made up.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	return remoteHost(r)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenStore is a ratelimit.Store that can't reach wherever it keeps its buckets
+type brokenStore struct{}
+
+func (brokenStore) Take(key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func rateLimitTestServer(store ratelimit.Store) http.Handler {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	byIP := func(r *http.Request) string { return ClientIP(r, false) }
+	return RateLimit(store, []RateLimitRule{
+		{"login", ratelimit.PerMinute(2), func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/login") }, byIP},
+		{"everything", ratelimit.PerMinute(3), func(r *http.Request) bool { return true }, byIP},
+	}, next)
+}
+
+func rateLimitGet(handler http.Handler, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := rateLimitTestServer(ratelimit.NewMemoryStore())
+
+	assert.Equal(t, http.StatusOK, rateLimitGet(handler, "/login", "10.0.0.1:5123").Code)
+	assert.Equal(t, http.StatusOK, rateLimitGet(handler, "/login", "10.0.0.1:5124").Code)
+	resp := rateLimitGet(handler, "/login", "10.0.0.1:5125")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "30", resp.Header().Get("Retry-After"))
+
+	// Somebody else has their own limit, and so does the rest of the site, since only the
+	// first rule that matches counts
+	assert.Equal(t, http.StatusOK, rateLimitGet(handler, "/login", "10.0.0.2:5123").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitGet(handler, "/links", "10.0.0.1:5123").Code)
+	}
+	resp = rateLimitGet(handler, "/links", "10.0.0.1:5123")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "20", resp.Header().Get("Retry-After"))
+}
+
+func TestRateLimitStoreError(t *testing.T) {
+	handler := rateLimitTestServer(brokenStore{})
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitGet(handler, "/login", "10.0.0.1:5123").Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:5123"
+	assert.Equal(t, "10.0.0.1", ClientIP(req, false))
+	assert.Equal(t, "10.0.0.1", ClientIP(req, true))
+
+	// The proxy adds the client to the end, after whatever the client said
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.9")
+	assert.Equal(t, "10.0.0.1", ClientIP(req, false))
+	assert.Equal(t, "203.0.113.9", ClientIP(req, true))
+}
@@ -0,0 +1,59 @@
+// Package middleware is the http middleware that wraps every request we serve, as opposed to
+// the middleware that only wraps some of them (like authentication's ProtectedHandler).
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+)
+
+// RequestIDHeader is the header a request's id comes in on, if whatever's in front of us (a
+// load balancer, say) has already given it one, and goes back out on in the response
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID is what we'll accept as somebody else's request id. We're going to put it in
+// our logs and send it back out in a header, so it can't be just anything.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestID gives every request an id, or keeps the one it came in with, so that everything
+// logged while handling it can be tied back together. The id goes on the request's context,
+// both for RequestIDFrom and as a field for logger's LogContext and PrintfContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logger.WithFields(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom is the id of the request a context belongs to, or "" if it doesn't belong to
+// one
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID makes up a new id. 64 random bits is far more than we need to keep them from
+// colliding in a day's worth of logs, and short enough to read out loud when somebody's
+// reporting a problem.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// This really shouldn't happen, and an id isn't worth failing a request over
+		logger.Warning.Printf("Unable to create a request id: %s", err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	log := logger.CreateDummyLogger()
+
+	seen := ""
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+		logger.Error.PrintfContext(r.Context(), "Something went wrong")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Len(t, seen, 16)
+	assert.Equal(t, seen, resp.Header().Get(RequestIDHeader))
+	assert.Equal(t, "ERROR: Something went wrong request_id="+seen+"\n", log.Error.Last())
+
+	// One we've been given is kept, so long as it looks like an id
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "lb-1234.abc")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, "lb-1234.abc", seen)
+	assert.Equal(t, "lb-1234.abc", resp.Header().Get(RequestIDHeader))
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "not an id\" <script>")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, seen, 16)
+}
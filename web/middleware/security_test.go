@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	resp := httptest.NewRecorder()
+	SecurityHeaders(false, next).ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, contentSecurityPolicy, resp.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", resp.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", resp.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, resp.Header().Get("Strict-Transport-Security"))
+
+	resp = httptest.NewRecorder()
+	SecurityHeaders(true, next).ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "max-age=31536000", resp.Header().Get("Strict-Transport-Security"))
+}
@@ -34,7 +34,7 @@ package web
 //     func IndexHandler(db *sql.DB, cookies *sessions.CookieStore, templator *template.Templator) func(w http.ResponseWriter, r *http.Request) {
 //      	return func(w http.ResponseWriter, r *http.Request) {
 //				db.Query("SELECT * FROM TABLE")
-//				templator.RenderTemplate(w, "index.tmpl", nil)
+//				templator.RenderTemplate(w, r, "index.tmpl", nil)
 //			}
 // 		}
 //
@@ -102,11 +102,15 @@ import (
 	"fmt"
 
 	"regexp"
+	"strings"
 
 	"github.com/cj-dimaggio/LinkLetter/config"
 	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/ratelimit"
+	"github.com/cj-dimaggio/LinkLetter/web/auth/authentication"
 	"github.com/cj-dimaggio/LinkLetter/web/auth/oauth2"
 	"github.com/cj-dimaggio/LinkLetter/web/handlers"
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
 	"github.com/cj-dimaggio/LinkLetter/web/template"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -121,23 +125,63 @@ type Server struct {
 	cookies   *sessions.CookieStore
 	conf      *config.Config
 	login     oauth2.OAuth2Login
+
+	// rateLimits is where the buckets for rateLimitRules are kept
+	rateLimits ratelimit.Store
+
+	// managerRouters are the routers of each of our HandlerManagers, in the order they were
+	// initialized, see RouteTemplate
+	managerRouters []*mux.Router
+
+	// handler is router wrapped in the middleware that every one of our routes gets, see
+	// defineRoutes
+	handler http.Handler
 }
 
+// csrfExempt are the paths that are posted to by other servers rather than by our own forms,
+// so they check tokens of their own instead of ours (see middleware.CSRF)
+var csrfExempt = []string{"/webhooks/", "/slack/"}
+
 // CreateServer creates an instance of Server using the supplied config and database connection.
 func CreateServer(conf config.Config, db *sql.DB) Server {
 	cookiesStore := sessions.NewCookieStore([]byte(conf.SecretKey))
+	// Scripts have no business reading our cookies, and if we're served over https they
+	// shouldn't ever be sent over anything else. (The version of gorilla/sessions we have
+	// vendored predates SameSite, so that will have to wait.)
+	cookiesStore.Options.HttpOnly = true
+	cookiesStore.Options.Secure = strings.HasPrefix(conf.URLBase, "https://")
 	pattern, err := regexp.Compile(conf.AuthorizationPattern)
 	if err != nil {
 		logger.Error.Printf("Unable to compile the string: '%s' into a regular expression. Aborting for security: %s", conf.AuthorizationPattern, err)
 		panic(err)
 	}
 
+	var rateLimits ratelimit.Store
+	switch conf.RateLimitStore {
+	case "", "memory":
+		rateLimits = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimits = ratelimit.NewPostgresStore(db)
+	default:
+		err := fmt.Errorf("Unknown rate limit store '%s', it should be 'memory' or 'postgres'", conf.RateLimitStore)
+		logger.Error.Printf("%s", err)
+		panic(err)
+	}
+
+	templator := template.CreateDefaultTemplator
+	if conf.TemplateReload {
+		logger.Warning.Printf("Templates will be parsed again whenever they change. That's handy for working on them, " +
+			"but it slows down every page, so please don't do it in production.")
+		templator = template.CreateReloadingTemplator
+	}
+
 	server := Server{
-		router:    mux.NewRouter(),
-		db:        db,
-		templator: template.CreateDefaultTemplator(),
-		cookies:   cookiesStore,
-		conf:      &conf,
+		router:     mux.NewRouter(),
+		db:         db,
+		templator:  templator(conf.InstanceName, cookiesStore),
+		cookies:    cookiesStore,
+		conf:       &conf,
+		rateLimits: rateLimits,
 		login: oauth2.OAuth2Login{
 			ClientID:             conf.GoogleClientID,
 			ClientSecret:         conf.GoogleClientSecret,
@@ -166,7 +210,7 @@ func (server *Server) defineRoutes() {
 	// dependent on handlers.HandlerManager for routes. HandlerManager is a tool to help us,
 	// but a handler is a handler and we can use whatever we want to define our routes.
 	server.router.PathPrefix("/static/").Handler(
-		http.StripPrefix("/static/", http.FileServer(http.Dir("static"))),
+		http.StripPrefix("/static/", cacheVersioned(http.FileServer(http.Dir("static")))),
 	)
 
 	// Keep in mind, when setting routes, that gorilla/mux will match with the first
@@ -189,7 +233,101 @@ func (server *Server) defineRoutes() {
 	// we need to get the reference here. It's not very intuitive, and I kind of wish Go would
 	// make up it's mind about whether we need think about pointers or not.
 	server.initializeManager("/login", &handlers.LoginHandlerManager{})
+	server.initializeManager("/webhooks/bounces", &handlers.BounceHandlerManager{})
+	server.initializeManager("/webhooks/inbound", &handlers.InboundHandlerManager{})
+	server.initializeManager("/slack", &handlers.SlackHandlerManager{})
+	server.initializeManager("/links", &handlers.LinkHandlerManager{})
+	server.initializeManager("/comments", &handlers.CommentHandlerManager{})
+	server.initializeManager("/issues", &handlers.IssueHandlerManager{})
+	server.initializeManager("/tags", &handlers.TagHandlerManager{})
+	server.initializeManager("/categories", &handlers.CategoryHandlerManager{})
+	server.initializeManager("/subscribers", &handlers.SubscriberHandlerManager{})
+	server.initializeManager("/integrations", &handlers.IntegrationHandlerManager{})
+	server.initializeManager("/import", &handlers.ImportHandlerManager{})
+	server.initializeManager("/feeds", &handlers.FeedHandlerManager{})
+	server.initializeManager("/search", &handlers.SearchHandlerManager{})
+	server.initializeManager("/api", &handlers.APIHandlerManager{})
+	server.initializeManager("/share", &handlers.ShareHandlerManager{})
+	server.initializeManager("/r", &handlers.ClickHandlerManager{})
+	server.initializeManager("/o", &handlers.OpenHandlerManager{})
+	server.initializeManager("/profile", &handlers.ProfileHandlerManager{})
+	server.initializeManager("/manifest.webmanifest", &handlers.ManifestHandlerManager{})
 	server.initializeManager("/", &handlers.IndexHandlerManager{})
+
+	// Every route gets the security headers, and has its forms protected from CSRF. Rate limits
+	// come before CSRF, so that somebody hammering us with forms they don't have tokens for
+	// gets turned away before we've gone to the trouble of reading them. Handlers get somewhere
+	// to tell the layout who the user is.
+	server.handler = middleware.SecurityHeaders(server.cookies.Options.Secure,
+		middleware.RateLimit(server.rateLimits, server.rateLimitRules(),
+			middleware.CSRF(server.cookies, csrfExempt, template.Common(server.router))))
+}
+
+// rateLimitRules are the limits on the routes that are worth somebody's while to hammer:
+// logging in, anything that puts something on the site for everybody else to see, and the
+// API, which scripts use and scripts have bugs. A limit of 0 in the config turns its rule off.
+//
+// There's no rule for subscribing, because there's nowhere for the public to subscribe yet:
+// everything under /subscribers is for people who are logged in, adding subscribers by hand.
+// Whoever adds a public subscribe form should give it a rule of its own, keyed by clientIP
+// since there's nobody logged in to key it by.
+func (server *Server) rateLimitRules() []middleware.RateLimitRule {
+	rules := []middleware.RateLimitRule{}
+	if server.conf.RateLimitLogin > 0 {
+		rules = append(rules, middleware.RateLimitRule{
+			Name:  "login",
+			Limit: ratelimit.PerMinute(server.conf.RateLimitLogin),
+			Match: func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/login") },
+			Key:   server.clientIP,
+		})
+	}
+	if server.conf.RateLimitSubmit > 0 {
+		rules = append(rules, middleware.RateLimitRule{
+			Name:  "submit",
+			Limit: ratelimit.PerMinute(server.conf.RateLimitSubmit),
+			Match: func(r *http.Request) bool {
+				return r.Method == "POST" && (strings.HasPrefix(r.URL.Path, "/links") || strings.HasPrefix(r.URL.Path, "/comments"))
+			},
+			Key: server.userOrIP,
+		})
+	}
+	if server.conf.RateLimitAPI > 0 {
+		rules = append(rules, middleware.RateLimitRule{
+			Name:  "api",
+			Limit: ratelimit.PerMinute(server.conf.RateLimitAPI),
+			Match: func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/api/") },
+			Key:   server.userOrIP,
+		})
+	}
+	return rules
+}
+
+func (server *Server) clientIP(r *http.Request) string {
+	return "ip:" + middleware.ClientIP(r, server.conf.BehindProxy)
+}
+
+// userOrIP is the logged in user, if there is one. Going by their IP address instead would
+// lump together everybody in the same office, who are the people most likely to be sharing
+// links at the same time. The user comes from their session cookie, which is signed, so it
+// can't just be made up to get a bucket of one's own. (That's why the API goes by it too,
+// rather than anything else in the request that we haven't checked yet, like a header.)
+func (server *Server) userOrIP(r *http.Request) string {
+	if email, err := authentication.CurrentUserEmail(server.login, r); err == nil {
+		return "user:" + email
+	}
+	return server.clientIP(r)
+}
+
+// cacheVersioned lets browsers keep static files that were asked for with a version on the
+// end (see the asset template function) for as long as they like, since a new version of the
+// file will come with a new URL
+func cacheVersioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") != "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // InitializeManager initializes the handlers.HandlerManager with the server's resource information
@@ -253,6 +391,7 @@ func (server *Server) initializeManager(prefix string, manager handlers.HandlerM
 	// of middleware, and return the wrapped function. The manager could also simply ignore the router and return
 	// whatever http.Handler it wants; here we make the assumption that the handler knows what it's doing.
 	handler := manager.InitRoutes(newRouter)
+	server.managerRouters = append(server.managerRouters, newRouter)
 
 	// Now we finally register our new http.Handler with our server's routers. Remember, PathPrefix simply filters
 	// and passes on to it's handler. But now, because we've gone through this whole process, that handler now
@@ -277,5 +416,27 @@ func (server *Server) initializeManager(prefix string, manager handlers.HandlerM
 // defineRoutes() out of the constructure would only serve to cause Server to be constructed in an incomplete
 // and unusable state.
 func (server *Server) Route() http.Handler {
-	return server.router
+	return server.handler
+}
+
+// RouteTemplate works out which of our routes a request is for, as its template ("/links/{id}"),
+// for things like metrics that need to group requests together. Requests that don't match a
+// route are "unmatched", and everything under /static/ is just "/static/".
+//
+// The server's own router can't tell us, since all it knows about are the prefixes each
+// HandlerManager was initialized with (see initializeManager). So we go through the managers'
+// routers ourselves, in the same order the server's router would.
+func (server *Server) RouteTemplate(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/static/") {
+		return "/static/"
+	}
+	for _, router := range server.managerRouters {
+		match := mux.RouteMatch{}
+		if router.Match(r, &match) {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				return template
+			}
+		}
+	}
+	return "unmatched"
 }
@@ -2,6 +2,7 @@ package web
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -160,3 +161,70 @@ func TestInitializeManagerAndMiddleware(t *testing.T) {
 	assert.Equal(t, 666, resp.Code)
 	assert.True(t, testHandlerManager.NestedHandlerFuncWasCalled)
 }
+
+func TestRouteTemplate(t *testing.T) {
+	originalCWD, _ := os.Getwd()
+	defer func() { os.Chdir(originalCWD) }()
+	os.Chdir("../")
+
+	db, _, _ := sqlmock.New()
+	server := CreateServer(config.Config{SecretKey: "test", GoogleClientID: "test", GoogleClientSecret: "test"}, db)
+
+	for path, template := range map[string]string{
+		"/links/42":          "/links/{id:[0-9]+}",
+		"/links/42/snapshot": "/links/{id:[0-9]+}/snapshot",
+		"/login":             "/login",
+		"/static/css/a.css":  "/static/",
+		"/nothing/here":      "unmatched",
+	} {
+		assert.Equal(t, template, server.RouteTemplate(httptest.NewRequest("GET", path, nil)), path)
+	}
+}
+
+func TestRateLimitRules(t *testing.T) {
+	originalCWD, _ := os.Getwd()
+	defer func() { os.Chdir(originalCWD) }()
+	os.Chdir("../")
+
+	db, _, _ := sqlmock.New()
+	server := CreateServer(config.Config{SecretKey: "test", GoogleClientID: "test", GoogleClientSecret: "test",
+		RateLimitLogin: 2, RateLimitAPI: 5}, db)
+
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		server.Route().ServeHTTP(resp, httptest.NewRequest("GET", "/login", nil))
+		assert.Equal(t, 200, resp.Code)
+	}
+	resp := httptest.NewRecorder()
+	server.Route().ServeHTTP(resp, httptest.NewRequest("GET", "/login", nil))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "30", resp.Header().Get("Retry-After"))
+
+	// Submissions are limited to 0, which is no limit at all
+	assert.Len(t, server.rateLimitRules(), 2)
+
+	// Making up an Authorization header doesn't get anybody a bucket of their own
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/api/search", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer made-up-%d", i))
+		server.Route().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest("GET", "/api/search", nil)
+	req.Header.Set("Authorization", "Bearer one-more")
+	resp = httptest.NewRecorder()
+	server.Route().ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "ip:192.0.2.1", server.userOrIP(req))
+}
+
+func TestCacheVersioned(t *testing.T) {
+	handler := cacheVersioned(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/css/custom.css?v=0123456789ab", nil))
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header().Get("Cache-Control"))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/css/custom.css", nil))
+	assert.Empty(t, resp.Header().Get("Cache-Control"))
+}
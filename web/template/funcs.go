@@ -0,0 +1,225 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/markdown"
+)
+
+// templateFuncs are the functions every template can call, on top of html/template's own
+var templateFuncs = template.FuncMap{
+	"csrfField": csrfField,
+	"humanDate": humanDate,
+	"relTime":   relTime,
+	"plural":    plural,
+	"urlFor":    urlFor,
+	"markdown":  markdown.Render,
+	"truncate":  truncate,
+	"asset":     asset,
+}
+
+// staticDir is where asset finds our static files, and staticPrefix is where the server
+// serves them from (see web/server.go)
+const (
+	staticDir    = "static"
+	staticPrefix = "/static/"
+)
+
+// now is time.Now, other than in tests
+var now = time.Now
+
+// humanDate is the way we show a date pretty much everywhere: "Mar 1, 2017"
+func humanDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
+
+// relTime is how long ago something was ("3 hours ago"), or how long until it is ("in 2
+// days"), to the nearest unit that makes sense. Months are 30 days and years 365, which is
+// close enough for something this vague.
+func relTime(t time.Time) string {
+	d := now().Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	const day = 24 * time.Hour
+	var amount string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		amount = plural(int(d/time.Minute), "minute")
+	case d < day:
+		amount = plural(int(d/time.Hour), "hour")
+	case d < 30*day:
+		amount = plural(int(d/day), "day")
+	case d < 365*day:
+		amount = plural(int(d/(30*day)), "month")
+	default:
+		amount = plural(int(d/(365*day)), "year")
+	}
+
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
+}
+
+// plural is a count of something, with an "s" on the end if there's any other number than
+// one of them: "1 comment", "3 comments". English has plenty of words that doesn't work for,
+// but we don't seem to need any of them.
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// urlFor fills in a path written the way our routes are (see the HandlerManagers), with each
+// of the values escaped, in order:
+//
+//	{{ urlFor "/links/{id}/vote" .ID }}
+//
+// Any values left over after that are pairs of query parameters:
+//
+//	{{ urlFor "/search" "q" .Query "page" .Next }}
+func urlFor(path string, values ...interface{}) (string, error) {
+	built := strings.Builder{}
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			built.WriteString(path)
+			break
+		}
+		end := closingBrace(path, start)
+		if end < 0 {
+			return "", fmt.Errorf("urlFor: %s has a { without a }", path)
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("urlFor: nothing to fill in %s with", path[start:end+1])
+		}
+		built.WriteString(path[:start])
+		built.WriteString(url.PathEscape(fmt.Sprint(values[0])))
+		path, values = path[end+1:], values[1:]
+	}
+
+	if len(values)%2 != 0 {
+		return "", fmt.Errorf("urlFor: query parameter %v doesn't have a value", values[len(values)-1])
+	}
+	query := url.Values{}
+	for i := 0; i < len(values); i += 2 {
+		query.Add(fmt.Sprint(values[i]), fmt.Sprint(values[i+1]))
+	}
+	if len(query) > 0 {
+		built.WriteString("?" + query.Encode())
+	}
+	return built.String(), nil
+}
+
+// closingBrace finds the } that goes with the { at start, skipping over any in a pattern
+// like {id:[0-9]{4}}
+func closingBrace(path string, start int) int {
+	depth := 0
+	for i := start; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// truncate cuts text down to at most length characters, ending with an ellipsis if it had
+// to cut anything. The length comes first so that it reads well at the end of a pipeline:
+//
+//	{{ .Description | truncate 140 }}
+func truncate(length int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	if length < 1 {
+		return ""
+	}
+	return strings.TrimRight(string(runes[:length-1]), " \t\n") + "…"
+}
+
+// assetVersion is the version of a static file, and what it was worked out from
+type assetVersion struct {
+	modTime time.Time
+	size    int64
+	version string
+}
+
+// assets are the versions we've already worked out. Yes, it's a global. Template functions
+// are handed over once, when the templates are parsed, and this is nothing more than a memo
+// of what's on disk, so there's nothing to be gained by threading it through a Templator.
+var (
+	assetsMu sync.Mutex
+	assets   = map[string]assetVersion{}
+)
+
+// asset is the URL of one of our static files, with a version on the end that changes
+// whenever the file does:
+//
+//	<link rel="stylesheet" href="{{ asset "css/custom.css" }}">
+//
+// That way browsers can keep hold of them for as long as they like, and still pick up a new
+// stylesheet the moment we have one. The version is a hash of what's in the file, which we
+// only work out again when the file looks like it's changed.
+func asset(name string) string {
+	path := staticPrefix + name
+	file := filepath.Join(staticDir, filepath.FromSlash(name))
+	info, err := os.Stat(file)
+	if err != nil {
+		logger.Warning.Printf("Unable to find the static file %s: %s", name, err)
+		return path
+	}
+
+	assetsMu.Lock()
+	defer assetsMu.Unlock()
+	cached, ok := assets[file]
+	if !ok || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+		version, err := hashFile(file)
+		if err != nil {
+			logger.Warning.Printf("Unable to read the static file %s: %s", name, err)
+			return path
+		}
+		cached = assetVersion{info.ModTime(), info.Size(), version}
+		assets[file] = cached
+	}
+	return path + "?v=" + cached.version
+}
+
+// hashFile is the start of the SHA-256 of what's in a file, which is plenty to tell one
+// version of it from another
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
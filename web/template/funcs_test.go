@@ -0,0 +1,88 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanDate(t *testing.T) {
+	assert.Equal(t, "Mar 1, 2017", humanDate(time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestRelTime(t *testing.T) {
+	current := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	for ago, expected := range map[time.Duration]string{
+		10 * time.Second:     "just now",
+		time.Minute:          "1 minute ago",
+		3 * time.Hour:        "3 hours ago",
+		-49 * time.Hour:      "in 2 days",
+		45 * 24 * time.Hour:  "1 month ago",
+		800 * 24 * time.Hour: "2 years ago",
+	} {
+		assert.Equal(t, expected, relTime(current.Add(-ago)))
+	}
+}
+
+func TestPlural(t *testing.T) {
+	assert.Equal(t, "0 comments", plural(0, "comment"))
+	assert.Equal(t, "1 comment", plural(1, "comment"))
+	assert.Equal(t, "2 comments", plural(2, "comment"))
+}
+
+func TestURLFor(t *testing.T) {
+	url, err := urlFor("/links/{id}/vote", 42)
+	assert.Nil(t, err)
+	assert.Equal(t, "/links/42/vote", url)
+
+	url, err = urlFor("/tags/{name:[a-z ]{1,20}}", "go lang/web")
+	assert.Nil(t, err)
+	assert.Equal(t, "/tags/go%20lang%2Fweb", url)
+
+	url, err = urlFor("/search", "q", "a&b", "page", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "/search?page=2&q=a%26b", url)
+
+	_, err = urlFor("/links/{id}")
+	assert.NotNil(t, err)
+	_, err = urlFor("/search", "q")
+	assert.NotNil(t, err)
+	_, err = urlFor("/links/{id", 42)
+	assert.NotNil(t, err)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate(10, "short"))
+	assert.Equal(t, "exactly 10", truncate(10, "exactly 10"))
+	assert.Equal(t, "this is…", truncate(9, "this is too long"))
+	assert.Equal(t, "héllo wö…", truncate(9, "héllo wörld, again"))
+	assert.Equal(t, "", truncate(0, "anything"))
+}
+
+func TestAsset(t *testing.T) {
+	originalCWD, _ := os.Getwd()
+	defer func() { os.Chdir(originalCWD) }()
+	dir, _ := ioutil.TempDir("", "assets")
+	defer os.RemoveAll(dir)
+	os.Chdir(dir)
+
+	// Something that isn't there still gets a URL, just without a version
+	assert.Equal(t, "/static/css/missing.css", asset("css/missing.css"))
+
+	os.MkdirAll(filepath.Join("static", "css"), 0700)
+	ioutil.WriteFile(filepath.Join("static", "css", "site.css"), []byte("body {}"), 0600)
+	first := asset("css/site.css")
+	assert.Regexp(t, regexp.MustCompile(`^/static/css/site\.css\?v=[0-9a-f]{12}$`), first)
+	assert.Equal(t, first, asset("css/site.css"))
+
+	ioutil.WriteFile(filepath.Join("static", "css", "site.css"), []byte("body { color: red; }"), 0600)
+	assert.NotEqual(t, first, asset("css/site.css"))
+}
@@ -0,0 +1,118 @@
+package template
+
+// Most of what a page shows comes from its handler, but there's a handful of things every
+// page needs to know about that it would be a shame to have every handler pass along: who's
+// looking at it (for the nav), any flash messages left for them, their CSRF token and what
+// we're called. RenderTemplate fills those in itself, in a Page.
+//
+// Who's looking is the awkward one, since only the handler knows, and it's found out about
+// it long after the request was handed to it, too late to hand back a request with the user
+// on its context. So, like the access log does (see middleware.SetUser), Common puts
+// somewhere on the request's context for the handler to leave a note, and SetUser is how it
+// leaves it.
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
+)
+
+// flashSessionName is the cookie flash messages are kept in until they're shown
+const flashSessionName = "flash"
+
+// Page is what the layout is rendered with
+type Page struct {
+	// User is who's looking at the page, or nil if they haven't logged in (or the handler
+	// never looked them up)
+	User *users.User
+
+	// Flashes are messages left for the user by whatever they did last, see Flash
+	Flashes []string
+
+	// CSRFToken is the user's CSRF token, for scripts (forms should stick to csrfField)
+	CSRFToken string
+
+	// InstanceName is what we're called
+	InstanceName string
+
+	// Data is whatever the handler passed to RenderTemplate
+	Data interface{}
+}
+
+// common is what a handler has told us for the Page
+type common struct {
+	user *users.User
+}
+
+type commonKey struct{}
+
+// Common makes room on each request for the handler to tell us what the layout needs to
+// know, see SetUser
+func Common(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), commonKey{}, &common{})))
+	})
+}
+
+// SetUser makes a note of who's looking at the page, for the layout
+func SetUser(ctx context.Context, user users.User) {
+	if c, ok := ctx.Value(commonKey{}).(*common); ok {
+		c.user = &user
+	}
+}
+
+// Flash leaves a message for the user, to be shown on whichever page they see next. It's
+// for telling them how something went when all we're going to do is redirect them, so it has
+// to be called before the redirect is written.
+func (t *Templator) Flash(w http.ResponseWriter, r *http.Request, message string) {
+	if t.cookies == nil {
+		return
+	}
+	// Like the CSRF token's, a cookie we can't decode just gets us a fresh session
+	session, _ := t.cookies.New(r, flashSessionName)
+	session.AddFlash(message)
+	if err := t.cookies.Save(r, w, session); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to save flash message: %s", err)
+	}
+}
+
+// flashes takes the messages that have been left for the user. Taking them clears them,
+// so that they're only shown the once.
+func (t *Templator) flashes(w http.ResponseWriter, r *http.Request) []string {
+	if t.cookies == nil {
+		return nil
+	}
+	session, _ := t.cookies.New(r, flashSessionName)
+	taken := session.Flashes()
+	if len(taken) == 0 {
+		return nil
+	}
+	if err := t.cookies.Save(r, w, session); err != nil {
+		logger.Error.PrintfContext(r.Context(), "Unable to clear flash messages: %s", err)
+	}
+
+	messages := []string{}
+	for _, flash := range taken {
+		if message, ok := flash.(string); ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// page puts together the Page for a request
+func (t *Templator) page(w http.ResponseWriter, r *http.Request, data interface{}) Page {
+	p := Page{
+		Flashes:      t.flashes(w, r),
+		CSRFToken:    middleware.CSRFToken(r.Context()),
+		InstanceName: t.instanceName,
+		Data:         data,
+	}
+	if c, ok := r.Context().Value(commonKey{}).(*common); ok {
+		p.User = c.user
+	}
+	return p
+}
@@ -0,0 +1,55 @@
+package template
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cj-dimaggio/LinkLetter/users"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPage(t *testing.T) {
+	templator := &Templator{instanceName: "LinkLetter", cookies: sessions.NewCookieStore([]byte("secret"))}
+
+	// A flash is left on one request, for the next
+	resp := httptest.NewRecorder()
+	templator.Flash(resp, httptest.NewRequest("POST", "/subscribers", nil), "Subscribed somebody@example.com.")
+	cookies := (&http.Response{Header: resp.Header()}).Cookies()
+	assert.Len(t, cookies, 1)
+
+	req := httptest.NewRequest("GET", "/subscribers", nil)
+	req.AddCookie(cookies[0])
+	var page Page
+	resp = httptest.NewRecorder()
+	Common(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), users.User{Email: "editor@example.com"})
+		page = templator.page(w, r, "data")
+	})).ServeHTTP(resp, req)
+
+	assert.Equal(t, "editor@example.com", page.User.Email)
+	assert.Equal(t, []string{"Subscribed somebody@example.com."}, page.Flashes)
+	assert.Equal(t, "LinkLetter", page.InstanceName)
+	assert.Equal(t, "data", page.Data)
+
+	// Taking the flashes cleared them, so they're only shown the once
+	cleared := (&http.Response{Header: resp.Header()}).Cookies()
+	assert.Len(t, cleared, 1)
+	req = httptest.NewRequest("GET", "/subscribers", nil)
+	req.AddCookie(cleared[0])
+	assert.Empty(t, templator.page(httptest.NewRecorder(), req, nil).Flashes)
+}
+
+func TestPageWithoutCommon(t *testing.T) {
+	// Nothing's been made room for, so there's nowhere to put the user, and no cookies means
+	// no flashes
+	templator := &Templator{}
+	req := httptest.NewRequest("GET", "/", nil)
+	SetUser(req.Context(), users.User{Email: "editor@example.com"})
+	templator.Flash(httptest.NewRecorder(), req, "Lost")
+
+	page := templator.page(httptest.NewRecorder(), req, nil)
+	assert.Nil(t, page.User)
+	assert.Empty(t, page.Flashes)
+}
@@ -1,6 +1,7 @@
 package template
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
 	"io/ioutil"
@@ -8,10 +9,40 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"text/template/parse"
+	"time"
 
 	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
+	"github.com/gorilla/sessions"
 )
 
+// csrfField is the hidden field every one of our forms that gets POSTed needs, with the
+// visitor's CSRF token in it (see web/middleware/csrf.go):
+//
+//     <form method="POST" action="/links">
+//         {{ csrfField }}
+//
+// The catch is that template functions are handed over when the templates are parsed, once,
+// and the token is different for everybody. So this one is only a stand in, for the
+// templates to be parsed with, and RenderTemplate swaps in one that knows the visitor's token
+// on a copy of the page (see bind). It used to put a placeholder in the page and swap the
+// token in for that on the way out instead, which was cheaper, but it swapped it in for
+// anybody's link or comment that happened to have the placeholder in it too, handing their
+// token to whoever's link it was.
+func csrfField() (template.HTML, error) {
+	return "", fmt.Errorf("csrfField can only be used in a page rendered by RenderTemplate")
+}
+
+// csrfFieldFor is csrfField, for somebody whose token is token
+func csrfFieldFor(token string) func() template.HTML {
+	return func() template.HTML {
+		return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+			middleware.CSRFFieldName, template.HTMLEscapeString(token)))
+	}
+}
+
 // parseFilesWithPaths is almost exactly the same as template.parseFiles with the
 // exception that it maintains the relative path to the file rather than parsing out
 // the basename. This allows us to have the same filenames in different directories.
@@ -22,11 +53,16 @@ import (
 //    posts/index.html
 //    etc...
 func parseFilesWithPaths(prefix string, filenames ...string) (*template.Template, error) {
-	var t *template.Template
 	if len(filenames) == 0 {
 		// Not really a problem, but be consistent.
 		return nil, fmt.Errorf("html/template: no files named in call to ParseFiles")
 	}
+	return parseFilesInto(nil, prefix, filenames...)
+}
+
+// parseFilesInto is parseFilesWithPaths for adding files to a set of templates we already
+// have, like a page to a clone of the layout (see parsePages). A nil t starts a new set.
+func parseFilesInto(t *template.Template, prefix string, filenames ...string) (*template.Template, error) {
 	for _, filename := range filenames {
 		b, err := ioutil.ReadFile(filename)
 		if err != nil {
@@ -47,7 +83,7 @@ func parseFilesWithPaths(prefix string, filenames ...string) (*template.Template
 		// works. Otherwise we create a new template associated with t.
 		var tmpl *template.Template
 		if t == nil {
-			t = template.New(name)
+			t = template.New(name).Funcs(templateFuncs)
 		}
 		if name == t.Name() {
 			tmpl = t
@@ -93,24 +129,268 @@ func listTemplates(root string) []string {
 	return templates
 }
 
+// layoutDir is where the layout lives, along with anything else that every page might want
+// to use (like the nav). Everything in it is parsed into every page, see parsePages.
+const layoutDir = "layout/"
+
+// layoutName is the template that pages are rendered through
+const layoutName = "layout"
+
+// page is one of our pages, parsed into its own copy of the layout
+type page struct {
+	// templates are never executed themselves, only copies of them are, see bind
+	templates *template.Template
+
+	// layout is whether the page is rendered through the layout, which it is if it has any
+	// content for it
+	layout bool
+}
+
+// parsePages parses the layout, and then every page on top of a clone of it, which is about
+// as close as html/template gets to template inheritance. The layout has blocks in it (see
+// templates/layout/layout.tmpl), and a page fills them in by defining templates of the same
+// names:
+//
+//     {{ define "title" }}Issues · {{ .InstanceName }}{{ end }}
+//
+//     {{ define "content" }}
+//     <div class="container">...</div>
+//     {{ end }}
+//
+// Every page needs a copy of the layout of its own, since they'd all be defining "content"
+// and in one big set of templates the last one parsed would win. Cloning does mean copying
+// the layout for every page, but only when the templates are parsed, not for every render.
+//
+// A page that doesn't define any content, like the email version of an issue, which is a
+// whole document of its own, is rendered as it is.
+func parsePages(prefix string, filenames ...string) (map[string]page, error) {
+	shared := []string{}
+	pageFiles := []string{}
+	for _, filename := range filenames {
+		if strings.HasPrefix(strings.TrimPrefix(filename, prefix), layoutDir) {
+			shared = append(shared, filename)
+		} else {
+			pageFiles = append(pageFiles, filename)
+		}
+	}
+	if len(pageFiles) == 0 {
+		return nil, fmt.Errorf("There aren't any pages in %s", prefix)
+	}
+
+	base := template.New(layoutName).Funcs(templateFuncs)
+	if _, err := parseFilesInto(base, prefix, shared...); err != nil {
+		return nil, err
+	}
+	hasLayout := defined(base, layoutName) && defined(base, "content")
+
+	pages := map[string]page{}
+	for _, filename := range pageFiles {
+		clone, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		var content *parse.Tree
+		if hasLayout {
+			content = clone.Lookup("content").Tree
+		}
+		if _, err := parseFilesInto(clone, prefix, filename); err != nil {
+			return nil, err
+		}
+		// A page that defines content has replaced the layout's with its own
+		name := strings.TrimPrefix(filename, prefix)
+		pages[name] = page{
+			templates: clone,
+			layout:    hasLayout && clone.Lookup("content").Tree != content,
+		}
+	}
+	return pages, nil
+}
+
+// bind is a copy of the page's templates for rendering for somebody in particular, with
+// csrfField filled in with their token. The copy has to be escaped all over again when it's
+// executed, which is the price of not sharing anything between one visitor and the next, but
+// it's only the page being rendered and what it uses, and it's quick next to the database.
+// html/template won't copy templates once they've been executed, so p.templates never are.
+func (p page) bind(token string) (*template.Template, error) {
+	clone, err := p.templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(template.FuncMap{"csrfField": csrfFieldFor(token)}), nil
+}
+
+// defined is whether there's a template called name in t's set, with something in it
+func defined(t *template.Template, name string) bool {
+	tmpl := t.Lookup(name)
+	return tmpl != nil && tmpl.Tree != nil
+}
+
 // Templator handles the rending of templates for a web application
 type Templator struct {
-	templates *template.Template
+	pages map[string]page
+
+	// instanceName is what we're called, for page titles and the like
+	instanceName string
+	// cookies are where flash messages are kept, see Flash
+	cookies *sessions.CookieStore
+
+	// reload is whether we check for changes to the templates in root before rendering, at
+	// most once every interval, see CreateReloadingTemplator
+	reload   bool
+	root     string
+	interval time.Duration
+
+	// mu guards everything below, and pages, once we're reloading
+	mu sync.RWMutex
+	// checked is when we last looked at the templates on disk
+	checked time.Time
+	// version is what the templates looked like on disk when we last parsed them, see
+	// templatesVersion
+	version string
+	// err is why they didn't parse, if they didn't
+	err error
 }
 
 // CreateDefaultTemplator creates a templator object with default settings and caches the parsed
-// files for later use.
-func CreateDefaultTemplator() *Templator {
-	return &Templator{
-		templates: template.Must(parseFilesWithPaths("templates/", listTemplates("templates")...)),
+// files for later use. instanceName is what we're called, and cookies are where flash messages
+// are kept between one request and the next (flashes are dropped if it's nil).
+func CreateDefaultTemplator(instanceName string, cookies *sessions.CookieStore) *Templator {
+	pages, err := parsePages("templates/", listTemplates("templates")...)
+	if err != nil {
+		panic(err)
+	}
+	return &Templator{pages: pages, instanceName: instanceName, cookies: cookies}
+}
+
+// CreateReloadingTemplator creates a templator for development, that parses the templates
+// again whenever one of them changes, so that you can see what you've done by reloading the
+// page rather than restarting us. A template that doesn't parse doesn't bring everything down
+// either, the error shows up in the browser instead, until it's fixed.
+//
+// We don't watch for changes as such, since the standard library has no way of being told
+// about them. Instead we have a quick look over the templates directory to see whether
+// anything's been touched since last time, which is far too slow to do for every render (a
+// page full of images and fonts is a whole lot of renders at once), but fine to do every
+// reloadInterval, which is nothing next to how long it takes somebody to switch windows.
+func CreateReloadingTemplator(instanceName string, cookies *sessions.CookieStore) *Templator {
+	t := &Templator{instanceName: instanceName, cookies: cookies, reload: true, root: "templates", interval: reloadInterval}
+	t.refresh()
+	return t
+}
+
+// reloadInterval is how often a reloading Templator looks for changes to the templates
+const reloadInterval = time.Second
+
+// refresh parses the templates again if they've changed on disk, if it's been long enough
+// since we last looked
+func (t *Templator) refresh() {
+	if !t.due() {
+		return
+	}
+	version := templatesVersion(t.root)
+	t.mu.RLock()
+	current := version == t.version
+	t.mu.RUnlock()
+	if current {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Somebody else may have got to it while we were waiting
+	if version == t.version {
+		return
+	}
+	t.version = version
+	pages, err := parsePages(t.root+"/", listTemplates(t.root)...)
+	if err != nil {
+		t.err = err
+		return
+	}
+	logger.Info.Printf("Templates have changed, parsed them again")
+	t.pages, t.err = pages, nil
+}
+
+// due is whether it's time to look at the templates on disk again, which it notes down as
+// having been done if so, so that everybody rendering at the same time doesn't all look
+func (t *Templator) due() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.checked) < t.interval {
+		return false
 	}
+	t.checked = now
+	return true
+}
+
+// templatesVersion sums up the name, size and modification time of every template under
+// root, which is as good as its contents for telling whether anything's changed, and a lot
+// quicker to get at
+func templatesVersion(root string) string {
+	version := strings.Builder{}
+	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if f != nil && !f.IsDir() && strings.HasSuffix(path, ".tmpl") {
+			fmt.Fprintf(&version, "%s %d %d\n", path, f.Size(), f.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return version.String()
 }
 
-// RenderTemplate passes the data in to the specified template and renders it
-func (t Templator) RenderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	err := t.templates.ExecuteTemplate(w, tmpl, data)
+// RenderTemplate passes the data in to the specified template and renders it. The request is
+// what the page is being rendered for, and is where csrfField gets its token from.
+//
+// Pages that are rendered through the layout get a Page, with data as its Data, and anything
+// that every page needs to know filled in for them. Their content gets just the data, so a
+// page's content looks the same as it did before we had a layout.
+//
+// The page is rendered into a buffer first, rather than straight out to w, so that a template
+// that breaks halfway through gets a proper 500 rather than half a page.
+func (t *Templator) RenderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	if t.reload {
+		t.refresh()
+	}
+	t.mu.RLock()
+	p, ok := t.pages[tmpl]
+	err := t.err
+	t.mu.RUnlock()
 	if err != nil {
-		logger.Error.Printf("Error rendering template: %s", err)
+		renderParseError(w, err)
+		return
+	}
+
+	buf := bytes.Buffer{}
+	if ok {
+		err = t.execute(&buf, w, r, p, tmpl, data)
+	} else {
+		err = fmt.Errorf("There's no page called %s", tmpl)
+	}
+	if err != nil {
+		logger.Error.PrintfContext(r.Context(), "Error rendering template: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	buf.WriteTo(w)
+}
+
+// execute renders the page named tmpl into buf, for the visitor making r
+func (t *Templator) execute(buf *bytes.Buffer, w http.ResponseWriter, r *http.Request, p page, tmpl string, data interface{}) error {
+	templates, err := p.bind(middleware.CSRFToken(r.Context()))
+	if err != nil {
+		return err
+	}
+	if p.layout {
+		return templates.ExecuteTemplate(buf, layoutName, t.page(w, r, data))
+	}
+	return templates.ExecuteTemplate(buf, tmpl, data)
+}
+
+// renderParseError shows whoever's developing the templates why they didn't parse. It's
+// only ever seen with a reloading Templator, a default one won't start with broken templates.
+func renderParseError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<!DOCTYPE html><title>Template error</title><h1>The templates didn't parse</h1><pre style="white-space: pre-wrap">%s</pre>`,
+		template.HTMLEscapeString(err.Error()))
 }
@@ -2,10 +2,17 @@ package template
 
 import (
 	"html/template"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cj-dimaggio/LinkLetter/web/middleware"
+	"github.com/gorilla/sessions"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,19 +41,162 @@ func TestCreateDefaultTemplator(t *testing.T) {
 	defer func() { os.Chdir(originalCWD) }()
 	os.Chdir("test_assets")
 
-	templator := CreateDefaultTemplator()
-	assert.NotNil(t, templator.templates.Lookup("testfile.tmpl"))
-	assert.NotNil(t, templator.templates.Lookup("nested/template.tmpl"))
+	templator := CreateDefaultTemplator("LinkLetter", nil)
+	assert.Contains(t, templator.pages, "testfile.tmpl")
+	assert.Contains(t, templator.pages, "nested/template.tmpl")
 }
 
 func TestRenderTemplate(t *testing.T) {
 	templator := Templator{
-		templates: template.Must(template.New("test_template").Parse("This is a var: {{ .Value }}")),
+		pages: map[string]page{"test_template": {templates: template.Must(template.New("test_template").Parse("This is a var: {{ .Value }}"))}},
 	}
 
 	resp := httptest.NewRecorder()
-	templator.RenderTemplate(resp, "test_template", struct {
+	templator.RenderTemplate(resp, httptest.NewRequest("GET", "/", nil), "test_template", struct {
 		Value string
 	}{Value: "example"})
 	assert.Equal(t, "This is a var: example", resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	templator.RenderTemplate(resp, httptest.NewRequest("GET", "/", nil), "missing_template", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
+
+func TestCSRFField(t *testing.T) {
+	templator := Templator{
+		pages: map[string]page{"form": {templates: template.Must(template.New("form").Funcs(templateFuncs).Parse(`<form method="POST">{{ csrfField }}</form>`))}},
+	}
+
+	// The token comes from the CSRF middleware, by way of the request
+	var token string
+	handler := middleware.CSRF(sessions.NewCookieStore([]byte("secret")), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = middleware.CSRFToken(r.Context())
+		templator.RenderTemplate(w, r, "form", nil)
+	}))
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+
+	assert.NotEmpty(t, token)
+	assert.Equal(t, `<form method="POST"><input type="hidden" name="csrf_token" value="`+token+`"></form>`, resp.Body.String())
+}
+
+func TestCSRFFieldOnlyInTheField(t *testing.T) {
+	templator := Templator{
+		pages: map[string]page{"link": {templates: template.Must(template.New("link").Funcs(templateFuncs).Parse(
+			`<a href="{{ .URL }}">{{ .Title }}</a><form method="POST">{{ csrfField }}</form>`))}},
+	}
+
+	// Somebody's link, that would have had the token swapped in for it back when csrfField
+	// left a placeholder for RenderTemplate to fill in
+	link := struct{ URL, Title string }{"https://evil.example/?t=__linkletter_csrf_token__", "__linkletter_csrf_token__"}
+
+	var token string
+	handler := middleware.CSRF(sessions.NewCookieStore([]byte("secret")), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = middleware.CSRFToken(r.Context())
+		templator.RenderTemplate(w, r, "link", link)
+	}))
+	// Twice, since the first render is the one that html/template would have escaped the
+	// page's templates on, if we weren't copying them
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+
+		assert.Equal(t, `<a href="https://evil.example/?t=__linkletter_csrf_token__">__linkletter_csrf_token__</a>`+
+			`<form method="POST"><input type="hidden" name="csrf_token" value="`+token+`"></form>`, resp.Body.String())
+		assert.Equal(t, 1, strings.Count(resp.Body.String(), token))
+	}
+}
+
+func TestCSRFFieldOutsideRenderTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("form").Funcs(templateFuncs).Parse(`{{ csrfField }}`))
+	assert.Error(t, tmpl.Execute(ioutil.Discard, nil))
+}
+
+func TestReloadingTemplator(t *testing.T) {
+	originalCWD, _ := os.Getwd()
+	defer func() { os.Chdir(originalCWD) }()
+	dir, _ := ioutil.TempDir("", "templates")
+	defer os.RemoveAll(dir)
+	os.Chdir(dir)
+	os.Mkdir("templates", 0700)
+
+	write := func(contents string, modified time.Time) {
+		ioutil.WriteFile(filepath.Join("templates", "page.tmpl"), []byte(contents), 0600)
+		os.Chtimes(filepath.Join("templates", "page.tmpl"), modified, modified)
+	}
+	var templator *Templator
+	render := func() *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		templator.RenderTemplate(resp, httptest.NewRequest("GET", "/", nil), "page.tmpl", nil)
+		return resp
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("First", start)
+	templator = CreateReloadingTemplator("LinkLetter", nil)
+	assert.Equal(t, "First", render().Body.String())
+
+	// Changes aren't looked for more than once a second...
+	write("Second", start.Add(time.Minute))
+	assert.Equal(t, "First", render().Body.String())
+	// ...which would make for a slow test, so from here on we look every time
+	templator.interval = 0
+
+	assert.Equal(t, "Second", render().Body.String())
+
+	// A mistake shows up in the browser rather than taking everything down, until it's fixed
+	write("{{ if }}", start.Add(2*time.Minute))
+	resp := render()
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Contains(t, resp.Body.String(), "missing value for if")
+
+	write("Fixed", start.Add(3*time.Minute))
+	assert.Equal(t, "Fixed", render().Body.String())
+}
+
+// writeTemplates writes out a templates directory, in a temporary directory that's made the
+// working directory until the returned func is called
+func writeTemplates(t *testing.T, files map[string]string) func() {
+	originalCWD, _ := os.Getwd()
+	dir, _ := ioutil.TempDir("", "templates")
+	os.Chdir(dir)
+	for name, contents := range files {
+		path := filepath.Join("templates", filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	}
+	return func() {
+		os.Chdir(originalCWD)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	defer writeTemplates(t, map[string]string{
+		"layout/layout.tmpl":   `{{ define "layout" }}<title>{{ block "title" . }}{{ .InstanceName }}{{ end }}</title>{{ with .User }}{{ template "nav" . }}{{ end }}{{ block "content" .Data }}{{ end }}{{ end }}`,
+		"layout/partials.tmpl": `{{ define "nav" }}<nav>{{ .Email }}</nav>{{ end }}`,
+		"index.tmpl":           `{{ define "content" }}<p>{{ .Value }}</p>{{ end }}`,
+		"issues/show.tmpl":     `{{ define "title" }}{{ .Data.Value }} · {{ .InstanceName }}{{ end }}{{ define "content" }}<h3>{{ .Value }}</h3>{{ end }}`,
+		"email.tmpl":           `<html>{{ .Value }}</html>`,
+	})()
+
+	templator := CreateDefaultTemplator("LinkLetter", nil)
+	data := struct{ Value string }{"Hello"}
+	render := func(name string) string {
+		resp := httptest.NewRecorder()
+		templator.RenderTemplate(resp, httptest.NewRequest("GET", "/", nil), name, data)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		return resp.Body.String()
+	}
+
+	// Each page has its own content, even though they all define it
+	assert.Equal(t, "<title>LinkLetter</title><p>Hello</p>", render("index.tmpl"))
+	assert.Equal(t, "<title>Hello · LinkLetter</title><h3>Hello</h3>", render("issues/show.tmpl"))
+	// A page without any content is a document of its own
+	assert.Equal(t, "<html>Hello</html>", render("email.tmpl"))
+
+	// The layout isn't a page
+	resp := httptest.NewRecorder()
+	templator.RenderTemplate(resp, httptest.NewRequest("GET", "/", nil), "layout/layout.tmpl", data)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
 }
@@ -0,0 +1,254 @@
+package webhooks
+
+// A delivery is one event on its way to one webhook. The payload is worked out once, when
+// the event happens, and saved with the delivery, so that a retry (or a redelivery days
+// later) sends exactly what the first attempt did rather than whatever the link or issue
+// looks like by then.
+//
+// Everything we send is signed. The X-LinkLetter-Signature header is "sha256=" followed by
+// the hex HMAC-SHA256, keyed with the webhook's secret, of the X-LinkLetter-Timestamp
+// header, a ".", and the raw request body. Signing the timestamp along with the body means
+// somebody who captures a delivery can't keep replaying it forever, as long as the receiver
+// checks the timestamp is recent. It's the same scheme Slack uses to sign what it sends us.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/logger"
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+)
+
+// DeliverJob is the type of job that sends a single delivery
+const DeliverJob = "webhooks.deliver"
+
+// These are the states a delivery can be in. "retrying" means the last attempt failed but
+// the jobs package will have another go at it, "failed" means it's out of attempts.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusRetrying  = "retrying"
+	StatusFailed    = "failed"
+)
+
+const (
+	// deliveryTimeout is how long we wait on an endpoint before counting it as a failure
+	deliveryTimeout = 10 * time.Second
+
+	// maxResponseBody is how much of what an endpoint says back we keep in the log
+	maxResponseBody = 1024
+)
+
+const (
+	selectDeliveries = "SELECT id, webhook_id, event, payload, status, attempts, response_code, response_body, error, created_at, updated_at FROM webhook_deliveries"
+
+	getDeliveryQuery      = selectDeliveries + " WHERE id = $1"
+	listDeliveriesQuery   = selectDeliveries + " WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2"
+	createDeliveryQuery   = "INSERT INTO webhook_deliveries (webhook_id, event, payload) VALUES ($1, $2, $3) RETURNING id"
+	redeliverQuery        = "INSERT INTO webhook_deliveries (webhook_id, event, payload) SELECT webhook_id, event, payload FROM webhook_deliveries WHERE id = $1 RETURNING id"
+	recordAttemptQuery    = "UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, response_code = $3, response_body = $4, error = $5, updated_at = now() WHERE id = $1"
+	deliveryEndpointQuery = "SELECT w.url, w.secret, w.active FROM webhooks w JOIN webhook_deliveries d ON d.webhook_id = w.id WHERE d.id = $1"
+)
+
+// Delivery is a single event sent, or to be sent, to a webhook
+type Delivery struct {
+	ID        int64
+	WebhookID int64
+	Event     string
+	Payload   string
+	Status    string
+	Attempts  int
+
+	// ResponseCode is the HTTP status the endpoint responded to the last attempt with, or 0
+	// if we never got a response at all (in which case Error will say why)
+	ResponseCode int
+	ResponseBody string
+	Error        string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// envelope is what actually gets POSTed, the event's data along with what happened and when
+type envelope struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type deliverPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+// Sign works out the X-LinkLetter-Signature for a request body sent at the given time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func scanDelivery(row interface {
+	Scan(...interface{}) error
+}) (Delivery, error) {
+	delivery := Delivery{}
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status, &delivery.Attempts,
+		&delivery.ResponseCode, &delivery.ResponseBody, &delivery.Error, &delivery.CreatedAt, &delivery.UpdatedAt)
+	return delivery, err
+}
+
+// GetDelivery retrieves a single delivery, or sql.ErrNoRows if there isn't one
+func GetDelivery(db *sql.DB, id int64) (Delivery, error) {
+	return scanDelivery(db.QueryRow(getDeliveryQuery, id))
+}
+
+// ListDeliveries retrieves a webhook's most recent deliveries, newest first
+func ListDeliveries(db *sql.DB, webhookID int64, limit int) ([]Delivery, error) {
+	rows, err := db.Query(listDeliveriesQuery, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// Dispatch sends an event to every active webhook subscribed to it. All this does is save a
+// delivery for each of them and queue it up, the sending happens in DeliverHandler.
+func Dispatch(db *sql.DB, event string, data interface{}) error {
+	subscribed, err := ListSubscribed(db, event)
+	if err != nil || len(subscribed) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(envelope{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	queue := jobs.NewQueue(db)
+	for _, webhook := range subscribed {
+		var id int64
+		if err := db.QueryRow(createDeliveryQuery, webhook.ID, event, string(payload)).Scan(&id); err != nil {
+			return err
+		}
+		if _, err := queue.Enqueue(DeliverJob, deliverPayload{id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redeliver sends a delivery again, as a brand new delivery with the same payload, so that
+// the log still shows what happened the first time. It returns the new delivery's id, or
+// sql.ErrNoRows if the original doesn't exist.
+func Redeliver(db *sql.DB, id int64) (int64, error) {
+	var newID int64
+	if err := db.QueryRow(redeliverQuery, id).Scan(&newID); err != nil {
+		return 0, err
+	}
+	_, err := jobs.NewQueue(db).Enqueue(DeliverJob, deliverPayload{newID})
+	return newID, err
+}
+
+// send POSTs a delivery to a webhook, returning whatever the endpoint responded with. An
+// endpoint that responds with anything other than a 2xx counts as a failure.
+func send(webhookURL, secret string, delivery Delivery, now time.Time) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LinkLetter-Webhooks")
+	req.Header.Set("X-LinkLetter-Event", delivery.Event)
+	req.Header.Set("X-LinkLetter-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-LinkLetter-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-LinkLetter-Signature", Sign(secret, timestamp, body))
+
+	// Create turns away URLs on our own network, but a host name can be pointed somewhere
+	// else afterwards, so we check again on the way out
+	resp, err := publicnet.Client().Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	response, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(response), fmt.Errorf("Webhook responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(response), nil
+}
+
+// DeliverHandler is the jobs.Handler for DeliverJob. Every attempt is recorded on the
+// delivery, and a failed attempt is returned as an error so that the jobs package retries
+// it with its usual backoff.
+func DeliverHandler(db *sql.DB) jobs.Handler {
+	return func(job jobs.Job) error {
+		payload := deliverPayload{}
+		if err := job.Decode(&payload); err != nil {
+			logger.Error.Printf("Unable to decode webhook delivery in job %d, giving up on it: %s", job.ID, err)
+			return nil
+		}
+
+		delivery, err := GetDelivery(db, payload.DeliveryID)
+		if err == sql.ErrNoRows {
+			// The webhook has been deleted, and its deliveries along with it
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var webhookURL, secret string
+		var active bool
+		if err := db.QueryRow(deliveryEndpointQuery, delivery.ID).Scan(&webhookURL, &secret, &active); err != nil {
+			return err
+		}
+		if !active {
+			_, err := db.Exec(recordAttemptQuery, delivery.ID, StatusFailed, 0, "", "The webhook was paused")
+			return err
+		}
+
+		code, response, sendErr := send(webhookURL, secret, delivery, time.Now())
+		status, message := StatusDelivered, ""
+		if sendErr != nil {
+			status, message = StatusRetrying, sendErr.Error()
+			if job.Attempts+1 >= job.MaxAttempts {
+				status = StatusFailed
+			}
+		}
+
+		if _, err := db.Exec(recordAttemptQuery, delivery.ID, status, code, response, message); err != nil {
+			logger.Error.Printf("Unable to record attempt at webhook delivery %d: %s", delivery.ID, err)
+		}
+		return sendErr
+	}
+}
@@ -0,0 +1,197 @@
+package webhooks
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cj-dimaggio/LinkLetter/jobs"
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+	"github.com/cj-dimaggio/LinkLetter/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const enqueueQuery = "INSERT INTO jobs"
+
+var deliveryColumns = []string{"id", "webhook_id", "event", "payload", "status", "attempts", "response_code",
+	"response_body", "error", "created_at", "updated_at"}
+
+func TestSign(t *testing.T) {
+	// Worked out independently with: printf '1500000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=fd82a5484b512271eb4df6eeed7adbb7d014939726d441430041f4d06f466b06",
+		Sign("secret", 1500000000, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1500000000, []byte("{}")), Sign("secret", 1500000001, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1500000000, []byte("{}")), Sign("other", 1500000000, []byte("{}")))
+}
+
+func TestDispatch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(subscribedQuery)).
+		WithArgs(EventSubscriberAdded).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).
+			AddRow(1, "https://example.com/a", "secret", "{subscriber.added}", true, time.Now()).
+			AddRow(2, "https://example.com/b", "secret", "{subscriber.added}", true, time.Now()))
+	for i := 1; i <= 2; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(createDeliveryQuery)).
+			WithArgs(i, EventSubscriberAdded, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10 + i))
+		mock.ExpectQuery(regexp.QuoteMeta(enqueueQuery)).
+			WithArgs(DeliverJob, `{"delivery_id":`+strconv.Itoa(10+i)+`}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i))
+	}
+	assert.Nil(t, Dispatch(db, EventSubscriberAdded, Subscriber{ID: 1, Email: "someone@example.com"}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDispatchNobodySubscribed(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(subscribedQuery)).
+		WithArgs(EventLinkCreated).
+		WillReturnRows(sqlmock.NewRows(webhookColumns))
+	assert.Nil(t, Dispatch(db, EventLinkCreated, Link{}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRedeliver(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(redeliverQuery)).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(enqueueQuery)).
+		WithArgs(DeliverJob, `{"delivery_id":4}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	id, err := Redeliver(db, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// expectDelivery sets up the lookups DeliverHandler makes for delivery 5
+func expectDelivery(mock sqlmock.Sqlmock, active bool) {
+	mock.ExpectQuery(regexp.QuoteMeta(getDeliveryQuery)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(5, 1, EventLinkCreated, `{"event":"link.created"}`, StatusPending, 0, 0, "", "", time.Now(), time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(deliveryEndpointQuery)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"url", "secret", "active"}).AddRow("https://example.com/hook", "secret", active))
+}
+
+func TestDeliverHandler(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "https://example.com/hook", req.URL.String())
+		assert.Equal(t, `{"event":"link.created"}`, string(body))
+		assert.Equal(t, EventLinkCreated, req.Header.Get("X-LinkLetter-Event"))
+		assert.Equal(t, "5", req.Header.Get("X-LinkLetter-Delivery"))
+
+		timestamp, _ := strconv.ParseInt(req.Header.Get("X-LinkLetter-Timestamp"), 10, 64)
+		assert.Equal(t, Sign("secret", timestamp, body), req.Header.Get("X-LinkLetter-Signature"))
+
+		resp := httptest.NewRecorder()
+		resp.WriteHeader(202)
+		resp.WriteString("thanks")
+		return resp.Result(), nil
+	})
+	defer transport.Close()
+
+	expectDelivery(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(recordAttemptQuery)).
+		WithArgs(5, StatusDelivered, 202, "thanks", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), MaxAttempts: 5}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliverHandlerFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		resp := httptest.NewRecorder()
+		resp.WriteHeader(500)
+		resp.WriteString("oops")
+		return resp.Result(), nil
+	})
+	defer transport.Close()
+
+	// Failing is returned as an error so that the job gets retried...
+	expectDelivery(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(recordAttemptQuery)).
+		WithArgs(5, StatusRetrying, 500, "oops", "Webhook responded with 500").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err := DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), Attempts: 0, MaxAttempts: 5})
+	assert.NotNil(t, err)
+
+	// ...until it's out of attempts
+	expectDelivery(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(recordAttemptQuery)).
+		WithArgs(5, StatusFailed, 500, "oops", "Webhook responded with 500").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), Attempts: 4, MaxAttempts: 5})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliverHandlerUnreachable(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	defer transport.Close()
+
+	expectDelivery(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta(recordAttemptQuery)).
+		WithArgs(5, StatusRetrying, 0, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NotNil(t, DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), MaxAttempts: 5}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSendRefusesLocalAddresses(t *testing.T) {
+	// A host name that pointed somewhere public when the webhook was created, and has been
+	// pointed at us since, is still turned away
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Secrets"))
+	}))
+	defer server.Close()
+
+	code, response, err := send(server.URL, "secret", Delivery{ID: 5, Event: EventLinkCreated, Payload: "{}"}, time.Now())
+	assert.True(t, errors.Is(err, publicnet.ErrNotPublic))
+	assert.Equal(t, 0, code)
+	assert.Empty(t, response)
+}
+
+func TestDeliverHandlerSkipped(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	transport := testhelpers.FakeTransport(func(req *http.Request) (*http.Response, error) {
+		t.Error("Nothing should have been sent")
+		return nil, errors.New("unexpected")
+	})
+	defer transport.Close()
+
+	// A paused webhook isn't sent anything
+	expectDelivery(mock, false)
+	mock.ExpectExec(regexp.QuoteMeta(recordAttemptQuery)).
+		WithArgs(5, StatusFailed, 0, "", "The webhook was paused").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), MaxAttempts: 5}))
+
+	// And neither is one that's been deleted
+	mock.ExpectQuery(regexp.QuoteMeta(getDeliveryQuery)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(deliveryColumns))
+	assert.Nil(t, DeliverHandler(db)(jobs.Job{Payload: []byte(`{"delivery_id":5}`), MaxAttempts: 5}))
+
+	assert.Nil(t, DeliverHandler(db)(jobs.Job{Payload: []byte(`nope`)}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+package webhooks
+
+// These are the shapes of the "data" each event is sent with. They're deliberately their
+// own types rather than our domain structs straight out of json.Marshal, so that renaming a
+// field on links.Link doesn't quietly break somebody else's integration.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/comments"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/cj-dimaggio/LinkLetter/subscribers"
+)
+
+// Link is the data sent with link.created, and with each of an issue's links
+type Link struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Submitter   string    `json:"submitter"`
+	Tags        []string  `json:"tags"`
+	CreatedAt   time.Time `json:"created_at"`
+	HTMLURL     string    `json:"html_url"`
+}
+
+// Comment is the data sent with comment.created
+type Comment struct {
+	ID        int64     `json:"id"`
+	LinkID    int64     `json:"link_id"`
+	ParentID  int64     `json:"parent_id,omitempty"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	HTMLURL   string    `json:"html_url"`
+}
+
+// Issue is the data sent with issue.sent
+type Issue struct {
+	ID      int64      `json:"id"`
+	Title   string     `json:"title"`
+	SentAt  *time.Time `json:"sent_at"`
+	Links   []Link     `json:"links"`
+	HTMLURL string     `json:"html_url"`
+}
+
+// Subscriber is the data sent with subscriber.added
+type Subscriber struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func pageURL(urlBase, format string, args ...interface{}) string {
+	return strings.TrimRight(urlBase, "/") + fmt.Sprintf(format, args...)
+}
+
+// FromLink builds the data for a link
+func FromLink(link links.Link, urlBase string) Link {
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Link{link.ID, link.URL, link.Title, link.Description, link.SubmitterEmail, tags, link.CreatedAt,
+		pageURL(urlBase, "/links/%d", link.ID)}
+}
+
+// FromComment builds the data for a comment. The body is the Markdown it was written in.
+func FromComment(comment comments.Comment, urlBase string) Comment {
+	return Comment{comment.ID, comment.LinkID, comment.ParentID, comment.AuthorEmail, comment.Body, comment.CreatedAt,
+		pageURL(urlBase, "/links/%d#comment-%d", comment.LinkID, comment.ID)}
+}
+
+// FromIssue builds the data for an issue, along with all of its links in the order they
+// appear in it
+func FromIssue(issue newsletter.Issue, urlBase string) Issue {
+	issueLinks := make([]Link, 0, len(issue.Links))
+	for _, link := range issue.Links {
+		issueLinks = append(issueLinks, FromLink(link, urlBase))
+	}
+	return Issue{issue.ID, issue.Title, issue.SentAt, issueLinks, pageURL(urlBase, "/issues/%d", issue.ID)}
+}
+
+// FromSubscriber builds the data for a subscriber
+func FromSubscriber(subscriber subscribers.Subscriber) Subscriber {
+	return Subscriber{subscriber.ID, subscriber.Email, subscriber.Status, subscriber.CreatedAt}
+}
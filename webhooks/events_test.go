@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/comments"
+	"github.com/cj-dimaggio/LinkLetter/links"
+	"github.com/cj-dimaggio/LinkLetter/newsletter"
+	"github.com/stretchr/testify/assert"
+)
+
+const testURLBase = "https://linkletter.example.com/"
+
+func TestFromLink(t *testing.T) {
+	link := FromLink(links.Link{ID: 7, URL: "https://example.com/a", SubmitterEmail: "someone@example.com"}, testURLBase)
+	assert.Equal(t, "https://linkletter.example.com/links/7", link.HTMLURL)
+	assert.Equal(t, "someone@example.com", link.Submitter)
+
+	// No tags are an empty list rather than a null, which is friendlier to whoever's reading it
+	data, _ := json.Marshal(link)
+	assert.Contains(t, string(data), `"tags":[]`)
+}
+
+func TestFromComment(t *testing.T) {
+	comment := FromComment(comments.Comment{ID: 3, LinkID: 7, AuthorEmail: "someone@example.com", Body: "*Nice*"}, testURLBase)
+	assert.Equal(t, "https://linkletter.example.com/links/7#comment-3", comment.HTMLURL)
+	assert.Equal(t, "*Nice*", comment.Body)
+
+	data, _ := json.Marshal(comment)
+	assert.NotContains(t, string(data), "parent_id")
+}
+
+func TestFromIssue(t *testing.T) {
+	sent := time.Now()
+	issue := FromIssue(newsletter.Issue{ID: 2, Title: "Issue 2", SentAt: &sent,
+		Links: []links.Link{{ID: 1}, {ID: 2}}}, testURLBase)
+	assert.Equal(t, "https://linkletter.example.com/issues/2", issue.HTMLURL)
+	assert.Len(t, issue.Links, 2)
+	assert.Equal(t, "https://linkletter.example.com/links/2", issue.Links[1].HTMLURL)
+}
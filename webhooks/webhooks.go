@@ -0,0 +1,194 @@
+// Package webhooks lets other tools find out when things happen in LinkLetter.
+package webhooks
+
+// An admin registers a URL along with the events it cares about, and from then on every
+// one of those events gets POSTed to it as JSON. Each webhook gets its own secret, which is
+// used to sign everything we send it (see Sign), so that whoever is on the other end can
+// tell a real event from somebody who simply found the URL.
+//
+// Sending happens in the background through the jobs package, one job per delivery, so a
+// slow or broken endpoint never holds up whoever shared a link, and a failed delivery gets
+// retried with the same backoff as any other job. Every delivery is kept around, along
+// with how the endpoint responded, so that when somebody asks "why didn't we get that
+// event?" there's an answer.
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cj-dimaggio/LinkLetter/publicnet"
+	"github.com/lib/pq"
+)
+
+// These are the events a webhook can subscribe to
+const (
+	EventLinkCreated     = "link.created"
+	EventCommentCreated  = "comment.created"
+	EventIssueSent       = "issue.sent"
+	EventSubscriberAdded = "subscriber.added"
+)
+
+// Events lists every event, in the order they're offered to admins
+var Events = []string{EventLinkCreated, EventCommentCreated, EventIssueSent, EventSubscriberAdded}
+
+const secretBytes = 32
+
+const (
+	selectWebhooks = "SELECT id, url, secret, events, active, created_at FROM webhooks"
+
+	listWebhooksQuery       = selectWebhooks + " ORDER BY created_at, id"
+	getWebhookQuery         = selectWebhooks + " WHERE id = $1"
+	subscribedQuery         = selectWebhooks + " WHERE active AND $1 = ANY(events) ORDER BY id"
+	createWebhookQuery      = "INSERT INTO webhooks (url, secret, events) VALUES ($1, $2, $3) RETURNING id, active, created_at"
+	setWebhookActiveQuery   = "UPDATE webhooks SET active = $2 WHERE id = $1"
+	deleteWebhookQuery      = "DELETE FROM webhooks WHERE id = $1"
+	resetWebhookSecretQuery = "UPDATE webhooks SET secret = $2 WHERE id = $1"
+)
+
+// ErrInvalidURL is returned when a webhook's URL isn't somewhere we can POST to
+var ErrInvalidURL = errors.New("Webhooks must be absolute http or https URLs")
+
+// ErrPrivateURL is returned when a webhook's URL is on our own machine or network. We'd be
+// showing whoever added it what came back (see Delivery.ResponseBody), which would make it a way
+// of reading things only we're meant to be able to get at.
+var ErrPrivateURL = errors.New("Webhooks can't be sent to addresses on our own network")
+
+// ErrNoEvents is returned when a webhook isn't subscribed to any events we know about
+var ErrNoEvents = errors.New("Webhooks must be subscribed to at least one event")
+
+// Webhook is an endpoint that gets told about the events it's subscribed to
+type Webhook struct {
+	ID        int64
+	URL       string
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Subscribed determines whether the webhook wants to hear about an event. It doesn't care
+// whether the webhook is active.
+func (webhook Webhook) Subscribed(event string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newSecret generates a secret to sign a webhook's deliveries with
+func newSecret() (string, error) {
+	raw := make([]byte, secretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// cleanEvents throws away anything that isn't one of our Events, along with any duplicates,
+// and puts what's left in the same order as Events.
+func cleanEvents(events []string) []string {
+	cleaned := []string{}
+	for _, known := range Events {
+		for _, event := range events {
+			if strings.TrimSpace(event) == known {
+				cleaned = append(cleaned, known)
+				break
+			}
+		}
+	}
+	return cleaned
+}
+
+func scanWebhook(row interface {
+	Scan(...interface{}) error
+}) (Webhook, error) {
+	webhook := Webhook{}
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, (*pq.StringArray)(&webhook.Events), &webhook.Active, &webhook.CreatedAt)
+	return webhook, err
+}
+
+func queryWebhooks(db *sql.DB, query string, args ...interface{}) ([]Webhook, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// Create registers a new webhook, generating its secret
+func Create(db *sql.DB, rawURL string, events []string) (Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, ErrInvalidURL
+	}
+	if publicnet.CheckHost(u.Hostname()) != nil {
+		return Webhook{}, ErrPrivateURL
+	}
+	events = cleanEvents(events)
+	if len(events) == 0 {
+		return Webhook{}, ErrNoEvents
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	webhook := Webhook{URL: u.String(), Secret: secret, Events: events}
+	err = db.QueryRow(createWebhookQuery, webhook.URL, secret, pq.StringArray(events)).Scan(&webhook.ID, &webhook.Active, &webhook.CreatedAt)
+	return webhook, err
+}
+
+// Get retrieves a single webhook, or sql.ErrNoRows if there isn't one
+func Get(db *sql.DB, id int64) (Webhook, error) {
+	return scanWebhook(db.QueryRow(getWebhookQuery, id))
+}
+
+// List retrieves every webhook, oldest first
+func List(db *sql.DB) ([]Webhook, error) {
+	return queryWebhooks(db, listWebhooksQuery)
+}
+
+// ListSubscribed retrieves every active webhook that's subscribed to an event
+func ListSubscribed(db *sql.DB, event string) ([]Webhook, error) {
+	return queryWebhooks(db, subscribedQuery, event)
+}
+
+// SetActive pauses or resumes a webhook. A paused webhook isn't sent anything, and events
+// that happen while it's paused aren't saved up for later.
+func SetActive(db *sql.DB, id int64, active bool) error {
+	_, err := db.Exec(setWebhookActiveQuery, id, active)
+	return err
+}
+
+// ResetSecret gives a webhook a new secret, for when the old one has gotten out
+func ResetSecret(db *sql.DB, id int64) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(resetWebhookSecretQuery, id, secret)
+	return secret, err
+}
+
+// Delete removes a webhook, along with its delivery log
+func Delete(db *sql.DB, id int64) error {
+	_, err := db.Exec(deleteWebhookQuery, id)
+	return err
+}
@@ -0,0 +1,70 @@
+package webhooks
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var webhookColumns = []string{"id", "url", "secret", "events", "active", "created_at"}
+
+func TestSubscribed(t *testing.T) {
+	webhook := Webhook{Events: []string{EventLinkCreated, EventIssueSent}}
+	assert.True(t, webhook.Subscribed(EventIssueSent))
+	assert.False(t, webhook.Subscribed(EventCommentCreated))
+}
+
+func TestCleanEvents(t *testing.T) {
+	assert.Equal(t, []string{EventLinkCreated, EventSubscriberAdded},
+		cleanEvents([]string{"subscriber.added", "nope", " link.created", "link.created"}))
+	assert.Equal(t, []string{}, cleanEvents(nil))
+}
+
+func TestCreate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(createWebhookQuery)).
+		WithArgs("https://example.com/hook", sqlmock.AnyArg(), `{"link.created","issue.sent"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "active", "created_at"}).AddRow(1, true, time.Now()))
+	webhook, err := Create(db, " https://example.com/hook ", []string{EventIssueSent, EventLinkCreated})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), webhook.ID)
+	assert.True(t, webhook.Active)
+	assert.Len(t, webhook.Secret, 2*secretBytes)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateInvalid(t *testing.T) {
+	db, _, _ := sqlmock.New()
+
+	for _, url := range []string{"", "example.com/hook", "ftp://example.com/hook", "javascript:alert(1)"} {
+		_, err := Create(db, url, []string{EventLinkCreated})
+		assert.Equal(t, ErrInvalidURL, err, url)
+	}
+
+	for _, url := range []string{"http://localhost:8080/hook", "http://127.0.0.1/hook", "http://169.254.169.254/latest/meta-data/", "http://[::1]/hook", "https://10.0.0.5/hook"} {
+		_, err := Create(db, url, []string{EventLinkCreated})
+		assert.Equal(t, ErrPrivateURL, err, url)
+	}
+
+	_, err := Create(db, "https://example.com/hook", []string{"link.deleted"})
+	assert.Equal(t, ErrNoEvents, err)
+}
+
+func TestListSubscribed(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(subscribedQuery)).
+		WithArgs(EventLinkCreated).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).
+			AddRow(1, "https://example.com/a", "secret", "{link.created}", true, time.Now()).
+			AddRow(2, "https://example.com/b", "secret", "{link.created,issue.sent}", true, time.Now()))
+	webhooks, err := ListSubscribed(db, EventLinkCreated)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 2)
+	assert.Equal(t, []string{EventLinkCreated, EventIssueSent}, webhooks[1].Events)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}